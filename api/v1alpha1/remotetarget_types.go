@@ -0,0 +1,89 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RemoteTargetSpec defines the desired state of RemoteTarget
+type RemoteTargetSpec struct {
+	// KubeconfigSecretRef references a key of a Secret in the namespace of the RemoteTarget that holds a kubeconfig of
+	// the remote cluster.
+	KubeconfigSecretRef corev1.SecretKeySelector `json:"kubeconfigSecretRef"`
+
+	// ServiceAccountSelector selects ServiceAccounts in the namespace of the RemoteTarget whose image pull secrets are
+	// mirrored to the remote cluster.
+	ServiceAccountSelector metav1.LabelSelector `json:"serviceAccountSelector"`
+
+	// Namespaces in the remote cluster to mirror the image pull secrets to. The image pull secrets are attached to the
+	// ServiceAccounts with the same names there. Defaults to the namespace of the RemoteTarget.
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+// RemoteTargetStatus defines the observed state of RemoteTarget
+type RemoteTargetStatus struct {
+	// ObservedGeneration is the generation of the RemoteTarget last synced.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// LastSyncTime is the time when the image pull secrets were last mirrored to the remote cluster.
+	// +optional
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+
+	// Namespaces in the remote cluster that the image pull secrets are mirrored to. They are tracked to clean up the
+	// image pull secrets when the namespaces are removed from the spec or the RemoteTarget is deleted.
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// Conditions of the RemoteTarget.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Last Sync",type=date,JSONPath=`.status.lastSyncTime`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// RemoteTarget is the Schema for the remotetargets API. It mirrors image pull secrets provisioned in this cluster to
+// a remote cluster, e.g. an edge cluster without its own identity federation.
+type RemoteTarget struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RemoteTargetSpec   `json:"spec,omitempty"`
+	Status RemoteTargetStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// RemoteTargetList contains a list of RemoteTarget
+type RemoteTargetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []RemoteTarget `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&RemoteTarget{}, &RemoteTargetList{})
+}
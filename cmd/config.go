@@ -0,0 +1,300 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/yaml"
+
+	"github.com/pfnet/image-pull-secrets-provisioner/internal/controller"
+)
+
+// Interval to check the config file for changes.
+const configReloadInterval = 10 * time.Second
+
+// bindPolicyFlags defines the flags that can be changed at runtime by the config file.
+func bindPolicyFlags(fs *flag.FlagSet, refresh *controller.RefreshPolicy, eviction *controller.EvictionPolicy) {
+	fs.DurationVar(&refresh.ExpirationGracePeriod, "expiration-grace-period", time.Minute,
+		"Period before the expiration of image pull secrets in which they are refreshed regardless of"+
+			" --refresh-fraction.")
+	fs.Float64Var(&refresh.RefreshFraction, "refresh-fraction", 0,
+		"Fraction of the validity period of image pull secrets after which they are refreshed, e.g. 0.8."+
+			" Zero refreshes them only shortly before they expire.")
+	fs.Float64Var(&refresh.RefreshJitter, "refresh-jitter", 0,
+		"Fraction of the period from issuance to refresh of image pull secrets by which their refreshes are randomly"+
+			" moved earlier to spread refreshes of Secrets issued at the same time, e.g. 0.1.")
+	fs.DurationVar(&refresh.MinRefreshInterval, "min-refresh-interval", 10*time.Second,
+		"Minimum delay before refreshing image pull secrets, both from their issuance and from each reconciliation,"+
+			" not to refresh them in a tight loop when a container registry provider returns already expired or very"+
+			" short-lived tokens. Must be shorter than --expiration-grace-period.")
+	fs.BoolVar(&eviction.DryRun, "evictor-dry-run", false,
+		"Only report pods that would be evicted as logs and events without evicting them.")
+	fs.BoolVar(&eviction.EvictBarePods, "evict-bare-pods", false,
+		"Evict pods that have no controller. They are not recreated once evicted.")
+	fs.BoolVar(&eviction.EvictJobPods, "evict-job-pods", false,
+		"Evict pods owned by Jobs. Eviction can count towards the backoff limit of the Jobs.")
+	fs.BoolVar(&eviction.RestartOwners, "restart-owners", false,
+		"Restart Deployments, StatefulSets and DaemonSets owning pods to evict instead of evicting the pods,"+
+			" like \"kubectl rollout restart\". Other pods are still evicted.")
+	fs.DurationVar(&eviction.ForceDeleteAfter, "force-delete-after", 0,
+		"Duration for which eviction of a pod keeps being blocked by PodDisruptionBudgets before the pod is deleted"+
+			" with its termination grace period, e.g. 10m. Zero disables the deletion.")
+	fs.IntVar(&eviction.MaxEvictionsPerReconcile, "max-evictions-per-reconcile", 0,
+		"Maximum number of pods evicted per reconciliation of a ServiceAccount. Zero means no limit.")
+}
+
+// configFile is a YAML file specified by --config flag, which holds values of command line flags keyed by their names,
+// e.g. "refresh-fraction: 0.8". Flags specified on the command line take precedence over the file.
+// Changes of the file to the flags defined by bindPolicyFlags are applied without restart.
+type configFile struct {
+	path string
+	// Names of the flags specified on the command line.
+	explicit map[string]bool
+	// Flag values currently applied from the file.
+	content []byte
+	values  map[string]string
+
+	// dryRun is --dry-run flag, which implies --evictor-dry-run.
+	dryRun bool
+	// Controllers to apply policy changes to, nil if disabled.
+	serviceAccounts interface {
+		SetRefreshPolicy(controller.RefreshPolicy) error
+	}
+	evictor interface {
+		SetEvictionPolicy(controller.EvictionPolicy)
+	}
+}
+
+// loadConfigFile reads the config file and applies its values to the flags not specified on the command line.
+// It must be called after the command line is parsed. The file is not read if the path is empty.
+func loadConfigFile(path string, fs *flag.FlagSet) (*configFile, error) {
+	c := &configFile{path: path, explicit: map[string]bool{}}
+	fs.Visit(func(f *flag.Flag) {
+		c.explicit[f.Name] = true
+	})
+	if path == "" {
+		return c, nil
+	}
+
+	content, values, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.apply(fs, values); err != nil {
+		return nil, err
+	}
+	c.content, c.values = content, values
+
+	return c, nil
+}
+
+// readConfigFile reads the config file and returns its content and the flag values in it.
+func readConfigFile(path string) ([]byte, map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read the config file: %w", err)
+	}
+
+	var raw map[string]any
+	if err := yaml.Unmarshal(content, &raw); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse the config file: %w", err)
+	}
+
+	values := make(map[string]string, len(raw))
+	for name, v := range raw {
+		value, err := flagValue(v)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid value of %s in the config file: %w", name, err)
+		}
+		values[name] = value
+	}
+
+	return content, values, nil
+}
+
+// flagValue formats a value in the config file as a command line flag value.
+// Lists are joined by commas and maps are formatted as comma-separated key=value pairs.
+func flagValue(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			value, err := flagValue(item)
+			if err != nil {
+				return "", err
+			}
+			values = append(values, value)
+		}
+		return strings.Join(values, ","), nil
+	case map[string]any:
+		pairs := make([]string, 0, len(v))
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			value, err := flagValue(v[k])
+			if err != nil {
+				return "", err
+			}
+			pairs = append(pairs, k+"="+value)
+		}
+		return strings.Join(pairs, ","), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", v)
+	}
+}
+
+// apply sets the flag values to the flags not specified on the command line.
+func (c *configFile) apply(fs *flag.FlagSet, values map[string]string) error {
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		if name == "config" {
+			return errors.New("config cannot be specified in the config file")
+		}
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("unknown flag %s in the config file", name)
+		}
+		if c.explicit[name] {
+			continue
+		}
+		if err := fs.Set(name, values[name]); err != nil {
+			return fmt.Errorf("invalid value of %s in the config file: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable to keep policies of all replicas up to date.
+func (c *configFile) NeedLeaderElection() bool {
+	return false
+}
+
+// Start implements manager.Runnable to reload the config file on changes until the context is done.
+func (c *configFile) Start(ctx context.Context) error {
+	if c.path == "" {
+		return nil
+	}
+
+	ticker := time.NewTicker(configReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			c.reload()
+		}
+	}
+}
+
+// reload applies changes of the config file to the policies of the controllers.
+// Invalid changes are logged and not applied, and the previous policies are kept.
+func (c *configFile) reload() {
+	logger := ctrl.Log.WithName("config")
+
+	content, values, err := readConfigFile(c.path)
+	if err != nil {
+		logger.Error(err, "failed to reload the config file")
+		return
+	}
+	if bytes.Equal(content, c.content) {
+		return
+	}
+	// Invalid content is reported only once until it changes again.
+	c.content = content
+
+	var refresh controller.RefreshPolicy
+	var eviction controller.EvictionPolicy
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	bindPolicyFlags(fs, &refresh, &eviction)
+	if err := c.applyPolicies(fs, values); err != nil {
+		logger.Error(err, "failed to reload the config file")
+		return
+	}
+	eviction.DryRun = eviction.DryRun || c.dryRun
+
+	if c.serviceAccounts != nil {
+		if err := c.serviceAccounts.SetRefreshPolicy(refresh); err != nil {
+			logger.Error(err, "failed to reload the config file")
+			return
+		}
+	}
+	if c.evictor != nil {
+		c.evictor.SetEvictionPolicy(eviction)
+	}
+
+	var restartRequired []string
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		if fs.Lookup(name) == nil && !c.explicit[name] && values[name] != c.values[name] {
+			restartRequired = append(restartRequired, name)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.values)) {
+		if _, ok := values[name]; !ok && fs.Lookup(name) == nil && !c.explicit[name] {
+			restartRequired = append(restartRequired, name)
+		}
+	}
+	if len(restartRequired) > 0 {
+		logger.Info("Changes of the config file require a restart to apply.", "flags", restartRequired)
+	}
+	c.values = values
+
+	logger.Info("Reloaded the config file.", "refreshPolicy", refresh, "evictionPolicy", eviction)
+}
+
+// applyPolicies sets the policy flags in the given flag set from the command line if specified there, or from the
+// config file otherwise. Flags in neither keep their defaults.
+func (c *configFile) applyPolicies(fs *flag.FlagSet, values map[string]string) error {
+	for name := range values {
+		if name == "config" || flag.CommandLine.Lookup(name) == nil {
+			return fmt.Errorf("unknown flag %s in the config file", name)
+		}
+	}
+
+	var rerr error
+	fs.VisitAll(func(f *flag.Flag) {
+		value, ok := values[f.Name]
+		if c.explicit[f.Name] {
+			value, ok = flag.CommandLine.Lookup(f.Name).Value.String(), true
+		}
+		if !ok || rerr != nil {
+			return
+		}
+		if err := fs.Set(f.Name, value); err != nil {
+			rerr = fmt.Errorf("invalid value of %s in the config file: %w", f.Name, err)
+		}
+	})
+
+	return rerr
+}
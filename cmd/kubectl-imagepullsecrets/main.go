@@ -0,0 +1,437 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command kubectl-imagepullsecrets is a kubectl plugin to inspect and operate image pull secret provisioning for
+// on-call debugging.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.).
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/pfnet/image-pull-secrets-provisioner/internal/controller"
+)
+
+const usage = `Inspect and operate image pull secret provisioning.
+
+Usage:
+  kubectl imagepullsecrets status [flags]           Show configured ServiceAccounts, expiration of their image pull
+                                                    secrets, and last errors.
+  kubectl imagepullsecrets refresh [flags] NAME     Refresh the image pull secret of a ServiceAccount immediately.
+  kubectl imagepullsecrets validate [flags] NAME    Exchange a token of a ServiceAccount for registry credentials once
+                                                    without provisioning an image pull secret.
+  kubectl imagepullsecrets provision [flags] NAME   Exchange a token of a ServiceAccount for registry credentials once,
+                                                    and print or apply the resulting image pull secret.
+  kubectl imagepullsecrets doctor [flags] NAME      Check each link in the chain to provision an image pull secret for
+                                                    a ServiceAccount, and print hints to fix a failure.
+  kubectl imagepullsecrets migrate [flags]          Rewrite labels and annotations of ServiceAccounts and image pull
+                                                    secrets from --from-prefix to the keys honored by the controller.
+
+Flags:
+`
+
+// Default prefix of annotation keys to configure ServiceAccounts with.
+const defaultAnnotationKeyPrefix = "imagepullsecrets.preferred.jp/"
+
+// Field manager of image pull secrets applied by provision.
+const fieldManager = "kubectl-imagepullsecrets"
+
+// options holds flags of all subcommands.
+type options struct {
+	kubeconfig          string
+	context             string
+	namespace           string
+	allNamespaces       bool
+	annotationKeyPrefix string
+
+	// For provision.
+	annotations map[string]string
+	apply       bool
+	output      string
+
+	// For migrate.
+	fromPrefix string
+}
+
+func main() {
+	if err := run(context.Background(), os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("kubectl-imagepullsecrets", flag.ContinueOnError)
+	opts := &options{annotations: map[string]string{}}
+	fs.StringVar(&opts.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file.")
+	fs.StringVar(&opts.context, "context", "", "Name of the kubeconfig context to use.")
+	fs.StringVar(&opts.namespace, "namespace", "", "Namespace of ServiceAccounts. Defaults to that of the context.")
+	fs.StringVar(&opts.namespace, "n", "", "Shorthand for --namespace.")
+	fs.BoolVar(&opts.allNamespaces, "all-namespaces", false, "Show ServiceAccounts in all namespaces.")
+	fs.BoolVar(&opts.allNamespaces, "A", false, "Shorthand for --all-namespaces.")
+	fs.StringVar(&opts.annotationKeyPrefix, "annotation-key-prefix", defaultAnnotationKeyPrefix,
+		"Custom prefix of annotation keys passed to the controller by the flag of the same name.")
+	fs.Func("annotation",
+		"Annotation to configure image pull secret provisioning with in KEY=VALUE format, which can be repeated."+
+			" If specified, annotations of the ServiceAccount are ignored. Only for provision.",
+		func(str string) error {
+			key, value, ok := strings.Cut(str, "=")
+			if !ok {
+				return fmt.Errorf("annotation must be in KEY=VALUE format: %q", str)
+			}
+			opts.annotations[key] = value
+			return nil
+		})
+	fs.BoolVar(&opts.apply, "apply", false,
+		"Apply the image pull secret to the cluster instead of printing it for provision, or the rewritten keys instead"+
+			" of only printing them for migrate.")
+	fs.StringVar(&opts.fromPrefix, "from-prefix", "",
+		"Old prefix of label and annotation keys to rewrite, e.g. an annotation key prefix previously passed to the"+
+			" controller. Only for migrate.")
+	fs.StringVar(&opts.output, "output", "yaml", "Format to print the image pull secret in, yaml or json."+
+		" Only for provision.")
+	fs.StringVar(&opts.output, "o", "yaml", "Shorthand for --output.")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+
+	// Flags are accepted both before and after the subcommand.
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("subcommand is required")
+	}
+	subcommand := fs.Arg(0)
+	if err := fs.Parse(fs.Args()[1:]); err != nil {
+		return err
+	}
+
+	switch {
+	case slices.Contains([]string{"status", "migrate"}, subcommand):
+		if fs.NArg() != 0 {
+			return fmt.Errorf("%s does not take arguments", subcommand)
+		}
+	case slices.Contains([]string{"refresh", "validate", "provision", "doctor"}, subcommand):
+		if fs.NArg() != 1 {
+			return fmt.Errorf("%s takes the name of a ServiceAccount", subcommand)
+		}
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown subcommand: %s", subcommand)
+	}
+
+	if err := controller.SetAnnotationKeyPrefix(opts.annotationKeyPrefix); err != nil {
+		return err
+	}
+	c, namespace, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	// Subcommands operating on all ServiceAccounts in the namespace, or in all namespaces.
+	listNamespace := namespace
+	if opts.allNamespaces {
+		listNamespace = ""
+	}
+	switch subcommand {
+	case "status":
+		return status(ctx, c, listNamespace, out)
+	case "migrate":
+		return migrate(ctx, c, listNamespace, opts, out)
+	}
+
+	sa := &corev1.ServiceAccount{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: fs.Arg(0)}, sa); err != nil {
+		return fmt.Errorf("failed to get a ServiceAccount: %w", err)
+	}
+	switch subcommand {
+	case "refresh":
+		return refresh(ctx, c, sa, out)
+	case "provision":
+		return provision(ctx, c, sa, opts, out)
+	case "doctor":
+		return doctor(ctx, c, sa, out)
+	}
+
+	return validate(ctx, c, sa, out)
+}
+
+// client returns a Kubernetes client and the namespace to operate in from the kubeconfig.
+func (o *options) client() (client.Client, string, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = o.kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: o.context}
+	overrides.Context.Namespace = o.namespace
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides)
+
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	namespace, _, err := clientConfig.Namespace()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to determine the namespace: %w", err)
+	}
+
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	c, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create a Kubernetes client: %w", err)
+	}
+
+	return c, namespace, nil
+}
+
+// status shows ServiceAccounts configured for image pull secret provisioning in a namespace, or in all namespaces if
+// namespace is empty.
+func status(ctx context.Context, c client.Client, namespace string, out io.Writer) error {
+	sas := &corev1.ServiceAccountList{}
+	if err := c.List(ctx, sas, client.InNamespace(namespace)); err != nil {
+		return fmt.Errorf("failed to list ServiceAccounts: %w", err)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tNAME\tPROVIDER\tSECRET\tEXPIRES\tLAST ERROR")
+	for i := range sas.Items {
+		sa := &sas.Items[i]
+		st, ok := controller.InspectServiceAccount(sa)
+		if !ok {
+			continue
+		}
+
+		secret := st.Secret
+		switch {
+		case st.Suspended:
+			secret = "<suspended>"
+		case secret == "":
+			secret = "<none>"
+		}
+		lastError := "<none>"
+		if st.LastError != "" {
+			// Keep each ServiceAccount on a single line.
+			lastError = fmt.Sprintf("%s ago: %s", since(st.LastErrorAt), strings.Join(strings.Fields(st.LastError), " "))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			sa.GetNamespace(), sa.GetName(), st.Provider, secret, until(st.ExpiresAt), lastError)
+	}
+
+	return w.Flush()
+}
+
+// refresh requests the controller to refresh the image pull secret of a ServiceAccount immediately.
+func refresh(ctx context.Context, c client.Client, sa *corev1.ServiceAccount, out io.Writer) error {
+	if err := controller.RequestRefresh(ctx, c, sa); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Requested refreshing the image pull secret of ServiceAccount %s/%s.\n",
+		sa.GetNamespace(), sa.GetName())
+
+	return nil
+}
+
+// validate exchanges a token of a ServiceAccount for registry credentials without provisioning an image pull secret.
+func validate(ctx context.Context, c client.Client, sa *corev1.ServiceAccount, out io.Writer) error {
+	expiresAt, err := controller.CheckServiceAccount(ctx, c, sa)
+	if err != nil {
+		return fmt.Errorf("failed to exchange a token of ServiceAccount %s/%s: %w", sa.GetNamespace(), sa.GetName(), err)
+	}
+	fmt.Fprintf(out, "ServiceAccount %s/%s can obtain credentials of its registry valid until %s.\n",
+		sa.GetNamespace(), sa.GetName(), expiresAt.Format(time.RFC3339))
+
+	return nil
+}
+
+// provision exchanges a token of a ServiceAccount for registry credentials once, and prints or applies the resulting
+// image pull secret, e.g. in CI pipelines or to check IAM setup before annotating the ServiceAccount.
+func provision(ctx context.Context, c client.Client, sa *corev1.ServiceAccount, opts *options, out io.Writer) error {
+	if opts.output != "yaml" && opts.output != "json" {
+		return fmt.Errorf("unknown output format: %s", opts.output)
+	}
+
+	// Replace the configuration of the ServiceAccount only in memory.
+	if len(opts.annotations) > 0 {
+		for key := range sa.Annotations {
+			if strings.HasPrefix(key, defaultAnnotationKeyPrefix) || strings.HasPrefix(key, opts.annotationKeyPrefix) {
+				delete(sa.Annotations, key)
+			}
+		}
+		if sa.Annotations == nil {
+			sa.Annotations = map[string]string{}
+		}
+		maps.Copy(sa.Annotations, opts.annotations)
+	}
+
+	secret, err := controller.BuildImagePullSecret(ctx, c, sa)
+	if err != nil {
+		return fmt.Errorf("failed to exchange a token of ServiceAccount %s/%s: %w", sa.GetNamespace(), sa.GetName(), err)
+	}
+	secret.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Secret"))
+
+	if opts.apply {
+		if err := c.Patch(ctx, secret, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership); err != nil {
+			return fmt.Errorf("failed to apply an image pull secret: %w", err)
+		}
+		fmt.Fprintf(out, "Applied image pull secret %s/%s.\n", secret.GetNamespace(), secret.GetName())
+		return nil
+	}
+
+	var data []byte
+	if opts.output == "json" {
+		data, err = json.MarshalIndent(secret, "", "  ")
+		data = append(data, '\n')
+	} else {
+		data, err = yaml.Marshal(secret)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to marshal an image pull secret: %w", err)
+	}
+	_, err = out.Write(data)
+
+	return err
+}
+
+// doctor checks each link in the chain to provision an image pull secret for a ServiceAccount, and prints the result of
+// each step with a hint to fix a failure.
+func doctor(ctx context.Context, c client.Client, sa *corev1.ServiceAccount, out io.Writer) error {
+	failed := false
+	for _, step := range controller.Diagnose(ctx, c, sa) {
+		fmt.Fprintf(out, "[%s] %s", step.Result, step.Name)
+		if step.Detail != "" {
+			fmt.Fprintf(out, ": %s", step.Detail)
+		}
+		fmt.Fprintln(out)
+		if step.Hint != "" {
+			fmt.Fprintf(out, "       Hint: %s\n", step.Hint)
+		}
+		failed = failed || step.Result == controller.DiagnosisFailed
+	}
+	if failed {
+		return fmt.Errorf("ServiceAccount %s/%s cannot be provisioned with an image pull secret",
+			sa.GetNamespace(), sa.GetName())
+	}
+
+	return nil
+}
+
+// migrate rewrites labels and annotations of ServiceAccounts and image pull secrets in a namespace, or in all
+// namespaces if namespace is empty, from an old prefix to the keys honored by the controller, e.g. after changing the
+// annotation key prefix, so that existing image pull secrets need not be deleted. The changes are only printed unless
+// opts.apply is true.
+func migrate(ctx context.Context, c client.Client, namespace string, opts *options, out io.Writer) error {
+	if opts.fromPrefix == "" {
+		return errors.New("migrate requires --from-prefix")
+	}
+	if err := controller.ValidateKeyPrefix(opts.fromPrefix); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "KIND\tNAMESPACE\tNAME\tFROM\tTO\tNOTE")
+	for _, kind := range []struct {
+		name    string
+		migrate func(obj metav1.Object, fromPrefix string) []controller.MigratedKey
+	}{
+		{name: "ServiceAccount", migrate: controller.MigrateServiceAccountKeys},
+		{name: "Secret", migrate: controller.MigrateSecretKeys},
+	} {
+		// Only metadata is needed, and not reading Secrets keeps their data out of the memory of this command.
+		list := &metav1.PartialObjectMetadataList{}
+		list.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind(kind.name + "List"))
+		if err := c.List(ctx, list, client.InNamespace(namespace)); err != nil {
+			return fmt.Errorf("failed to list %ss: %w", kind.name, err)
+		}
+
+		for i := range list.Items {
+			obj := &list.Items[i]
+			orig := obj.DeepCopy()
+			migrated := kind.migrate(obj, opts.fromPrefix)
+			for _, key := range migrated {
+				from, to, note := "annotation "+key.From, "annotation "+key.To, ""
+				if key.Label {
+					from, to = "label "+key.From, "label "+key.To
+				}
+				if key.Conflicting {
+					note = "dropped in favor of the existing value"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", kind.name, obj.GetNamespace(), obj.GetName(), from, to, note)
+			}
+			if len(migrated) == 0 || !opts.apply {
+				continue
+			}
+
+			// Fail instead of overwriting keys changed since listed. Running the command again resumes the migration.
+			if err := c.Patch(ctx, obj, client.MergeFromWithOptions(orig, client.MergeFromWithOptimisticLock{})); err != nil {
+				_ = w.Flush()
+				return fmt.Errorf("failed to patch %s %s/%s: %w", kind.name, obj.GetNamespace(), obj.GetName(), err)
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if !opts.apply {
+		fmt.Fprintln(out, "Nothing has been changed. Pass --apply to rewrite the keys.")
+	}
+
+	return nil
+}
+
+// until formats the remaining time until t.
+func until(t time.Time) string {
+	switch {
+	case t.IsZero():
+		return "<unknown>"
+	case time.Now().After(t):
+		return "expired"
+	default:
+		return time.Until(t).Round(time.Second).String()
+	}
+}
+
+// since formats the elapsed time since t.
+func since(t time.Time) string {
+	if t.IsZero() {
+		return "<unknown>"
+	}
+
+	return time.Since(t).Round(time.Second).String()
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// auditLog records every access token handed out to a ServiceAccount as a JSON line, e.g. for compliance audits.
+// Records never contain the token itself.
+type auditLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+type auditRecord struct {
+	Time           time.Time `json:"time"`
+	Namespace      string    `json:"namespace"`
+	ServiceAccount string    `json:"serviceAccount"`
+	Provider       string    `json:"provider"`
+	Principal      string    `json:"principal"`
+	Registry       string    `json:"registry"`
+	IssuedAt       time.Time `json:"issuedAt"`
+	ExpiresAt      time.Time `json:"expiresAt"`
+	// Whether the token was issued for another ServiceAccount federated to the same principal and shared.
+	Shared bool `json:"shared"`
+}
+
+func newAuditLog(w io.Writer) *auditLog {
+	return &auditLog{enc: json.NewEncoder(w)}
+}
+
+// audit records an access token handed out to a ServiceAccount if auditing is enabled.
+func (r *serviceAccountReconciler) audit(
+	sa *corev1.ServiceAccount, issuedAt time.Time, expiresAt time.Time, shared bool,
+) error {
+	if r.auditLog == nil {
+		return nil
+	}
+
+	return r.auditLog.record(sa, issuedAt, expiresAt, shared)
+}
+
+// record writes a record of an access token issued at issuedAt and expiring at expiresAt for a ServiceAccount.
+func (a *auditLog) record(sa *corev1.ServiceAccount, issuedAt time.Time, expiresAt time.Time, shared bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.enc.Encode(&auditRecord{
+		Time:           time.Now().UTC(),
+		Namespace:      sa.GetNamespace(),
+		ServiceAccount: sa.GetName(),
+		Provider:       providerName(sa),
+		Principal:      principalName(sa),
+		Registry:       annotation(sa, annotationKeyRegistry),
+		IssuedAt:       issuedAt.UTC(),
+		ExpiresAt:      expiresAt.UTC(),
+		Shared:         shared,
+	}); err != nil {
+		return fmt.Errorf("failed to write an audit record: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAuditLog(t *testing.T) {
+	sa := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "namespace-0",
+			Name:      "serviceaccount-0",
+			Annotations: map[string]string{
+				"imagepullsecrets.preferred.jp/registry":     "999999999999.dkr.ecr.ap-northeast-1.amazonaws.com",
+				"imagepullsecrets.preferred.jp/aws-role-arn": "arn:aws:iam::999999999999:role/ROLE-NAME",
+			},
+		},
+	}
+	issuedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	expiresAt := issuedAt.Add(12 * time.Hour)
+
+	buf := &bytes.Buffer{}
+	a := newAuditLog(buf)
+	if err := a.record(sa, issuedAt, expiresAt, false); err != nil {
+		t.Fatalf("Failed to record: %v", err)
+	}
+	if err := a.record(sa, issuedAt, expiresAt, true); err != nil {
+		t.Fatalf("Failed to record: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Unexpected number of records: %d", len(lines))
+	}
+
+	actual := auditRecord{}
+	if err := json.Unmarshal([]byte(lines[1]), &actual); err != nil {
+		t.Fatalf("Failed to unmarshal a record: %v", err)
+	}
+	expected := auditRecord{
+		Namespace:      "namespace-0",
+		ServiceAccount: "serviceaccount-0",
+		Provider:       "AWS",
+		Principal:      "arn:aws:iam::999999999999:role/ROLE-NAME",
+		Registry:       "999999999999.dkr.ecr.ap-northeast-1.amazonaws.com",
+		IssuedAt:       issuedAt,
+		ExpiresAt:      expiresAt,
+		Shared:         true,
+	}
+	if diff := cmp.Diff(expected, actual, cmpopts.IgnoreFields(auditRecord{}, "Time")); diff != "" {
+		t.Errorf("Record mismatch (-want +got):\n%s", diff)
+	}
+}
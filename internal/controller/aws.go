@@ -18,15 +18,14 @@ package controller
 
 import (
 	"context"
-	"encoding/base64"
-	"errors"
 	"fmt"
-	"strings"
+	"net/http"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
-	"github.com/aws/aws-sdk-go-v2/service/ecr"
-	"github.com/aws/aws-sdk-go-v2/service/sts"
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+
+	awscredentials "github.com/pfnet/image-pull-secrets-provisioner/pkg/credentials/aws"
 )
 
 type aws interface {
@@ -42,95 +41,59 @@ type aws interface {
 	ExtractRegion(registry string) (string, error)
 }
 
-func newAWS() aws {
-	return &awsImpl{
-		ecrClient: ecr.New(ecr.Options{}),
-	}
-}
+// AWSClientOptions configures the clients of AWS APIs.
+type AWSClientOptions struct {
+	TransportOptions
 
-type awsImpl struct {
-	ecrClient *ecr.Client
+	// RetryMode is the retry mode of the SDK, i.e. "standard" or "adaptive", which also rate-limits calls on
+	// throttling errors. Empty uses the SDK's default.
+	RetryMode string
+	// MaxAttempts is the maximum number of attempts of each API call including retries. Zero uses the SDK's default.
+	MaxAttempts int
 }
 
-func (a *awsImpl) GenerateAccessToken(
-	ctx context.Context,
-	k8sServiceAccountToken string,
-	region string,
-	awsRoleARN string,
-) (username string, password string, expiresAt time.Time, _ error) {
-	// With stscreds.NewWebIdentityRoleProvider, there seems to be no way to specify a region for the STS client
-	// dynamically, so here we need to create a new STS client with the region specified.
-	stsClient := sts.New(sts.Options{
-		Region: region,
+// config returns an AWS SDK configuration of the options.
+func (o AWSClientOptions) config() (awssdk.Config, error) {
+	var cfg awssdk.Config
+
+	var transportErr error
+	cfg.HTTPClient = awshttp.NewBuildableClient().WithTransportOptions(func(t *http.Transport) {
+		transportErr = o.configure(t)
 	})
-	credsProvider := stscreds.NewWebIdentityRoleProvider(
-		stsClient, awsRoleARN, &awsStaticIDTokenRetriever{token: k8sServiceAccountToken},
-	)
-
-	// Create an ECR authorization token.
-	resp, err := a.ecrClient.GetAuthorizationToken(
-		ctx, &ecr.GetAuthorizationTokenInput{},
-		func(o *ecr.Options) {
-			o.Region = region
-			o.Credentials = credsProvider
-		},
-	)
-	if err != nil {
-		return "", "", time.Time{}, fmt.Errorf("failed to get an ECR authorization token: %w", err)
+	if transportErr != nil {
+		return awssdk.Config{}, fmt.Errorf("invalid AWS client options: %w", transportErr)
 	}
 
-	if auth := resp.AuthorizationData; len(auth) != 1 {
-		return "", "", time.Time{}, fmt.Errorf(
-			"unexpected response from ECR GetAuthorizationToken API: length %d != 1", len(auth),
-		)
-	} else if auth[0].AuthorizationToken == nil {
-		return "", "", time.Time{}, errors.New(
-			"unexpected response from ECR GetAuthorizationToken API: AuthorizationToken is nil",
-		)
-	} else if auth[0].ExpiresAt == nil {
-		return "", "", time.Time{}, errors.New(
-			"unexpected response from ECR GetAuthorizationToken API: ExpiresAt is nil",
-		)
+	switch mode := awssdk.RetryMode(o.RetryMode); mode {
+	case "", awssdk.RetryModeStandard, awssdk.RetryModeAdaptive:
+		cfg.RetryMode = mode
+	default:
+		return awssdk.Config{}, fmt.Errorf("AWS retry mode must be standard or adaptive: %s", o.RetryMode)
 	}
-
-	username, password, err = a.parseECRToken(*resp.AuthorizationData[0].AuthorizationToken)
-	if err != nil {
-		return "", "", time.Time{}, fmt.Errorf("failed to parse an ECR authorization token: %w", err)
+	if o.MaxAttempts < 0 {
+		return awssdk.Config{}, fmt.Errorf("AWS max attempts must not be negative: %d", o.MaxAttempts)
 	}
+	cfg.RetryMaxAttempts = o.MaxAttempts
 
-	return username, password, *resp.AuthorizationData[0].ExpiresAt, nil
+	return cfg, nil
 }
 
-func (a *awsImpl) ExtractRegion(registry string) (string, error) {
-	// Registry <account>.dkr.ecr.<region>.amazonaws.com format.
-	parts := strings.SplitN(registry, ".", 5)
-	if len(parts) != 5 {
-		return "", fmt.Errorf("unexpected registry format: %s", registry)
+func newAWS(opts AWSClientOptions) (aws, error) {
+	cfg, err := opts.config()
+	if err != nil {
+		return nil, err
 	}
 
-	return parts[3], nil
-}
-
-// awsStaticIDTokenRetriever implements stscreds.IdentityTokenRetriever interface.
-type awsStaticIDTokenRetriever struct {
-	token string
+	return &awsImpl{
+		Client: awscredentials.NewClient(awscredentials.WithConfig(cfg)),
+	}, nil
 }
 
-func (a *awsStaticIDTokenRetriever) GetIdentityToken() ([]byte, error) {
-	return []byte(a.token), nil
+// awsImpl implements aws by the exported client. Errors of AWS APIs are classified by errorClass as they are.
+type awsImpl struct {
+	*awscredentials.Client
 }
 
-func (a *awsImpl) parseECRToken(token string) (username string, password string, _ error) {
-	// ECR tokens are base64-encoded strings in <username>:<password> format.
-	decoded, err := base64.StdEncoding.DecodeString(token)
-	if err != nil {
-		return "", "", err
-	}
-
-	parts := strings.SplitN(string(decoded), ":", 2)
-	if len(parts) != 2 {
-		return "", "", errors.New("unexpected ECR authorization token format")
-	}
-
-	return parts[0], parts[1], nil
+func (a *awsImpl) ExtractRegion(registry string) (string, error) {
+	return awscredentials.ExtractRegion(registry)
 }
@@ -0,0 +1,109 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// failureBackoff tracks consecutive provisioning failures of ServiceAccounts to retry them with exponential backoff.
+// It also decides which failures to report as events not to flood namespaces with them.
+type failureBackoff struct {
+	baseDelay time.Duration
+	maxDelay  time.Duration
+	// Minimum interval between events of a ServiceAccount.
+	eventInterval time.Duration
+	now           func() time.Time
+
+	mu       sync.Mutex
+	failures map[types.NamespacedName]*failureState
+}
+
+type failureState struct {
+	count int
+	// Message and time of the last reported failure, and the count of failures at that time.
+	notifiedMessage string
+	notifiedAt      time.Time
+	notifiedCount   int
+}
+
+func newFailureBackoff(
+	baseDelay time.Duration, maxDelay time.Duration, eventInterval time.Duration,
+) *failureBackoff {
+	return &failureBackoff{
+		baseDelay:     baseDelay,
+		maxDelay:      maxDelay,
+		eventInterval: eventInterval,
+		now:           time.Now,
+		failures:      map[types.NamespacedName]*failureState{},
+	}
+}
+
+// failed records a failure of a ServiceAccount and returns the delay to retry it.
+// notify is false if the failure needs not to be reported, i.e. it has the same message as the last reported one, or
+// the last one was reported within the event interval. Such failures are collapsed into the next report, and
+// suppressed is the number of them.
+func (b *failureBackoff) failed(
+	sa types.NamespacedName, message string,
+) (delay time.Duration, notify bool, suppressed int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state, ok := b.failures[sa]
+	if !ok {
+		state = &failureState{}
+		b.failures[sa] = state
+	}
+	state.count++
+	now := b.now()
+	notify = !ok || (message != state.notifiedMessage && now.Sub(state.notifiedAt) >= b.eventInterval)
+	if notify {
+		suppressed = state.count - state.notifiedCount - 1
+		state.notifiedMessage = message
+		state.notifiedAt = now
+		state.notifiedCount = state.count
+	}
+	consecutiveFailures.WithLabelValues(sa.Namespace, sa.Name).Set(float64(state.count))
+
+	delay = b.maxDelay
+	// Avoid overflow by stopping doubling once the delay reaches the cap.
+	if d := b.baseDelay; d > 0 {
+		for i := 1; i < state.count && d < b.maxDelay; i++ {
+			d *= 2
+		}
+		delay = min(d, b.maxDelay)
+	}
+
+	// Randomize the latter half of the delay not to retry failures happened at the same time in bursts.
+	return delay/2 + rand.N(delay/2+1), notify, suppressed
+}
+
+// reset forgets failures of a ServiceAccount.
+func (b *failureBackoff) reset(sa types.NamespacedName) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.failures[sa]; !ok {
+		return
+	}
+	delete(b.failures, sa)
+	consecutiveFailures.DeleteLabelValues(sa.Namespace, sa.Name)
+}
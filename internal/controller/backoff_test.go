@@ -0,0 +1,89 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestFailureBackoff(t *testing.T) {
+	b := newFailureBackoff(time.Second, 10*time.Second, 0)
+	sa := types.NamespacedName{Namespace: "namespace-0", Name: "serviceaccount-0"}
+
+	for i, tt := range []struct {
+		message        string
+		expectedMax    time.Duration
+		expectedNotify bool
+	}{
+		{message: "error-0", expectedMax: time.Second, expectedNotify: true},
+		{message: "error-0", expectedMax: 2 * time.Second, expectedNotify: false},
+		{message: "error-1", expectedMax: 4 * time.Second, expectedNotify: true},
+		{message: "error-1", expectedMax: 8 * time.Second, expectedNotify: false},
+		{message: "error-1", expectedMax: 10 * time.Second, expectedNotify: false},
+		{message: "error-1", expectedMax: 10 * time.Second, expectedNotify: false},
+	} {
+		delay, notify, _ := b.failed(sa, tt.message)
+		if delay < tt.expectedMax/2 || delay > tt.expectedMax {
+			t.Errorf("Delay of failure %d is out of range\n\texpected: [%s, %s]\n\tactual: %s",
+				i, tt.expectedMax/2, tt.expectedMax, delay)
+		}
+		if notify != tt.expectedNotify {
+			t.Errorf("Unexpected notify of failure %d\n\texpected: %t\n\tactual: %t", i, tt.expectedNotify, notify)
+		}
+	}
+
+	b.reset(sa)
+	delay, notify, _ := b.failed(sa, "error-1")
+	if delay > time.Second || !notify {
+		t.Errorf("Failures are not reset\n\tdelay: %s\n\tnotify: %t", delay, notify)
+	}
+}
+
+func TestFailureBackoffEventInterval(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newFailureBackoff(time.Second, 10*time.Second, time.Minute)
+	b.now = func() time.Time { return now }
+	sa := types.NamespacedName{Namespace: "namespace-0", Name: "serviceaccount-0"}
+
+	for i, tt := range []struct {
+		elapsed            time.Duration
+		message            string
+		expectedNotify     bool
+		expectedSuppressed int
+	}{
+		{message: "error-0", expectedNotify: true},
+		// Failures with different messages, e.g. including request IDs, are rate limited.
+		{elapsed: 10 * time.Second, message: "error-1", expectedNotify: false},
+		{elapsed: 10 * time.Second, message: "error-2", expectedNotify: false},
+		{elapsed: 40 * time.Second, message: "error-3", expectedNotify: true, expectedSuppressed: 2},
+		// Failures with the same message as the last reported one are never reported again.
+		{elapsed: 10 * time.Minute, message: "error-3", expectedNotify: false},
+		{elapsed: time.Second, message: "error-4", expectedNotify: true, expectedSuppressed: 1},
+	} {
+		now = now.Add(tt.elapsed)
+		_, notify, suppressed := b.failed(sa, tt.message)
+		if notify != tt.expectedNotify {
+			t.Errorf("Unexpected notify of failure %d\n\texpected: %t\n\tactual: %t", i, tt.expectedNotify, notify)
+		}
+		if notify && suppressed != tt.expectedSuppressed {
+			t.Errorf("Unexpected suppressed of failure %d\n\texpected: %d\n\tactual: %d", i, tt.expectedSuppressed, suppressed)
+		}
+	}
+}
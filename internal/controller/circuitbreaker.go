@@ -0,0 +1,195 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// circuitBreaker stops calling a container registry provider during its outage so that the controller does not hammer
+// it by retrying every ServiceAccount independently.
+//
+// The breaker opens after consecutive failures that look like an outage. While open, calls fail immediately. After a
+// while, it lets a single call through as a probe. The breaker closes if the probe succeeds, and otherwise opens again
+// for twice as long up to a cap.
+type circuitBreaker struct {
+	provider         string
+	failureThreshold int
+	baseOpenDuration time.Duration
+	maxOpenDuration  time.Duration
+	now              func() time.Time
+
+	mu       sync.Mutex
+	failures int
+	// Time until which the breaker is open. Zero if the breaker is closed.
+	openUntil    time.Time
+	openDuration time.Duration
+	probing      bool
+}
+
+func newCircuitBreaker(provider string) *circuitBreaker {
+	circuitBreakerOpen.WithLabelValues(provider).Set(0)
+
+	return &circuitBreaker{
+		provider:         provider,
+		failureThreshold: 5,
+		baseOpenDuration: 30 * time.Second,
+		maxOpenDuration:  10 * time.Minute,
+		now:              time.Now,
+	}
+}
+
+// circuitOpenError is returned instead of calling a provider while its circuit breaker is open.
+type circuitOpenError struct {
+	provider   string
+	retryAfter time.Duration
+}
+
+func (e *circuitOpenError) Error() string {
+	// Not including retryAfter not to break deduplication of events.
+	return fmt.Sprintf("%s seems to be unavailable, and calls to it are suspended for a while", e.provider)
+}
+
+// do calls f unless the breaker is open, and records the result.
+func (c *circuitBreaker) do(ctx context.Context, f func() error) error {
+	if err := c.allow(); err != nil {
+		return err
+	}
+
+	err := f()
+	c.record(ctx, err)
+
+	return err
+}
+
+func (c *circuitBreaker) allow() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.openUntil.IsZero() {
+		return nil
+	}
+
+	now := c.now()
+	if now.Before(c.openUntil) || c.probing {
+		return &circuitOpenError{provider: c.provider, retryAfter: max(c.openUntil.Sub(now), time.Second)}
+	}
+
+	// Let this call through as a probe.
+	c.probing = true
+	return nil
+}
+
+// check returns an error if the breaker would reject a call now, without letting a probe through.
+func (c *circuitBreaker) check() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.openUntil.IsZero() {
+		return nil
+	}
+
+	now := c.now()
+	if now.Before(c.openUntil) || c.probing {
+		return &circuitOpenError{provider: c.provider, retryAfter: max(c.openUntil.Sub(now), time.Second)}
+	}
+
+	return nil
+}
+
+// open returns true if the breaker is open or probing, i.e. the provider has not recovered from its outage yet.
+func (c *circuitBreaker) open() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return !c.openUntil.IsZero()
+}
+
+func (c *circuitBreaker) record(ctx context.Context, err error) {
+	logger := log.FromContext(ctx).WithValues("provider", c.provider)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	probe := c.probing
+	c.probing = false
+
+	// Errors not caused by an outage, e.g. permission errors of a misconfigured ServiceAccount, prove that the provider
+	// is available.
+	if !isProviderUnavailable(err) {
+		if !c.openUntil.IsZero() {
+			logger.Info("Provider has recovered. Closing the circuit breaker.")
+		}
+		c.failures = 0
+		c.openUntil = time.Time{}
+		c.openDuration = 0
+		circuitBreakerOpen.WithLabelValues(c.provider).Set(0)
+		return
+	}
+
+	c.failures++
+	switch {
+	case probe:
+		c.openDuration = min(2*c.openDuration, c.maxOpenDuration)
+	case c.openUntil.IsZero() && c.failures >= c.failureThreshold:
+		c.openDuration = c.baseOpenDuration
+	default:
+		return
+	}
+	c.openUntil = c.now().Add(c.openDuration)
+	logger.Error(err, "provider seems to be unavailable, opening the circuit breaker", "openDuration", c.openDuration)
+	circuitBreakerOpen.WithLabelValues(c.provider).Set(1)
+}
+
+// isProviderUnavailable returns true if an error from a container registry provider looks like an outage rather than
+// a problem of a specific request.
+func isProviderUnavailable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	// Google.
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		return isUnavailableStatus(gerr.Code)
+	}
+
+	// AWS.
+	var respErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &respErr) {
+		return isUnavailableStatus(respErr.HTTPStatusCode())
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+func isUnavailableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := newCircuitBreaker("test")
+	c.now = func() time.Time { return now }
+
+	unavailable := fmt.Errorf("wrapped: %w", &googleapi.Error{Code: http.StatusServiceUnavailable})
+	calls := 0
+	call := func(err error) error {
+		return c.do(ctx, func() error {
+			calls++
+			return err
+		})
+	}
+
+	// Trip the breaker.
+	for range c.failureThreshold {
+		if err := call(unavailable); !errors.Is(err, unavailable) {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	// Test that calls are suspended while the breaker is open.
+	var openErr *circuitOpenError
+	if err := call(nil); !errors.As(err, &openErr) {
+		t.Fatalf("Breaker is not open: %v", err)
+	}
+	if calls != c.failureThreshold {
+		t.Errorf("Provider is called while the breaker is open")
+	}
+
+	// Test that a failed probe opens the breaker for longer.
+	now = now.Add(c.baseOpenDuration)
+	if err := call(unavailable); !errors.Is(err, unavailable) {
+		t.Fatalf("Probe is not let through: %v", err)
+	}
+	now = now.Add(c.baseOpenDuration)
+	if err := call(nil); !errors.As(err, &openErr) {
+		t.Fatalf("Breaker is not open after a failed probe: %v", err)
+	}
+
+	// Test that a successful probe closes the breaker.
+	now = now.Add(c.baseOpenDuration)
+	if err := call(nil); err != nil {
+		t.Fatalf("Probe is not let through: %v", err)
+	}
+	if err := call(nil); err != nil {
+		t.Errorf("Breaker is not closed after a successful probe: %v", err)
+	}
+}
+
+func TestIsProviderUnavailable(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "Success"},
+		{name: "Server error", err: &googleapi.Error{Code: http.StatusInternalServerError}, expected: true},
+		{name: "Rate limited", err: &googleapi.Error{Code: http.StatusTooManyRequests}, expected: true},
+		{name: "Permission denied", err: &googleapi.Error{Code: http.StatusForbidden}},
+		{name: "Timeout", err: fmt.Errorf("wrapped: %w", context.DeadlineExceeded), expected: true},
+		{name: "Canceled", err: context.Canceled},
+		{name: "Other", err: errors.New("invalid registry")},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if actual := isProviderUnavailable(tt.err); actual != tt.expected {
+				t.Errorf("Unexpected result\n\texpected: %t\n\tactual: %t", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerCheck(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := newCircuitBreaker("test")
+	c.now = func() time.Time { return now }
+
+	if err := c.check(); err != nil {
+		t.Fatalf("Closed breaker rejects a call: %v", err)
+	}
+
+	// Trip the breaker.
+	unavailable := &googleapi.Error{Code: http.StatusServiceUnavailable}
+	for range c.failureThreshold {
+		_ = c.do(ctx, func() error { return unavailable })
+	}
+
+	var openErr *circuitOpenError
+	if err := c.check(); !errors.As(err, &openErr) {
+		t.Fatalf("Breaker is not open: %v", err)
+	}
+
+	// Test that checking does not take the place of a probe.
+	now = now.Add(c.baseOpenDuration)
+	for range 2 {
+		if err := c.check(); err != nil {
+			t.Fatalf("Breaker rejects a probe: %v", err)
+		}
+	}
+	calls := 0
+	if err := c.do(ctx, func() error { calls++; return nil }); err != nil || calls != 1 {
+		t.Errorf("Probe is not let through after checks: %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// cleanupCache remembers ServiceAccounts that have no outdated image pull secrets, to skip listing their Secrets on
+// every reconciliation until any of their Secrets changes. A nil cache remembers nothing.
+type cleanupCache struct {
+	mu sync.Mutex
+	// generation is incremented on every change of Secrets, not to remember a ServiceAccount as clean by Secrets
+	// listed before a change.
+	generation uint64
+	cleaned    map[types.NamespacedName]cleanState
+}
+
+// cleanState is the image pull secret in use that a ServiceAccount was cleaned up for.
+type cleanState struct {
+	namespace string
+	inUse     string
+}
+
+func newCleanupCache() *cleanupCache {
+	return &cleanupCache{
+		cleaned: map[types.NamespacedName]cleanState{},
+	}
+}
+
+// snapshot returns the current generation to pass to remember.
+func (c *cleanupCache) snapshot() uint64 {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.generation
+}
+
+// clean returns true if a ServiceAccount is known to have no image pull secrets other than the one in use.
+func (c *cleanupCache) clean(sa types.NamespacedName, state cleanState) bool {
+	if c == nil {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cleaned, ok := c.cleaned[sa]
+	return ok && cleaned == state
+}
+
+// remember records that a ServiceAccount has no image pull secrets other than the one in use as of the generation.
+func (c *cleanupCache) remember(sa types.NamespacedName, state cleanState, generation uint64) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation == c.generation {
+		c.cleaned[sa] = state
+	}
+}
+
+// forget drops what is known about a ServiceAccount, e.g. when one of its Secrets changes or it is deleted.
+func (c *cleanupCache) forget(sa types.NamespacedName) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	delete(c.cleaned, sa)
+}
+
+// forgetOnSecretEvents returns an event handler that makes the cache forget the ServiceAccounts of changed image pull
+// secrets and then enqueues them. Enqueueing after forgetting, rather than relying on other handlers, ensures that the
+// reconciliation triggered by a change lists Secrets again.
+func (c *cleanupCache) forgetOnSecretEvents() handler.EventHandler {
+	forget := func(obj client.Object, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+		secret, ok := obj.(*corev1.Secret)
+		if !ok {
+			return
+		}
+		sa := serviceAccountOf(secret)
+		if sa.Name == "" {
+			return
+		}
+		c.forget(sa)
+		q.Add(reconcile.Request{NamespacedName: sa})
+	}
+	return handler.Funcs{
+		CreateFunc: func(
+			_ context.Context, e event.CreateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request],
+		) {
+			forget(e.Object, q)
+		},
+		UpdateFunc: func(
+			_ context.Context, e event.UpdateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request],
+		) {
+			forget(e.ObjectOld, q)
+			forget(e.ObjectNew, q)
+		},
+		DeleteFunc: func(
+			_ context.Context, e event.DeleteEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request],
+		) {
+			forget(e.Object, q)
+		},
+	}
+}
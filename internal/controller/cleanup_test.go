@@ -0,0 +1,60 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestCleanupCache(t *testing.T) {
+	sa := types.NamespacedName{Namespace: "default", Name: "sa"}
+	state := cleanState{namespace: "default", inUse: "sa-0"}
+
+	c := newCleanupCache()
+	if c.clean(sa, state) {
+		t.Errorf("ServiceAccount not cleaned up yet should not be clean")
+	}
+
+	c.remember(sa, state, c.snapshot())
+	if !c.clean(sa, state) {
+		t.Errorf("ServiceAccount cleaned up should be clean")
+	}
+	if c.clean(sa, cleanState{namespace: "default", inUse: "sa-1"}) {
+		t.Errorf("ServiceAccount using another image pull secret should not be clean")
+	}
+
+	c.forget(sa)
+	if c.clean(sa, state) {
+		t.Errorf("ServiceAccount forgotten should not be clean")
+	}
+
+	generation := c.snapshot()
+	c.forget(types.NamespacedName{Namespace: "default", Name: "another"})
+	c.remember(sa, state, generation)
+	if c.clean(sa, state) {
+		t.Errorf("ServiceAccount listed before a change of Secrets should not be clean")
+	}
+
+	var disabled *cleanupCache
+	disabled.remember(sa, state, disabled.snapshot())
+	disabled.forget(sa)
+	if disabled.clean(sa, state) {
+		t.Errorf("Nil cache should remember nothing")
+	}
+}
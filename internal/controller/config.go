@@ -17,29 +17,39 @@ limitations under the License.
 package controller
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/validation"
+
+	awscredentials "github.com/pfnet/image-pull-secrets-provisioner/pkg/credentials/aws"
+	googlecredentials "github.com/pfnet/image-pull-secrets-provisioner/pkg/credentials/google"
+	"github.com/pfnet/image-pull-secrets-provisioner/pkg/imagepullsecret"
 )
 
 // Helpers for config annotations.
 
 func hasConfig(sa *corev1.ServiceAccount) bool {
 	// Common.
-	if sa.Annotations[annotationKeyRegistry] == "" {
-		return false
-	}
-	if sa.Annotations[annotationKeyAudience] == "" {
+	if annotation(sa, annotationKeyRegistry) == "" {
 		return false
 	}
 
 	// AWS.
-	if sa.Annotations[annotationKeyAWSRoleARN] != "" {
+	if annotation(sa, annotationKeyAWSRoleARN) != "" {
 		return true
 	}
 
 	// Google.
-	if sa.Annotations[annotationKeyGoogleWIDP] != "" {
-		if sa.Annotations[annotationKeyGoogleSA] != "" {
+	if annotation(sa, annotationKeyGoogleWIDP) != "" {
+		if annotation(sa, annotationKeyGoogleSA) != "" {
 			return true
 		}
 	}
@@ -47,15 +57,384 @@ func hasConfig(sa *corev1.ServiceAccount) bool {
 	return false
 }
 
+// Formats of configuration annotations, checked up front to report misconfiguration naming the offending annotation
+// instead of an opaque error from the provider.
+var (
+	awsRoleARNPattern    = regexp.MustCompile(`^arn:aws[a-z-]*:iam::[0-9]{12}:role/[\w+=,.@/-]+$`)
+	awsRegionPattern     = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-[0-9]+$`)
+	registryHostPattern  = regexp.MustCompile(`^[a-zA-Z0-9.-]+(:[0-9]+)?$`)
+	googleWIDPPattern    = regexp.MustCompile(`^projects/[^/]+/locations/[^/]+/workloadIdentityPools/[^/]+/providers/[^/]+$`)
+	googleSAEmailPattern = regexp.MustCompile(`^[a-z0-9-]+@[a-z0-9.-]+\.gserviceaccount\.com$`)
+	registryAliasPattern = regexp.MustCompile(`^(https?://)?[a-zA-Z0-9.-]+(:[0-9]+)?(/[^\s,]*)?$`)
+	// ARN or name of a secret of AWS Secrets Manager.
+	awsSecretsManagerSecretIDPattern = regexp.MustCompile(
+		`^(arn:aws[a-z-]*:secretsmanager:[a-z0-9-]+:[0-9]{12}:secret:[\w/+=.@-]+|[\w/+=.@-]{1,512})$`,
+	)
+)
+
+// validateConfig checks the formats of the configuration annotations of a ServiceAccount for its provider.
+// It returns nil if the ServiceAccount does not have configuration.
+func validateConfig(sa *corev1.ServiceAccount) error {
+	if !hasConfig(sa) {
+		return nil
+	}
+
+	var errs []error
+	check := func(key string, pattern *regexp.Regexp, expected string) {
+		if v := annotation(sa, key); !pattern.MatchString(v) {
+			errs = append(errs, fmt.Errorf("%q annotation must be %s: %q", key, expected, v))
+		}
+	}
+	switch providerName(sa) {
+	case providerAWS:
+		// Registries of any hosts, e.g. mirrors of ECR, are allowed with an explicit region.
+		if _, ok := lookupAnnotation(sa, annotationKeyAWSRegion); ok {
+			check(annotationKeyAWSRegion, awsRegionPattern, "an AWS region like us-east-1")
+			check(annotationKeyRegistry, registryHostPattern, "a registry host optionally with a port like HOST:PORT")
+		} else if v := annotation(sa, annotationKeyRegistry); !isECRRegistry(v) {
+			errs = append(errs, fmt.Errorf(
+				"%q annotation must be an ECR registry like 123456789012.dkr.ecr.us-east-1.amazonaws.com: %q",
+				annotationKeyRegistry, v,
+			))
+		}
+		check(annotationKeyAWSRoleARN, awsRoleARNPattern, "an IAM role ARN like arn:aws:iam::123456789012:role/NAME")
+		if _, ok := lookupAnnotation(sa, annotationKeyAWSSecretsManagerSecretID); ok {
+			check(annotationKeyAWSSecretsManagerSecretID, awsSecretsManagerSecretIDPattern,
+				"the ARN or the name of a secret of AWS Secrets Manager")
+		}
+	case providerGoogle:
+		// Registries may be scoped to a path like asia-northeast1-docker.pkg.dev/PROJECT/REPOSITORY.
+		v := annotation(sa, annotationKeyRegistry)
+		if host, _, _ := strings.Cut(v, "/"); len(validation.IsDNS1123Subdomain(host)) > 0 {
+			errs = append(errs, fmt.Errorf(
+				"%q annotation must be a registry host optionally with a path like asia-northeast1-docker.pkg.dev: %q",
+				annotationKeyRegistry, v,
+			))
+		}
+		check(annotationKeyGoogleWIDP, googleWIDPPattern,
+			"a workload identity provider like projects/NUMBER/locations/global/workloadIdentityPools/POOL/providers/NAME")
+		check(annotationKeyGoogleSA, googleSAEmailPattern,
+			"a service account email like NAME@PROJECT.iam.gserviceaccount.com")
+	}
+	// Secrets are written as the IAM role that the ServiceAccount is federated to.
+	if _, ok := lookupAnnotation(sa, annotationKeyAWSSecretsManagerSecretID); ok && providerName(sa) != providerAWS {
+		errs = append(errs, fmt.Errorf(
+			"%q annotation requires %q annotation", annotationKeyAWSSecretsManagerSecretID, annotationKeyAWSRoleARN,
+		))
+	}
+	for _, alias := range registryAliases(sa) {
+		if !registryAliasPattern.MatchString(alias) {
+			errs = append(errs, fmt.Errorf(
+				"%q annotation must be registry hosts optionally with a port and a scheme like https://HOST:PORT: %q",
+				annotationKeyRegistryAliases, alias,
+			))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// isECRRegistry returns true if a registry is an ECR registry whose region can be extracted.
+func isECRRegistry(registry string) bool {
+	_, err := awscredentials.ExtractRegion(registry)
+	return err == nil
+}
+
+// awsRegion returns the AWS region to get ECR authorization tokens for a ServiceAccount in. The region annotation takes
+// precedence over the region extracted from the registry.
+func awsRegion(sa *corev1.ServiceAccount, a aws) (string, error) {
+	if region := annotation(sa, annotationKeyAWSRegion); region != "" {
+		return region, nil
+	}
+
+	region, err := a.ExtractRegion(annotation(sa, annotationKeyRegistry))
+	if err != nil {
+		return "", fmt.Errorf("failed to extract an AWS region from registry: %w", err)
+	}
+
+	return region, nil
+}
+
+// Names of container registry providers.
+const (
+	providerAWS    = "AWS"
+	providerGoogle = "Google"
+)
+
+// providerName returns the name of the container registry provider configured for a ServiceAccount.
+// It returns an empty string if the ServiceAccount has no provider configured.
+func providerName(sa *corev1.ServiceAccount) string {
+	switch {
+	case annotation(sa, annotationKeyAWSRoleARN) != "":
+		return providerAWS
+	case annotation(sa, annotationKeyGoogleWIDP) != "":
+		return providerGoogle
+	default:
+		return ""
+	}
+}
+
+// principalName returns the AWS IAM role or the Google service account that a ServiceAccount is federated to.
+func principalName(sa *corev1.ServiceAccount) string {
+	switch providerName(sa) {
+	case providerAWS:
+		return annotation(sa, annotationKeyAWSRoleARN)
+	case providerGoogle:
+		return annotation(sa, annotationKeyGoogleSA)
+	default:
+		return ""
+	}
+}
+
+// suspended returns true if provisioning is suspended for a ServiceAccount.
+func suspended(sa *corev1.ServiceAccount) bool {
+	return annotation(sa, annotationKeySuspend) == "true"
+}
+
+// audiences returns the audiences of ServiceAccount tokens to exchange for registry credentials.
+// The audience annotation accepts a comma-separated list. If it is omitted, the audience is derived from the
+// provider configuration.
+func audiences(sa *corev1.ServiceAccount) []string {
+	var auds []string
+	for _, aud := range strings.Split(annotation(sa, annotationKeyAudience), ",") {
+		if aud = strings.TrimSpace(aud); aud != "" {
+			auds = append(auds, aud)
+		}
+	}
+	if len(auds) > 0 {
+		return auds
+	}
+
+	// AWS.
+	if annotation(sa, annotationKeyAWSRoleARN) != "" {
+		return []string{awscredentials.DefaultAudience}
+	}
+
+	// Google.
+	if provider := annotation(sa, annotationKeyGoogleWIDP); provider != "" {
+		return []string{googlecredentials.Audience(provider)}
+	}
+
+	return nil
+}
+
 func secretName(sa *corev1.ServiceAccount) string {
-	if name, ok := sa.Annotations[annotationKeySecretName]; ok {
+	if name, ok := lookupAnnotation(sa, annotationKeySecretName); ok {
 		return name
 	}
 
-	name := "imagepullsecret-" + sa.GetName()
-	if len(name) > validation.DNS1123SubdomainMaxLength {
-		name = name[:validation.DNS1123SubdomainMaxLength]
+	return imagepullsecret.Name(sa.GetNamespace(), sa.GetName(), secretNamespace(sa))
+}
+
+// secretNamespace returns the namespace to provision image pull secrets for a ServiceAccount in.
+// Image pull secrets in another namespace than the ServiceAccount are not attached to it, but consumed by other tools.
+func secretNamespace(sa *corev1.ServiceAccount) string {
+	if ns := annotation(sa, annotationKeySecretNamespace); ns != "" {
+		return ns
+	}
+
+	return sa.GetNamespace()
+}
+
+// configHash returns a hash of a ServiceAccount's configuration that determines the credentials in image pull secrets.
+func configHash(sa *corev1.ServiceAccount) string {
+	h := sha256.New()
+	for _, key := range []string{
+		annotationKeyRegistry,
+		annotationKeyAudience,
+		annotationKeyAWSRoleARN,
+		annotationKeyGoogleWIDP,
+		annotationKeyGoogleSA,
+	} {
+		// Separate values by a character that cannot appear in them.
+		_, _ = h.Write([]byte(annotation(sa, key) + "\n"))
+	}
+	// Keys added later are hashed only if set not to refresh image pull secrets of all ServiceAccounts on upgrade.
+	for _, key := range []string{
+		annotationKeyRegistryAliases,
+		annotationKeyAWSRegion,
+		annotationKeyAWSSecretsManagerSecretID,
+	} {
+		if v := annotation(sa, key); v != "" {
+			_, _ = h.Write([]byte(key + "=" + v + "\n"))
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// immutableSecretName returns the name of an immutable image pull secret for a ServiceAccount.
+// The name is suffixed with a hash of the Secret's content so that a refreshed Secret always gets a new name.
+func immutableSecretName(sa *corev1.ServiceAccount, dockerConfigJSON string) string {
+	return immutableSecretNamePrefix(sa) + contentHash([]byte(dockerConfigJSON))[:immutableSecretHashLength]
+}
+
+// immutableSecretNamePrefix returns the common prefix of immutable image pull secret names for a ServiceAccount.
+func immutableSecretNamePrefix(sa *corev1.ServiceAccount) string {
+	name := secretName(sa)
+	if len(name)+1+immutableSecretHashLength > validation.DNS1123SubdomainMaxLength {
+		name = name[:validation.DNS1123SubdomainMaxLength-1-immutableSecretHashLength]
+		// A label of a DNS subdomain cannot end with a dot or a hyphen followed by the separator.
+		name = strings.TrimRight(name, ".-")
+	}
+
+	return name + "-"
+}
+
+// Length of the hash suffix of immutable image pull secret names.
+const immutableSecretHashLength = 10
+
+// secretMetadata returns extra labels and annotations to add to image pull secrets for a ServiceAccount.
+// Those annotated to the ServiceAccount take precedence over the given defaults.
+func secretMetadata(
+	sa *corev1.ServiceAccount, defaultLabels map[string]string, defaultAnnotations map[string]string,
+) (labels map[string]string, annotations map[string]string, _ error) {
+	saLabels, err := ParseKeyValues(annotation(sa, annotationKeySecretLabels))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %q annotation: %w", annotationKeySecretLabels, err)
+	}
+	if err := validateLabels(saLabels); err != nil {
+		return nil, nil, fmt.Errorf("invalid %q annotation: %w", annotationKeySecretLabels, err)
+	}
+
+	saAnnotations, err := ParseKeyValues(annotation(sa, annotationKeySecretAnnotations))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %q annotation: %w", annotationKeySecretAnnotations, err)
+	}
+	if err := validateAnnotations(saAnnotations); err != nil {
+		return nil, nil, fmt.Errorf("invalid %q annotation: %w", annotationKeySecretAnnotations, err)
+	}
+
+	labels = map[string]string{}
+	for k, v := range defaultLabels {
+		labels[k] = v
+	}
+	for k, v := range saLabels {
+		labels[k] = v
+	}
+
+	annotations = map[string]string{}
+	for k, v := range defaultAnnotations {
+		annotations[k] = v
+	}
+	for k, v := range saAnnotations {
+		annotations[k] = v
+	}
+
+	return labels, annotations, nil
+}
+
+// refreshInterval returns the maximum interval to refresh image pull secrets for a ServiceAccount.
+// It returns zero if the interval is not specified.
+func refreshInterval(sa *corev1.ServiceAccount) (time.Duration, error) {
+	str, ok := lookupAnnotation(sa, annotationKeyRefreshInterval)
+	if !ok {
+		return 0, nil
+	}
+
+	interval, err := time.ParseDuration(str)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %q annotation: %w", annotationKeyRefreshInterval, err)
+	}
+	if interval <= 0 {
+		return 0, fmt.Errorf("%q annotation must be positive: %s", annotationKeyRefreshInterval, str)
+	}
+
+	return interval, nil
+}
+
+// ParseKeyValues parses comma-separated key=value pairs, e.g. of labels. An empty string is an empty map.
+// Values cannot contain commas.
+func ParseKeyValues(str string) (map[string]string, error) {
+	kvs := map[string]string{}
+	if strings.TrimSpace(str) == "" {
+		return kvs, nil
+	}
+
+	for _, pair := range strings.Split(str, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not in key=value format", pair)
+		}
+		kvs[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+
+	return kvs, nil
+}
+
+// validateLabels checks that labels to add to image pull secrets are valid and do not use reserved key prefixes.
+func validateLabels(labels map[string]string) error {
+	for k, v := range labels {
+		if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+			return fmt.Errorf("invalid label key %q: %s", k, strings.Join(errs, "; "))
+		}
+		if errs := validation.IsValidLabelValue(v); len(errs) > 0 {
+			return fmt.Errorf("invalid label value %q: %s", v, strings.Join(errs, "; "))
+		}
+		if prefix, ok := reservedKeyPrefix(k); ok {
+			return errors.New("label keys with " + prefix + " prefix are reserved")
+		}
+	}
+
+	return nil
+}
+
+// validateAnnotations checks that annotations to add to image pull secrets have valid, unreserved keys.
+func validateAnnotations(annotations map[string]string) error {
+	for k := range annotations {
+		if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+			return fmt.Errorf("invalid annotation key %q: %s", k, strings.Join(errs, "; "))
+		}
+		if prefix, ok := reservedKeyPrefix(k); ok {
+			return errors.New("annotation keys with " + prefix + " prefix are reserved")
+		}
 	}
 
-	return name
+	return nil
+}
+
+// reservedKeyPrefix returns the prefix of a label or annotation key if it is reserved for the metadata managed by the
+// controller or for the configuration annotations, which may have a custom prefix.
+func reservedKeyPrefix(key string) (string, bool) {
+	for _, prefix := range []string{metadataKeyPrefix, annotationKeyPrefix} {
+		if strings.HasPrefix(key, prefix) {
+			return prefix, true
+		}
+	}
+
+	return "", false
+}
+
+// registryAliases returns alternate keys of the registry to add to image pull secrets of a ServiceAccount.
+func registryAliases(sa *corev1.ServiceAccount) []string {
+	var aliases []string
+	for _, alias := range strings.Split(annotation(sa, annotationKeyRegistryAliases), ",") {
+		if alias = strings.TrimSpace(alias); alias != "" {
+			aliases = append(aliases, alias)
+		}
+	}
+
+	return aliases
+}
+
+// attachedSecrets returns names of image pull secrets that the controller attached to a ServiceAccount.
+// tracked is false if the ServiceAccount has not been updated by a version of the controller that tracks them.
+func attachedSecrets(sa *corev1.ServiceAccount) (names sets.Set[string], tracked bool) {
+	str, tracked := sa.Annotations[annotationKeyAttachedSecrets]
+	names = sets.New[string]()
+	for _, name := range strings.Split(str, ",") {
+		if name != "" {
+			names.Insert(name)
+		}
+	}
+
+	return names, tracked
+}
+
+// setAttachedSecrets records names of image pull secrets that the controller attached to a ServiceAccount.
+func setAttachedSecrets(sa *corev1.ServiceAccount, names sets.Set[string]) {
+	if sa.Annotations == nil {
+		sa.Annotations = map[string]string{}
+	}
+	sa.Annotations[annotationKeyAttachedSecrets] = strings.Join(sets.List(names), ",")
 }
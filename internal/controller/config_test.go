@@ -0,0 +1,440 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func TestImmutableSecretName(t *testing.T) {
+	for _, tt := range []struct {
+		name           string
+		serviceAccount string
+		expectedPrefix string
+	}{
+		{
+			name:           "Short name",
+			serviceAccount: "serviceaccount-0",
+			expectedPrefix: "imagepullsecret-serviceaccount-0-",
+		},
+		{
+			name:           "Long name",
+			serviceAccount: strings.Repeat("a", validation.DNS1123SubdomainMaxLength),
+			expectedPrefix: "imagepullsecret-" + strings.Repeat("a", validation.DNS1123SubdomainMaxLength-27) + "-",
+		},
+		{
+			name:           "Long name cut at a dot",
+			serviceAccount: strings.Repeat("a", 225) + "." + strings.Repeat("b", validation.DNS1123SubdomainMaxLength-226),
+			expectedPrefix: "imagepullsecret-" + strings.Repeat("a", 225) + "-",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			sa := &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: tt.serviceAccount,
+				},
+			}
+
+			name := immutableSecretName(sa, `{"auths":{}}`)
+			if !strings.HasPrefix(name, tt.expectedPrefix) {
+				t.Errorf("Unexpected name\n\texpectedPrefix: %s\n\tactual: %s", tt.expectedPrefix, name)
+			}
+			if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+				t.Errorf("Invalid name %s: %v", name, errs)
+			}
+			if name != immutableSecretName(sa, `{"auths":{}}`) {
+				t.Errorf("Name is not deterministic")
+			}
+			if name == immutableSecretName(sa, `{"auths":{"registry":{}}}`) {
+				t.Errorf("Name does not depend on the content")
+			}
+		})
+	}
+}
+
+func TestSecretMetadata(t *testing.T) {
+	for _, tt := range []struct {
+		name                string
+		annotations         map[string]string
+		expectedLabels      map[string]string
+		expectedAnnotations map[string]string
+		wantErr             bool
+	}{
+		{
+			name: "Defaults",
+			expectedLabels: map[string]string{
+				"cost-center": "default",
+			},
+			expectedAnnotations: map[string]string{
+				"argocd.argoproj.io/compare-options": "IgnoreExtraneous",
+			},
+		},
+		{
+			name: "Overridden",
+			annotations: map[string]string{
+				"imagepullsecrets.preferred.jp/secret-labels":      "cost-center=1234, team=ml",
+				"imagepullsecrets.preferred.jp/secret-annotations": "example.com/owner=ml",
+			},
+			expectedLabels: map[string]string{
+				"cost-center": "1234",
+				"team":        "ml",
+			},
+			expectedAnnotations: map[string]string{
+				"argocd.argoproj.io/compare-options": "IgnoreExtraneous",
+				"example.com/owner":                  "ml",
+			},
+		},
+		{
+			name: "Invalid format",
+			annotations: map[string]string{
+				"imagepullsecrets.preferred.jp/secret-labels": "cost-center",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Reserved key",
+			annotations: map[string]string{
+				"imagepullsecrets.preferred.jp/secret-labels": "imagepullsecrets.preferred.jp/service-account=other",
+			},
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			sa := &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "serviceaccount-0",
+					Annotations: tt.annotations,
+				},
+			}
+
+			labels, annotations, err := secretMetadata(
+				sa,
+				map[string]string{"cost-center": "default"},
+				map[string]string{"argocd.argoproj.io/compare-options": "IgnoreExtraneous"},
+			)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unexpected error\n\twantErr: %t\n\tactual: %v", tt.wantErr, err)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if diff := cmp.Diff(tt.expectedLabels, labels); diff != "" {
+				t.Errorf("Labels mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.expectedAnnotations, annotations); diff != "" {
+				t.Errorf("Annotations mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseKeyValues(t *testing.T) {
+	for _, tt := range []struct {
+		str      string
+		expected map[string]string
+		wantErr  bool
+	}{
+		{str: "", expected: map[string]string{}},
+		{str: " a=1, b = 2 ", expected: map[string]string{"a": "1", "b": "2"}},
+		{str: "a=1=2", expected: map[string]string{"a": "1=2"}},
+		{str: "a=1,b", wantErr: true},
+	} {
+		actual, err := ParseKeyValues(tt.str)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Unexpected error of %q\n\twantErr: %t\n\tactual: %v", tt.str, tt.wantErr, err)
+			continue
+		}
+		if diff := cmp.Diff(tt.expected, actual); !tt.wantErr && diff != "" {
+			t.Errorf("Key-values of %q mismatch (-want +got):\n%s", tt.str, diff)
+		}
+	}
+}
+
+func TestAttachedSecrets(t *testing.T) {
+	sa := &corev1.ServiceAccount{}
+
+	if _, tracked := attachedSecrets(sa); tracked {
+		t.Errorf("ServiceAccount without annotation should not be tracked")
+	}
+
+	names, _ := attachedSecrets(sa)
+	names.Insert("secret-1", "secret-0")
+	setAttachedSecrets(sa, names)
+	if actual := sa.Annotations["imagepullsecrets.preferred.jp/attached-secrets"]; actual != "secret-0,secret-1" {
+		t.Errorf("Unexpected annotation\n\texpected: %s\n\tactual: %s", "secret-0,secret-1", actual)
+	}
+
+	names.Delete("secret-0", "secret-1")
+	setAttachedSecrets(sa, names)
+	names, tracked := attachedSecrets(sa)
+	if !tracked || names.Len() != 0 {
+		t.Errorf("Unexpected attached secrets\n\ttracked: %t\n\tnames: %v", tracked, sets.List(names))
+	}
+}
+
+func TestAudiences(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		annotations map[string]string
+		expected    []string
+	}{
+		{
+			name: "Explicit",
+			annotations: map[string]string{
+				"imagepullsecrets.preferred.jp/audience":     "example.com",
+				"imagepullsecrets.preferred.jp/aws-role-arn": "arn:aws:iam::999999999999:role/ROLE-NAME",
+			},
+			expected: []string{"example.com"},
+		},
+		{
+			name: "Multiple",
+			annotations: map[string]string{
+				"imagepullsecrets.preferred.jp/audience": "example.com, example.net,",
+			},
+			expected: []string{"example.com", "example.net"},
+		},
+		{
+			name: "AWS default",
+			annotations: map[string]string{
+				"imagepullsecrets.preferred.jp/aws-role-arn": "arn:aws:iam::999999999999:role/ROLE-NAME",
+			},
+			expected: []string{"sts.amazonaws.com"},
+		},
+		{
+			name: "Google default",
+			annotations: map[string]string{
+				"imagepullsecrets.preferred.jp/googlecloud-workload-identity-provider": "projects/999999999999/locations/global/workloadIdentityPools/POOL-NAME/providers/PROVIDER-NAME",
+			},
+			expected: []string{
+				"//iam.googleapis.com/projects/999999999999/locations/global/workloadIdentityPools/POOL-NAME/providers/PROVIDER-NAME",
+			},
+		},
+		{
+			name: "No config",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			if diff := cmp.Diff(tt.expected, audiences(sa)); diff != "" {
+				t.Errorf("Audiences mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	t.Parallel()
+
+	aws := map[string]string{
+		annotationKeyRegistry:   "123456789012.dkr.ecr.us-east-1.amazonaws.com",
+		annotationKeyAWSRoleARN: "arn:aws:iam::123456789012:role/puller",
+	}
+	google := map[string]string{
+		annotationKeyRegistry:   "asia-northeast1-docker.pkg.dev",
+		annotationKeyGoogleWIDP: "projects/123/locations/global/workloadIdentityPools/pool/providers/provider",
+		annotationKeyGoogleSA:   "puller@project.iam.gserviceaccount.com",
+	}
+	with := func(annotations map[string]string, key, value string) map[string]string {
+		annotations = maps.Clone(annotations)
+		annotations[key] = value
+		return annotations
+	}
+
+	for _, tt := range []struct {
+		name        string
+		annotations map[string]string
+		invalid     string
+	}{
+		{
+			name:        "Valid AWS",
+			annotations: aws,
+		},
+		{
+			name:        "Valid AWS in China",
+			annotations: with(aws, annotationKeyRegistry, "123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn"),
+		},
+		{
+			name:        "Valid AWS with a FIPS registry",
+			annotations: with(aws, annotationKeyRegistry, "123456789012.dkr.ecr-fips.us-east-1.amazonaws.com"),
+		},
+		{
+			name:        "Valid AWS with a dual-stack registry",
+			annotations: with(aws, annotationKeyRegistry, "123456789012.dkr-ecr.us-east-1.on.aws"),
+		},
+		{
+			name: "Valid AWS with a mirror",
+			annotations: with(
+				with(aws, annotationKeyRegistry, "ecr-mirror.example.com:5000"), annotationKeyAWSRegion, "us-gov-west-1",
+			),
+		},
+		{
+			name:        "Invalid AWS region",
+			annotations: with(aws, annotationKeyAWSRegion, "us-east"),
+			invalid:     annotationKeyAWSRegion,
+		},
+		{
+			name:        "Valid AWS Secrets Manager secret name",
+			annotations: with(aws, annotationKeyAWSSecretsManagerSecretID, "team/image-pull-secret"),
+		},
+		{
+			name: "Valid AWS Secrets Manager secret ARN",
+			annotations: with(
+				aws,
+				annotationKeyAWSSecretsManagerSecretID,
+				"arn:aws:secretsmanager:us-east-1:123456789012:secret:team/image-pull-secret-AbCdEf",
+			),
+		},
+		{
+			name:        "Invalid AWS Secrets Manager secret ID",
+			annotations: with(aws, annotationKeyAWSSecretsManagerSecretID, "image pull secret"),
+			invalid:     annotationKeyAWSSecretsManagerSecretID,
+		},
+		{
+			name:        "AWS Secrets Manager secret ID for Google",
+			annotations: with(google, annotationKeyAWSSecretsManagerSecretID, "team/image-pull-secret"),
+			invalid:     annotationKeyAWSSecretsManagerSecretID,
+		},
+		{
+			name:        "Valid Google",
+			annotations: google,
+		},
+		{
+			name:        "Valid Google with a path-scoped registry",
+			annotations: with(google, annotationKeyRegistry, "asia-northeast1-docker.pkg.dev/project/repository"),
+		},
+		{
+			name:        "No configuration",
+			annotations: map[string]string{annotationKeyRegistry: "registry"},
+		},
+		{
+			name:        "Invalid ECR registry",
+			annotations: with(aws, annotationKeyRegistry, "123456789012.dkr.ecr.us-east-1.amazonaws.com/repository"),
+			invalid:     annotationKeyRegistry,
+		},
+		{
+			name:        "Invalid AWS role ARN",
+			annotations: with(aws, annotationKeyAWSRoleARN, "puller"),
+			invalid:     annotationKeyAWSRoleARN,
+		},
+		{
+			name:        "Invalid Google registry",
+			annotations: with(google, annotationKeyRegistry, "https://asia-northeast1-docker.pkg.dev"),
+			invalid:     annotationKeyRegistry,
+		},
+		{
+			name:        "Invalid workload identity provider",
+			annotations: with(google, annotationKeyGoogleWIDP, "pool/provider"),
+			invalid:     annotationKeyGoogleWIDP,
+		},
+		{
+			name:        "Invalid Google service account email",
+			annotations: with(google, annotationKeyGoogleSA, "puller"),
+			invalid:     annotationKeyGoogleSA,
+		},
+		{
+			name:        "Valid registry aliases",
+			annotations: with(google, annotationKeyRegistryAliases, "registry:443, https://registry:443/v2/"),
+		},
+		{
+			name:        "Invalid registry alias",
+			annotations: with(google, annotationKeyRegistryAliases, "registry:443,ftp://registry"),
+			invalid:     annotationKeyRegistryAliases,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			err := validateConfig(sa)
+			if tt.invalid == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.invalid) {
+				t.Errorf("Expected an error naming %s, but got: %v", tt.invalid, err)
+			}
+		})
+	}
+}
+
+func TestAWSRegion(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		name        string
+		annotations map[string]string
+		expected    string
+		wantErr     bool
+	}{
+		{
+			name:        "Extracted from the registry",
+			annotations: map[string]string{annotationKeyRegistry: "123456789012.dkr.ecr.us-east-1.amazonaws.com"},
+			expected:    "us-east-1",
+		},
+		{
+			name: "Overridden by the annotation",
+			annotations: map[string]string{
+				annotationKeyRegistry:  "123456789012.dkr.ecr.us-east-1.amazonaws.com",
+				annotationKeyAWSRegion: "ap-northeast-1",
+			},
+			expected: "ap-northeast-1",
+		},
+		{
+			name: "Mirror",
+			annotations: map[string]string{
+				annotationKeyRegistry:  "ecr-mirror.example.com",
+				annotationKeyAWSRegion: "ap-northeast-1",
+			},
+			expected: "ap-northeast-1",
+		},
+		{
+			name:        "Mirror without the annotation",
+			annotations: map[string]string{annotationKeyRegistry: "ecr-mirror.example.com"},
+			wantErr:     true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			actual, err := awsRegion(sa, &awsImpl{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Unexpected error\n\twantErr: %t\n\tactual: %v", tt.wantErr, err)
+			}
+			if actual != tt.expected {
+				t.Errorf("Unexpected region\n\texpected: %s\n\tactual: %s", tt.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// secretProviderClassPodStatusListGVK is the kind of lists of SecretProviderClassPodStatuses, which the Secrets Store
+// CSI driver creates for each volume it mounts. They are read as unstructured objects not to depend on the driver.
+var secretProviderClassPodStatusListGVK = schema.GroupVersionKind{
+	Group:   "secrets-store.csi.x-k8s.io",
+	Version: "v1",
+	Kind:    "SecretProviderClassPodStatusList",
+}
+
+const reasonRotationRequested = "RotationRequestedForImagePullSecret"
+
+//+kubebuilder:rbac:groups=secrets-store.csi.x-k8s.io,resources=secretproviderclasspodstatuses,verbs=list;patch
+
+// requestSecretsStoreCSIRotation annotates the SecretProviderClassPodStatuses of pods running as a ServiceAccount with
+// the time its image pull secret was written to secret stores, and records an event on them, so that volumes projecting
+// the image pull secret from the secret stores can be told to rotate. It does nothing if the driver is not installed.
+func (r *serviceAccountReconciler) requestSecretsStoreCSIRotation(
+	ctx context.Context, sa *corev1.ServiceAccount, writtenAt time.Time,
+) error {
+	// Read from the API server because pods may not be cached, e.g. while the evictor is disabled.
+	pods := &corev1.PodList{}
+	if err := r.apiReader.List(
+		ctx,
+		pods,
+		client.InNamespace(sa.GetNamespace()),
+		client.MatchingFields{indexKeyServiceAccountName: sa.GetName()},
+	); err != nil {
+		return fmt.Errorf("failed to list pods: %w", err)
+	}
+	if len(pods.Items) == 0 {
+		return nil
+	}
+	podNames := make(map[string]bool, len(pods.Items))
+	for _, pod := range pods.Items {
+		podNames[pod.GetName()] = true
+	}
+
+	statuses := &unstructured.UnstructuredList{}
+	statuses.SetGroupVersionKind(secretProviderClassPodStatusListGVK)
+	if err := r.apiReader.List(ctx, statuses, client.InNamespace(sa.GetNamespace())); err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to list SecretProviderClassPodStatuses: %w", err)
+	}
+
+	var errs []error
+	for i := range statuses.Items {
+		status := &statuses.Items[i]
+		podName, _, _ := unstructured.NestedString(status.Object, "status", "podName")
+		if !podNames[podName] {
+			continue
+		}
+
+		patch := client.MergeFrom(status.DeepCopy())
+		annotations := status.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[annotationKeyRotationRequestedAt] = writtenAt.UTC().Format(time.RFC3339)
+		status.SetAnnotations(annotations)
+		if err := r.Patch(ctx, status, patch); err != nil {
+			errs = append(errs, fmt.Errorf("failed to annotate SecretProviderClassPodStatus %s: %w", status.GetName(), err))
+			continue
+		}
+		r.eventRecorder.Eventf(
+			status, corev1.EventTypeNormal, reasonRotationRequested,
+			"Image pull secret of ServiceAccount %s was written to secret stores", sa.GetName(),
+		)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// newCSIRotationTestClient returns a fake client with pods of ServiceAccounts "fake" and "other" in the default
+// namespace, and a SecretProviderClassPodStatus for each of them. Calls with a canceled context fail as they would
+// against the API server.
+func newCSIRotationTestClient(t *testing.T) client.Client {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatalf("Failed to add core types to a scheme: %v", err)
+	}
+	if err := authenticationv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("Failed to add authentication types to a scheme: %v", err)
+	}
+	scheme.AddKnownTypeWithName(csiRotationTestStatusGVK, &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(secretProviderClassPodStatusListGVK, &unstructured.UnstructuredList{})
+
+	pod := func(name, serviceAccountName string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+			Spec:       corev1.PodSpec{ServiceAccountName: serviceAccountName},
+		}
+	}
+	status := func(name, podName string) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{Object: map[string]interface{}{
+			"status": map[string]interface{}{"podName": podName},
+		}}
+		u.SetGroupVersionKind(csiRotationTestStatusGVK)
+		u.SetNamespace("default")
+		u.SetName(name)
+		return u
+	}
+
+	return fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(
+			pod("puller", "fake"),
+			pod("other", "other"),
+			status("puller-default-spc", "puller"),
+			status("other-default-spc", "other"),
+		).
+		WithIndex(&corev1.Pod{}, indexKeyServiceAccountName, func(obj client.Object) []string {
+			return []string{obj.(*corev1.Pod).Spec.ServiceAccountName}
+		}).
+		WithInterceptorFuncs(interceptor.Funcs{
+			List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				return c.List(ctx, list, opts...)
+			},
+			Patch: func(
+				ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption,
+			) error {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				return c.Patch(ctx, obj, patch, opts...)
+			},
+			SubResourceCreate: func(
+				ctx context.Context, _ client.Client, _ string, _ client.Object, subResource client.Object,
+				_ ...client.SubResourceCreateOption,
+			) error {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				subResource.(*authenticationv1.TokenRequest).Status.Token = "fake-token"
+				return nil
+			},
+		}).
+		Build()
+}
+
+var csiRotationTestStatusGVK = secretProviderClassPodStatusListGVK.GroupVersion().WithKind("SecretProviderClassPodStatus")
+
+// rotationRequestedAt returns the rotation-requested-at annotation of a SecretProviderClassPodStatus.
+func rotationRequestedAt(t *testing.T, c client.Client, name string) string {
+	t.Helper()
+
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(csiRotationTestStatusGVK)
+	if err := c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: name}, u); err != nil {
+		t.Fatalf("Failed to get %s: %v", name, err)
+	}
+
+	return u.GetAnnotations()[annotationKeyRotationRequestedAt]
+}
+
+func TestRequestSecretsStoreCSIRotation(t *testing.T) {
+	c := newCSIRotationTestClient(t)
+	recorder := record.NewFakeRecorder(10)
+	r := &serviceAccountReconciler{Client: c, apiReader: c, eventRecorder: recorder}
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "fake"}}
+	writtenAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	if err := r.requestSecretsStoreCSIRotation(context.Background(), sa, writtenAt); err != nil {
+		t.Fatalf("Failed to request rotation: %v", err)
+	}
+
+	for name, expected := range map[string]string{
+		"puller-default-spc": "2024-01-02T03:04:05Z",
+		"other-default-spc":  "",
+	} {
+		if actual := rotationRequestedAt(t, c, name); actual != expected {
+			t.Errorf("Unexpected annotation of %s\n\texpected: %v\n\tactual: %v", name, expected, actual)
+		}
+	}
+	if len(recorder.Events) != 1 {
+		t.Errorf("Unexpected number of events\n\texpected: %v\n\tactual: %v", 1, len(recorder.Events))
+	}
+}
+
+// fakeSecretWriter is a secret writer that records the targets written to.
+type fakeSecretWriter struct {
+	written []string
+}
+
+func (w *fakeSecretWriter) name() string { return "fake" }
+
+func (w *fakeSecretWriter) target(sa *corev1.ServiceAccount) string { return sa.GetName() }
+
+func (w *fakeSecretWriter) write(
+	ctx context.Context, _ *corev1.ServiceAccount, _ string, target string, _ []byte,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	w.written = append(w.written, target)
+	return nil
+}
+
+func TestWriteToSecretStoresRequestsCSIRotation(t *testing.T) {
+	c := newCSIRotationTestClient(t)
+	writers := []*fakeSecretWriter{{}, {}}
+	r := &serviceAccountReconciler{
+		Client:        c,
+		apiReader:     c,
+		eventRecorder: record.NewFakeRecorder(10),
+		// Bounds each write, and must not cancel the following writers and the rotation hint.
+		providerTimeout:  time.Minute,
+		csiRotationHints: true,
+		secretWriters:    []secretWriter{writers[0], writers[1]},
+	}
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "fake"}}
+	secret := &corev1.Secret{Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{}}`)}}
+
+	if err := r.writeToSecretStores(context.Background(), logr.Discard(), sa, secret); err != nil {
+		t.Fatalf("Failed to write to secret stores: %v", err)
+	}
+
+	for i, w := range writers {
+		if len(w.written) != 1 {
+			t.Errorf("Unexpected writes by writer %d: %v", i, w.written)
+		}
+	}
+	if rotationRequestedAt(t, c, "puller-default-spc") == "" {
+		t.Errorf("Rotation is not requested for the pod of the ServiceAccount")
+	}
+	if actual := rotationRequestedAt(t, c, "other-default-spc"); actual != "" {
+		t.Errorf("Rotation is requested for the pod of another ServiceAccount: %s", actual)
+	}
+}
@@ -0,0 +1,233 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DiagnosisResult is the result of a step of a diagnosis.
+type DiagnosisResult string
+
+const (
+	DiagnosisPassed  DiagnosisResult = "PASS"
+	DiagnosisFailed  DiagnosisResult = "FAIL"
+	DiagnosisSkipped DiagnosisResult = "SKIP"
+)
+
+// DiagnosisStep is the result of checking a link in the chain to provision an image pull secret for a ServiceAccount.
+type DiagnosisStep struct {
+	Name   string
+	Result DiagnosisResult
+	// Detail is what was observed in the step, or the error if it failed.
+	Detail string
+	// Hint is how to fix the failure. It is empty unless the step failed.
+	Hint string
+}
+
+// diagnosis runs steps in order, skipping the rest after a failure.
+type diagnosis struct {
+	steps  []DiagnosisStep
+	failed bool
+}
+
+func (d *diagnosis) check(name string, hint string, f func() (string, error)) {
+	if d.failed {
+		d.steps = append(d.steps, DiagnosisStep{Name: name, Result: DiagnosisSkipped})
+		return
+	}
+
+	detail, err := f()
+	if err != nil {
+		d.failed = true
+		d.steps = append(d.steps, DiagnosisStep{Name: name, Result: DiagnosisFailed, Detail: err.Error(), Hint: hint})
+		return
+	}
+	d.steps = append(d.steps, DiagnosisStep{Name: name, Result: DiagnosisPassed, Detail: detail})
+}
+
+// Diagnose checks each link in the chain to provision an image pull secret for a ServiceAccount with the permissions of
+// the client, i.e. the configuration, the ServiceAccount token, the token exchange with the provider, and the
+// authentication to the registry, and reports the result of each step with a hint to fix a failure.
+// It does not create an image pull secret.
+func Diagnose(ctx context.Context, c client.Client, sa *corev1.ServiceAccount) []DiagnosisStep {
+	d := &diagnosis{}
+	subject := "system:serviceaccount:" + sa.GetNamespace() + ":" + sa.GetName()
+	isAWS := providerName(sa) == providerAWS
+
+	var r *serviceAccountReconciler
+	configHint := "Fix the annotations of the ServiceAccount as described in the error."
+	d.check("Configuration", configHint, func() (string, error) {
+		if !hasConfig(sa) {
+			return "", errors.New("ServiceAccount does not have configuration for image pull secret provisioning")
+		}
+		if err := validateConfig(sa); err != nil {
+			return "", err
+		}
+		if _, err := refreshInterval(sa); err != nil {
+			return "", err
+		}
+
+		var err error
+		r, err = newStandaloneReconciler(ctx, c)
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("provider %s, principal %s, registry %s",
+			providerName(sa), principalName(sa), annotation(sa, annotationKeyRegistry)), nil
+	})
+
+	var k8sToken string
+	d.check("ServiceAccount token",
+		"Allow yourself to create tokens of the ServiceAccount, i.e. create verb on serviceaccounts/token. "+
+			"The controller is allowed by its ClusterRole.",
+		func() (string, error) {
+			tokenReq := &authenticationv1.TokenRequest{
+				Spec: authenticationv1.TokenRequestSpec{
+					Audiences: audiences(sa),
+				},
+			}
+			if err := c.SubResource("token").Create(ctx, sa, tokenReq); err != nil {
+				return "", fmt.Errorf("failed to create a ServiceAccount token: %w", err)
+			}
+			k8sToken = tokenReq.Status.Token
+
+			return fmt.Sprintf("created a token for audiences %v", audiences(sa)), nil
+		})
+
+	audienceHint := "Register the issuer of the cluster as an identity provider with the audience, " +
+		"e.g. as an IAM OIDC provider with the audience as its client ID for AWS, " +
+		"or in the allowed audiences of the workload identity pool provider for Google."
+	d.check("Token audience", audienceHint, func() (string, error) {
+		issuer, tokenAudiences, err := tokenClaims(k8sToken)
+		if err != nil {
+			return "", err
+		}
+		for _, aud := range audiences(sa) {
+			if !slices.Contains(tokenAudiences, aud) {
+				return "", fmt.Errorf("token of issuer %s is not for audience %s: %v", issuer, aud, tokenAudiences)
+			}
+		}
+
+		return fmt.Sprintf("issuer %s, audiences %v", issuer, tokenAudiences), nil
+	})
+
+	var username, password string
+	var exchangeErr error
+	var expiresAt time.Time
+	federationHint := "Allow the workload identity pool provider to accept tokens of the issuer with the audience, " +
+		"and check its attribute mapping and conditions for subject " + subject + "."
+	if isAWS {
+		federationHint = "Allow sts:AssumeRoleWithWebIdentity in the trust policy of the IAM role for the OIDC provider " +
+			"of the issuer with the audience and subject " + subject + "."
+	}
+	federationStep := "Token exchange"
+	if provider := providerName(sa); provider != "" {
+		federationStep += " with " + provider + " STS"
+	}
+	d.check(federationStep, federationHint, func() (string, error) {
+		username, password, expiresAt, exchangeErr = r.exchangeServiceAccountToken(ctx, sa, k8sToken)
+		// Failures after the token exchange are reported in the next step.
+		if exchangeErr != nil && !slices.Contains(
+			[]string{errorClassImpersonationDenied, errorClassRegistryAPIError}, stepErrorClass(exchangeErr),
+		) {
+			return "", exchangeErr
+		}
+
+		return "exchanged the token", nil
+	})
+
+	if isAWS {
+		d.check("ECR authorization token",
+			"Allow ecr:GetAuthorizationToken in the permission policy of the IAM role.",
+			func() (string, error) {
+				if exchangeErr != nil {
+					return "", exchangeErr
+				}
+				return "obtained credentials valid until " + expiresAt.Format(time.RFC3339), nil
+			})
+	} else {
+		pool, _, _ := strings.Cut(annotation(sa, annotationKeyGoogleWIDP), "/providers/")
+		d.check("Google service account impersonation",
+			"Grant roles/iam.workloadIdentityUser on the Google service account to "+
+				"principal://iam.googleapis.com/"+pool+"/subject/"+subject+".",
+			func() (string, error) {
+				if exchangeErr != nil {
+					return "", exchangeErr
+				}
+				return "obtained credentials valid until " + expiresAt.Format(time.RFC3339), nil
+			})
+	}
+
+	d.check("Registry authentication",
+		"Allow the principal to pull images from the registry, e.g. ecr:BatchGetImage for AWS, "+
+			"or roles/artifactregistry.reader for Google.",
+		func() (string, error) {
+			registry, repository := annotation(sa, annotationKeyRegistry), annotation(sa, annotationKeyVerifyRepository)
+			if err := r.verifier.verify(ctx, registry, repository, username, password); err != nil {
+				return "", err
+			}
+			if repository != "" {
+				return "registry accepted the credentials for repository " + repository, nil
+			}
+			return "registry accepted the credentials", nil
+		})
+
+	return d.steps
+}
+
+// tokenClaims returns the issuer and the audiences of a JWT without verifying it.
+func tokenClaims(token string) (issuer string, audiences []string, _ error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", nil, errors.New("token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decode a JWT payload: %w", err)
+	}
+
+	claims := struct {
+		Issuer   string          `json:"iss"`
+		Audience json.RawMessage `json:"aud"`
+	}{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", nil, fmt.Errorf("failed to parse a JWT payload: %w", err)
+	}
+	// The audience claim is either a string or an array of strings.
+	if err := json.Unmarshal(claims.Audience, &audiences); err != nil {
+		var aud string
+		if err := json.Unmarshal(claims.Audience, &aud); err != nil {
+			return "", nil, fmt.Errorf("failed to parse the audience claim: %w", err)
+		}
+		audiences = []string{aud}
+	}
+
+	return claims.Issuer, audiences, nil
+}
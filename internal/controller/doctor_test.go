@@ -0,0 +1,93 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/base64"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestTokenClaims(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		name              string
+		payload           string
+		expectedIssuer    string
+		expectedAudiences []string
+		wantErr           bool
+	}{
+		{
+			name:              "Array of audiences",
+			payload:           `{"iss":"https://issuer","aud":["sts.amazonaws.com","audience"]}`,
+			expectedIssuer:    "https://issuer",
+			expectedAudiences: []string{"sts.amazonaws.com", "audience"},
+		},
+		{
+			name:              "Single audience",
+			payload:           `{"iss":"https://issuer","aud":"sts.amazonaws.com"}`,
+			expectedIssuer:    "https://issuer",
+			expectedAudiences: []string{"sts.amazonaws.com"},
+		},
+		{
+			name:    "Invalid audience",
+			payload: `{"iss":"https://issuer","aud":0}`,
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			token := "e30." + base64.RawURLEncoding.EncodeToString([]byte(tt.payload)) + ".signature"
+			issuer, audiences, err := tokenClaims(token)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Invalid token was accepted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if issuer != tt.expectedIssuer {
+				t.Errorf("Unexpected issuer\n\texpected: %s\n\tactual: %s", tt.expectedIssuer, issuer)
+			}
+			if !slices.Equal(audiences, tt.expectedAudiences) {
+				t.Errorf("Unexpected audiences\n\texpected: %v\n\tactual: %v", tt.expectedAudiences, audiences)
+			}
+		})
+	}
+}
+
+func TestDiagnoseSkipsStepsAfterFailure(t *testing.T) {
+	t.Parallel()
+
+	// The client is not used once the configuration is found missing.
+	steps := Diagnose(context.Background(), nil, &corev1.ServiceAccount{})
+	if len(steps) == 0 || steps[0].Result != DiagnosisFailed || steps[0].Hint == "" {
+		t.Fatalf("Missing configuration was not reported: %+v", steps)
+	}
+	for _, step := range steps[1:] {
+		if step.Result != DiagnosisSkipped {
+			t.Errorf("Step after a failure was not skipped: %+v", step)
+		}
+	}
+}
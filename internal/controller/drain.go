@@ -0,0 +1,51 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// errDrainTimeout is the cause of cancellation of work that did not finish within the drain timeout.
+var errDrainTimeout = errors.New("drain timeout exceeded after shutdown")
+
+// drainContext returns a context that is canceled only after the timeout elapses since the given context is done,
+// to let work in flight finish on shutdown. The returned function must be called to release resources once the work
+// finishes. Zero timeout returns the given context as is.
+func drainContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+
+	drainCtx, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			cancel(errDrainTimeout)
+		case <-drainCtx.Done():
+		}
+	})
+
+	return drainCtx, func() {
+		stop()
+		cancel(context.Canceled)
+	}
+}
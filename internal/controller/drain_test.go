@@ -0,0 +1,77 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDrainContext(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Finished within the timeout", func(t *testing.T) {
+		t.Parallel()
+
+		parent, cancelParent := context.WithCancel(context.Background())
+		ctx, cancel := drainContext(parent, time.Hour)
+		cancelParent()
+
+		time.Sleep(10 * time.Millisecond)
+		if err := ctx.Err(); err != nil {
+			t.Errorf("Context was canceled before the drain timeout: %v", err)
+		}
+
+		cancel()
+		if err := ctx.Err(); !errors.Is(err, context.Canceled) {
+			t.Errorf("Context was not canceled after the work finished: %v", err)
+		}
+	})
+
+	t.Run("Timed out", func(t *testing.T) {
+		t.Parallel()
+
+		parent, cancelParent := context.WithCancel(context.Background())
+		ctx, cancel := drainContext(parent, 10*time.Millisecond)
+		defer cancel()
+		cancelParent()
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+			t.Fatalf("Context was not canceled after the drain timeout")
+		}
+		if cause := context.Cause(ctx); !errors.Is(cause, errDrainTimeout) {
+			t.Errorf("Unexpected cause\n\texpected: %v\n\tactual: %v", errDrainTimeout, cause)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		t.Parallel()
+
+		parent, cancelParent := context.WithCancel(context.Background())
+		ctx, cancel := drainContext(parent, 0)
+		defer cancel()
+		cancelParent()
+
+		if err := ctx.Err(); !errors.Is(err, context.Canceled) {
+			t.Errorf("Context was not canceled with its parent: %v", err)
+		}
+	})
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Event reason of changes that would be made in dry-run mode.
+const reasonDryRun = "DryRunImagePullSecret"
+
+// planProvisioning reports the changes that the reconciliation would make for a ServiceAccount in dry-run mode.
+// It neither mutates the cluster nor calls container registry providers, but checks the preconditions of generating an
+// access token instead.
+func (r *serviceAccountReconciler) planProvisioning(
+	ctx context.Context, logger logr.Logger, sa *corev1.ServiceAccount,
+	should bool, current *corev1.Secret, refreshAt time.Time,
+) (ctrl.Result, error) {
+	inUse := ""
+	if current != nil {
+		inUse = current.GetName()
+	}
+
+	if should {
+		if err := r.checkProvisioning(ctx, sa); err != nil {
+			r.eventRecorder.Eventf(
+				sa, corev1.EventTypeWarning, failureReason(errorClass(err)),
+				"Dry run: provisioning an image pull secret would fail: %v", err,
+			)
+			logger.Error(err, "provisioning an image pull secret would fail")
+			return ctrl.Result{}, nil
+		}
+
+		action, name := "create", secretName(sa)
+		if current != nil {
+			action = "refresh"
+		}
+		if r.immutableSecrets {
+			name = "a new immutable Secret " + immutableSecretNamePrefix(sa) + "*"
+		}
+		r.eventRecorder.Eventf(
+			sa, corev1.EventTypeNormal, reasonDryRun,
+			"Dry run: would %s an image pull secret %s and attach it to the ServiceAccount", action, name,
+		)
+		logger.Info("Dry run: would provision an image pull secret.", "action", action, "secret", name)
+		if !r.immutableSecrets {
+			inUse = name
+		}
+	} else if current != nil && current.GetNamespace() == sa.GetNamespace() &&
+		!r.imagePullSecretAttached(sa, current.GetName()) {
+		r.eventRecorder.Eventf(
+			sa, corev1.EventTypeNormal, reasonDryRun,
+			"Dry run: would attach an image pull secret %s to the ServiceAccount", current.GetName(),
+		)
+		logger.Info("Dry run: would attach an image pull secret.", "secret", current.GetName())
+	}
+
+	targets, _, err := r.listImagePullSecretsToCleanup(ctx, sa, inUse)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to list image pull secrets to cleanup: %w", err)
+	}
+	names := make([]string, 0, len(targets))
+	for _, target := range targets {
+		names = append(names, target.GetName())
+	}
+	if len(names) > 0 {
+		r.eventRecorder.Eventf(
+			sa, corev1.EventTypeNormal, reasonDryRun,
+			"Dry run: would decommission outdated image pull secrets: %v", names,
+		)
+		logger.Info("Dry run: would decommission outdated image pull secrets.", "targets", names)
+	}
+
+	if !refreshAt.IsZero() {
+		return ctrl.Result{RequeueAfter: r.requeueAfter(refreshAt)}, nil
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// checkProvisioning checks the preconditions of provisioning an image pull secret for a ServiceAccount, i.e. its
+// configuration is valid, and the controller is allowed to create its tokens for the audiences.
+func (r *serviceAccountReconciler) checkProvisioning(ctx context.Context, sa *corev1.ServiceAccount) error {
+	if err := r.checkSecretNamespace(sa); err != nil {
+		return err
+	}
+	if _, _, err := secretMetadata(sa, r.secretLabels, r.secretAnnotations); err != nil {
+		return err
+	}
+	if _, err := refreshInterval(sa); err != nil {
+		return err
+	}
+
+	merged, err := r.getSecretToMerge(ctx, sa)
+	if err != nil {
+		return err
+	}
+	if merged != nil {
+		if _, err := dockerConfigJSONAuths(merged); err != nil {
+			return fmt.Errorf("failed to read the Secret to merge: %w", err)
+		}
+	}
+
+	if providerName(sa) == providerAWS {
+		if _, err := awsRegion(sa, r.aws); err != nil {
+			return err
+		}
+	}
+
+	// The API server validates the request without issuing a token.
+	tokenReq := &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			Audiences: audiences(sa),
+		},
+	}
+	if err := r.SubResource("token").Create(ctx, sa, tokenReq, client.DryRunAll); err != nil {
+		return fmt.Errorf("failed to create a ServiceAccount token: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Classes of errors of provisioning an image pull secret, which tell users where to fix.
+const (
+	errorClassCircuitOpen = "circuit_open"
+	errorClassThrottled   = "throttled"
+	errorClassUnavailable = "unavailable"
+	// Exchanging a ServiceAccount token with AWS or Google STS failed, e.g. because of the trust policy.
+	errorClassFederationDenied = "federation_denied"
+	// Impersonating a Google service account failed, e.g. because of a missing IAM binding.
+	errorClassImpersonationDenied = "impersonation_denied"
+	// Container registry API returned an error, e.g. because the AWS IAM role is not allowed to pull images.
+	errorClassRegistryAPIError = "registry_api_error"
+	// Kubernetes API returned an error, e.g. because the controller is not allowed to create ServiceAccount tokens.
+	errorClassKubernetesAPIError = "kubernetes_api_error"
+	// Container registry rejected newly generated credentials on verification.
+	errorClassVerificationFailed = "verification_failed"
+	// Annotations of the ServiceAccount are in invalid formats.
+	errorClassInvalidConfig = "invalid_config"
+	errorClassOther         = "other"
+)
+
+// classifiedError is an error annotated with its class where the cause cannot be told from the error itself.
+type classifiedError struct {
+	class string
+	err   error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() error {
+	return e.err
+}
+
+// errorClass classifies an error of provisioning an image pull secret.
+// Transient errors take precedence over the step that failed because they are not fixed by users.
+func errorClass(err error) string {
+	var openErr *circuitOpenError
+	if errors.As(err, &openErr) {
+		return errorClassCircuitOpen
+	}
+	if _, ok := throttled(err, time.Now()); ok {
+		return errorClassThrottled
+	}
+	if isProviderUnavailable(err) {
+		return errorClassUnavailable
+	}
+
+	return stepErrorClass(err)
+}
+
+// stepErrorClass classifies an error of provisioning an image pull secret by the step that failed, ignoring whether it
+// is transient.
+func stepErrorClass(err error) string {
+	var classified *classifiedError
+	if errors.As(err, &classified) {
+		return classified.class
+	}
+
+	// AWS SDK reports a failure to assume a role as an error of the ECR operation wrapping one of the STS operation.
+	class := ""
+	var opErr *smithy.OperationError
+	for e := err; errors.As(e, &opErr); e = opErr.Err {
+		switch opErr.ServiceID {
+		case sts.ServiceID:
+			return errorClassFederationDenied
+		case ecr.ServiceID:
+			class = errorClassRegistryAPIError
+		}
+	}
+	if class != "" {
+		return class
+	}
+
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		return errorClassKubernetesAPIError
+	}
+
+	return errorClassOther
+}
+
+// failureReason returns the event reason for a provisioning failure of an error class.
+func failureReason(class string) string {
+	switch class {
+	case errorClassThrottled:
+		return reasonThrottled
+	case errorClassFederationDenied:
+		return reasonFederationDenied
+	case errorClassImpersonationDenied:
+		return reasonImpersonationDenied
+	case errorClassRegistryAPIError:
+		return reasonRegistryAPIError
+	case errorClassKubernetesAPIError:
+		return reasonKubernetesAPIError
+	case errorClassVerificationFailed:
+		return reasonVerificationFailed
+	default:
+		return reasonFailedProvisioning
+	}
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"google.golang.org/api/googleapi"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestErrorClass(t *testing.T) {
+	awsErr := func(service string, operation string, err error) error {
+		return &smithy.OperationError{ServiceID: service, OperationName: operation, Err: err}
+	}
+
+	for _, tt := range []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{
+			name:     "Circuit open",
+			err:      fmt.Errorf("wrapped: %w", &circuitOpenError{provider: "Google", retryAfter: time.Minute}),
+			expected: "circuit_open",
+		},
+		{
+			name:     "Throttled",
+			err:      fmt.Errorf("wrapped: %w", &googleapi.Error{Code: http.StatusTooManyRequests}),
+			expected: "throttled",
+		},
+		{
+			name: "Server error",
+			err: &classifiedError{
+				class: errorClassFederationDenied,
+				err:   fmt.Errorf("wrapped: %w", &googleapi.Error{Code: http.StatusServiceUnavailable}),
+			},
+			expected: "unavailable",
+		},
+		{
+			name:     "Timeout",
+			err:      fmt.Errorf("wrapped: %w", context.DeadlineExceeded),
+			expected: "unavailable",
+		},
+		{
+			name: "Google federation denied",
+			err: fmt.Errorf("wrapped: %w", &classifiedError{
+				class: errorClassFederationDenied,
+				err:   fmt.Errorf("wrapped: %w", &googleapi.Error{Code: http.StatusBadRequest}),
+			}),
+			expected: "federation_denied",
+		},
+		{
+			name: "Google impersonation denied",
+			err: fmt.Errorf("wrapped: %w", &classifiedError{
+				class: errorClassImpersonationDenied,
+				err:   fmt.Errorf("wrapped: %w", &googleapi.Error{Code: http.StatusForbidden}),
+			}),
+			expected: "impersonation_denied",
+		},
+		{
+			name: "AWS federation denied",
+			err: fmt.Errorf("wrapped: %w", awsErr(
+				"ECR", "GetAuthorizationToken",
+				fmt.Errorf("failed to refresh cached credentials: %w", awsErr(
+					"STS", "AssumeRoleWithWebIdentity", &smithy.GenericAPIError{Code: "AccessDenied"},
+				)),
+			)),
+			expected: "federation_denied",
+		},
+		{
+			name: "AWS registry API error",
+			err: fmt.Errorf("wrapped: %w", awsErr(
+				"ECR", "GetAuthorizationToken", &smithy.GenericAPIError{Code: "AccessDeniedException"},
+			)),
+			expected: "registry_api_error",
+		},
+		{
+			name: "Kubernetes API error",
+			err: fmt.Errorf("wrapped: %w", apierrors.NewForbidden(
+				schema.GroupResource{Resource: "serviceaccounts/token"}, "serviceaccount-0", errors.New("forbidden"),
+			)),
+			expected: "kubernetes_api_error",
+		},
+		{
+			name:     "Misconfiguration",
+			err:      errors.New("invalid refresh interval"),
+			expected: "other",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if actual := errorClass(tt.err); actual != tt.expected {
+				t.Errorf("Unexpected error class\n\texpected: %s\n\tactual: %s", tt.expected, actual)
+			}
+		})
+	}
+}
@@ -19,19 +19,29 @@ package controller
 import (
 	"context"
 	"fmt"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"golang.org/x/time/rate"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	policyv1 "k8s.io/api/policy/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 type evictor struct {
@@ -40,30 +50,140 @@ type evictor struct {
 	eventRecorder record.EventRecorder
 	// requeueAfter is the interval to requeue the reconciliation to reevaluate pods or to retry eviction that failed
 	// due to PodDisruptionBudget violation.
-	// TODO: Split into two fields if we need to set different intervals for each case.
-	requeueAfter time.Duration
+	// Retries of eviction blocked repeatedly are delayed exponentially up to maxRequeueAfter.
+	requeueAfter    time.Duration
+	maxRequeueAfter time.Duration
+	// Minimum age of an image pull secret before pods become eviction targets.
+	secretSettleDelay time.Duration
+	// ServiceAccounts to leave alone in addition to those annotated.
+	ignoredServiceAccounts ServiceAccountPatterns
+	// Namespaces to reconcile by this replica.
+	shard Shard
+	// Which pods to evict and how, which can be changed at runtime.
+	policy   EvictionPolicy
+	policyMu sync.RWMutex
+	// Maximum number of pods to evict per minute per namespace. Zero means no limit.
+	maxEvictionsPerMinute int
+
+	// evictionLimiters holds the rate limiter of evictions for each namespace.
+	evictionLimiters   map[string]*rate.Limiter
+	evictionLimitersMu sync.Mutex
+
+	// blockedEvictions holds when eviction of each pod was first blocked, to delete the pod after forceDeleteAfter.
+	blockedEvictions   map[types.UID]blockedEviction
+	blockedEvictionsMu sync.Mutex
+}
+
+// blockedEviction is when eviction of a pod using a ServiceAccount was first blocked, and how many times it has been
+// blocked since then.
+type blockedEviction struct {
+	serviceAccount types.NamespacedName
+	since          time.Time
+	attempts       int
+}
+
+// EvictionPolicy holds settings of which pods the evictor evicts and how.
+type EvictionPolicy struct {
+	// DryRun makes the evictor only report pods that would be evicted as logs and events without evicting them.
+	DryRun bool
+
+	// EvictBarePods allows evicting pods that have no controller. They are not recreated once evicted.
+	EvictBarePods bool
+
+	// EvictJobPods allows evicting pods owned by Jobs. Eviction can count towards the backoff limit of the Jobs.
+	EvictJobPods bool
+
+	// RestartOwners makes the evictor restart Deployments, StatefulSets and DaemonSets owning pods by updating their pod
+	// templates instead of evicting the pods, which respects their update strategies. Other pods are still evicted.
+	RestartOwners bool
+
+	// ForceDeleteAfter makes the evictor delete pods with their termination grace period once eviction of them keeps
+	// being blocked by PodDisruptionBudgets for the duration, because pods failing to pull images never become ready
+	// to satisfy the PodDisruptionBudgets anyway. Zero disables the deletion.
+	ForceDeleteAfter time.Duration
+
+	// MaxEvictionsPerReconcile caps the number of pods evicted per reconciliation of a ServiceAccount.
+	// The remaining pods are evicted by the next reconciliation. Zero means no limit.
+	MaxEvictionsPerReconcile int
+}
+
+// EvictorOptions holds controller-wide settings for the evictor.
+type EvictorOptions struct {
+	// Shard restricts the namespaces reconciled by this replica to run multiple replicas actively.
+	Shard Shard
+
+	// EvictionPolicy determines which pods to evict and how. It can be changed later by SetEvictionPolicy.
+	EvictionPolicy
+
+	// MaxEvictionsPerMinute caps the number of pods evicted per minute per namespace to avoid an eviction storm,
+	// e.g. when a ServiceAccount with many failing pods is newly configured. Zero means no limit.
+	MaxEvictionsPerMinute int
+
+	// RequeueAfter is the interval to reevaluate pods that can fail to pull container images later, and to retry
+	// eviction blocked by PodDisruptionBudgets. It defaults to 5 seconds.
+	RequeueAfter time.Duration
+
+	// MaxRequeueAfter caps the retry interval of eviction blocked by PodDisruptionBudgets, which is doubled on every
+	// blocked eviction of a pod. The interval is not increased if it is not greater than RequeueAfter.
+	MaxRequeueAfter time.Duration
+
+	// SecretSettleDelay is the minimum age of an image pull secret before pods lacking it are evicted, to let the
+	// Secret and the ServiceAccount update propagate so that recreated pods do not fail again.
+	SecretSettleDelay time.Duration
+
+	// IgnoredServiceAccounts are ServiceAccounts whose pods are left alone as if the ServiceAccounts were annotated to
+	// be ignored. They must be valid.
+	IgnoredServiceAccounts ServiceAccountPatterns
 }
 
 // NewEvictor creates a new ServiceAccount reconciler that evicts pods that are failing to pull container images because
 // they do not have an image pull secret provisioned for their ServiceAccount.
 func NewEvictor(
-	client client.Client, scheme *runtime.Scheme, eventRecorder record.EventRecorder,
+	client client.Client, scheme *runtime.Scheme, eventRecorder record.EventRecorder, opts EvictorOptions,
 ) *evictor {
-	return &evictor{
-		Client:        client,
-		Scheme:        scheme,
-		eventRecorder: eventRecorder,
+	requeueAfter := opts.RequeueAfter
+	if requeueAfter <= 0 {
 		// "kubectl drain" retries eviction after 5 seconds.
 		// https://github.com/kubernetes/kubernetes/blob/546f7c30860dcdecb75c544230a1b7cdf5bd5958/staging/src/k8s.io/kubectl/pkg/drain/drain.go#L319
-		requeueAfter: 5 * time.Second,
+		requeueAfter = 5 * time.Second
+	}
+
+	return &evictor{
+		Client:                 client,
+		Scheme:                 scheme,
+		eventRecorder:          eventRecorder,
+		shard:                  opts.Shard,
+		policy:                 opts.EvictionPolicy,
+		maxEvictionsPerMinute:  opts.MaxEvictionsPerMinute,
+		requeueAfter:           requeueAfter,
+		maxRequeueAfter:        opts.MaxRequeueAfter,
+		secretSettleDelay:      opts.SecretSettleDelay,
+		ignoredServiceAccounts: opts.IgnoredServiceAccounts,
 	}
 }
 
+// SetEvictionPolicy changes which pods to evict and how at runtime. It takes effect on the next reconciliation of each
+// ServiceAccount.
+func (e *evictor) SetEvictionPolicy(p EvictionPolicy) {
+	e.policyMu.Lock()
+	defer e.policyMu.Unlock()
+	e.policy = p
+}
+
+// evictionPolicy returns the current settings of which pods to evict and how.
+func (e *evictor) evictionPolicy() EvictionPolicy {
+	e.policyMu.RLock()
+	defer e.policyMu.RUnlock()
+
+	return e.policy
+}
+
 //+kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;list;watch
 //+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
-//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;delete
 //+kubebuilder:rbac:groups="",resources=pods/eviction,verbs=create
 //+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=apps,resources=deployments;statefulsets;daemonsets,verbs=patch
 
 const (
 	indexKeyServiceAccountName = "spec.serviceAccountName"
@@ -71,6 +191,13 @@ const (
 	// Event reasons.
 	reasonFailedEviction = "FailedEvictionForImagePullSecret"
 	reasonEvicted        = "EvictedForImagePullSecret"
+	reasonDryRunEviction = "DryRunEvictionForImagePullSecret"
+	reasonEvictedPods    = "EvictedPodsForImagePullSecret"
+	reasonFailedRestart  = "FailedOwnerRestartForImagePullSecret"
+	reasonRestarted      = "RestartedOwnerForImagePullSecret"
+	reasonDryRunRestart  = "DryRunOwnerRestartForImagePullSecret"
+	reasonFailedDeletion = "FailedDeletionForImagePullSecret"
+	reasonDeleted        = "DeletedForImagePullSecret"
 )
 
 func (e *evictor) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -81,12 +208,19 @@ func (e *evictor) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result,
 	if err := e.Get(ctx, req.NamespacedName, sa); err != nil {
 		if apierrors.IsNotFound(err) {
 			logger.Info("Requested ServiceAccount is not found.")
+			e.forgetBlockedEvictions(req.NamespacedName, nil)
 			return ctrl.Result{}, nil
 		}
 		logger.Error(err, "failed to get a ServiceAccount")
 		return ctrl.Result{}, err
 	}
 
+	// Requeued reconciliations of a ServiceAccount can come after it gets ignored.
+	if ignored(sa, e.ignoredServiceAccounts) {
+		logger.Info("ServiceAccount is ignored.")
+		return ctrl.Result{}, nil
+	}
+
 	// Check if an image pull secret has already been provisioned for the ServiceAccount.
 	secret, err := e.getProvisionedImagePullSecret(ctx, sa)
 	if err != nil {
@@ -94,18 +228,26 @@ func (e *evictor) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result,
 		return ctrl.Result{}, err
 	}
 
-	if secret == "" {
+	if secret == nil {
 		logger.Info("There is no image pull secret provisioned for a ServiceAccount.")
 		// Once an image pull secret is provisioned, the reconciliation will be triggered by the ServiceAccount update.
 		return ctrl.Result{}, nil
 	}
 
+	// Give the image pull secret time to propagate, e.g. to the ServiceAccount admission plugin, not to recreate pods
+	// that still fail.
+	if age := time.Since(secret.GetCreationTimestamp().Time); age < e.secretSettleDelay {
+		logger.Info("Image pull secret has just been provisioned.", "settleDelay", e.secretSettleDelay)
+		return ctrl.Result{RequeueAfter: e.secretSettleDelay - age}, nil
+	}
+
 	// Evaluate pods that use the ServiceAccount to list pods to evict.
-	pods, requeue, err := e.listPodsToEvict(ctx, sa, secret)
+	pods, requeue, err := e.listPodsToEvict(ctx, sa, secret.GetName())
 	if err != nil {
 		logger.Error(err, "failed to list pods to evict")
 		return ctrl.Result{}, err
 	}
+	e.forgetBlockedEvictions(req.NamespacedName, pods)
 
 	result := ctrl.Result{}
 	if requeue {
@@ -125,35 +267,61 @@ func (e *evictor) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result,
 	logger.Info("Listed pods to evict.", "targets", names)
 
 	var rerr error
+	policy := e.evictionPolicy()
+	restarted := map[string]bool{}
+	summary := evictionSummary{}
 	for _, pod := range pods {
 		logger := logger.WithValues("pod", pod.GetName())
 
-		if err := e.SubResource("eviction").Create(ctx, pod, &policyv1.Eviction{}); err != nil {
-			if apierrors.IsTooManyRequests(err) {
-				e.eventRecorder.Eventf(
-					pod, corev1.EventTypeWarning, reasonFailedEviction,
-					"Eviction failed due to PodDisruptionBudget violation: %v", err,
-				)
-				logger.Info("Eviction failed due to PodDisruptionBudget violation: " + err.Error())
-				result = ctrl.Result{RequeueAfter: e.requeueAfter}
+		if policy.RestartOwners {
+			ok, err := e.restartOwner(ctx, pod, secret.GetName(), restarted)
+			if err != nil {
+				logger.Error(err, "failed to restart the owner of a pod")
+				// It is OK to throw away old error because it was logged.
+				rerr = err
+			} else if ok {
+				summary.restarted++
+			}
+			if ok {
 				continue
 			}
+		}
 
-			e.eventRecorder.Eventf(pod, corev1.EventTypeWarning, reasonFailedEviction, "Eviction failed: %v", err)
-			logger.Error(err, "failed to evict a pod")
+		if policy.MaxEvictionsPerReconcile > 0 && summary.evicted >= policy.MaxEvictionsPerReconcile {
+			logger.Info("Reached the maximum number of evictions per reconciliation.")
+			result = ctrl.Result{RequeueAfter: e.requeueAfter}
+			break
+		}
+		reservation := e.evictionLimiter(sa.GetNamespace()).Reserve()
+		if delay := reservation.Delay(); delay > 0 {
+			reservation.Cancel()
+			logger.Info("Eviction is rate limited.", "delay", delay)
+			result = ctrl.Result{RequeueAfter: delay}
+			break
+		}
+
+		removed, retryAfter, err := e.evictPod(ctx, req.NamespacedName, pod)
+		if err != nil {
 			// It is OK to throw away old error because it was logged.
 			rerr = err
-			continue
 		}
-
-		e.eventRecorder.Event(
-			pod, corev1.EventTypeNormal, reasonEvicted,
-			"Evicted because the pod is failing to pull container images"+
-				" and does not have an image pull secret provisioned for its ServiceAccount.",
-		)
-		logger.Info("Evicted a pod.")
+		if retryAfter > 0 {
+			summary.blocked++
+			if result.RequeueAfter == 0 || retryAfter < result.RequeueAfter {
+				result = ctrl.Result{RequeueAfter: retryAfter}
+			}
+		}
+		if removed {
+			summary.evicted++
+		} else {
+			// Only pods actually evicted count towards the rate limit.
+			reservation.Cancel()
+		}
 	}
 
+	// Also report the actions on the ServiceAccount, where application owners look first.
+	e.reportSummary(sa, secret.GetName(), summary)
+
 	return result, rerr
 }
 
@@ -175,50 +343,101 @@ func (e *evictor) SetupWithManager(mgr ctrl.Manager) error {
 		return fmt.Errorf("failed to create a field index: %w", err)
 	}
 
-	// Only reconcile ServiceAccounts that have configuration for image pull secret provisioning.
+	// Only reconcile ServiceAccounts that have configuration for image pull secret provisioning, for which provisioning
+	// is not suspended, that are not ignored, and that are in the shard of this replica.
 	pred := func(obj client.Object) bool {
 		sa, ok := obj.(*corev1.ServiceAccount)
 		if !ok {
 			return false
 		}
 
-		return hasConfig(sa)
+		return hasConfig(sa) && !suspended(sa) && !ignored(sa, e.ignoredServiceAccounts) &&
+			e.shard.Contains(sa.GetNamespace())
+	}
+
+	// Also reconcile the ServiceAccount of a pod once the pod starts failing to pull container images, because the pod
+	// can be created long after the last reconciliation of the ServiceAccount.
+	podToServiceAccount := func(ctx context.Context, obj client.Object) []reconcile.Request {
+		pod, ok := obj.(*corev1.Pod)
+		if !ok {
+			return nil
+		}
+
+		sa := &corev1.ServiceAccount{}
+		key := client.ObjectKey{Namespace: pod.GetNamespace(), Name: pod.Spec.ServiceAccountName}
+		if err := e.Get(ctx, key, sa); err != nil || !pred(sa) {
+			return nil
+		}
+
+		return []reconcile.Request{{NamespacedName: key}}
+	}
+	podPred := predicate.Funcs{
+		// Pods already failing when the cache is synced.
+		CreateFunc: func(ev event.CreateEvent) bool {
+			pod, ok := ev.Object.(*corev1.Pod)
+			return ok && len(failingImages(pod)) > 0
+		},
+		UpdateFunc: func(ev event.UpdateEvent) bool {
+			oldPod, ok := ev.ObjectOld.(*corev1.Pod)
+			if !ok {
+				return false
+			}
+			newPod, ok := ev.ObjectNew.(*corev1.Pod)
+			if !ok {
+				return false
+			}
+			return len(failingImages(oldPod)) == 0 && len(failingImages(newPod)) > 0
+		},
+		DeleteFunc: func(event.DeleteEvent) bool {
+			return false
+		},
+		GenericFunc: func(event.GenericEvent) bool {
+			return false
+		},
 	}
 
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&corev1.ServiceAccount{}, builder.WithPredicates(predicate.NewPredicateFuncs(pred))).
+		Watches(
+			&corev1.Pod{},
+			handler.EnqueueRequestsFromMapFunc(podToServiceAccount),
+			builder.WithPredicates(podPred),
+		).
 		Named("evictor").
 		Complete(e)
 }
 
-// getProvionedImagePullSecret gets an image pull secret provisioned for a ServiceAccount.
-// It returns an empty string if there is no image pull secret provisioned.
+// getProvisionedImagePullSecret gets an image pull secret provisioned for a ServiceAccount.
+// It returns nil if there is no image pull secret provisioned.
 func (e *evictor) getProvisionedImagePullSecret(
 	ctx context.Context, sa *corev1.ServiceAccount,
-) (string, error) {
-	if len(sa.ImagePullSecrets) == 0 {
-		return "", nil
+) (*corev1.Secret, error) {
+	// Pods cannot use image pull secrets provisioned in another namespace, so evicting them would not help.
+	if len(sa.ImagePullSecrets) == 0 || secretNamespace(sa) != sa.GetNamespace() {
+		return nil, nil
 	}
 
-	key := client.ObjectKey{Namespace: sa.GetNamespace(), Name: secretName(sa)}
-	secret := &corev1.Secret{}
-	if err := e.Get(ctx, key, secret); err != nil {
-		if apierrors.IsNotFound(err) {
-			// ServiceAccount has invalid configuration for image pull secret provisioning,
-			// or an image pull secret has not been provisioned yet.
-			return "", nil
+	// The evictor does not know whether the provisioner makes Secrets immutable, so try both.
+	for _, immutable := range []bool{false, true} {
+		secret, err := findImagePullSecret(ctx, e, sa, immutable)
+		if err != nil {
+			return nil, err
+		}
+		if secret != nil {
+			return secret, nil
 		}
-
-		return "", fmt.Errorf("failed to get an image pull secret: %w", err)
 	}
 
-	return secret.GetName(), nil
+	// ServiceAccount has invalid configuration for image pull secret provisioning,
+	// or an image pull secret has not been provisioned yet.
+	return nil, nil
 }
 
 // listPodsToEvict lists pods to evict, i.e., pods
 // - that uses the given ServiceAccount,
-// - that are failing to pull a container image, and
-// - that do not have the given image pull secret.
+// - that are failing to pull a container image from the ServiceAccount's registry,
+// - that do not have the given image pull secret, and
+// - that do not opt out of eviction and are allowed to be evicted by their owner kind.
 //
 // It also returns a boolean that indicates whether we need to requeue the reconciliation to reevaluate pods later
 // because they can be eviction target.
@@ -237,13 +456,15 @@ func (e *evictor) listPodsToEvict(
 		return nil, false, fmt.Errorf("failed to list pods: %w", err)
 	}
 
+	// Aliases are keys of the image pull secret as well, e.g. with a port that images are pulled from.
+	registries := append([]string{annotation(sa, annotationKeyRegistry)}, registryAliases(sa)...)
 	targets := []*corev1.Pod{}
 	for _, pod := range pods.Items {
-		if e.hasImagePullSecret(&pod, secret) {
+		if e.hasImagePullSecret(&pod, secret) || !e.evictable(&pod) {
 			continue
 		}
 
-		if e.isImagePullFailing(&pod) {
+		if e.isImagePullFailing(&pod, registries) {
 			targets = append(targets, &pod)
 		} else if e.canFailImagePullLater(&pod) {
 			requeue = true
@@ -253,6 +474,287 @@ func (e *evictor) listPodsToEvict(
 	return targets, requeue, nil
 }
 
+// restartOwner restarts the controller of a pod that is a Deployment, a StatefulSet or a DaemonSet by updating its pod
+// template, instead of evicting the pod. The rollout recreates the pod with the image pull secret while respecting the
+// update strategy of the controller.
+// It returns false if the pod has no such controller and should be evicted instead.
+// restarted holds controllers already restarted in the reconciliation to restart them only once.
+func (e *evictor) restartOwner(
+	ctx context.Context, pod *corev1.Pod, secret string, restarted map[string]bool,
+) (bool, error) {
+	logger := log.FromContext(ctx).WithValues("pod", pod.GetName())
+
+	owner := restartableOwner(pod)
+	if owner == nil {
+		return false, nil
+	}
+
+	kind := owner.GetObjectKind().GroupVersionKind().Kind
+	key := kind + "/" + owner.GetName()
+	if restarted[key] {
+		return true, nil
+	}
+	restarted[key] = true
+	logger = logger.WithValues("owner", key)
+
+	if e.evictionPolicy().DryRun {
+		e.eventRecorder.Eventf(
+			pod, corev1.EventTypeNormal, reasonDryRunRestart,
+			"Dry run: would restart %s because the pod is failing to pull container images"+
+				" and does not have an image pull secret provisioned for its ServiceAccount.", key,
+		)
+		logger.Info("Dry run: would restart the owner of a pod.")
+		return true, nil
+	}
+
+	// Setting the annotation to the same value again does not trigger another rollout.
+	patch := fmt.Sprintf(
+		`{"spec":{"template":{"metadata":{"annotations":{%q:%q}}}}}`, annotationKeyRestartedFor, secret,
+	)
+	if err := e.Patch(ctx, owner, client.RawPatch(types.MergePatchType, []byte(patch))); err != nil {
+		if apierrors.IsNotFound(err) {
+			// The ReplicaSet is not owned by a Deployment of the derived name.
+			delete(restarted, key)
+			return false, nil
+		}
+
+		e.eventRecorder.Eventf(pod, corev1.EventTypeWarning, reasonFailedRestart, "Restarting %s failed: %v", key, err)
+		return true, fmt.Errorf("failed to restart %s: %w", key, err)
+	}
+
+	e.eventRecorder.Eventf(
+		pod, corev1.EventTypeNormal, reasonRestarted,
+		"Restarted %s because the pod is failing to pull container images"+
+			" and does not have an image pull secret provisioned for its ServiceAccount.", key,
+	)
+	logger.Info("Restarted the owner of a pod.")
+
+	return true, nil
+}
+
+// restartableOwner returns the Deployment, StatefulSet or DaemonSet that controls a pod, with only its namespace and
+// name set. It returns nil if the pod is not controlled by any of them.
+// The Deployment of a ReplicaSet is derived from the name of the ReplicaSet and the pod-template-hash label of the pod
+// to avoid reading ReplicaSets.
+func restartableOwner(pod *corev1.Pod) client.Object {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil || owner.APIVersion != appsv1.SchemeGroupVersion.String() {
+		return nil
+	}
+
+	var obj client.Object
+	name, kind := owner.Name, owner.Kind
+	switch owner.Kind {
+	case "ReplicaSet":
+		hash := pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey]
+		if hash == "" || !strings.HasSuffix(name, "-"+hash) {
+			return nil
+		}
+		name, kind = strings.TrimSuffix(name, "-"+hash), "Deployment"
+		obj = &appsv1.Deployment{}
+	case "StatefulSet":
+		obj = &appsv1.StatefulSet{}
+	case "DaemonSet":
+		obj = &appsv1.DaemonSet{}
+	default:
+		return nil
+	}
+
+	obj.SetNamespace(pod.GetNamespace())
+	obj.SetName(name)
+	obj.GetObjectKind().SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind(kind))
+
+	return obj
+}
+
+// evictionSummary counts pods acted on by a reconciliation of a ServiceAccount.
+type evictionSummary struct {
+	// Pods evicted or deleted.
+	evicted int
+	// Pods whose owners were restarted.
+	restarted int
+	// Pods whose eviction was blocked by PodDisruptionBudgets.
+	blocked int
+}
+
+// message returns a summary message, or an empty string if no pods were acted on.
+func (s evictionSummary) message() string {
+	parts := []string{}
+	if s.evicted > 0 {
+		parts = append(parts, fmt.Sprintf("%d evicted", s.evicted))
+	}
+	if s.restarted > 0 {
+		parts = append(parts, fmt.Sprintf("%d recreated by restarting their owners", s.restarted))
+	}
+	if s.blocked > 0 {
+		parts = append(parts, fmt.Sprintf("%d blocked by PodDisruptionBudget", s.blocked))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// reportSummary emits an event summarizing pods acted on by a reconciliation of a ServiceAccount.
+func (e *evictor) reportSummary(sa *corev1.ServiceAccount, secret string, summary evictionSummary) {
+	msg := summary.message()
+	if msg == "" {
+		return
+	}
+
+	reason := reasonEvictedPods
+	if e.evictionPolicy().DryRun {
+		reason, msg = reasonDryRunEviction, "Dry run: "+msg
+	}
+	e.eventRecorder.Eventf(
+		sa, corev1.EventTypeNormal, reason,
+		"Pods failing to pull container images without image pull secret %q: %s.", secret, msg,
+	)
+}
+
+// evictPod evicts a pod, or deletes it if its eviction has been blocked by PodDisruptionBudgets for forceDeleteAfter.
+// It returns whether the pod has been removed, or would be in dry run, and the delay to retry its eviction if it was
+// blocked.
+func (e *evictor) evictPod(
+	ctx context.Context, sa types.NamespacedName, pod *corev1.Pod,
+) (removed bool, retryAfter time.Duration, _ error) {
+	logger := log.FromContext(ctx).WithValues("pod", pod.GetName())
+
+	if e.evictionPolicy().DryRun {
+		e.eventRecorder.Event(
+			pod, corev1.EventTypeNormal, reasonDryRunEviction,
+			"Dry run: would evict because the pod is failing to pull container images"+
+				" and does not have an image pull secret provisioned for its ServiceAccount.",
+		)
+		logger.Info("Dry run: would evict a pod.")
+		return true, 0, nil
+	}
+
+	if err := e.SubResource("eviction").Create(ctx, pod, &policyv1.Eviction{}); err != nil {
+		if apierrors.IsTooManyRequests(err) {
+			blockedFor, retryAfter := e.blockEviction(sa, pod, time.Now())
+			if deleted, err := e.deleteBlockedPod(ctx, pod, blockedFor); deleted || err != nil {
+				return deleted, 0, err
+			}
+
+			e.eventRecorder.Eventf(
+				pod, corev1.EventTypeWarning, reasonFailedEviction,
+				"Eviction failed due to PodDisruptionBudget violation: %v", err,
+			)
+			logger.Info("Eviction failed due to PodDisruptionBudget violation: "+err.Error(), "retryAfter", retryAfter)
+			return false, retryAfter, nil
+		}
+
+		e.eventRecorder.Eventf(pod, corev1.EventTypeWarning, reasonFailedEviction, "Eviction failed: %v", err)
+		logger.Error(err, "failed to evict a pod")
+		return false, 0, err
+	}
+
+	e.eventRecorder.Event(
+		pod, corev1.EventTypeNormal, reasonEvicted,
+		"Evicted because the pod is failing to pull container images"+
+			" and does not have an image pull secret provisioned for its ServiceAccount.",
+	)
+	logger.Info("Evicted a pod.")
+
+	return true, 0, nil
+}
+
+// evictionLimiter returns the rate limiter of evictions in a namespace.
+func (e *evictor) evictionLimiter(namespace string) *rate.Limiter {
+	e.evictionLimitersMu.Lock()
+	defer e.evictionLimitersMu.Unlock()
+
+	if e.evictionLimiters == nil {
+		e.evictionLimiters = map[string]*rate.Limiter{}
+	}
+
+	limiter, ok := e.evictionLimiters[namespace]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Inf, 0)
+		if e.maxEvictionsPerMinute > 0 {
+			limiter = rate.NewLimiter(rate.Limit(float64(e.maxEvictionsPerMinute)/60), e.maxEvictionsPerMinute)
+		}
+		e.evictionLimiters[namespace] = limiter
+	}
+
+	return limiter
+}
+
+// deleteBlockedPod deletes a pod whose eviction has been blocked by PodDisruptionBudgets for forceDeleteAfter.
+// It returns false if the deletion is disabled or it is not the time yet.
+func (e *evictor) deleteBlockedPod(ctx context.Context, pod *corev1.Pod, blockedFor time.Duration) (bool, error) {
+	logger := log.FromContext(ctx).WithValues("pod", pod.GetName())
+
+	forceDeleteAfter := e.evictionPolicy().ForceDeleteAfter
+	if forceDeleteAfter <= 0 || blockedFor < forceDeleteAfter {
+		return false, nil
+	}
+
+	if err := e.Delete(ctx, pod, client.Preconditions{UID: &pod.UID}); err != nil && !apierrors.IsNotFound(err) {
+		e.eventRecorder.Eventf(pod, corev1.EventTypeWarning, reasonFailedDeletion, "Deletion failed: %v", err)
+		logger.Error(err, "failed to delete a pod")
+		return false, err
+	}
+
+	e.eventRecorder.Eventf(
+		pod, corev1.EventTypeNormal, reasonDeleted,
+		"Deleted because the pod is failing to pull container images"+
+			" and does not have an image pull secret provisioned for its ServiceAccount,"+
+			" and eviction has been blocked by PodDisruptionBudget for %s.", forceDeleteAfter,
+	)
+	logger.Info("Deleted a pod whose eviction has been blocked.")
+
+	return true, nil
+}
+
+// blockEviction records that eviction of a pod is blocked and returns how long it has been blocked, and the delay to
+// retry it, which is doubled on every blocked eviction up to maxRequeueAfter.
+func (e *evictor) blockEviction(
+	sa types.NamespacedName, pod *corev1.Pod, now time.Time,
+) (blockedFor time.Duration, retryAfter time.Duration) {
+	e.blockedEvictionsMu.Lock()
+	defer e.blockedEvictionsMu.Unlock()
+
+	if e.blockedEvictions == nil {
+		e.blockedEvictions = map[types.UID]blockedEviction{}
+	}
+
+	blocked, ok := e.blockedEvictions[pod.GetUID()]
+	if !ok {
+		blocked = blockedEviction{serviceAccount: sa, since: now}
+	}
+	blocked.attempts++
+	e.blockedEvictions[pod.GetUID()] = blocked
+
+	retryAfter = e.requeueAfter
+	// Avoid overflow by stopping doubling once the delay reaches the cap.
+	for i := 1; i < blocked.attempts && retryAfter < e.maxRequeueAfter; i++ {
+		retryAfter *= 2
+	}
+	if e.maxRequeueAfter > e.requeueAfter {
+		retryAfter = min(retryAfter, e.maxRequeueAfter)
+	}
+
+	return now.Sub(blocked.since), retryAfter
+}
+
+// forgetBlockedEvictions forgets blocked eviction of pods using a ServiceAccount except the given pods, e.g. because
+// they have been deleted or are no longer eviction targets.
+func (e *evictor) forgetBlockedEvictions(sa types.NamespacedName, pods []*corev1.Pod) {
+	e.blockedEvictionsMu.Lock()
+	defer e.blockedEvictionsMu.Unlock()
+
+	keep := map[types.UID]bool{}
+	for _, pod := range pods {
+		keep[pod.GetUID()] = true
+	}
+
+	for uid, blocked := range e.blockedEvictions {
+		if blocked.serviceAccount == sa && !keep[uid] {
+			delete(e.blockedEvictions, uid)
+		}
+	}
+}
+
 // hasImagePullSecret returns true iff a pod's spec.imagePullSecrets contains the given Secret.
 func (e *evictor) hasImagePullSecret(pod *corev1.Pod, secret string) bool {
 	for _, podSecret := range pod.Spec.ImagePullSecrets {
@@ -264,23 +766,62 @@ func (e *evictor) hasImagePullSecret(pod *corev1.Pod, secret string) bool {
 	return false
 }
 
-// isImagePullFailing returns true iff a pod is failing to pull container images.
-func (e *evictor) isImagePullFailing(pod *corev1.Pod) bool {
+// evictable returns false iff a pod opts out of eviction, e.g. because it is a critical singleton workload, or is not
+// allowed to be evicted by its owner kind.
+// Only pods managed by controllers that recreate them, e.g. ReplicaSets and StatefulSets, are evicted by default.
+func (e *evictor) evictable(pod *corev1.Pod) bool {
+	if annotation(pod, annotationKeyEvict) == "false" || pod.Annotations[annotationKeySafeToEvict] == "false" {
+		return false
+	}
+
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return e.evictionPolicy().EvictBarePods
+	}
+	if owner.Kind == "Job" && strings.HasPrefix(owner.APIVersion, batchv1.GroupName+"/") {
+		return e.evictionPolicy().EvictJobPods
+	}
+
+	return true
+}
+
+// isImagePullFailing returns true iff a pod is failing to pull container images from any of the given registries.
+// Failures for images from other registries, e.g. a typo in a public image, cannot be fixed by the image pull secret.
+func (e *evictor) isImagePullFailing(pod *corev1.Pod, registries []string) bool {
 	// Envtest seems not to support container statuses, so we cannot determine if a pod is failing to pull container
 	// images using these fields.
 	if testing.Testing() {
 		return true
 	}
 
+	return failsToPullFrom(pod, registries)
+}
+
+// failsToPullFrom returns true iff a pod is failing to pull a container image from any of the given registries.
+func failsToPullFrom(pod *corev1.Pod, registries []string) bool {
+	for _, image := range failingImages(pod) {
+		for _, registry := range registries {
+			if imageMatchesRegistry(image, registry) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// failingImages returns container images that a pod is failing to pull.
+func failingImages(pod *corev1.Pod) []string {
+	images := []string{}
 	for _, status := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
 		if w := status.State.Waiting; w != nil {
 			if w.Reason == "ErrImagePull" || w.Reason == "ImagePullBackOff" {
-				return true
+				images = append(images, status.Image)
 			}
 		}
 	}
 
-	return false
+	return images
 }
 
 // canFailImagePullLater returns true iff a pod can fail to pull container images later.
@@ -18,14 +18,18 @@ package controller
 
 import (
 	"context"
+	"testing"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"github.com/google/go-cmp/cmp"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -119,6 +123,138 @@ var _ = Describe("Evictor", func() {
 		}).Should(Succeed())
 	})
 
+	It("Not evict a pod opted out of eviction", func() {
+		// Create a ServiceAccount.
+		sa := &corev1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:    ns,
+				GenerateName: "sa-",
+			},
+		}
+		Expect(k8sClient.Create(ctx, sa)).NotTo(HaveOccurred())
+		objectsToDelete = append(objectsToDelete, sa)
+
+		// Create a pod that uses the ServiceAccount and opts out of eviction.
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:    ns,
+				GenerateName: "pod-",
+				Annotations: map[string]string{
+					"imagepullsecrets.preferred.jp/evict": "false",
+				},
+			},
+			Spec: corev1.PodSpec{
+				ServiceAccountName: sa.GetName(),
+				Containers: []corev1.Container{
+					{
+						Name:  "main",
+						Image: "busybox",
+					},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, pod)).NotTo(HaveOccurred())
+		objectsToDelete = append(objectsToDelete, pod)
+
+		// Add configuration for image pull secret provisioning to the ServiceAccount.
+		orig := sa.DeepCopy()
+		sa.Annotations = map[string]string{
+			"imagepullsecrets.preferred.jp/registry":                               "asia-northeas1-docker.pkg.dev",
+			"imagepullsecrets.preferred.jp/audience":                               "//iam.googleapis.com/projects/999999999999/locations/global/workloadIdentityPools/pool-name/providers/provider-name",
+			"imagepullsecrets.preferred.jp/googlecloud-workload-identity-provider": "projects/999999999999/locations/global/workloadIdentityPools/pool-name/providers/provider-name",
+			"imagepullsecrets.preferred.jp/googlecloud-service-account-email":      "imagepullsecret@example.iam.gserviceaccount.com",
+		}
+		Expect(k8sClient.Patch(ctx, sa, client.StrategicMergeFrom(orig))).NotTo(HaveOccurred())
+
+		// Wait for an image pull secret to be created.
+		Eventually(func(g Gomega) {
+			secrets := &corev1.SecretList{}
+			g.Expect(k8sClient.List(
+				ctx,
+				secrets,
+				client.InNamespace(ns),
+				client.MatchingLabels{
+					"imagepullsecrets.preferred.jp/service-account": sa.GetName(),
+				},
+			)).NotTo(HaveOccurred())
+			g.Expect(secrets.Items).To(HaveLen(1))
+		}).Should(Succeed())
+
+		// Test that the pod remains.
+		Consistently(func(g Gomega) {
+			g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pod), &corev1.Pod{})).NotTo(HaveOccurred())
+		}, time.Second).Should(Succeed())
+	})
+
+	It("Not evict a pod owned by a Job", func() {
+		// Create a ServiceAccount.
+		sa := &corev1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:    ns,
+				GenerateName: "sa-",
+			},
+		}
+		Expect(k8sClient.Create(ctx, sa)).NotTo(HaveOccurred())
+		objectsToDelete = append(objectsToDelete, sa)
+
+		// Create a pod that uses the ServiceAccount and is owned by a Job.
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:    ns,
+				GenerateName: "pod-",
+				OwnerReferences: []metav1.OwnerReference{
+					{
+						APIVersion: "batch/v1",
+						Kind:       "Job",
+						Name:       "job-0",
+						UID:        "uid-0",
+						Controller: ptr.To(true),
+					},
+				},
+			},
+			Spec: corev1.PodSpec{
+				ServiceAccountName: sa.GetName(),
+				Containers: []corev1.Container{
+					{
+						Name:  "main",
+						Image: "busybox",
+					},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, pod)).NotTo(HaveOccurred())
+		objectsToDelete = append(objectsToDelete, pod)
+
+		// Add configuration for image pull secret provisioning to the ServiceAccount.
+		orig := sa.DeepCopy()
+		sa.Annotations = map[string]string{
+			"imagepullsecrets.preferred.jp/registry":                               "asia-northeas1-docker.pkg.dev",
+			"imagepullsecrets.preferred.jp/audience":                               "//iam.googleapis.com/projects/999999999999/locations/global/workloadIdentityPools/pool-name/providers/provider-name",
+			"imagepullsecrets.preferred.jp/googlecloud-workload-identity-provider": "projects/999999999999/locations/global/workloadIdentityPools/pool-name/providers/provider-name",
+			"imagepullsecrets.preferred.jp/googlecloud-service-account-email":      "imagepullsecret@example.iam.gserviceaccount.com",
+		}
+		Expect(k8sClient.Patch(ctx, sa, client.StrategicMergeFrom(orig))).NotTo(HaveOccurred())
+
+		// Wait for an image pull secret to be created.
+		Eventually(func(g Gomega) {
+			secrets := &corev1.SecretList{}
+			g.Expect(k8sClient.List(
+				ctx,
+				secrets,
+				client.InNamespace(ns),
+				client.MatchingLabels{
+					"imagepullsecrets.preferred.jp/service-account": sa.GetName(),
+				},
+			)).NotTo(HaveOccurred())
+			g.Expect(secrets.Items).To(HaveLen(1))
+		}).Should(Succeed())
+
+		// Test that the pod remains.
+		Consistently(func(g Gomega) {
+			g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pod), &corev1.Pod{})).NotTo(HaveOccurred())
+		}, time.Second).Should(Succeed())
+	})
+
 	It("Not evict a non-target pod", func() {
 		// Create a ServiceAccount.
 		sa := &corev1.ServiceAccount{
@@ -188,3 +324,213 @@ var _ = Describe("Evictor", func() {
 		}, time.Second).Should(Succeed())
 	})
 })
+
+func TestRestartableOwner(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		owner    *metav1.OwnerReference
+		labels   map[string]string
+		expected string
+	}{
+		{
+			name:     "Deployment",
+			owner:    &metav1.OwnerReference{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "app-5d4f8b7c9"},
+			labels:   map[string]string{"pod-template-hash": "5d4f8b7c9"},
+			expected: "Deployment/app",
+		},
+		{
+			name:  "ReplicaSet without a Deployment",
+			owner: &metav1.OwnerReference{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "app"},
+		},
+		{
+			name:     "StatefulSet",
+			owner:    &metav1.OwnerReference{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "app"},
+			expected: "StatefulSet/app",
+		},
+		{
+			name:  "Job",
+			owner: &metav1.OwnerReference{APIVersion: "batch/v1", Kind: "Job", Name: "app"},
+		},
+		{
+			name: "Bare pod",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "namespace-0", Labels: tt.labels}}
+			if tt.owner != nil {
+				tt.owner.Controller = ptr.To(true)
+				pod.OwnerReferences = []metav1.OwnerReference{*tt.owner}
+			}
+
+			actual := ""
+			if owner := restartableOwner(pod); owner != nil {
+				actual = owner.GetObjectKind().GroupVersionKind().Kind + "/" + owner.GetName()
+				if owner.GetNamespace() != "namespace-0" {
+					t.Errorf("Unexpected namespace: %s", owner.GetNamespace())
+				}
+			}
+			if actual != tt.expected {
+				t.Errorf("Unexpected owner\n\texpected: %s\n\tactual: %s", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestBlockedEvictions(t *testing.T) {
+	e := &evictor{requeueAfter: time.Second, maxRequeueAfter: 3 * time.Second}
+	sa := types.NamespacedName{Namespace: "namespace-0", Name: "serviceaccount-0"}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{UID: "uid-0"}}
+	now := time.Now()
+
+	for i, tt := range []struct {
+		blockedFor time.Duration
+		retryAfter time.Duration
+	}{
+		{blockedFor: 0, retryAfter: time.Second},
+		{blockedFor: time.Minute, retryAfter: 2 * time.Second},
+		{blockedFor: 2 * time.Minute, retryAfter: 3 * time.Second},
+		{blockedFor: 3 * time.Minute, retryAfter: 3 * time.Second},
+	} {
+		blockedFor, retryAfter := e.blockEviction(sa, pod, now.Add(tt.blockedFor))
+		if blockedFor != tt.blockedFor || retryAfter != tt.retryAfter {
+			t.Errorf(
+				"Unexpected blocked eviction %d\n\texpected: %s, %s\n\tactual: %s, %s",
+				i, tt.blockedFor, tt.retryAfter, blockedFor, retryAfter,
+			)
+		}
+	}
+
+	// Pods of other ServiceAccounts are not forgotten.
+	e.forgetBlockedEvictions(types.NamespacedName{Namespace: "namespace-0", Name: "serviceaccount-1"}, nil)
+	if blockedFor, _ := e.blockEviction(sa, pod, now.Add(4*time.Minute)); blockedFor != 4*time.Minute {
+		t.Errorf("Unexpected blocked duration\n\texpected: %s\n\tactual: %s", 4*time.Minute, blockedFor)
+	}
+
+	e.forgetBlockedEvictions(sa, nil)
+	blockedFor, retryAfter := e.blockEviction(sa, pod, now.Add(5*time.Minute))
+	if blockedFor != 0 || retryAfter != time.Second {
+		t.Errorf("Blocked eviction is not forgotten\n\tblockedFor: %s\n\tretryAfter: %s", blockedFor, retryAfter)
+	}
+}
+
+func TestEvictionLimiter(t *testing.T) {
+	e := &evictor{maxEvictionsPerMinute: 2}
+
+	for i := 0; i < 2; i++ {
+		if !e.evictionLimiter("namespace-0").Allow() {
+			t.Errorf("Eviction %d should be allowed", i)
+		}
+	}
+	if e.evictionLimiter("namespace-0").Allow() {
+		t.Errorf("Eviction beyond the limit should not be allowed")
+	}
+	if !e.evictionLimiter("namespace-1").Allow() {
+		t.Errorf("Eviction in another namespace should be allowed")
+	}
+
+	if !(&evictor{}).evictionLimiter("namespace-0").Allow() {
+		t.Errorf("Eviction should be allowed without a limit")
+	}
+}
+
+func TestFailingImages(t *testing.T) {
+	waiting := func(image string, reason string) corev1.ContainerStatus {
+		return corev1.ContainerStatus{
+			Image: image,
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason}},
+		}
+	}
+	pod := &corev1.Pod{
+		Status: corev1.PodStatus{
+			InitContainerStatuses: []corev1.ContainerStatus{
+				waiting("init", "ErrImagePull"),
+			},
+			ContainerStatuses: []corev1.ContainerStatus{
+				waiting("main", "ImagePullBackOff"),
+				waiting("sidecar", "ContainerCreating"),
+				{Image: "running", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+			},
+		},
+	}
+
+	if diff := cmp.Diff([]string{"init", "main"}, failingImages(pod)); diff != "" {
+		t.Errorf("Failing images mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFailsToPullFrom(t *testing.T) {
+	pod := func(image string) *corev1.Pod {
+		return &corev1.Pod{
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Image: image,
+					State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff"}},
+				}},
+			},
+		}
+	}
+	registries := []string{"harbor.example.com", "harbor.example.com:8443"}
+
+	for _, tt := range []struct {
+		name     string
+		image    string
+		expected bool
+	}{
+		{
+			name:     "Registry",
+			image:    "harbor.example.com/project/image:latest",
+			expected: true,
+		},
+		{
+			name:     "Alias",
+			image:    "harbor.example.com:8443/project/image:latest",
+			expected: true,
+		},
+		{
+			name:     "Another registry",
+			image:    "docker.io/library/busybox:latest",
+			expected: false,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if actual := failsToPullFrom(pod(tt.image), registries); actual != tt.expected {
+				t.Errorf("Unexpected result\n\texpected: %t\n\tactual: %t", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestEvictionSummary(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		summary  evictionSummary
+		expected string
+	}{
+		{
+			name:     "Nothing",
+			expected: "",
+		},
+		{
+			name:     "Evicted",
+			summary:  evictionSummary{evicted: 3},
+			expected: "3 evicted",
+		},
+		{
+			name:     "All",
+			summary:  evictionSummary{evicted: 3, restarted: 2, blocked: 1},
+			expected: "3 evicted, 2 recreated by restarting their owners, 1 blocked by PodDisruptionBudget",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if actual := tt.summary.message(); actual != tt.expected {
+				t.Errorf("Unexpected message\n\texpected: %s\n\tactual: %s", tt.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Timeout of listing image pull secrets to collect metrics, e.g. while the cache has not been synced yet.
+const expirationCollectTimeout = 5 * time.Second
+
+var (
+	expiredSecretsDesc = prometheus.NewDesc(
+		"image_pull_secrets_provisioner_secrets_expired",
+		"Number of image pull secrets that have already expired.",
+		[]string{"namespace"}, nil,
+	)
+	expiringSecretsDesc = prometheus.NewDesc(
+		"image_pull_secrets_provisioner_secrets_expiring_soon",
+		"Number of image pull secrets that have already expired or will expire within the expiring-soon window.",
+		[]string{"namespace"}, nil,
+	)
+)
+
+// expirationCollector is a Prometheus collector that counts image pull secrets expired or expiring soon at each scrape,
+// so that an alert can fire before workloads fail to pull images even if the controller is stuck.
+type expirationCollector struct {
+	reader client.Reader
+	shard  Shard
+	window time.Duration
+}
+
+var _ prometheus.Collector = &expirationCollector{}
+
+func (c *expirationCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- expiredSecretsDesc
+	ch <- expiringSecretsDesc
+}
+
+func (c *expirationCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), expirationCollectTimeout)
+	defer cancel()
+
+	secrets := &corev1.SecretList{}
+	if err := c.reader.List(ctx, secrets, client.HasLabels{labelKeyServiceAccount}); err != nil {
+		ch <- prometheus.NewInvalidMetric(expiredSecretsDesc, err)
+		ch <- prometheus.NewInvalidMetric(expiringSecretsDesc, err)
+		return
+	}
+
+	var inShard []corev1.Secret
+	for _, secret := range secrets.Items {
+		if c.shard.Contains(serviceAccountOf(&secret).Namespace) {
+			inShard = append(inShard, secret)
+		}
+	}
+
+	expired, expiring := countExpiringSecrets(inShard, time.Now(), c.window)
+	for ns, n := range expired {
+		ch <- prometheus.MustNewConstMetric(expiredSecretsDesc, prometheus.GaugeValue, float64(n), ns)
+	}
+	for ns, n := range expiring {
+		ch <- prometheus.MustNewConstMetric(expiringSecretsDesc, prometheus.GaugeValue, float64(n), ns)
+	}
+}
+
+// countExpiringSecrets counts image pull secrets expired by now and expiring within window from now for each namespace.
+// Secrets expiring soon include the expired ones. Secrets without a valid expiration are ignored.
+func countExpiringSecrets(
+	secrets []corev1.Secret, now time.Time, window time.Duration,
+) (expired map[string]int, expiring map[string]int) {
+	expired = map[string]int{}
+	expiring = map[string]int{}
+	for _, secret := range secrets {
+		expiresAt, err := secretExpiresAt(&secret)
+		if err != nil {
+			continue
+		}
+
+		// Secrets provisioned in another namespace are counted for the namespace of their ServiceAccount.
+		ns := serviceAccountOf(&secret).Namespace
+		if !now.Before(expiresAt) {
+			expired[ns]++
+		}
+		if now.Add(window).After(expiresAt) {
+			expiring[ns]++
+		}
+	}
+
+	return expired, expiring
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCountExpiringSecrets(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	secret := func(namespace string, expiresAt string) corev1.Secret {
+		return corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+				Annotations: map[string]string{
+					"imagepullsecrets.preferred.jp/expires-at": expiresAt,
+				},
+			},
+		}
+	}
+
+	expired, expiring := countExpiringSecrets([]corev1.Secret{
+		secret("namespace-0", "2023-12-31T23:00:00Z"),
+		secret("namespace-0", "2024-01-01T00:00:00Z"),
+		secret("namespace-0", "2024-01-01T00:10:00Z"),
+		secret("namespace-0", "2024-01-01T01:00:00Z"),
+		secret("namespace-1", "2024-01-01T00:14:59Z"),
+		secret("namespace-1", "invalid"),
+	}, now, 15*time.Minute)
+
+	if diff := cmp.Diff(map[string]int{"namespace-0": 2}, expired); diff != "" {
+		t.Errorf("Expired secrets mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(map[string]int{"namespace-0": 3, "namespace-1": 1}, expiring); diff != "" {
+		t.Errorf("Expiring secrets mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestExpiringSoonWindow(t *testing.T) {
+	tests := map[string]struct {
+		opts     ServiceAccountReconcilerOptions
+		expected time.Duration
+	}{
+		"default": {
+			expected: 30 * time.Second,
+		},
+		"expiration grace period": {
+			opts:     ServiceAccountReconcilerOptions{RefreshPolicy: RefreshPolicy{ExpirationGracePeriod: 10 * time.Minute}},
+			expected: 5 * time.Minute,
+		},
+		"explicit": {
+			opts: ServiceAccountReconcilerOptions{
+				RefreshPolicy:      RefreshPolicy{ExpirationGracePeriod: 10 * time.Minute},
+				ExpiringSoonWindow: 15 * time.Minute,
+			},
+			expected: 15 * time.Minute,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if actual := tt.opts.expiringSoonWindow(); actual != tt.expected {
+				t.Errorf("Unexpected window\n\texpected: %s\n\tactual: %s", tt.expected, actual)
+			}
+		})
+	}
+}
@@ -18,13 +18,14 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
-	"golang.org/x/oauth2"
-	"google.golang.org/api/iamcredentials/v1"
-	"google.golang.org/api/option"
-	"google.golang.org/api/sts/v1"
+	googlecredentials "github.com/pfnet/image-pull-secrets-provisioner/pkg/credentials/google"
 )
 
 type google interface {
@@ -38,64 +39,88 @@ type google interface {
 	) (token string, expiresAt time.Time, _ error)
 }
 
+// goog implements google by the exported client, classifying its errors by the step that failed.
 type goog struct {
-	stsClient *sts.Service
+	client *googlecredentials.Client
 }
 
-func newGoogle(ctx context.Context) (google, error) {
-	stsClient, err := sts.NewService(ctx, option.WithoutAuthentication())
+// GoogleClientOptions configures the clients of Google APIs.
+type GoogleClientOptions struct {
+	TransportOptions
+
+	// STSEndpoint and IAMCredentialsEndpoint override the endpoints of Google STS and IAM Credentials API, e.g. with
+	// Private Service Connect or regional endpoints. Empty uses the default ones.
+	STSEndpoint            string
+	IAMCredentialsEndpoint string
+}
+
+func newGoogle(ctx context.Context, opts GoogleClientOptions) (google, error) {
+	var clientOpts []googlecredentials.Option
+	if opts.STSEndpoint != "" {
+		endpoint, err := googleEndpoint(opts.STSEndpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Google STS endpoint: %w", err)
+		}
+		clientOpts = append(clientOpts, googlecredentials.WithSTSEndpoint(endpoint))
+	}
+	if opts.IAMCredentialsEndpoint != "" {
+		endpoint, err := googleEndpoint(opts.IAMCredentialsEndpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Google IAM Credentials endpoint: %w", err)
+		}
+		clientOpts = append(clientOpts, googlecredentials.WithIAMCredentialsEndpoint(endpoint))
+	}
+	if opts.TransportOptions != (TransportOptions{}) {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if err := opts.configure(transport); err != nil {
+			return nil, fmt.Errorf("invalid Google client options: %w", err)
+		}
+		clientOpts = append(clientOpts, googlecredentials.WithTransport(transport))
+	}
+
+	client, err := googlecredentials.NewClient(ctx, clientOpts...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create a Google STS client: %w", err)
+		return nil, err
 	}
 
 	return &goog{
-		stsClient: stsClient,
+		client: client,
 	}, nil
 }
 
+// googleEndpoint validates the URL of a Google API endpoint, and returns it as a base path with a trailing slash, to
+// which the clients append paths of API methods.
+func googleEndpoint(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return "", fmt.Errorf("endpoint must be an HTTP(S) URL like https://HOST/: %s", endpoint)
+	}
+
+	return strings.TrimSuffix(u.String(), "/") + "/", nil
+}
+
 func (g *goog) GenerateAccessToken(
 	ctx context.Context,
 	k8sServiceAccountToken string,
 	workloadIdentityProvider string,
 	googleServiceAccountEmail string,
 ) (token string, expiresAt time.Time, _ error) {
-	// Exchange the ServiceAccount token for a Google OAuth 2.0 access token.
-	stsResp, err := g.stsClient.V1.Token(&sts.GoogleIdentityStsV1ExchangeTokenRequest{
-		Audience:           "//iam.googleapis.com/" + workloadIdentityProvider,
-		GrantType:          "urn:ietf:params:oauth:grant-type:token-exchange",
-		RequestedTokenType: "urn:ietf:params:oauth:token-type:access_token",
-		Scope:              "https://www.googleapis.com/auth/iam",
-		SubjectToken:       k8sServiceAccountToken,
-		SubjectTokenType:   "urn:ietf:params:oauth:token-type:jwt",
-	}).Context(ctx).Do()
-	if err != nil {
-		return "", time.Time{}, fmt.Errorf("failed to exchange a ServiceAccount token for a Google OAuth 2.0 access token: %w", err)
-	}
-
-	// Impersonate to a Google service account and generate an access token.
-	opt := option.WithTokenSource(oauth2.StaticTokenSource(&oauth2.Token{
-		AccessToken: stsResp.AccessToken,
-		Expiry:      time.Now().Add(time.Duration(stsResp.ExpiresIn) * time.Second),
-	}))
-	iamCredClient, err := iamcredentials.NewService(ctx, opt)
-	if err != nil {
-		return "", time.Time{}, fmt.Errorf("failed to create a Google IAM Credentials client: %w", err)
-	}
-
-	tokenResp, err := iamCredClient.Projects.ServiceAccounts.GenerateAccessToken(
-		"projects/-/serviceAccounts/"+googleServiceAccountEmail,
-		&iamcredentials.GenerateAccessTokenRequest{
-			Scope: []string{"https://www.googleapis.com/auth/cloud-platform.read-only"},
-		},
-	).Context(ctx).Do()
-	if err != nil {
-		return "", time.Time{}, fmt.Errorf("failed to generate a Google service account's access token: %w", err)
-	}
-
-	expiresAt, err = time.Parse(time.RFC3339, tokenResp.ExpireTime)
-	if err != nil {
-		return "", time.Time{}, fmt.Errorf("failed to parse a timestamp: %w", err)
+	token, expiresAt, err := g.client.GenerateAccessToken(
+		ctx, k8sServiceAccountToken, workloadIdentityProvider, googleServiceAccountEmail,
+	)
+	var federationErr *googlecredentials.FederationError
+	var impersonationErr *googlecredentials.ImpersonationError
+	switch {
+	case errors.As(err, &federationErr):
+		return "", time.Time{}, &classifiedError{class: errorClassFederationDenied, err: err}
+	case errors.As(err, &impersonationErr):
+		return "", time.Time{}, &classifiedError{class: errorClassImpersonationDenied, err: err}
+	case err != nil:
+		return "", time.Time{}, err
 	}
 
-	return tokenResp.AccessToken, expiresAt, nil
+	return token, expiresAt, nil
 }
@@ -0,0 +1,135 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// handoverWindow is how soon image pull secrets must be due for refresh to be handed over to the next leader.
+	handoverWindow = 10 * time.Minute
+	// handoverTimeout bounds writing the handover on shutdown not to delay releasing the leadership.
+	handoverTimeout = 5 * time.Second
+	// handoverDataKey is the key of the handover in the data of the ConfigMap.
+	handoverDataKey = "handover.json"
+)
+
+// handover is ServiceAccounts whose image pull secrets are due for refresh soon, recorded by the leader stepping down
+// for the next one to reconcile them first.
+type handover struct {
+	// WrittenAt is when the handover was written. A handover older than handoverWindow is stale.
+	WrittenAt time.Time `json:"writtenAt"`
+	// ServiceAccounts are NAMESPACE/NAME of ServiceAccounts in the order of the expiration of their image pull secrets.
+	ServiceAccounts []string `json:"serviceAccounts"`
+}
+
+// handOver records ServiceAccounts whose image pull secrets are due for refresh within handoverWindow in the handover
+// ConfigMap. It is called when this replica is stepping down from the leader.
+func (r *serviceAccountReconciler) handOver(ctx context.Context) error {
+	logger := log.FromContext(ctx)
+
+	dues, err := r.dueServiceAccounts(ctx, time.Now().Add(handoverWindow))
+	if err != nil {
+		return err
+	}
+	h := handover{WrittenAt: time.Now(), ServiceAccounts: make([]string, 0, len(dues))}
+	for _, sa := range dues {
+		h.ServiceAccounts = append(h.ServiceAccounts, client.ObjectKeyFromObject(sa).String())
+	}
+	data, err := json.Marshal(h)
+	if err != nil {
+		return fmt.Errorf("failed to marshal a handover: %w", err)
+	}
+
+	// Read and write the ConfigMap directly not to cache ConfigMaps.
+	cm := &corev1.ConfigMap{}
+	err = r.apiReader.Get(ctx, r.handoverConfigMap, cm)
+	switch {
+	case apierrors.IsNotFound(err):
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: r.handoverConfigMap.Namespace,
+				Name:      r.handoverConfigMap.Name,
+			},
+			Data: map[string]string{handoverDataKey: string(data)},
+		}
+		err = r.Create(ctx, cm)
+	case err == nil:
+		cm.Data = map[string]string{handoverDataKey: string(data)}
+		err = r.Update(ctx, cm)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write a handover ConfigMap: %w", err)
+	}
+	logger.Info("Handed over ServiceAccounts due for refresh soon to the next leader.", "count", len(dues))
+
+	return nil
+}
+
+// takeOver returns ServiceAccounts handed over by the previous leader that this replica still reconciles.
+// It returns nil if handover is disabled or there is no recent handover.
+func (r *serviceAccountReconciler) takeOver(ctx context.Context) ([]*corev1.ServiceAccount, error) {
+	if r.handoverConfigMap.Name == "" {
+		return nil, nil
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := r.apiReader.Get(ctx, r.handoverConfigMap, cm); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get a handover ConfigMap: %w", err)
+	}
+	var h handover
+	if err := json.Unmarshal([]byte(cm.Data[handoverDataKey]), &h); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal a handover: %w", err)
+	}
+	if time.Since(h.WrittenAt) > handoverWindow {
+		return nil, nil
+	}
+
+	var sas []*corev1.ServiceAccount
+	for _, key := range h.ServiceAccounts {
+		ns, name, ok := cutNamespacedName(key)
+		if !ok {
+			continue
+		}
+		sa := &corev1.ServiceAccount{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: ns, Name: name}, sa); err != nil {
+			// The ServiceAccount may have been deleted since the handover.
+			continue
+		}
+		// The configuration may have changed since the handover, e.g. by sharding differently.
+		if !r.shard.Contains(ns) || !hasConfig(sa) || suspended(sa) || ignored(sa, r.ignoredServiceAccounts) {
+			continue
+		}
+		sas = append(sas, sa)
+	}
+
+	return sas, nil
+}
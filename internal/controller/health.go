@@ -0,0 +1,39 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// checkReadiness is a readiness check that fails while the controller cannot provision image pull secrets, i.e. a
+// container registry provider seems to be unreachable or provisioning keeps failing for every ServiceAccount.
+// It does not call providers by itself but relies on the results of provisioning, so it never costs their quota.
+func (r *serviceAccountReconciler) checkReadiness(_ *http.Request) error {
+	for _, breaker := range []*circuitBreaker{r.awsBreaker, r.googleBreaker} {
+		if breaker.open() {
+			return fmt.Errorf("%s seems to be unavailable", breaker.provider)
+		}
+	}
+
+	if streak := r.failureStreak.Load(); streak >= int64(r.readinessFailureThreshold) {
+		return fmt.Errorf("failed to provision image pull secrets %d times in a row", streak)
+	}
+
+	return nil
+}
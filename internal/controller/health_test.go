@@ -0,0 +1,55 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCheckReadiness(t *testing.T) {
+	r := &serviceAccountReconciler{
+		awsBreaker:                newCircuitBreaker("test-aws"),
+		googleBreaker:             newCircuitBreaker("test-google"),
+		readinessFailureThreshold: 3,
+	}
+
+	if err := r.checkReadiness(nil); err != nil {
+		t.Errorf("Not ready initially: %v", err)
+	}
+
+	// Test that consecutive failures make the controller not ready.
+	r.failureStreak.Store(3)
+	if err := r.checkReadiness(nil); err == nil {
+		t.Errorf("Ready after consecutive failures")
+	}
+	r.failureStreak.Store(0)
+
+	// Test that an unavailable provider makes the controller not ready.
+	for range r.googleBreaker.failureThreshold {
+		r.googleBreaker.record(context.Background(), context.DeadlineExceeded)
+	}
+	if err := r.checkReadiness(nil); err == nil {
+		t.Errorf("Ready while a provider is unavailable")
+	}
+
+	// Test that the controller gets ready again once the provider recovers.
+	r.googleBreaker.record(context.Background(), nil)
+	if err := r.checkReadiness(nil); err != nil {
+		t.Errorf("Not ready after the provider recovered: %v", err)
+	}
+}
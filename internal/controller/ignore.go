@@ -0,0 +1,61 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ServiceAccountPatterns are glob patterns of ServiceAccounts in the syntax of path.Match, e.g. "builder-*".
+// A pattern is matched against NAMESPACE/NAME if it contains a slash, or NAME otherwise.
+type ServiceAccountPatterns []string
+
+// Validate returns an error if any of the patterns is malformed.
+func (p ServiceAccountPatterns) Validate() error {
+	for _, pattern := range p {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid ServiceAccount pattern %q: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// Match returns true if a ServiceAccount matches any of the patterns.
+func (p ServiceAccountPatterns) Match(sa *corev1.ServiceAccount) bool {
+	for _, pattern := range p {
+		name := sa.GetName()
+		if strings.Contains(pattern, "/") {
+			name = sa.GetNamespace() + "/" + name
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ignored returns true if the controller should leave a ServiceAccount and its image pull secrets alone, e.g. because
+// it is managed by another system and happens to carry conflicting annotations.
+func ignored(sa *corev1.ServiceAccount, patterns ServiceAccountPatterns) bool {
+	return annotation(sa, annotationKeyIgnore) == "true" || patterns.Match(sa)
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestIgnored(t *testing.T) {
+	patterns := ServiceAccountPatterns{"builder-*", "ci/deployer-?"}
+	if err := patterns.Validate(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name        string
+		namespace   string
+		saName      string
+		annotations map[string]string
+		expected    bool
+	}{
+		{name: "Name pattern", namespace: "default", saName: "builder-1", expected: true},
+		{name: "Name pattern in another namespace", namespace: "ci", saName: "builder-1", expected: true},
+		{name: "Namespaced pattern", namespace: "ci", saName: "deployer-1", expected: true},
+		{name: "Namespaced pattern in another namespace", namespace: "default", saName: "deployer-1"},
+		{name: "No match", namespace: "default", saName: "default"},
+		{
+			name:        "Annotation",
+			namespace:   "default",
+			saName:      "default",
+			annotations: map[string]string{annotationKeyIgnore: "true"},
+			expected:    true,
+		},
+		{
+			name:        "Annotation set to false",
+			namespace:   "default",
+			saName:      "default",
+			annotations: map[string]string{annotationKeyIgnore: "false"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			sa := &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{Namespace: tt.namespace, Name: tt.saName, Annotations: tt.annotations},
+			}
+			if actual := ignored(sa, patterns); actual != tt.expected {
+				t.Errorf("Unexpected result\n\texpected: %t\n\tactual: %t", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestServiceAccountPatternsValidate(t *testing.T) {
+	t.Parallel()
+
+	if err := (ServiceAccountPatterns{"builder-[a-"}).Validate(); err == nil {
+		t.Errorf("Malformed pattern was accepted")
+	}
+}
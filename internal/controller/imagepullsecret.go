@@ -17,76 +17,293 @@ limitations under the License.
 package controller
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/pfnet/image-pull-secrets-provisioner/pkg/imagepullsecret"
 )
 
 // buildImagePullSecret builds a Kubernetes Secret definition for an image pull secrets.
 // The built Secret will have
 // - a label to select them by the ServiceAccount name,
-// - an annotation to store the expiration time, and
+// - annotations to store the issuance and expiration time and the hashes of the content and the configuration, and
 // - an owner reference to the ServiceAccount so that they will be deleted when the ServiceAccount no longer exists.
+//
+// Secrets in another namespace than the ServiceAccount have an annotation referring to the ServiceAccount instead of
+// the owner reference, which cannot refer across namespaces.
+//
+// mergedAuths are auth entries of a user-managed Docker config JSON to be included in the Secret as is.
+// The entries for the given registry and its aliases always take precedence over them.
 func buildImagePullSecret(
 	serviceAccount *corev1.ServiceAccount,
 	secretName string,
 	registry string,
 	username string,
 	password string,
+	issuedAt time.Time,
 	expiresAt time.Time,
+	mergedAuths map[string]json.RawMessage,
 ) (*corev1.Secret, error) {
-	type dockerConfigEntry struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
-	}
-
-	type dockerConfigJSON struct {
-		Auths map[string]dockerConfigEntry `json:"auths"`
-	}
-
-	dockerCfg := &dockerConfigJSON{
-		Auths: map[string]dockerConfigEntry{
-			registry: {
-				Username: username,
-				Password: password,
-			},
-		},
-	}
-
-	data, err := json.Marshal(dockerCfg)
+	data, err := imagepullsecret.DockerConfigJSON(
+		registry, username, password, mergedAuths, registryAliases(serviceAccount)...,
+	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal a Docker config JSON: %w", err)
+		return nil, err
 	}
 
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Namespace: serviceAccount.GetNamespace(),
+			Namespace: secretNamespace(serviceAccount),
 			Name:      secretName,
 			Labels: map[string]string{
 				labelKeyServiceAccount: serviceAccount.GetName(),
 			},
 			Annotations: map[string]string{
-				annotationKeyExpiresAt: expiresAt.Format(time.RFC3339),
-			},
-			OwnerReferences: []metav1.OwnerReference{
-				{
-					APIVersion: "v1",
-					Kind:       "ServiceAccount",
-					Name:       serviceAccount.GetName(),
-					UID:        serviceAccount.GetUID(),
-					Controller: ptr.To(true),
-				},
+				annotationKeyIssuedAt:    issuedAt.Format(time.RFC3339),
+				annotationKeyExpiresAt:   expiresAt.Format(time.RFC3339),
+				annotationKeyContentHash: contentHash(data),
+				annotationKeyConfigHash:  configHash(serviceAccount),
 			},
 		},
 		Type: corev1.SecretTypeDockerConfigJson,
-		StringData: map[string]string{
-			corev1.DockerConfigJsonKey: string(data),
+		Data: map[string][]byte{
+			corev1.DockerConfigJsonKey: data,
 		},
 	}
+	if secret.GetNamespace() == serviceAccount.GetNamespace() {
+		secret.OwnerReferences = []metav1.OwnerReference{ownerReference(serviceAccount)}
+	} else {
+		secret.Annotations[annotationKeyServiceAccount] = client.ObjectKeyFromObject(serviceAccount).String()
+	}
+	if requestedAt := annotation(serviceAccount, annotationKeyRefreshRequestedAt); requestedAt != "" {
+		secret.Annotations[annotationKeyRefreshRequestedAt] = requestedAt
+	}
 
 	return secret, nil
 }
+
+// ImagePullSecretSelector returns a label selector that matches image pull secrets provisioned by the controller.
+// The cache for Secrets can be restricted with it because the controller reads other Secrets from the API server.
+func ImagePullSecretSelector() labels.Selector {
+	req, err := labels.NewRequirement(labelKeyServiceAccount, selection.Exists, nil)
+	if err != nil {
+		// The label key is a valid constant.
+		panic(err)
+	}
+
+	return labels.NewSelector().Add(*req)
+}
+
+// ownerReference returns an owner reference to a ServiceAccount for its image pull secrets.
+func ownerReference(sa *corev1.ServiceAccount) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: "v1",
+		Kind:       "ServiceAccount",
+		Name:       sa.GetName(),
+		UID:        sa.GetUID(),
+		Controller: ptr.To(true),
+	}
+}
+
+// isOwnedBy returns true iff a Secret is an image pull secret provisioned for a ServiceAccount.
+func isOwnedBy(secret *corev1.Secret, sa *corev1.ServiceAccount) bool {
+	if _, ok := secret.Labels[labelKeyServiceAccount]; ok && serviceAccountOf(secret) == client.ObjectKeyFromObject(sa) {
+		return true
+	}
+
+	return metav1.IsControlledBy(secret, sa)
+}
+
+// adoptable returns true iff a ServiceAccount allows taking over an existing Secret that it does not own.
+// Secrets in other namespaces are never adopted not to let a ServiceAccount overwrite Secrets of other tenants in a
+// shared namespace, nor are image pull secrets provisioned for other ServiceAccounts.
+func adoptable(secret *corev1.Secret, sa *corev1.ServiceAccount) bool {
+	if annotation(sa, annotationKeyAdopt) != "true" || secret.GetNamespace() != sa.GetNamespace() {
+		return false
+	}
+	if _, ok := secret.Labels[labelKeyServiceAccount]; ok && serviceAccountOf(secret) != client.ObjectKeyFromObject(sa) {
+		return false
+	}
+
+	return true
+}
+
+// serviceAccountOf returns the key of the ServiceAccount that an image pull secret is provisioned for.
+// It is in the namespace of the Secret unless the Secret refers to another namespace by its annotation.
+func serviceAccountOf(secret *corev1.Secret) types.NamespacedName {
+	if ns, name, ok := cutNamespacedName(secret.Annotations[annotationKeyServiceAccount]); ok {
+		return types.NamespacedName{Namespace: ns, Name: name}
+	}
+
+	return types.NamespacedName{Namespace: secret.GetNamespace(), Name: secret.Labels[labelKeyServiceAccount]}
+}
+
+// contentHash returns a hash of the Docker config JSON of an image pull secret.
+func contentHash(dockerConfigJSON []byte) string {
+	sum := sha256.Sum256(dockerConfigJSON)
+	return hex.EncodeToString(sum[:])
+}
+
+// secretExpiresAt returns the expiration time of an image pull secret stored in its annotation.
+func secretExpiresAt(secret *corev1.Secret) (time.Time, error) {
+	str, ok := secret.Annotations[annotationKeyExpiresAt]
+	if !ok {
+		return time.Time{}, fmt.Errorf("%q annotation is missing", annotationKeyExpiresAt)
+	}
+
+	expiresAt, err := parseTimestamp(str)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse %q annotation: %w", annotationKeyExpiresAt, err)
+	}
+
+	return expiresAt, nil
+}
+
+// secretIssuedAt returns the issuance time of an image pull secret stored in its annotation.
+// It returns the zero time if the annotation is missing or invalid, e.g. for Secrets provisioned by older versions.
+func secretIssuedAt(secret *corev1.Secret) time.Time {
+	issuedAt, err := parseTimestamp(secret.Annotations[annotationKeyIssuedAt])
+	if err != nil {
+		return time.Time{}
+	}
+
+	return issuedAt
+}
+
+// parseTimestamp parses a timestamp in RFC 3339 format, tolerating fractional seconds and surrounding whitespace,
+// e.g. of timestamps written by hand or returned by container registry providers with sub-second precision.
+func parseTimestamp(str string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, strings.TrimSpace(str))
+}
+
+// findImagePullSecret finds the image pull secret currently provisioned for a ServiceAccount.
+// If immutable is false, it returns the Secret named by secretName. Otherwise, it returns the immutable Secret with the
+// latest expiration time among those named by immutableSecretName.
+// It returns nil if there is no image pull secret provisioned.
+func findImagePullSecret(
+	ctx context.Context, c client.Reader, sa *corev1.ServiceAccount, immutable bool,
+) (*corev1.Secret, error) {
+	if !immutable {
+		secret := &corev1.Secret{}
+		key := client.ObjectKey{Namespace: secretNamespace(sa), Name: secretName(sa)}
+		if err := c.Get(ctx, key, secret); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, nil
+			}
+
+			return nil, fmt.Errorf("failed to get an image pull secret: %w", err)
+		}
+
+		return secret, nil
+	}
+
+	secrets := &corev1.SecretList{}
+	if err := c.List(
+		ctx,
+		secrets,
+		client.InNamespace(secretNamespace(sa)),
+		client.MatchingLabels{
+			labelKeyServiceAccount: sa.GetName(),
+		},
+	); err != nil {
+		return nil, fmt.Errorf("failed to list image pull secrets: %w", err)
+	}
+
+	var latest *corev1.Secret
+	var latestExpiresAt time.Time
+	prefix := immutableSecretNamePrefix(sa)
+	for _, secret := range secrets.Items {
+		if !ptr.Deref(secret.Immutable, false) || !strings.HasPrefix(secret.GetName(), prefix) ||
+			serviceAccountOf(&secret) != client.ObjectKeyFromObject(sa) {
+			continue
+		}
+
+		// Secrets without a valid expiration are treated as the oldest.
+		expiresAt, _ := secretExpiresAt(&secret)
+		if latest == nil || expiresAt.After(latestExpiresAt) {
+			latest = &secret
+			latestExpiresAt = expiresAt
+		}
+	}
+
+	return latest, nil
+}
+
+// dockerConfigJSONAuths extracts auth entries from a Secret of kubernetes.io/dockerconfigjson type.
+func dockerConfigJSONAuths(secret *corev1.Secret) (map[string]json.RawMessage, error) {
+	if secret.Type != corev1.SecretTypeDockerConfigJson {
+		return nil, fmt.Errorf("unexpected Secret type: %s", secret.Type)
+	}
+
+	dockerCfg := &struct {
+		Auths map[string]json.RawMessage `json:"auths"`
+	}{}
+	if err := json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], dockerCfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal a Docker config JSON: %w", err)
+	}
+
+	return dockerCfg.Auths, nil
+}
+
+// dockerConfigJSONCredentials extracts the username and the password for a registry from an image pull secret.
+func dockerConfigJSONCredentials(secret *corev1.Secret, registry string) (username string, password string, _ error) {
+	auths, err := dockerConfigJSONAuths(secret)
+	if err != nil {
+		return "", "", err
+	}
+
+	var entry struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.Unmarshal(auths[registry], &entry); err != nil {
+		return "", "", fmt.Errorf("failed to unmarshal the auth entry for %s: %w", registry, err)
+	}
+	if entry.Password == "" {
+		return "", "", fmt.Errorf("auth entry for %s has no password", registry)
+	}
+
+	return entry.Username, entry.Password, nil
+}
+
+// imageMatchesRegistry returns true iff an image reference is served by a registry, i.e., a key of a Docker config JSON.
+// The registry can be scoped to a repository path, e.g. "asia-northeast1-docker.pkg.dev/project/repository".
+func imageMatchesRegistry(image string, registry string) bool {
+	registry = strings.TrimPrefix(strings.TrimPrefix(registry, "https://"), "http://")
+	host, path, _ := strings.Cut(strings.TrimSuffix(registry, "/"), "/")
+	if host == "index.docker.io" {
+		// The legacy key for Docker Hub, e.g. "https://index.docker.io/v1/".
+		host, path = "docker.io", ""
+	}
+
+	// An image reference without a domain is pulled from Docker Hub.
+	domain, repository, found := strings.Cut(image, "/")
+	if !found || (!strings.ContainsAny(domain, ".:") && domain != "localhost") {
+		domain, repository = "docker.io", image
+	}
+	if domain != host {
+		return false
+	}
+
+	// Strip the digest and the tag.
+	repository, _, _ = strings.Cut(repository, "@")
+	if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		repository = repository[:i]
+	}
+
+	return path == "" || repository == path || strings.HasPrefix(repository, path+"/")
+}
@@ -27,6 +27,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 func TestBuildImagePullSecret(t *testing.T) {
@@ -40,9 +41,10 @@ func TestBuildImagePullSecret(t *testing.T) {
 	registry := "asia-northeast1-docker.pkg.dev"
 	username := "oauth2accesstoken"
 	password := "0xc0bebeef"
-	expiresAt := time.Now().Add(time.Hour)
+	issuedAt := time.Now()
+	expiresAt := issuedAt.Add(time.Hour)
 
-	actual, err := buildImagePullSecret(sa, "secret-0", registry, username, password, expiresAt)
+	actual, err := buildImagePullSecret(sa, "secret-0", registry, username, password, issuedAt, expiresAt, nil)
 	if err != nil {
 		t.Errorf("Failed to build an image pull secret: %v", err)
 	}
@@ -54,7 +56,10 @@ func TestBuildImagePullSecret(t *testing.T) {
 			"imagepullsecrets.preferred.jp/service-account": "serviceaccount-0",
 		},
 		Annotations: map[string]string{
-			"imagepullsecrets.preferred.jp/expires-at": expiresAt.Format(time.RFC3339),
+			"imagepullsecrets.preferred.jp/issued-at":    issuedAt.Format(time.RFC3339),
+			"imagepullsecrets.preferred.jp/expires-at":   expiresAt.Format(time.RFC3339),
+			"imagepullsecrets.preferred.jp/content-hash": contentHash(actual.Data[corev1.DockerConfigJsonKey]),
+			"imagepullsecrets.preferred.jp/config-hash":  configHash(sa),
 		},
 		OwnerReferences: []metav1.OwnerReference{
 			{
@@ -84,7 +89,7 @@ func TestBuildImagePullSecret(t *testing.T) {
 }`, registry, username, password)
 
 	actualData := &bytes.Buffer{}
-	if err := json.Indent(actualData, []byte(actual.StringData[corev1.DockerConfigJsonKey]), "", "\t"); err != nil {
+	if err := json.Indent(actualData, actual.Data[corev1.DockerConfigJsonKey], "", "\t"); err != nil {
 		t.Fatalf("Failed to indent a JSON: %v", err)
 	}
 
@@ -92,3 +97,339 @@ func TestBuildImagePullSecret(t *testing.T) {
 		t.Errorf("Data mismatch (-want +got):\n%s", diff)
 	}
 }
+
+func TestBuildImagePullSecretWithMergedAuths(t *testing.T) {
+	sa := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "namespace-0",
+			Name:      "serviceaccount-0",
+			UID:       "uid-0",
+		},
+	}
+	registry := "asia-northeast1-docker.pkg.dev"
+	mergedAuths := map[string]json.RawMessage{
+		"registry.example.com": json.RawMessage(`{"auth":"dXNlcjpwYXNz"}`),
+		registry:               json.RawMessage(`{"username":"user","password":"stale"}`),
+	}
+
+	actual, err := buildImagePullSecret(
+		sa, "secret-0", registry, "oauth2accesstoken", "0xc0bebeef", time.Now(), time.Now().Add(time.Hour), mergedAuths,
+	)
+	if err != nil {
+		t.Errorf("Failed to build an image pull secret: %v", err)
+	}
+
+	expectedData := fmt.Sprintf(`{
+	"auths": {
+		"%s": {
+			"username": "oauth2accesstoken",
+			"password": "0xc0bebeef"
+		},
+		"registry.example.com": {
+			"auth": "dXNlcjpwYXNz"
+		}
+	}
+}`, registry)
+
+	actualData := &bytes.Buffer{}
+	if err := json.Indent(actualData, actual.Data[corev1.DockerConfigJsonKey], "", "\t"); err != nil {
+		t.Fatalf("Failed to indent a JSON: %v", err)
+	}
+
+	if diff := cmp.Diff(expectedData, actualData.String()); diff != "" {
+		t.Errorf("Data mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestBuildImagePullSecretInSecretNamespace(t *testing.T) {
+	sa := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "namespace-0",
+			Name:      "serviceaccount-0",
+			UID:       "uid-0",
+			Annotations: map[string]string{
+				"imagepullsecrets.preferred.jp/secret-namespace": "credentials",
+			},
+		},
+	}
+
+	actual, err := buildImagePullSecret(
+		sa, secretName(sa), "asia-northeast1-docker.pkg.dev", "oauth2accesstoken", "0xc0bebeef",
+		time.Now(), time.Now().Add(time.Hour), nil,
+	)
+	if err != nil {
+		t.Errorf("Failed to build an image pull secret: %v", err)
+	}
+
+	if actual.GetNamespace() != "credentials" {
+		t.Errorf("Unexpected namespace\n\texpected: %s\n\tactual: %s", "credentials", actual.GetNamespace())
+	}
+	expectedName := "imagepullsecret-namespace-0-serviceaccount-0-" + replicaOf(client.ObjectKeyFromObject(sa))
+	if actual.GetName() != expectedName {
+		t.Errorf("Unexpected name\n\texpected: %s\n\tactual: %s", expectedName, actual.GetName())
+	}
+	if len(actual.OwnerReferences) > 0 {
+		t.Errorf("Unexpected owner references: %v", actual.OwnerReferences)
+	}
+	if ref := actual.Annotations["imagepullsecrets.preferred.jp/service-account"]; ref != "namespace-0/serviceaccount-0" {
+		t.Errorf("Unexpected reference\n\texpected: %s\n\tactual: %s", "namespace-0/serviceaccount-0", ref)
+	}
+	if !isOwnedBy(actual, sa) {
+		t.Errorf("Image pull secret is not owned by the ServiceAccount")
+	}
+}
+
+func TestSecretExpiresAt(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		name       string
+		annotation string
+		expected   time.Time
+		valid      bool
+	}{
+		{
+			name:       "RFC 3339",
+			annotation: "2024-01-01T00:00:00Z",
+			expected:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			valid:      true,
+		},
+		{
+			name:       "RFC 3339 with fractional seconds",
+			annotation: "2024-01-01T00:00:00.123456789Z",
+			expected:   time.Date(2024, 1, 1, 0, 0, 0, 123456789, time.UTC),
+			valid:      true,
+		},
+		{
+			name:       "RFC 3339 with surrounding whitespace",
+			annotation: " 2024-01-01T09:00:00+09:00\n",
+			expected:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			valid:      true,
+		},
+		{
+			name:       "Invalid",
+			annotation: "2024-01-01",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{annotationKeyExpiresAt: tt.annotation},
+				},
+			}
+			actual, err := secretExpiresAt(secret)
+			if !tt.valid {
+				if err == nil {
+					t.Errorf("Invalid annotation was accepted: %s", actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !actual.Equal(tt.expected) {
+				t.Errorf("Unexpected expiration time\n\texpected: %s\n\tactual: %s", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestIsOwnedBy(t *testing.T) {
+	sa := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "namespace-0",
+			Name:      "serviceaccount-0",
+			UID:       "uid-0",
+		},
+	}
+
+	for _, tt := range []struct {
+		name        string
+		namespace   string
+		labels      map[string]string
+		annotations map[string]string
+		expected    bool
+	}{
+		{
+			name:      "Same namespace",
+			namespace: "namespace-0",
+			labels:    map[string]string{labelKeyServiceAccount: "serviceaccount-0"},
+			expected:  true,
+		},
+		{
+			name:      "Another ServiceAccount",
+			namespace: "namespace-0",
+			labels:    map[string]string{labelKeyServiceAccount: "serviceaccount-1"},
+			expected:  false,
+		},
+		{
+			name:        "Another namespace",
+			namespace:   "credentials",
+			labels:      map[string]string{labelKeyServiceAccount: "serviceaccount-0"},
+			annotations: map[string]string{annotationKeyServiceAccount: "namespace-0/serviceaccount-0"},
+			expected:    true,
+		},
+		{
+			name:        "Same name in another namespace",
+			namespace:   "credentials",
+			labels:      map[string]string{labelKeyServiceAccount: "serviceaccount-0"},
+			annotations: map[string]string{annotationKeyServiceAccount: "namespace-1/serviceaccount-0"},
+			expected:    false,
+		},
+		{
+			name:      "Not provisioned",
+			namespace: "namespace-0",
+			expected:  false,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   tt.namespace,
+					Name:        "secret-0",
+					Labels:      tt.labels,
+					Annotations: tt.annotations,
+				},
+			}
+
+			if actual := isOwnedBy(secret, sa); actual != tt.expected {
+				t.Errorf("Unexpected result\n\texpected: %t\n\tactual: %t", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestAdoptable(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		adopt       string
+		namespace   string
+		labels      map[string]string
+		annotations map[string]string
+		expected    bool
+	}{
+		{
+			name:      "Unmanaged Secret in the same namespace",
+			adopt:     "true",
+			namespace: "namespace-0",
+			expected:  true,
+		},
+		{
+			name:      "Not allowed",
+			namespace: "namespace-0",
+			expected:  false,
+		},
+		{
+			name:      "Another namespace",
+			adopt:     "true",
+			namespace: "credentials",
+			expected:  false,
+		},
+		{
+			name:      "Image pull secret of another ServiceAccount",
+			adopt:     "true",
+			namespace: "namespace-0",
+			labels:    map[string]string{labelKeyServiceAccount: "serviceaccount-1"},
+			expected:  false,
+		},
+		{
+			name:        "Image pull secret of a ServiceAccount in another namespace",
+			adopt:       "true",
+			namespace:   "namespace-0",
+			labels:      map[string]string{labelKeyServiceAccount: "serviceaccount-0"},
+			annotations: map[string]string{annotationKeyServiceAccount: "namespace-1/serviceaccount-0"},
+			expected:    false,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			sa := &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "namespace-0",
+					Name:      "serviceaccount-0",
+					UID:       "uid-0",
+				},
+			}
+			if tt.adopt != "" {
+				sa.Annotations = map[string]string{annotationKeyAdopt: tt.adopt}
+			}
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   tt.namespace,
+					Name:        "secret-0",
+					Labels:      tt.labels,
+					Annotations: tt.annotations,
+				},
+			}
+
+			if actual := adoptable(secret, sa); actual != tt.expected {
+				t.Errorf("Unexpected result\n\texpected: %t\n\tactual: %t", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestImageMatchesRegistry(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		image    string
+		registry string
+		expected bool
+	}{
+		{
+			name:     "Same registry",
+			image:    "asia-northeast1-docker.pkg.dev/project/repository/image:latest",
+			registry: "asia-northeast1-docker.pkg.dev",
+			expected: true,
+		},
+		{
+			name:     "Different registry",
+			image:    "docker.io/library/busybox:latest",
+			registry: "asia-northeast1-docker.pkg.dev",
+			expected: false,
+		},
+		{
+			name:     "Docker Hub without a domain",
+			image:    "busybox",
+			registry: "https://index.docker.io/v1/",
+			expected: true,
+		},
+		{
+			name:     "Registry with a scheme",
+			image:    "999999999999.dkr.ecr.ap-northeast-1.amazonaws.com/image@sha256:0123",
+			registry: "https://999999999999.dkr.ecr.ap-northeast-1.amazonaws.com",
+			expected: true,
+		},
+		{
+			name:     "Registry with a port",
+			image:    "localhost:5000/image",
+			registry: "localhost:5000",
+			expected: true,
+		},
+		{
+			name:     "Matching repository path",
+			image:    "asia-northeast1-docker.pkg.dev/project/repository:latest",
+			registry: "asia-northeast1-docker.pkg.dev/project/repository",
+			expected: true,
+		},
+		{
+			name:     "Different repository path",
+			image:    "asia-northeast1-docker.pkg.dev/project/repository-other/image",
+			registry: "asia-northeast1-docker.pkg.dev/project/repository",
+			expected: false,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if actual := imageMatchesRegistry(tt.image, tt.registry); actual != tt.expected {
+				t.Errorf("Unexpected result\n\texpected: %t\n\tactual: %t", tt.expected, actual)
+			}
+		})
+	}
+}
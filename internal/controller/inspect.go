@@ -0,0 +1,166 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Helpers for tools to inspect and operate image pull secret provisioning from outside the controller, e.g. the kubectl
+// plugin.
+
+// ServiceAccountStatus summarizes image pull secret provisioning for a ServiceAccount.
+type ServiceAccountStatus struct {
+	Provider  string
+	Principal string
+	Registry  string
+	Suspended bool
+
+	// Fields below are recorded by the controller, and zero until it reconciles the ServiceAccount.
+	Secret            string
+	LastProvisionedAt time.Time
+	ExpiresAt         time.Time
+	LastError         string
+	LastErrorAt       time.Time
+}
+
+// InspectServiceAccount returns the status of image pull secret provisioning for a ServiceAccount. ok is false if the
+// ServiceAccount does not have configuration for image pull secret provisioning.
+func InspectServiceAccount(sa *corev1.ServiceAccount) (_ ServiceAccountStatus, ok bool) {
+	if !hasConfig(sa) {
+		return ServiceAccountStatus{}, false
+	}
+
+	recorded := provisioningStatus{}
+	if str, ok := sa.Annotations[annotationKeyStatus]; ok {
+		_ = json.Unmarshal([]byte(str), &recorded)
+	}
+	parse := func(str string) time.Time {
+		t, _ := parseTimestamp(str)
+		return t
+	}
+
+	return ServiceAccountStatus{
+		Provider:          providerName(sa),
+		Principal:         principalName(sa),
+		Registry:          annotation(sa, annotationKeyRegistry),
+		Suspended:         suspended(sa),
+		Secret:            recorded.Secret,
+		LastProvisionedAt: parse(recorded.LastProvisionedAt),
+		ExpiresAt:         parse(recorded.ExpiresAt),
+		LastError:         recorded.LastError,
+		LastErrorAt:       parse(recorded.LastErrorAt),
+	}, true
+}
+
+// RequestRefresh requests the controller to refresh the image pull secret of a ServiceAccount immediately by setting
+// the refresh-requested-at annotation to the current time.
+func RequestRefresh(ctx context.Context, c client.Client, sa *corev1.ServiceAccount) error {
+	if !hasConfig(sa) {
+		return errors.New("ServiceAccount does not have configuration for image pull secret provisioning")
+	}
+
+	orig := sa.DeepCopy()
+	if sa.Annotations == nil {
+		sa.Annotations = map[string]string{}
+	}
+	key := annotationKeyPrefix + strings.TrimPrefix(annotationKeyRefreshRequestedAt, metadataKeyPrefix)
+	sa.Annotations[key] = time.Now().UTC().Format(time.RFC3339)
+	if err := c.Patch(ctx, sa, client.MergeFrom(orig)); err != nil {
+		return fmt.Errorf("failed to patch a ServiceAccount: %w", err)
+	}
+
+	return nil
+}
+
+// CheckServiceAccount validates the configuration of a ServiceAccount, and exchanges a token of the ServiceAccount for
+// credentials of the configured registry without provisioning an image pull secret. The credentials are verified
+// against the registry as well if the ServiceAccount opts in to verification. It returns the expiration time of the
+// credentials.
+func CheckServiceAccount(ctx context.Context, c client.Client, sa *corev1.ServiceAccount) (time.Time, error) {
+	_, _, _, expiresAt, err := exchangeToken(ctx, c, sa)
+
+	return expiresAt, err
+}
+
+// BuildImagePullSecret exchanges a token of a ServiceAccount for credentials of the configured registry once like
+// CheckServiceAccount, and returns an image pull secret of them as the controller would provision, without creating it.
+// Auth entries of the Secret to merge are not included.
+func BuildImagePullSecret(ctx context.Context, c client.Client, sa *corev1.ServiceAccount) (*corev1.Secret, error) {
+	username, password, issuedAt, expiresAt, err := exchangeToken(ctx, c, sa)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := buildImagePullSecret(
+		sa, secretName(sa), annotation(sa, annotationKeyRegistry), username, password, issuedAt, expiresAt, nil,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build image pull secret definition: %w", err)
+	}
+
+	return secret, nil
+}
+
+// exchangeToken validates the configuration of a ServiceAccount, and exchanges a token of the ServiceAccount for
+// credentials of the configured registry outside the controller.
+func exchangeToken(
+	ctx context.Context, c client.Client, sa *corev1.ServiceAccount,
+) (username string, password string, issuedAt time.Time, expiresAt time.Time, _ error) {
+	if !hasConfig(sa) {
+		return "", "", time.Time{}, time.Time{},
+			errors.New("ServiceAccount does not have configuration for image pull secret provisioning")
+	}
+	if err := validateConfig(sa); err != nil {
+		return "", "", time.Time{}, time.Time{}, err
+	}
+	if _, err := refreshInterval(sa); err != nil {
+		return "", "", time.Time{}, time.Time{}, err
+	}
+
+	r, err := newStandaloneReconciler(ctx, c)
+	if err != nil {
+		return "", "", time.Time{}, time.Time{}, err
+	}
+
+	issuedAt = time.Now()
+	username, password, expiresAt, err = r.generateAccessToken(ctx, sa, audiences(sa))
+	if err != nil {
+		return "", "", time.Time{}, time.Time{}, err
+	}
+	if err := r.verifyImagePullSecret(ctx, sa, username, password); err != nil {
+		return "", "", time.Time{}, time.Time{}, err
+	}
+
+	return username, password, issuedAt, expiresAt, nil
+}
+
+// newStandaloneReconciler returns a reconciler only to call container registry providers outside the controller.
+func newStandaloneReconciler(ctx context.Context, c client.Client) (*serviceAccountReconciler, error) {
+	return NewServiceAccountReconciler(ctx, c, c, c.Scheme(), nil, ServiceAccountReconcilerOptions{
+		MaxRetryDelay:   time.Minute,
+		ProviderTimeout: 30 * time.Second,
+	})
+}
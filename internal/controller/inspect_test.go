@@ -0,0 +1,66 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestInspectServiceAccount(t *testing.T) {
+	t.Parallel()
+
+	sa := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				annotationKeyRegistry:   "asia-northeast1-docker.pkg.dev",
+				annotationKeyAudience:   "audience",
+				annotationKeyGoogleWIDP: "projects/0/locations/global/workloadIdentityPools/pool/providers/provider",
+				annotationKeyGoogleSA:   "sa@project.iam.gserviceaccount.com",
+				annotationKeyStatus: `{"provider":"Google","principal":"sa@project.iam.gserviceaccount.com",` +
+					`"secret":"imagepullsecret-0","lastProvisionedAt":"2024-01-01T11:00:00Z",` +
+					`"expiresAt":"2024-01-01T12:00:00Z","lastError":"denied","lastErrorAt":"2024-01-01T10:00:00Z"}`,
+			},
+		},
+	}
+
+	actual, ok := InspectServiceAccount(sa)
+	if !ok {
+		t.Fatalf("ServiceAccount with configuration was not inspected")
+	}
+	expected := ServiceAccountStatus{
+		Provider:          providerGoogle,
+		Principal:         "sa@project.iam.gserviceaccount.com",
+		Registry:          "asia-northeast1-docker.pkg.dev",
+		Secret:            "imagepullsecret-0",
+		LastProvisionedAt: time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC),
+		ExpiresAt:         time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		LastError:         "denied",
+		LastErrorAt:       time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC),
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Errorf("Status mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, ok := InspectServiceAccount(&corev1.ServiceAccount{}); ok {
+		t.Errorf("ServiceAccount without configuration was inspected")
+	}
+}
@@ -16,25 +16,160 @@ limitations under the License.
 
 package controller
 
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
 const (
 	metadataKeyPrefix = "imagepullsecrets.preferred.jp/"
 
 	// Label for Secrets to select them by a ServiceAccount name.
-	labelKeyServiceAccount = metadataKeyPrefix + "service-account"
+	// Secrets provisioned in another namespace than their ServiceAccount cannot have an owner reference to it, so they
+	// store the namespace and the name of the ServiceAccount in the annotation of the same key instead.
+	labelKeyServiceAccount      = metadataKeyPrefix + "service-account"
+	annotationKeyServiceAccount = metadataKeyPrefix + "service-account"
 
 	// Annotations for ServiceAccounts to specify configuration.
 	annotationKeyRegistry = metadataKeyPrefix + "registry"
 	annotationKeyAudience = metadataKeyPrefix + "audience"
+	// Comma-separated alternate keys of the registry in image pull secrets, e.g. with a port or a scheme.
+	annotationKeyRegistryAliases = metadataKeyPrefix + "registry-aliases"
 
 	annotationKeyAWSRoleARN = metadataKeyPrefix + "aws-role-arn"
+	// AWS region overriding the one extracted from the registry, e.g. for a mirror of ECR.
+	annotationKeyAWSRegion = metadataKeyPrefix + "aws-region"
 
 	annotationKeyGoogleWIDP = metadataKeyPrefix + "googlecloud-workload-identity-provider"
 	annotationKeyGoogleSA   = metadataKeyPrefix + "googlecloud-service-account-email"
 
-	annotationKeySecretName = metadataKeyPrefix + "secret-name"
+	annotationKeySecretName      = metadataKeyPrefix + "secret-name"
+	annotationKeySecretNamespace = metadataKeyPrefix + "secret-namespace"
+	annotationKeyAdopt           = metadataKeyPrefix + "adopt"
+	annotationKeySuspend         = metadataKeyPrefix + "suspend"
+	annotationKeyIgnore          = metadataKeyPrefix + "ignore"
+
+	// Annotation for ServiceAccounts to force refreshing image pull secrets whenever its value is changed.
+	// Secrets store the value they are provisioned for under the same key.
+	annotationKeyRefreshRequestedAt = metadataKeyPrefix + "refresh-requested-at"
+
+	// Annotation for ServiceAccounts to track image pull secrets attached by the controller.
+	annotationKeyAttachedSecrets = metadataKeyPrefix + "attached-secrets"
+	// Annotation for ServiceAccounts to record the status of image pull secret provisioning in JSON.
+	annotationKeyStatus = metadataKeyPrefix + "status"
+
+	annotationKeyMergeSecretName = metadataKeyPrefix + "merge-secret-name"
+
+	annotationKeyRefreshInterval = metadataKeyPrefix + "refresh-interval"
+
+	annotationKeyShareAccessToken = metadataKeyPrefix + "share-access-token"
+
+	// Annotation for ServiceAccounts to write their image pull secrets to a secret of AWS Secrets Manager as well.
+	annotationKeyAWSSecretsManagerSecretID = metadataKeyPrefix + "aws-secrets-manager-secret-id"
+
+	annotationKeySecretLabels      = metadataKeyPrefix + "secret-labels"
+	annotationKeySecretAnnotations = metadataKeyPrefix + "secret-annotations"
+
+	// Annotations for ServiceAccounts to verify credentials against the registry before provisioning them, optionally
+	// with a repository to pull from.
+	annotationKeyVerify           = metadataKeyPrefix + "verify"
+	annotationKeyVerifyRepository = metadataKeyPrefix + "verify-repository"
+
+	// Annotation for ServiceAccounts to replicate their image pull secrets to namespaces selected by a label selector.
+	annotationKeyReplicateToNamespaces = metadataKeyPrefix + "replicate-to-namespaces"
+	// Annotation for ServiceAccounts to track the namespaces that their image pull secrets are replicated to.
+	annotationKeyReplicatedTo = metadataKeyPrefix + "replicated-to"
+	// Label for replicas of image pull secrets to select them by a hash of the ServiceAccount they are replicated from.
+	// Replicas store the namespace and the name of the ServiceAccount in the annotation of the same key.
+	labelKeyReplicaOf      = metadataKeyPrefix + "replica-of"
+	annotationKeyReplicaOf = metadataKeyPrefix + "replica-of"
+	// Label for image pull secrets mirrored to remote clusters to select them by a hash of their RemoteTarget.
+	// Mirrors store the namespace and the name of the RemoteTarget in the annotation of the same key.
+	labelKeyRemoteTarget      = metadataKeyPrefix + "remote-target"
+	annotationKeyRemoteTarget = metadataKeyPrefix + "remote-target"
+	// Label for mirrors to store the name of the ServiceAccount in the remote cluster that they are attached to.
+	// It is not labelKeyServiceAccount not to be taken for image pull secrets provisioned in the remote cluster.
+	labelKeyRemoteServiceAccount = metadataKeyPrefix + "remote-service-account"
+	// Finalizer for RemoteTargets to delete their mirrors in the remote cluster.
+	finalizerRemoteTarget = metadataKeyPrefix + "remote-target"
+
+	// Annotation for pods to opt out of eviction by the evictor.
+	annotationKeyEvict = metadataKeyPrefix + "evict"
+	// Annotation for pods to opt out of eviction by the cluster autoscaler, which the evictor also honors.
+	annotationKeySafeToEvict = "cluster-autoscaler.kubernetes.io/safe-to-evict"
+	// Annotation for pod templates of controllers restarted by the evictor to store the image pull secret to roll out.
+	annotationKeyRestartedFor = metadataKeyPrefix + "restarted-for"
 
-	// Annotation for Secrets to store the expiration time.
+	// Annotations for Secrets to store the issuance and expiration time.
+	annotationKeyIssuedAt  = metadataKeyPrefix + "issued-at"
 	annotationKeyExpiresAt = metadataKeyPrefix + "expires-at"
+	// Annotation for Secrets to store the hash of their content to detect external modifications.
+	annotationKeyContentHash = metadataKeyPrefix + "content-hash"
+	// Annotation for Secrets to store the hash of the ServiceAccount's configuration they are provisioned for.
+	annotationKeyConfigHash = metadataKeyPrefix + "config-hash"
+	// Annotation for Secrets to store the resource version of a merged user-managed Secret.
+	annotationKeyMergedSecretVersion = metadataKeyPrefix + "merged-secret-version"
+
+	// Annotation for default ServiceAccounts to record that the namespace reconciler configured them once, not to add
+	// the configuration again after users remove it.
+	annotationKeyDefaultConfigured = metadataKeyPrefix + "default-configured"
+
+	// Annotation for SecretProviderClassPodStatuses to store when the image pull secret was written to secret stores.
+	annotationKeyRotationRequestedAt = metadataKeyPrefix + "rotation-requested-at"
 
 	fieldManager = "image-pull-secrets-provisioner"
 )
+
+// annotationKeyPrefix is a custom prefix of annotation keys for users to configure ServiceAccounts and pods with,
+// honored in addition to metadataKeyPrefix, e.g. to migrate to a company domain.
+// Metadata managed by the controller itself keeps metadataKeyPrefix because the controller finds its Secrets by it.
+var annotationKeyPrefix = metadataKeyPrefix
+
+// SetAnnotationKeyPrefix sets a custom prefix of annotation keys for users to configure ServiceAccounts and pods with,
+// e.g. "imagepullsecrets.example.com/". Annotations with the default prefix are still honored, but those with the
+// custom prefix take precedence. Labels and annotations written by the controller, e.g. on image pull secrets, are not
+// affected. It must be called before the controllers start.
+func SetAnnotationKeyPrefix(prefix string) error {
+	if err := ValidateKeyPrefix(prefix); err != nil {
+		return err
+	}
+
+	annotationKeyPrefix = prefix
+
+	return nil
+}
+
+// ValidateKeyPrefix validates a prefix of label and annotation keys like "imagepullsecrets.example.com/".
+func ValidateKeyPrefix(prefix string) error {
+	domain, ok := strings.CutSuffix(prefix, "/")
+	if !ok {
+		return fmt.Errorf("key prefix must end with a slash: %q", prefix)
+	}
+	if errs := validation.IsDNS1123Subdomain(domain); len(errs) > 0 {
+		return fmt.Errorf("invalid key prefix %q: %s", prefix, strings.Join(errs, ", "))
+	}
+
+	return nil
+}
+
+// lookupAnnotation returns the value of the annotation of an object for the given key with metadataKeyPrefix.
+// The annotation with the custom prefix takes precedence if present.
+func lookupAnnotation(obj metav1.Object, key string) (string, bool) {
+	annotations := obj.GetAnnotations()
+	if v, ok := annotations[annotationKeyPrefix+strings.TrimPrefix(key, metadataKeyPrefix)]; ok {
+		return v, true
+	}
+	v, ok := annotations[key]
+
+	return v, ok
+}
+
+// annotation returns the value of the annotation of an object like lookupAnnotation, or an empty string if absent.
+func annotation(obj metav1.Object, key string) string {
+	v, _ := lookupAnnotation(obj, key)
+
+	return v
+}
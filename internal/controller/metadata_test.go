@@ -0,0 +1,87 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Not parallel because it changes the package-wide prefix.
+func TestAnnotationKeyPrefix(t *testing.T) {
+	if err := SetAnnotationKeyPrefix("imagepullsecrets.example.com/"); err != nil {
+		t.Fatalf("Failed to set the annotation key prefix: %v", err)
+	}
+	t.Cleanup(func() {
+		annotationKeyPrefix = metadataKeyPrefix
+	})
+
+	for _, tt := range []struct {
+		name        string
+		annotations map[string]string
+		expected    string
+	}{
+		{
+			name:        "Default prefix",
+			annotations: map[string]string{"imagepullsecrets.preferred.jp/registry": "registry-0"},
+			expected:    "registry-0",
+		},
+		{
+			name:        "Custom prefix",
+			annotations: map[string]string{"imagepullsecrets.example.com/registry": "registry-1"},
+			expected:    "registry-1",
+		},
+		{
+			name: "Custom prefix takes precedence",
+			annotations: map[string]string{
+				"imagepullsecrets.preferred.jp/registry": "registry-0",
+				"imagepullsecrets.example.com/registry":  "registry-1",
+			},
+			expected: "registry-1",
+		},
+		{
+			name:        "Neither",
+			annotations: map[string]string{"example.com/registry": "registry-2"},
+			expected:    "",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			if actual := annotation(sa, annotationKeyRegistry); actual != tt.expected {
+				t.Errorf("Unexpected annotation\n\texpected: %s\n\tactual: %s", tt.expected, actual)
+			}
+		})
+	}
+
+	// Keys with the custom prefix are reserved as well as those with the default one.
+	for _, key := range []string{"imagepullsecrets.preferred.jp/registry", "imagepullsecrets.example.com/registry"} {
+		if err := validateLabels(map[string]string{key: "registry-0"}); err == nil {
+			t.Errorf("Reserved label key %q was accepted", key)
+		}
+		if err := validateAnnotations(map[string]string{key: "registry-0"}); err == nil {
+			t.Errorf("Reserved annotation key %q was accepted", key)
+		}
+	}
+
+	for _, prefix := range []string{"imagepullsecrets.example.com", "Example.com/", "/"} {
+		if err := SetAnnotationKeyPrefix(prefix); err == nil {
+			t.Errorf("Invalid prefix %q was accepted", prefix)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var consecutiveFailures = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "image_pull_secrets_provisioner_consecutive_failures",
+		Help: "Number of consecutive failures to provision an image pull secret for a ServiceAccount.",
+	},
+	[]string{"namespace", "service_account"},
+)
+
+var circuitBreakerOpen = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "image_pull_secrets_provisioner_circuit_breaker_open",
+		Help: "Whether calls to a container registry provider are suspended because it seems to be unavailable.",
+	},
+	[]string{"provider"},
+)
+
+// Operations on image pull secrets counted by secretOperations.
+const (
+	secretOperationProvisioned = "provisioned"
+	secretOperationRefreshed   = "refreshed"
+	secretOperationDeleted     = "deleted"
+)
+
+var secretOperations = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "image_pull_secrets_provisioner_secret_operations_total",
+		Help: "Number of image pull secrets provisioned, refreshed, or deleted by the controller.",
+	},
+	[]string{"provider", "namespace", "operation"},
+)
+
+var tokenExchangeDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "image_pull_secrets_provisioner_token_exchange_duration_seconds",
+		Help:    "Latency of calls to a container registry provider to exchange a ServiceAccount token for an access token.",
+		Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	},
+	[]string{"provider"},
+)
+
+var provisioningFailures = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "image_pull_secrets_provisioner_provisioning_failures_total",
+		Help: "Number of failures to provision an image pull secret.",
+	},
+	[]string{"provider", "class"},
+)
+
+var secretExpiration = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "image_pull_secrets_provisioner_secret_expiration_timestamp_seconds",
+		Help: "Expiration time of the image pull secret in use for a ServiceAccount in seconds since the Unix epoch.",
+	},
+	[]string{"namespace", "service_account"},
+)
+
+var registryProbeSuccess = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "image_pull_secrets_provisioner_registry_probe_success",
+		Help: "Whether a registry accepted the credentials of a representative image pull secret on the last probe.",
+	},
+	[]string{"registry"},
+)
+
+var tokenRequests = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "image_pull_secrets_provisioner_token_requests_total",
+		Help: "Number of ServiceAccount tokens requested to exchange for access tokens, or skipped because no container" +
+			" registry provider would be called.",
+	},
+	[]string{"audience", "result"},
+)
+
+var tokenRequestDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "image_pull_secrets_provisioner_token_request_duration_seconds",
+		Help:    "Latency of TokenRequests to the Kubernetes API server to create ServiceAccount tokens.",
+		Buckets: []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5},
+	},
+	[]string{"audience"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		consecutiveFailures,
+		circuitBreakerOpen,
+		secretOperations,
+		tokenExchangeDuration,
+		provisioningFailures,
+		secretExpiration,
+		registryProbeSuccess,
+		tokenRequests,
+		tokenRequestDuration,
+	)
+}
+
+// recordSecretExpiration records the expiration time of the image pull secret in use for a ServiceAccount.
+// It removes the record if secret is nil or has no valid expiration time.
+func recordSecretExpiration(sa types.NamespacedName, secret *corev1.Secret) {
+	if secret == nil {
+		secretExpiration.DeleteLabelValues(sa.Namespace, sa.Name)
+		return
+	}
+
+	expiresAt, err := secretExpiresAt(secret)
+	if err != nil {
+		secretExpiration.DeleteLabelValues(sa.Namespace, sa.Name)
+		return
+	}
+	secretExpiration.WithLabelValues(sa.Namespace, sa.Name).Set(float64(expiresAt.Unix()))
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MigratedKey is a label or annotation key rewritten by MigrateServiceAccountKeys or MigrateSecretKeys.
+type MigratedKey struct {
+	// Label is true for a label, and false for an annotation.
+	Label bool
+	From  string
+	To    string
+	// Conflicting is true if the object already had the new key, whose value is kept instead of the old one.
+	Conflicting bool
+}
+
+// Annotations of ServiceAccounts recorded by the controller, which keep metadataKeyPrefix.
+var managedServiceAccountAnnotationKeys = []string{
+	annotationKeyAttachedSecrets,
+	annotationKeyStatus,
+	annotationKeyReplicatedTo,
+}
+
+// MigrateServiceAccountKeys rewrites labels and annotations of a ServiceAccount with another prefix, e.g. of an
+// annotation key prefix previously passed to the controller, to the keys honored by the controller.
+// Annotations to configure the ServiceAccount get the custom annotation key prefix, and those recorded by the
+// controller and labels get the default one. It returns the rewritten keys.
+func MigrateServiceAccountKeys(sa metav1.Object, fromPrefix string) []MigratedKey {
+	return migrateKeys(sa, fromPrefix, func(name string) string {
+		if slices.Contains(managedServiceAccountAnnotationKeys, metadataKeyPrefix+name) {
+			return metadataKeyPrefix
+		}
+		return annotationKeyPrefix
+	})
+}
+
+// MigrateSecretKeys rewrites labels and annotations of an image pull secret provisioned with another prefix, e.g. by a
+// fork of the controller, to the keys recognized by the controller, i.e. with the default prefix. It returns the
+// rewritten keys.
+func MigrateSecretKeys(secret metav1.Object, fromPrefix string) []MigratedKey {
+	return migrateKeys(secret, fromPrefix, func(string) string { return metadataKeyPrefix })
+}
+
+// migrateKeys rewrites labels and annotations of an object from fromPrefix to the prefix returned by
+// annotationPrefix for the name of each annotation. Labels always get metadataKeyPrefix.
+// The old keys are removed even if the new ones are already present, in which case the values of the new ones are kept.
+func migrateKeys(obj metav1.Object, fromPrefix string, annotationPrefix func(name string) string) []MigratedKey {
+	var migrated []MigratedKey
+
+	rewrite := func(m map[string]string, label bool, prefix func(name string) string) {
+		// Iterate in a stable order to report changes deterministically.
+		keys := make([]string, 0, len(m))
+		for key := range m {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, from := range keys {
+			name, ok := strings.CutPrefix(from, fromPrefix)
+			if !ok {
+				continue
+			}
+			to := prefix(name) + name
+			if to == from {
+				continue
+			}
+
+			_, conflicting := m[to]
+			if !conflicting {
+				m[to] = m[from]
+			}
+			delete(m, from)
+			migrated = append(migrated, MigratedKey{Label: label, From: from, To: to, Conflicting: conflicting})
+		}
+	}
+
+	if labels := obj.GetLabels(); labels != nil {
+		rewrite(labels, true, func(string) string { return metadataKeyPrefix })
+		obj.SetLabels(labels)
+	}
+	if annotations := obj.GetAnnotations(); annotations != nil {
+		rewrite(annotations, false, annotationPrefix)
+		obj.SetAnnotations(annotations)
+	}
+
+	return migrated
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMigrateServiceAccountKeys(t *testing.T) {
+	sa := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{
+				"imagepullsecrets.example.com/team": "a",
+			},
+			Annotations: map[string]string{
+				"imagepullsecrets.example.com/registry":          "asia-northeast1-docker.pkg.dev",
+				"imagepullsecrets.example.com/status":            "{}",
+				"imagepullsecrets.example.com/suspend":           "true",
+				"imagepullsecrets.preferred.jp/suspend":          "false",
+				"imagepullsecrets.preferred.jp/attached-secrets": "sa-0",
+				"example.com/other":                              "value",
+			},
+		},
+	}
+
+	migrated := MigrateServiceAccountKeys(sa, "imagepullsecrets.example.com/")
+
+	expected := []MigratedKey{
+		{Label: true, From: "imagepullsecrets.example.com/team", To: "imagepullsecrets.preferred.jp/team"},
+		{From: "imagepullsecrets.example.com/registry", To: "imagepullsecrets.preferred.jp/registry"},
+		{From: "imagepullsecrets.example.com/status", To: "imagepullsecrets.preferred.jp/status"},
+		{From: "imagepullsecrets.example.com/suspend", To: "imagepullsecrets.preferred.jp/suspend", Conflicting: true},
+	}
+	if !reflect.DeepEqual(migrated, expected) {
+		t.Errorf("Unexpected migrated keys\n\texpected: %+v\n\tactual: %+v", expected, migrated)
+	}
+	expectedAnnotations := map[string]string{
+		"imagepullsecrets.preferred.jp/registry":         "asia-northeast1-docker.pkg.dev",
+		"imagepullsecrets.preferred.jp/status":           "{}",
+		"imagepullsecrets.preferred.jp/suspend":          "false",
+		"imagepullsecrets.preferred.jp/attached-secrets": "sa-0",
+		"example.com/other":                              "value",
+	}
+	if !reflect.DeepEqual(sa.Annotations, expectedAnnotations) {
+		t.Errorf("Unexpected annotations\n\texpected: %v\n\tactual: %v", expectedAnnotations, sa.Annotations)
+	}
+	expectedLabels := map[string]string{"imagepullsecrets.preferred.jp/team": "a"}
+	if !reflect.DeepEqual(sa.Labels, expectedLabels) {
+		t.Errorf("Unexpected labels\n\texpected: %v\n\tactual: %v", expectedLabels, sa.Labels)
+	}
+}
+
+func TestMigrateSecretKeys(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{
+				"imagepullsecrets.example.com/service-account": "sa",
+			},
+			Annotations: map[string]string{
+				"imagepullsecrets.example.com/expires-at": "2024-01-01T00:00:00Z",
+			},
+		},
+	}
+
+	migrated := MigrateSecretKeys(secret, "imagepullsecrets.example.com/")
+
+	expected := []MigratedKey{
+		{Label: true, From: "imagepullsecrets.example.com/service-account", To: labelKeyServiceAccount},
+		{From: "imagepullsecrets.example.com/expires-at", To: annotationKeyExpiresAt},
+	}
+	if !reflect.DeepEqual(migrated, expected) {
+		t.Errorf("Unexpected migrated keys\n\texpected: %+v\n\tactual: %+v", expected, migrated)
+	}
+	if secret.Labels[labelKeyServiceAccount] != "sa" || secret.Annotations[annotationKeyExpiresAt] == "" {
+		t.Errorf("Keys should be rewritten: %v, %v", secret.Labels, secret.Annotations)
+	}
+
+	if migrated := MigrateSecretKeys(secret, metadataKeyPrefix); len(migrated) != 0 {
+		t.Errorf("Keys already with the default prefix should not be rewritten: %+v", migrated)
+	}
+}
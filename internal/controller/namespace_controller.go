@@ -0,0 +1,225 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+type namespaceReconciler struct {
+	client.Client
+	// Reader not backed by the cache, which may not have the default ServiceAccounts.
+	apiReader     client.Reader
+	eventRecorder record.EventRecorder
+	// Namespaces whose default ServiceAccounts are configured.
+	selector labels.Selector
+	// Annotations to configure the default ServiceAccounts with.
+	annotations map[string]string
+	// ServiceAccounts to leave alone as if they were annotated to be ignored.
+	ignoredServiceAccounts ServiceAccountPatterns
+	// Namespaces to reconcile by this replica.
+	shard Shard
+	// Whether to only report the changes that would be made without mutating the cluster.
+	dryRun bool
+}
+
+// NamespaceReconcilerOptions holds controller-wide settings for the namespace reconciler.
+type NamespaceReconcilerOptions struct {
+	// Selector selects namespaces whose default ServiceAccounts are configured. Nil selects all namespaces.
+	Selector labels.Selector
+
+	// Annotations are the configuration for image pull secret provisioning, e.g. the registry and the principal to
+	// federate to, added to the default ServiceAccounts.
+	Annotations map[string]string
+
+	// IgnoredServiceAccounts are ServiceAccounts not to configure as if they were annotated to be ignored.
+	IgnoredServiceAccounts ServiceAccountPatterns
+
+	// Shard restricts the namespaces reconciled by this replica to run multiple replicas actively.
+	Shard Shard
+
+	// DryRun makes the reconciler only report the changes that it would make as logs and events.
+	DryRun bool
+}
+
+// NewNamespaceReconciler creates a new namespace reconciler that configures the default ServiceAccount of each
+// namespace for image pull secret provisioning, so that pods in new namespaces can pull images from the beginning.
+// The ServiceAccount reconciler then provisions image pull secrets for them.
+func NewNamespaceReconciler(
+	client client.Client, apiReader client.Reader, eventRecorder record.EventRecorder, opts NamespaceReconcilerOptions,
+) (*namespaceReconciler, error) {
+	if !hasConfig(&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Annotations: opts.Annotations}}) {
+		return nil, errors.New("annotations for default ServiceAccounts lack configuration for provisioning")
+	}
+	if err := opts.IgnoredServiceAccounts.Validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.Shard.Validate(); err != nil {
+		return nil, err
+	}
+
+	selector := opts.Selector
+	if selector == nil {
+		selector = labels.Everything()
+	}
+
+	return &namespaceReconciler{
+		Client:                 client,
+		apiReader:              apiReader,
+		eventRecorder:          eventRecorder,
+		selector:               selector,
+		annotations:            opts.Annotations,
+		ignoredServiceAccounts: opts.IgnoredServiceAccounts,
+		shard:                  opts.Shard,
+		dryRun:                 opts.DryRun,
+	}, nil
+}
+
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;patch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+const (
+	// Event reasons.
+	reasonConfiguredDefaultServiceAccount = "ConfiguredImagePullSecretProvisioning"
+)
+
+func (r *namespaceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	ns := &corev1.Namespace{}
+	if err := r.Get(ctx, client.ObjectKey{Name: req.Name}, ns); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "failed to get a namespace")
+		return ctrl.Result{}, err
+	}
+	if ns.Status.Phase == corev1.NamespaceTerminating || !r.selector.Matches(labels.Set(ns.GetLabels())) {
+		return ctrl.Result{}, nil
+	}
+
+	sa := &corev1.ServiceAccount{}
+	key := client.ObjectKey{Namespace: ns.GetName(), Name: defaultServiceAccountName}
+	if err := r.apiReader.Get(ctx, key, sa); err != nil {
+		if apierrors.IsNotFound(err) {
+			// The default ServiceAccount is created shortly after the namespace. Its creation is not observed if it
+			// is not selected by the cache, so check it again later with the backoff of the workqueue, not to poll
+			// forever at a fixed interval if it never appears.
+			logger.Info("Default ServiceAccount does not exist yet.")
+			return ctrl.Result{Requeue: true}, nil
+		}
+		logger.Error(err, "failed to get the default ServiceAccount")
+		return ctrl.Result{}, err
+	}
+
+	orig := sa.DeepCopy()
+	if !configureServiceAccount(sa, r.annotations, r.ignoredServiceAccounts) {
+		return ctrl.Result{}, nil
+	}
+
+	if r.dryRun {
+		r.eventRecorder.Event(
+			sa, corev1.EventTypeNormal, reasonDryRun,
+			"Dry run: would configure the ServiceAccount for image pull secret provisioning",
+		)
+		logger.Info("Dry run: would configure the default ServiceAccount.")
+		return ctrl.Result{}, nil
+	}
+
+	if err := r.Patch(
+		ctx, sa, client.MergeFromWithOptions(orig, client.MergeFromWithOptimisticLock{}), client.FieldOwner(fieldManager),
+	); err != nil {
+		logger.Error(err, "failed to patch the default ServiceAccount")
+		return ctrl.Result{}, fmt.Errorf("failed to patch a ServiceAccount: %w", err)
+	}
+	r.eventRecorder.Event(
+		sa, corev1.EventTypeNormal, reasonConfiguredDefaultServiceAccount,
+		"Configured the ServiceAccount for image pull secret provisioning",
+	)
+	logger.Info("Configured the default ServiceAccount.")
+
+	return ctrl.Result{}, nil
+}
+
+// configureServiceAccount adds annotations for image pull secret provisioning to a ServiceAccount unless it already has
+// configuration, which takes precedence. It returns false if the ServiceAccount is left as it is.
+// ServiceAccounts are configured only once, so that users can remove the configuration, and never while they are
+// ignored or provisioning for them is suspended.
+func configureServiceAccount(
+	sa *corev1.ServiceAccount, annotations map[string]string, ignoredServiceAccounts ServiceAccountPatterns,
+) bool {
+	if hasConfig(sa) || ignored(sa, ignoredServiceAccounts) || suspended(sa) ||
+		sa.Annotations[annotationKeyDefaultConfigured] == "true" {
+		return false
+	}
+
+	if sa.Annotations == nil {
+		sa.Annotations = map[string]string{}
+	}
+	for k, v := range annotations {
+		if _, ok := sa.Annotations[k]; !ok {
+			sa.Annotations[k] = v
+		}
+	}
+	sa.Annotations[annotationKeyDefaultConfigured] = "true"
+
+	return true
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *namespaceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// Reconcile the namespace of a default ServiceAccount when it is created after the namespace.
+	serviceAccountToNamespace := func(_ context.Context, obj client.Object) []reconcile.Request {
+		if obj.GetName() != defaultServiceAccountName {
+			return nil
+		}
+		return []reconcile.Request{{NamespacedName: client.ObjectKey{Name: obj.GetNamespace()}}}
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.Namespace{}, builder.WithPredicates(
+			predicate.LabelChangedPredicate{},
+			predicate.NewPredicateFuncs(func(obj client.Object) bool {
+				return r.shard.Contains(obj.GetName())
+			}),
+		)).
+		Watches(
+			&corev1.ServiceAccount{},
+			handler.EnqueueRequestsFromMapFunc(serviceAccountToNamespace),
+			builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+				return r.shard.Contains(obj.GetNamespace())
+			})),
+		).
+		Named("namespace").
+		Complete(r)
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestConfigureServiceAccount(t *testing.T) {
+	annotations := map[string]string{
+		annotationKeyRegistry:   "123456789012.dkr.ecr.us-east-1.amazonaws.com",
+		annotationKeyAWSRoleARN: "arn:aws:iam::123456789012:role/puller",
+	}
+
+	for _, tt := range []struct {
+		name                string
+		namespace           string
+		annotations         map[string]string
+		expectedConfigured  bool
+		expectedAnnotations map[string]string
+	}{
+		{
+			name:               "No annotations",
+			expectedConfigured: true,
+			expectedAnnotations: map[string]string{
+				annotationKeyRegistry:          "123456789012.dkr.ecr.us-east-1.amazonaws.com",
+				annotationKeyAWSRoleARN:        "arn:aws:iam::123456789012:role/puller",
+				annotationKeyDefaultConfigured: "true",
+			},
+		},
+		{
+			name:               "Unrelated annotations",
+			annotations:        map[string]string{"example.com/owner": "tenant"},
+			expectedConfigured: true,
+			expectedAnnotations: map[string]string{
+				annotationKeyRegistry:          "123456789012.dkr.ecr.us-east-1.amazonaws.com",
+				annotationKeyAWSRoleARN:        "arn:aws:iam::123456789012:role/puller",
+				annotationKeyDefaultConfigured: "true",
+				"example.com/owner":            "tenant",
+			},
+		},
+		{
+			name: "Partial configuration",
+			annotations: map[string]string{
+				annotationKeyRegistry: "asia-northeast1-docker.pkg.dev",
+			},
+			expectedConfigured: true,
+			expectedAnnotations: map[string]string{
+				annotationKeyRegistry:          "asia-northeast1-docker.pkg.dev",
+				annotationKeyAWSRoleARN:        "arn:aws:iam::123456789012:role/puller",
+				annotationKeyDefaultConfigured: "true",
+			},
+		},
+		{
+			name: "Configured",
+			annotations: map[string]string{
+				annotationKeyRegistry:   "asia-northeast1-docker.pkg.dev",
+				annotationKeyGoogleWIDP: "projects/123/locations/global/workloadIdentityPools/pool/providers/provider",
+				annotationKeyGoogleSA:   "puller@project.iam.gserviceaccount.com",
+			},
+			expectedConfigured: false,
+			expectedAnnotations: map[string]string{
+				annotationKeyRegistry:   "asia-northeast1-docker.pkg.dev",
+				annotationKeyGoogleWIDP: "projects/123/locations/global/workloadIdentityPools/pool/providers/provider",
+				annotationKeyGoogleSA:   "puller@project.iam.gserviceaccount.com",
+			},
+		},
+		{
+			name:                "Configuration removed after configured once",
+			annotations:         map[string]string{annotationKeyDefaultConfigured: "true"},
+			expectedConfigured:  false,
+			expectedAnnotations: map[string]string{annotationKeyDefaultConfigured: "true"},
+		},
+		{
+			name:                "Ignored",
+			annotations:         map[string]string{annotationKeyIgnore: "true"},
+			expectedConfigured:  false,
+			expectedAnnotations: map[string]string{annotationKeyIgnore: "true"},
+		},
+		{
+			name:                "Suspended",
+			annotations:         map[string]string{annotationKeySuspend: "true"},
+			expectedConfigured:  false,
+			expectedAnnotations: map[string]string{annotationKeySuspend: "true"},
+		},
+		{
+			name:               "Ignored by pattern",
+			namespace:          "kube-system",
+			expectedConfigured: false,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			sa := &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   tt.namespace,
+					Name:        defaultServiceAccountName,
+					Annotations: tt.annotations,
+				},
+			}
+
+			configured := configureServiceAccount(sa, annotations, ServiceAccountPatterns{"kube-system/*"})
+			if configured != tt.expectedConfigured {
+				t.Errorf("Unexpected configured\n\texpected: %t\n\tactual: %t", tt.expectedConfigured, configured)
+			}
+			if diff := cmp.Diff(tt.expectedAnnotations, sa.Annotations); diff != "" {
+				t.Errorf("Annotations mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var refreshBacklogDesc = prometheus.NewDesc(
+	"image_pull_secrets_provisioner_refresh_backlog",
+	"Number of image pull secrets whose refresh time has passed but that have not been refreshed yet, including those"+
+		" waiting for a refresh slot of their registry.",
+	nil, nil,
+)
+
+// refreshPlanner groups upcoming refreshes of image pull secrets by container registry, and bounds how many of them
+// are executed at once for each registry, so that Secrets due at the same time do not burst calls to the provider.
+// A nil planner neither tracks nor bounds refreshes.
+type refreshPlanner struct {
+	// Maximum number of access tokens generated at once for each registry. Zero disables the bound.
+	limit int
+
+	mu sync.Mutex
+	// Upcoming refreshes of ServiceAccounts.
+	planned map[types.NamespacedName]plannedRefresh
+	// Semaphores of registries.
+	slots map[string]chan struct{}
+}
+
+// plannedRefresh is when to refresh the image pull secret of a ServiceAccount and its registry.
+type plannedRefresh struct {
+	group string
+	at    time.Time
+}
+
+var _ prometheus.Collector = &refreshPlanner{}
+
+func newRefreshPlanner(limit int) *refreshPlanner {
+	return &refreshPlanner{
+		limit:   limit,
+		planned: map[types.NamespacedName]plannedRefresh{},
+		slots:   map[string]chan struct{}{},
+	}
+}
+
+// refreshGroup returns the provider and registry of a ServiceAccount whose refreshes share a bound.
+func refreshGroup(sa *corev1.ServiceAccount) string {
+	return providerName(sa) + "/" + annotation(sa, annotationKeyRegistry)
+}
+
+// plan records the time to refresh the image pull secret of a ServiceAccount. A zero time forgets the ServiceAccount.
+func (p *refreshPlanner) plan(sa types.NamespacedName, group string, at time.Time) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if at.IsZero() {
+		delete(p.planned, sa)
+		return
+	}
+	p.planned[sa] = plannedRefresh{group: group, at: at}
+}
+
+// forget drops the upcoming refresh of a ServiceAccount, e.g. when it is deleted or no longer provisioned.
+func (p *refreshPlanner) forget(sa types.NamespacedName) {
+	p.plan(sa, "", time.Time{})
+}
+
+// acquire waits for a slot to generate an access token for a registry group. The returned function releases the slot.
+func (p *refreshPlanner) acquire(ctx context.Context, group string) (release func(), _ error) {
+	if p == nil || p.limit <= 0 {
+		return func() {}, nil
+	}
+
+	p.mu.Lock()
+	slots, ok := p.slots[group]
+	if !ok {
+		slots = make(chan struct{}, p.limit)
+		p.slots[group] = slots
+	}
+	p.mu.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("failed to wait for a refresh slot of %s: %w", group, ctx.Err())
+	}
+}
+
+// backlog returns the number of ServiceAccounts whose refresh time has passed by now.
+func (p *refreshPlanner) backlog(now time.Time) int {
+	if p == nil {
+		return 0
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	backlog := 0
+	for _, planned := range p.planned {
+		if !planned.at.After(now) {
+			backlog++
+		}
+	}
+
+	return backlog
+}
+
+func (p *refreshPlanner) Describe(ch chan<- *prometheus.Desc) {
+	ch <- refreshBacklogDesc
+}
+
+func (p *refreshPlanner) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(refreshBacklogDesc, prometheus.GaugeValue, float64(p.backlog(time.Now())))
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestRefreshPlannerBacklog(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := newRefreshPlanner(0)
+
+	p.plan(types.NamespacedName{Namespace: "default", Name: "sa-0"}, "aws/registry-0", now.Add(-time.Minute))
+	p.plan(types.NamespacedName{Namespace: "default", Name: "sa-1"}, "google/registry-1", now)
+	p.plan(types.NamespacedName{Namespace: "default", Name: "sa-2"}, "aws/registry-0", now.Add(time.Minute))
+	if backlog := p.backlog(now); backlog != 2 {
+		t.Errorf("Unexpected backlog\n\texpected: %d\n\tactual: %d", 2, backlog)
+	}
+
+	// Refreshed.
+	p.plan(types.NamespacedName{Namespace: "default", Name: "sa-0"}, "aws/registry-0", now.Add(time.Hour))
+	// No longer provisioned.
+	p.forget(types.NamespacedName{Namespace: "default", Name: "sa-1"})
+	if backlog := p.backlog(now); backlog != 0 {
+		t.Errorf("Unexpected backlog\n\texpected: %d\n\tactual: %d", 0, backlog)
+	}
+	if backlog := p.backlog(now.Add(time.Hour)); backlog != 2 {
+		t.Errorf("Unexpected backlog\n\texpected: %d\n\tactual: %d", 2, backlog)
+	}
+
+	var disabled *refreshPlanner
+	disabled.plan(types.NamespacedName{Namespace: "default", Name: "sa-0"}, "aws/registry-0", now)
+	if backlog := disabled.backlog(now); backlog != 0 {
+		t.Errorf("Nil planner should have no backlog: %d", backlog)
+	}
+}
+
+func TestRefreshPlannerAcquire(t *testing.T) {
+	p := newRefreshPlanner(1)
+
+	release, err := p.acquire(context.Background(), "aws/registry-0")
+	if err != nil {
+		t.Fatalf("Failed to acquire a slot: %v", err)
+	}
+
+	// Another registry has its own slots.
+	releaseOther, err := p.acquire(context.Background(), "aws/registry-1")
+	if err != nil {
+		t.Fatalf("Failed to acquire a slot of another registry: %v", err)
+	}
+	releaseOther()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := p.acquire(ctx, "aws/registry-0"); err == nil {
+		t.Errorf("Acquiring a slot of a registry without free slots should wait until the context is done")
+	}
+
+	release()
+	release, err = p.acquire(context.Background(), "aws/registry-0")
+	if err != nil {
+		t.Fatalf("Failed to acquire a released slot: %v", err)
+	}
+	release()
+
+	for _, p := range []*refreshPlanner{nil, newRefreshPlanner(0)} {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		release, err := p.acquire(ctx, "aws/registry-0")
+		if err != nil {
+			t.Errorf("Planner without a bound should not wait: %v", err)
+			continue
+		}
+		release()
+	}
+}
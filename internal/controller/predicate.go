@@ -0,0 +1,62 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"maps"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// serviceAccountChanged returns true if an update of a ServiceAccount needs to be reconciled, i.e. it changes the
+// annotations to configure the controller other than the status, the image pull secrets, or the deletion timestamp.
+// Other updates, e.g. of annotations of other systems, labels, or managed fields, are not reconciled. Resyncs of the
+// cache, which do not change the resource version, are reconciled to recover ServiceAccounts whose reconciliation was
+// lost.
+func serviceAccountChanged(e event.UpdateEvent) bool {
+	oldSA, ok := e.ObjectOld.(*corev1.ServiceAccount)
+	if !ok {
+		return true
+	}
+	newSA, ok := e.ObjectNew.(*corev1.ServiceAccount)
+	if !ok || oldSA.GetResourceVersion() == newSA.GetResourceVersion() {
+		return true
+	}
+
+	return !equality.Semantic.DeepEqual(oldSA.ImagePullSecrets, newSA.ImagePullSecrets) ||
+		!oldSA.GetDeletionTimestamp().Equal(newSA.GetDeletionTimestamp()) ||
+		!maps.Equal(controllerAnnotations(oldSA), controllerAnnotations(newSA))
+}
+
+// controllerAnnotations returns the annotations of a ServiceAccount with the key prefixes of the controller, except the
+// status recorded by the controller itself.
+func controllerAnnotations(sa *corev1.ServiceAccount) map[string]string {
+	annotations := map[string]string{}
+	for k, v := range sa.GetAnnotations() {
+		if k == annotationKeyStatus {
+			continue
+		}
+		if strings.HasPrefix(k, metadataKeyPrefix) || strings.HasPrefix(k, annotationKeyPrefix) {
+			annotations[k] = v
+		}
+	}
+
+	return annotations
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestServiceAccountChanged(t *testing.T) {
+	sa := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "serviceaccount-0",
+			ResourceVersion: "1",
+			Annotations: map[string]string{
+				annotationKeyRegistry: "asia-northeast1-docker.pkg.dev",
+			},
+		},
+	}
+
+	for _, tt := range []struct {
+		name     string
+		update   func(sa *corev1.ServiceAccount)
+		expected bool
+	}{
+		{
+			name:     "Resync",
+			update:   func(sa *corev1.ServiceAccount) { sa.ResourceVersion = "1" },
+			expected: true,
+		},
+		{
+			name:   "Status",
+			update: func(sa *corev1.ServiceAccount) { sa.Annotations[annotationKeyStatus] = "{}" },
+		},
+		{
+			name:     "Configuration",
+			update:   func(sa *corev1.ServiceAccount) { sa.Annotations[annotationKeyRegistry] = "us-docker.pkg.dev" },
+			expected: true,
+		},
+		{
+			name:     "New annotation of the controller",
+			update:   func(sa *corev1.ServiceAccount) { sa.Annotations[annotationKeyRefreshRequestedAt] = "now" },
+			expected: true,
+		},
+		{
+			name:   "Annotation of another system",
+			update: func(sa *corev1.ServiceAccount) { sa.Annotations["example.com/owner"] = "team-a" },
+		},
+		{
+			name:   "Labels",
+			update: func(sa *corev1.ServiceAccount) { sa.Labels = map[string]string{"team": "a"} },
+		},
+		{
+			name:   "Token Secrets",
+			update: func(sa *corev1.ServiceAccount) { sa.Secrets = []corev1.ObjectReference{{Name: "token"}} },
+		},
+		{
+			name: "Image pull secrets",
+			update: func(sa *corev1.ServiceAccount) {
+				sa.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "imagepullsecret-0"}}
+			},
+			expected: true,
+		},
+		{
+			name: "Image pull secrets and status",
+			update: func(sa *corev1.ServiceAccount) {
+				sa.Annotations[annotationKeyStatus] = "{}"
+				sa.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "imagepullsecret-0"}}
+			},
+			expected: true,
+		},
+		{
+			name:     "Deletion",
+			update:   func(sa *corev1.ServiceAccount) { sa.DeletionTimestamp = &metav1.Time{} },
+			expected: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			updated := sa.DeepCopy()
+			updated.ResourceVersion = "2"
+			tt.update(updated)
+			if actual := serviceAccountChanged(event.UpdateEvent{ObjectOld: sa, ObjectNew: updated}); actual != tt.expected {
+				t.Errorf("Unexpected result\n\texpected: %t\n\tactual: %t", tt.expected, actual)
+			}
+		})
+	}
+}
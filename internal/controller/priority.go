@@ -0,0 +1,76 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// Window over which reconciliations of existing ServiceAccounts are spread when they are first observed, e.g. after
+	// the controller restarts, so that image pull secrets closest to expiration are refreshed first.
+	startupPriorityWindow = time.Minute
+	// Remaining validity of image pull secrets mapped to the end of startupPriorityWindow.
+	startupPriorityHorizon = 12 * time.Hour
+)
+
+// startupDelay returns the delay to reconcile a ServiceAccount first observed with an image pull secret valid for
+// remaining. The delay is monotonic in remaining so that Secrets closer to expiration are reconciled earlier.
+func startupDelay(remaining time.Duration) time.Duration {
+	if remaining <= 0 {
+		return 0
+	}
+	if remaining >= startupPriorityHorizon {
+		return startupPriorityWindow
+	}
+
+	return time.Duration(float64(startupPriorityWindow) * float64(remaining) / float64(startupPriorityHorizon))
+}
+
+// enqueueByExpiration enqueues a ServiceAccount first observed, delaying it by the remaining validity of its image
+// pull secret. Without this, ServiceAccounts listed at startup are reconciled in arbitrary order.
+func (r *serviceAccountReconciler) enqueueByExpiration(
+	ctx context.Context, e event.CreateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request],
+) {
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(e.Object)}
+
+	sa, ok := e.Object.(*corev1.ServiceAccount)
+	if !ok || !hasConfig(sa) || suspended(sa) {
+		q.Add(req)
+		return
+	}
+
+	secret, err := findImagePullSecret(ctx, r, sa, r.immutableSecrets)
+	if err != nil || secret == nil {
+		q.Add(req)
+		return
+	}
+	expiresAt, err := secretExpiresAt(secret)
+	if err != nil {
+		q.Add(req)
+		return
+	}
+
+	q.AddAfter(req, startupDelay(time.Until(expiresAt)))
+}
@@ -18,37 +18,36 @@ package controller
 
 import (
 	"testing"
+	"time"
 )
 
-func TestAWSExtractRegion(t *testing.T) {
+func TestStartupDelay(t *testing.T) {
 	for _, tt := range []struct {
-		name     string
-		registry string
-		expected string
-		wantErr  bool
+		name      string
+		remaining time.Duration
+		expected  time.Duration
 	}{
 		{
-			name:     "Valid registry",
-			registry: "123456789012.dkr.ecr.us-east-1.amazonaws.com",
-			expected: "us-east-1",
-			wantErr:  false,
+			name:      "Expired",
+			remaining: -time.Hour,
+			expected:  0,
 		},
 		{
-			name:     "Invalid registry",
-			registry: "docker.io",
-			wantErr:  true,
+			name:      "Within horizon",
+			remaining: 6 * time.Hour,
+			expected:  30 * time.Second,
+		},
+		{
+			name:      "Beyond horizon",
+			remaining: 24 * time.Hour,
+			expected:  time.Minute,
 		},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 
-			aws := newAWS()
-			region, err := aws.ExtractRegion(tt.registry)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("Unexpected error\n\twantErr: %t\n\tactual: %v", tt.wantErr, err)
-			}
-			if region != tt.expected {
-				t.Errorf("Unexpected region\n\texpected: %s\n\tactual: %s", tt.expected, region)
+			if actual := startupDelay(tt.remaining); actual != tt.expected {
+				t.Errorf("Unexpected delay\n\texpected: %s\n\tactual: %s", tt.expected, actual)
 			}
 		})
 	}
@@ -0,0 +1,138 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Event reason of a registry rejecting the credentials of an image pull secret on a periodic probe.
+const reasonRegistryProbeFailed = "RegistryProbeFailedForImagePullSecret"
+
+// probeTarget is a representative image pull secret of a registry to probe the registry with.
+type probeTarget struct {
+	sa         *corev1.ServiceAccount
+	secret     *corev1.Secret
+	issuedAt   time.Time
+	username   string
+	password   string
+	repository string
+}
+
+// probeRegistries verifies the credentials of a representative image pull secret for each distinct registry against
+// the registry, and exports the result as a metric, to catch permission regressions on the registry side before pods
+// fail to pull images. A warning event is emitted on the ServiceAccount of the Secret when a registry starts failing.
+func (r *serviceAccountReconciler) probeRegistries(ctx context.Context) error {
+	logger := log.FromContext(ctx)
+
+	targets, err := r.listProbeTargets(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, registry := range slices.Sorted(maps.Keys(targets)) {
+		target := targets[registry]
+		logger := logger.WithValues(
+			"registry", registry, "serviceAccount", client.ObjectKeyFromObject(target.sa),
+			"secret", target.secret.GetName(),
+		)
+
+		err := r.verifier.verify(ctx, registry, target.repository, target.username, target.password)
+		if err == nil {
+			registryProbeSuccess.WithLabelValues(registry).Set(1)
+			delete(r.failingRegistries, registry)
+			continue
+		}
+
+		registryProbeSuccess.WithLabelValues(registry).Set(0)
+		logger.Error(err, "registry rejected the credentials of an image pull secret on a probe")
+		if !r.failingRegistries[registry] {
+			r.recordEvent(
+				target.sa, target.secret, corev1.EventTypeWarning, reasonRegistryProbeFailed,
+				"Registry %s rejected the credentials of image pull secret %s on a periodic probe: %v",
+				registry, target.secret.GetName(), err,
+			)
+		}
+		r.failingRegistries[registry] = true
+	}
+
+	// Forget registries no longer configured.
+	for registry := range r.probedRegistries {
+		if _, ok := targets[registry]; !ok {
+			registryProbeSuccess.DeleteLabelValues(registry)
+			delete(r.failingRegistries, registry)
+		}
+	}
+	r.probedRegistries = targets
+
+	return nil
+}
+
+// listProbeTargets returns the most recently issued valid image pull secret for each registry.
+func (r *serviceAccountReconciler) listProbeTargets(ctx context.Context) (map[string]probeTarget, error) {
+	secrets := &corev1.SecretList{}
+	if err := r.List(ctx, secrets, client.HasLabels{labelKeyServiceAccount}); err != nil {
+		return nil, fmt.Errorf("failed to list image pull secrets: %w", err)
+	}
+
+	targets := map[string]probeTarget{}
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		key := serviceAccountOf(secret)
+		if !r.shard.Contains(key.Namespace) {
+			continue
+		}
+		if expiresAt, err := secretExpiresAt(secret); err != nil || !time.Now().Before(expiresAt) {
+			continue
+		}
+
+		sa := &corev1.ServiceAccount{}
+		if err := r.Get(ctx, key, sa); err != nil || !hasConfig(sa) || suspended(sa) ||
+			ignored(sa, r.ignoredServiceAccounts) {
+			continue
+		}
+		registry := annotation(sa, annotationKeyRegistry)
+		issuedAt := secretIssuedAt(secret)
+		if current, ok := targets[registry]; ok && !issuedAt.After(current.issuedAt) {
+			continue
+		}
+
+		username, password, err := dockerConfigJSONCredentials(secret, registry)
+		if err != nil {
+			continue
+		}
+
+		targets[registry] = probeTarget{
+			sa:         sa,
+			secret:     secret,
+			issuedAt:   issuedAt,
+			username:   username,
+			password:   password,
+			repository: annotation(sa, annotationKeyVerifyRepository),
+		}
+	}
+
+	return targets, nil
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	awscredentials "github.com/pfnet/image-pull-secrets-provisioner/pkg/credentials/aws"
+	"github.com/pfnet/image-pull-secrets-provisioner/pkg/credentials/credentialstest"
+	googlecredentials "github.com/pfnet/image-pull-secrets-provisioner/pkg/credentials/google"
+)
+
+func TestAWSConformance(t *testing.T) {
+	fake := credentialstest.NewFakeAWS(t)
+	var a aws = &awsImpl{
+		Client: awscredentials.NewClient(
+			awscredentials.WithSTSEndpoint(fake.URL()), awscredentials.WithECREndpoint(fake.URL()),
+		),
+	}
+
+	credentialstest.Run(t, credentialstest.Provider{
+		Fake: fake,
+		GenerateAccessToken: func(
+			ctx context.Context,
+			k8sServiceAccountToken string,
+		) (username string, password string, expiresAt time.Time, _ error) {
+			return a.GenerateAccessToken(ctx, k8sServiceAccountToken, "us-east-1", "arn:aws:iam::000000000000:role/fake")
+		},
+		FailedStep: failedStep(map[string]string{
+			errorClassFederationDenied: credentialstest.StepAssumeRoleWithWebIdentity,
+			errorClassRegistryAPIError: credentialstest.StepGetAuthorizationToken,
+		}),
+		ExtractRegion: a.ExtractRegion,
+		Regions: map[string]string{
+			"123456789012.dkr.ecr.us-east-1.amazonaws.com": "us-east-1",
+			"docker.io": "",
+		},
+	})
+}
+
+func TestGoogleConformance(t *testing.T) {
+	fake := credentialstest.NewFakeGoogle(t)
+	client, err := googlecredentials.NewClient(
+		context.Background(),
+		googlecredentials.WithSTSEndpoint(fake.URL()),
+		googlecredentials.WithIAMCredentialsEndpoint(fake.URL()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create a client: %v", err)
+	}
+	var g google = &goog{client: client}
+
+	credentialstest.Run(t, credentialstest.Provider{
+		Fake: fake,
+		GenerateAccessToken: func(
+			ctx context.Context,
+			k8sServiceAccountToken string,
+		) (username string, password string, expiresAt time.Time, _ error) {
+			token, expiresAt, err := g.GenerateAccessToken(
+				ctx,
+				k8sServiceAccountToken,
+				"projects/0/locations/global/workloadIdentityPools/fake/providers/fake",
+				"fake@fake.iam.gserviceaccount.com",
+			)
+			return googlecredentials.Username, token, expiresAt, err
+		},
+		FailedStep: failedStep(map[string]string{
+			errorClassFederationDenied:    credentialstest.StepExchangeToken,
+			errorClassImpersonationDenied: credentialstest.StepGenerateAccessToken,
+		}),
+	})
+}
+
+// failedStep returns a function telling the step of a fake whose failure an error reports by its error class.
+func failedStep(steps map[string]string) func(err error) string {
+	return func(err error) string {
+		return steps[stepErrorClass(err)]
+	}
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// redacted replaces credentials in logs and events.
+const redacted = "[REDACTED]"
+
+// credentialPatterns match credentials that may appear in messages, e.g. in errors of container registry providers
+// echoing request bodies. The first submatch, if any, is kept to tell what has been redacted.
+var credentialPatterns = []*regexp.Regexp{
+	// JWTs, e.g. ServiceAccount tokens, and base64-encoded JSON, e.g. Docker config JSONs.
+	regexp.MustCompile(`eyJ[A-Za-z0-9+/=_.-]{8,}`),
+	// Base64-encoded "AWS:PASSWORD", i.e. ECR authorization tokens.
+	regexp.MustCompile(`QVdTO[A-Za-z0-9+/=]{8,}`),
+	// Google OAuth 2.0 access tokens.
+	regexp.MustCompile(`ya29\.[A-Za-z0-9._-]+`),
+	// Authorization headers.
+	regexp.MustCompile(`(?i)((?:authorization:\s*(?:bearer|basic)|bearer)\s+)[A-Za-z0-9+/=._~-]+`),
+	// JSON fields.
+	regexp.MustCompile(
+		`(?i)("(?:password|auth|identitytoken|registrytoken|[a-z_]*token|secret_?access_?key)"\s*:\s*")[^"]*`,
+	),
+	// Form and query parameters.
+	regexp.MustCompile(`(?i)(\b(?:password|[a-z_]*token|secret_?access_?key)=)[^&\s"]+`),
+	// XML elements of AWS STS responses.
+	regexp.MustCompile(`(<(SecretAccessKey|SessionToken)>)[^<]*`),
+}
+
+// redact replaces credentials in a message.
+func redact(message string) string {
+	for _, pattern := range credentialPatterns {
+		if pattern.NumSubexp() == 0 {
+			message = pattern.ReplaceAllLiteralString(message, redacted)
+		} else {
+			message = pattern.ReplaceAllString(message, "${1}"+redacted)
+		}
+	}
+
+	return message
+}
+
+// redactedError redacts credentials in the message of an error while keeping the error chain for errors.Is and
+// errors.As.
+type redactedError struct {
+	err error
+}
+
+// redactError wraps an error to redact credentials in its message. It returns nil if err is nil.
+func redactError(err error) error {
+	if _, ok := err.(*redactedError); ok || err == nil {
+		return err
+	}
+
+	return &redactedError{err: err}
+}
+
+func (e *redactedError) Error() string {
+	return redact(e.err.Error())
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// redactValue redacts credentials in a value of a log.
+// Secrets are replaced with their keys not to log their data.
+func redactValue(value any) any {
+	switch v := value.(type) {
+	case string:
+		return redact(v)
+	case []byte:
+		return redact(string(v))
+	case error:
+		return redactError(v)
+	case *corev1.Secret:
+		return client.ObjectKeyFromObject(v).String()
+	case corev1.Secret:
+		return client.ObjectKeyFromObject(&v).String()
+	default:
+		return value
+	}
+}
+
+func redactKeysAndValues(keysAndValues []any) []any {
+	redactedKeysAndValues := make([]any, len(keysAndValues))
+	for i, v := range keysAndValues {
+		redactedKeysAndValues[i] = redactValue(v)
+	}
+
+	return redactedKeysAndValues
+}
+
+// redactingLogSink is a logr.LogSink that redacts credentials in messages and values before passing them to another.
+type redactingLogSink struct {
+	sink logr.LogSink
+}
+
+// RedactingLogger returns a logger that redacts credentials, e.g. tokens, passwords, and Docker config JSONs, in
+// messages and values, including errors of container registry providers, at any verbosity.
+func RedactingLogger(logger logr.Logger) logr.Logger {
+	sink := logger.GetSink()
+	if sink == nil {
+		return logger
+	}
+	// Report the callers of the logger instead of the redacting sink.
+	if s, ok := sink.(logr.CallDepthLogSink); ok {
+		sink = s.WithCallDepth(1)
+	}
+
+	return logr.New(&redactingLogSink{sink: sink})
+}
+
+// Init does nothing because the wrapped sink has been initialized by its own logger.
+func (s *redactingLogSink) Init(logr.RuntimeInfo) {}
+
+func (s *redactingLogSink) Enabled(level int) bool {
+	return s.sink.Enabled(level)
+}
+
+func (s *redactingLogSink) Info(level int, msg string, keysAndValues ...any) {
+	s.sink.Info(level, redact(msg), redactKeysAndValues(keysAndValues)...)
+}
+
+func (s *redactingLogSink) Error(err error, msg string, keysAndValues ...any) {
+	s.sink.Error(redactError(err), redact(msg), redactKeysAndValues(keysAndValues)...)
+}
+
+func (s *redactingLogSink) WithValues(keysAndValues ...any) logr.LogSink {
+	return &redactingLogSink{sink: s.sink.WithValues(redactKeysAndValues(keysAndValues)...)}
+}
+
+func (s *redactingLogSink) WithName(name string) logr.LogSink {
+	return &redactingLogSink{sink: s.sink.WithName(name)}
+}
+
+func (s *redactingLogSink) WithCallDepth(depth int) logr.LogSink {
+	if sink, ok := s.sink.(logr.CallDepthLogSink); ok {
+		return &redactingLogSink{sink: sink.WithCallDepth(depth)}
+	}
+
+	return s
+}
+
+// redactingEventRecorder is a record.EventRecorder that redacts credentials in messages of events.
+type redactingEventRecorder struct {
+	recorder record.EventRecorder
+}
+
+// RedactingEventRecorder returns an event recorder that redacts credentials in messages of events, e.g. errors of
+// container registry providers.
+func RedactingEventRecorder(recorder record.EventRecorder) record.EventRecorder {
+	return &redactingEventRecorder{recorder: recorder}
+}
+
+func (r *redactingEventRecorder) Event(object runtime.Object, eventtype string, reason string, message string) {
+	r.recorder.Event(object, eventtype, reason, redact(message))
+}
+
+func (r *redactingEventRecorder) Eventf(
+	object runtime.Object, eventtype string, reason string, messageFmt string, args ...any,
+) {
+	r.recorder.Event(object, eventtype, reason, redact(fmt.Sprintf(messageFmt, args...)))
+}
+
+func (r *redactingEventRecorder) AnnotatedEventf(
+	object runtime.Object,
+	annotations map[string]string,
+	eventtype string,
+	reason string,
+	messageFmt string,
+	args ...any,
+) {
+	r.recorder.AnnotatedEventf(object, annotations, eventtype, reason, "%s", redact(fmt.Sprintf(messageFmt, args...)))
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Default grace period for refreshing image pull secrets before they expire.
+const defaultExpirationGracePeriod = time.Minute
+
+// Minimum delay to requeue a ServiceAccount for refreshing its image pull secret, not to requeue it in a hot loop, or
+// never, when the refresh time is already past, e.g. for tokens valid for less than the expiration grace period or
+// timestamps skewed from the clock of the controller.
+const minRequeueAfter = time.Second
+
+// RefreshPolicy holds settings of when to refresh image pull secrets.
+type RefreshPolicy struct {
+	// RefreshFraction is the fraction of the validity period of image pull secrets after which they are refreshed,
+	// e.g. 0.8 refreshes a Secret valid for 12 hours after 9.6 hours.
+	// Secrets are still refreshed before the expiration grace period even if the fraction is larger.
+	// Zero disables the fraction-based refreshing.
+	RefreshFraction float64
+
+	// RefreshJitter spreads refreshes of image pull secrets issued at the same time to avoid bursts of API calls.
+	// The refresh time of each Secret is moved earlier by a random duration up to this fraction of the period from its
+	// issuance to the refresh time.
+	RefreshJitter float64
+
+	// ExpirationGracePeriod is the period before the expiration of image pull secrets in which they are refreshed
+	// regardless of the fraction. It defaults to 1 minute.
+	ExpirationGracePeriod time.Duration
+
+	// MinRefreshInterval is the minimum period from the issuance of image pull secrets to their refresh, and the
+	// minimum delay of every requeue to refresh them, so that a provider returning already expired or very short-lived
+	// tokens cannot drive a tight refresh loop against it. It must be shorter than the expiration grace period, or a
+	// requeue shortly before the refresh time would delay the refresh past the expiration. Zero disables the floor.
+	MinRefreshInterval time.Duration
+}
+
+func (p RefreshPolicy) validate() error {
+	if p.RefreshFraction < 0 || p.RefreshFraction > 1 {
+		return fmt.Errorf("refresh fraction must be in [0, 1]: %v", p.RefreshFraction)
+	}
+	if p.RefreshJitter < 0 || p.RefreshJitter > 1 {
+		return fmt.Errorf("refresh jitter must be in [0, 1]: %v", p.RefreshJitter)
+	}
+	if p.ExpirationGracePeriod < 0 {
+		return fmt.Errorf("expiration grace period must not be negative: %v", p.ExpirationGracePeriod)
+	}
+	if p.MinRefreshInterval < 0 {
+		return fmt.Errorf("minimum refresh interval must not be negative: %v", p.MinRefreshInterval)
+	}
+	if grace := p.withDefaults().ExpirationGracePeriod; p.MinRefreshInterval >= grace {
+		return fmt.Errorf(
+			"minimum refresh interval must be shorter than expiration grace period %v: %v", grace, p.MinRefreshInterval,
+		)
+	}
+
+	return nil
+}
+
+func (p RefreshPolicy) withDefaults() RefreshPolicy {
+	if p.ExpirationGracePeriod == 0 {
+		p.ExpirationGracePeriod = defaultExpirationGracePeriod
+	}
+
+	return p
+}
+
+// SetRefreshPolicy changes when to refresh image pull secrets at runtime. It takes effect on the next reconciliation of
+// each ServiceAccount.
+func (r *serviceAccountReconciler) SetRefreshPolicy(p RefreshPolicy) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+
+	r.refreshMu.Lock()
+	defer r.refreshMu.Unlock()
+	r.refresh = p.withDefaults()
+
+	return nil
+}
+
+// refreshPolicy returns the current settings of when to refresh image pull secrets.
+func (r *serviceAccountReconciler) refreshPolicy() RefreshPolicy {
+	r.refreshMu.RLock()
+	defer r.refreshMu.RUnlock()
+
+	return r.refresh
+}
+
+// refreshTime returns the time to refresh an image pull secret issued at issuedAt and expiring at expiresAt.
+// issuedAt is zero if unknown. interval caps the time from the issuance to the refresh unless it is zero.
+// The refresh time is not earlier than the minimum refresh interval after the issuance even if the Secret has expired.
+func (r *serviceAccountReconciler) refreshTime(
+	secret types.NamespacedName, issuedAt time.Time, expiresAt time.Time, interval time.Duration,
+) time.Time {
+	policy := r.refreshPolicy()
+	refreshAt := expiresAt.Add(-policy.ExpirationGracePeriod)
+
+	if issuedAt.IsZero() {
+		return refreshAt
+	}
+	if !issuedAt.Before(refreshAt) {
+		return issuedAt.Add(policy.MinRefreshInterval)
+	}
+
+	if policy.RefreshFraction > 0 {
+		validity := expiresAt.Sub(issuedAt)
+		if at := issuedAt.Add(time.Duration(float64(validity) * policy.RefreshFraction)); at.Before(refreshAt) {
+			refreshAt = at
+		}
+	}
+
+	// Some registries revoke tokens earlier than their stated expiration.
+	if interval > 0 {
+		if at := issuedAt.Add(interval); at.Before(refreshAt) {
+			refreshAt = at
+		}
+	}
+
+	// Spread refreshes of Secrets issued at the same time by moving the refresh time earlier by a random fraction of
+	// the jitter window. The fraction is derived from the Secret so that every reconciliation agrees on the time.
+	if policy.RefreshJitter > 0 {
+		window := float64(refreshAt.Sub(issuedAt)) * policy.RefreshJitter
+		refreshAt = refreshAt.Add(-time.Duration(window * jitterFraction(secret)))
+	}
+
+	if at := issuedAt.Add(policy.MinRefreshInterval); refreshAt.Before(at) {
+		refreshAt = at
+	}
+
+	return refreshAt
+}
+
+// requeueAfter returns the delay to requeue a ServiceAccount for refreshing its image pull secret at refreshAt.
+// A refresh time in the past results in a refresh as soon as possible after minRequeueAfter or the minimum refresh
+// interval, whichever is longer.
+func (r *serviceAccountReconciler) requeueAfter(refreshAt time.Time) time.Duration {
+	return max(time.Until(refreshAt), minRequeueAfter, r.refreshPolicy().MinRefreshInterval)
+}
+
+// jitterFraction returns a pseudo-random number in [0, 1) that is stable for a Secret.
+func jitterFraction(secret types.NamespacedName) float64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(secret.String()))
+	return float64(h.Sum64()) / (math.MaxUint64 + 1.0)
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestRefreshTime(t *testing.T) {
+	issuedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	expiresAt := issuedAt.Add(10 * time.Hour)
+	secret := types.NamespacedName{Namespace: "namespace-0", Name: "secret-0"}
+
+	for _, tt := range []struct {
+		name               string
+		refreshFraction    float64
+		minRefreshInterval time.Duration
+		interval           time.Duration
+		issuedAt           time.Time
+		expected           time.Time
+	}{
+		{
+			name:     "Grace period",
+			issuedAt: issuedAt,
+			expected: expiresAt.Add(-time.Minute),
+		},
+		{
+			name:            "Refresh fraction",
+			refreshFraction: 0.8,
+			issuedAt:        issuedAt,
+			expected:        issuedAt.Add(8 * time.Hour),
+		},
+		{
+			name:            "Refresh fraction later than grace period",
+			refreshFraction: 1,
+			issuedAt:        issuedAt,
+			expected:        expiresAt.Add(-time.Minute),
+		},
+		{
+			name:     "Refresh interval",
+			interval: 30 * time.Minute,
+			issuedAt: issuedAt,
+			expected: issuedAt.Add(30 * time.Minute),
+		},
+		{
+			name:            "Refresh fraction earlier than refresh interval",
+			refreshFraction: 0.01,
+			interval:        30 * time.Minute,
+			issuedAt:        issuedAt,
+			expected:        issuedAt.Add(6 * time.Minute),
+		},
+		{
+			name:     "Refresh interval longer than validity",
+			interval: 24 * time.Hour,
+			issuedAt: issuedAt,
+			expected: expiresAt.Add(-time.Minute),
+		},
+		{
+			name:               "Minimum refresh interval longer than refresh interval",
+			minRefreshInterval: 10 * time.Second,
+			interval:           time.Second,
+			issuedAt:           issuedAt,
+			expected:           issuedAt.Add(10 * time.Second),
+		},
+		{
+			name:               "Minimum refresh interval after expiration",
+			minRefreshInterval: 10 * time.Second,
+			issuedAt:           expiresAt.Add(time.Hour),
+			expected:           expiresAt.Add(time.Hour + 10*time.Second),
+		},
+		{
+			name:            "Unknown issuance time",
+			refreshFraction: 0.8,
+			expected:        expiresAt.Add(-time.Minute),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := &serviceAccountReconciler{
+				refresh: RefreshPolicy{
+					ExpirationGracePeriod: time.Minute,
+					RefreshFraction:       tt.refreshFraction,
+					MinRefreshInterval:    tt.minRefreshInterval,
+				},
+			}
+			if actual := r.refreshTime(secret, tt.issuedAt, expiresAt, tt.interval); !actual.Equal(tt.expected) {
+				t.Errorf("Unexpected refresh time\n\texpected: %s\n\tactual: %s", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRefreshTimeJitter(t *testing.T) {
+	issuedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	expiresAt := issuedAt.Add(10 * time.Hour)
+
+	r := &serviceAccountReconciler{
+		refresh: RefreshPolicy{
+			RefreshFraction: 0.8,
+			RefreshJitter:   0.5,
+		},
+	}
+
+	seen := map[time.Time]bool{}
+	for _, name := range []string{"secret-0", "secret-1", "secret-2", "secret-3"} {
+		secret := types.NamespacedName{Namespace: "namespace-0", Name: name}
+
+		actual := r.refreshTime(secret, issuedAt, expiresAt, 0)
+		if actual.Before(issuedAt.Add(4*time.Hour)) || actual.After(issuedAt.Add(8*time.Hour)) {
+			t.Errorf("Refresh time is out of the jitter window: %s", actual)
+		}
+		if again := r.refreshTime(secret, issuedAt, expiresAt, 0); !again.Equal(actual) {
+			t.Errorf("Refresh time is not stable\n\tfirst: %s\n\tsecond: %s", actual, again)
+		}
+		seen[actual] = true
+	}
+
+	if len(seen) == 1 {
+		t.Errorf("Refresh times are not spread")
+	}
+}
+
+func TestRequeueAfter(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		name               string
+		refreshAt          time.Time
+		minRefreshInterval time.Duration
+		min                time.Duration
+		max                time.Duration
+	}{
+		{
+			name:      "Refresh time in the future",
+			refreshAt: time.Now().Add(time.Hour),
+			min:       59 * time.Minute,
+			max:       time.Hour,
+		},
+		{
+			name:      "Refresh time in the past",
+			refreshAt: time.Now().Add(-time.Hour),
+			min:       minRequeueAfter,
+			max:       minRequeueAfter,
+		},
+		{
+			name:               "Refresh time in the past with minimum refresh interval",
+			refreshAt:          time.Now().Add(-time.Hour),
+			minRefreshInterval: 10 * time.Second,
+			min:                10 * time.Second,
+			max:                10 * time.Second,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := &serviceAccountReconciler{refresh: RefreshPolicy{MinRefreshInterval: tt.minRefreshInterval}}
+			actual := r.requeueAfter(tt.refreshAt)
+			if actual < tt.min || actual > tt.max {
+				t.Errorf("Unexpected requeue delay\n\texpected: [%s, %s]\n\tactual: %s", tt.min, tt.max, actual)
+			}
+		})
+	}
+}
+
+func TestSetRefreshPolicy(t *testing.T) {
+	r := &serviceAccountReconciler{}
+
+	if err := r.SetRefreshPolicy(RefreshPolicy{RefreshFraction: 0.8}); err != nil {
+		t.Fatalf("Failed to set a refresh policy: %v", err)
+	}
+	expected := RefreshPolicy{RefreshFraction: 0.8, ExpirationGracePeriod: defaultExpirationGracePeriod}
+	if actual := r.refreshPolicy(); actual != expected {
+		t.Errorf("Unexpected refresh policy\n\texpected: %+v\n\tactual: %+v", expected, actual)
+	}
+
+	if err := r.SetRefreshPolicy(RefreshPolicy{RefreshJitter: 2}); err == nil {
+		t.Errorf("Invalid refresh policy was accepted")
+	}
+	if err := r.SetRefreshPolicy(RefreshPolicy{MinRefreshInterval: 5 * time.Minute}); err == nil {
+		t.Errorf("Minimum refresh interval longer than the default expiration grace period was accepted")
+	}
+	if err := r.SetRefreshPolicy(
+		RefreshPolicy{ExpirationGracePeriod: time.Minute, MinRefreshInterval: time.Minute},
+	); err == nil {
+		t.Errorf("Minimum refresh interval as long as the expiration grace period was accepted")
+	}
+	if actual := r.refreshPolicy(); actual != expected {
+		t.Errorf("Refresh policy was changed by an invalid one\n\texpected: %+v\n\tactual: %+v", expected, actual)
+	}
+}
@@ -0,0 +1,588 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/pfnet/image-pull-secrets-provisioner/api/v1alpha1"
+)
+
+const (
+	// Interval to mirror image pull secrets to remote clusters again, which repairs changes made in the remote clusters.
+	remoteTargetResyncInterval = 5 * time.Minute
+
+	// Condition type and reasons of RemoteTargets.
+	conditionTypeReady = "Ready"
+	reasonSynced       = "Synced"
+	reasonFailedSync   = "FailedSync"
+
+	// Event reasons.
+	reasonFailedMirroring = "FailedMirroringImagePullSecrets"
+	reasonFailedCleanup   = "FailedCleaningUpImagePullSecrets"
+)
+
+type remoteTargetReconciler struct {
+	client.Client
+	// Reader not backed by the cache, which does not have kubeconfig Secrets.
+	apiReader     client.Reader
+	scheme        *runtime.Scheme
+	eventRecorder record.EventRecorder
+	// Whether image pull secrets are provisioned as immutable Secrets.
+	immutableSecrets bool
+	// Namespaces to reconcile by this replica.
+	shard Shard
+	// Whether to only report the changes that would be made without mutating the clusters.
+	dryRun bool
+
+	// Clients of remote clusters by RemoteTarget, which are rebuilt when their kubeconfig is changed.
+	remoteClients   map[types.NamespacedName]remoteClient
+	remoteClientsMu sync.Mutex
+}
+
+type remoteClient struct {
+	// Resource version of the kubeconfig Secret that the client is built from.
+	resourceVersion string
+	client          client.Client
+}
+
+// RemoteTargetReconcilerOptions holds controller-wide settings for the RemoteTarget reconciler.
+type RemoteTargetReconcilerOptions struct {
+	// ImmutableSecrets must be the same as ServiceAccountReconcilerOptions.ImmutableSecrets to find image pull secrets
+	// to mirror.
+	ImmutableSecrets bool
+
+	// Shard restricts the namespaces reconciled by this replica to run multiple replicas actively.
+	Shard Shard
+
+	// DryRun makes the reconciler only report the changes that it would make as logs and events.
+	DryRun bool
+}
+
+// NewRemoteTargetReconciler creates a new RemoteTarget reconciler that mirrors image pull secrets provisioned in this
+// cluster to remote clusters, so that one controller can manage image pull secrets for clusters without their own
+// identity federation.
+func NewRemoteTargetReconciler(
+	client client.Client, apiReader client.Reader, scheme *runtime.Scheme, eventRecorder record.EventRecorder,
+	opts RemoteTargetReconcilerOptions,
+) (*remoteTargetReconciler, error) {
+	if err := opts.Shard.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &remoteTargetReconciler{
+		Client:           client,
+		apiReader:        apiReader,
+		scheme:           scheme,
+		eventRecorder:    eventRecorder,
+		immutableSecrets: opts.ImmutableSecrets,
+		shard:            opts.Shard,
+		dryRun:           opts.DryRun,
+		remoteClients:    map[types.NamespacedName]remoteClient{},
+	}, nil
+}
+
+//+kubebuilder:rbac:groups=imagepullsecrets.preferred.jp,resources=remotetargets,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=imagepullsecrets.preferred.jp,resources=remotetargets/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=imagepullsecrets.preferred.jp,resources=remotetargets/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+func (r *remoteTargetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	target := &v1alpha1.RemoteTarget{}
+	if err := r.Get(ctx, req.NamespacedName, target); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.forgetRemoteClient(req.NamespacedName)
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "failed to get a RemoteTarget")
+		return ctrl.Result{}, err
+	}
+
+	if !target.GetDeletionTimestamp().IsZero() {
+		return ctrl.Result{}, r.finalize(ctx, logger, target)
+	}
+
+	if r.dryRun {
+		return ctrl.Result{RequeueAfter: remoteTargetResyncInterval}, r.planMirroring(ctx, logger, target)
+	}
+
+	if controllerutil.AddFinalizer(target, finalizerRemoteTarget) {
+		if err := r.Update(ctx, target); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to add a finalizer to a RemoteTarget: %w", err)
+		}
+	}
+
+	namespaces, syncErr := r.mirrorImagePullSecrets(ctx, target)
+	if syncErr != nil {
+		r.eventRecorder.Eventf(
+			target, corev1.EventTypeWarning, reasonFailedMirroring, "Failed to mirror image pull secrets: %v", syncErr,
+		)
+		logger.Error(syncErr, "failed to mirror image pull secrets")
+	} else {
+		logger.Info("Mirrored image pull secrets to the remote cluster.", "namespaces", namespaces)
+	}
+
+	if err := r.updateStatus(ctx, target, namespaces, syncErr); err != nil {
+		return ctrl.Result{}, err
+	}
+	if syncErr != nil {
+		return ctrl.Result{}, syncErr
+	}
+
+	return ctrl.Result{RequeueAfter: remoteTargetResyncInterval}, nil
+}
+
+// mirrorImagePullSecrets mirrors the image pull secrets of the ServiceAccounts selected by a RemoteTarget to the
+// remote cluster, and deletes mirrors no longer desired. It returns the namespaces in the remote cluster that may have
+// mirrors, which are to be tracked in the status even on errors.
+func (r *remoteTargetReconciler) mirrorImagePullSecrets(
+	ctx context.Context, target *v1alpha1.RemoteTarget,
+) ([]string, error) {
+	tracked := sets.New(target.Status.Namespaces...)
+
+	remote, err := r.remoteClient(ctx, target)
+	if err != nil {
+		return sets.List(tracked), err
+	}
+
+	sas, err := r.selectServiceAccounts(ctx, target)
+	if err != nil {
+		return sets.List(tracked), err
+	}
+
+	key := client.ObjectKeyFromObject(target)
+	namespaces := remoteNamespaces(target)
+	tracked.Insert(namespaces...)
+	desired := sets.New[types.NamespacedName]()
+	for _, sa := range sas {
+		secret, err := findImagePullSecret(ctx, r, &sa, r.immutableSecrets)
+		if err != nil {
+			return sets.List(tracked), err
+		}
+		// The provisioning of the image pull secret triggers the mirroring later.
+		if secret == nil {
+			continue
+		}
+
+		for _, ns := range namespaces {
+			mirror := remoteImagePullSecret(key, &sa, secret, ns)
+			if err := remote.Patch(
+				ctx, mirror, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership,
+			); err != nil {
+				return sets.List(tracked), fmt.Errorf("failed to apply an image pull secret to %s: %w", ns, err)
+			}
+			if err := attachMirror(ctx, remote, mirror, sa.GetName()); err != nil {
+				return sets.List(tracked), err
+			}
+			desired.Insert(client.ObjectKeyFromObject(mirror))
+		}
+	}
+
+	for ns := range tracked {
+		if err := deleteMirrors(ctx, remote, key, ns, desired); err != nil {
+			return sets.List(tracked), err
+		}
+	}
+
+	return namespaces, nil
+}
+
+// planMirroring reports the image pull secrets that would be mirrored to the remote cluster in dry-run mode.
+func (r *remoteTargetReconciler) planMirroring(
+	ctx context.Context, logger logr.Logger, target *v1alpha1.RemoteTarget,
+) error {
+	sas, err := r.selectServiceAccounts(ctx, target)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(sas))
+	for _, sa := range sas {
+		names = append(names, sa.GetName())
+	}
+	namespaces := remoteNamespaces(target)
+	r.eventRecorder.Eventf(
+		target, corev1.EventTypeNormal, reasonDryRun,
+		"Dry run: would mirror image pull secrets of ServiceAccounts %v to namespaces %v", names, namespaces,
+	)
+	logger.Info(
+		"Dry run: would mirror image pull secrets to the remote cluster.",
+		"serviceAccounts", names, "namespaces", namespaces,
+	)
+
+	return nil
+}
+
+// finalize deletes the mirrors of a RemoteTarget in the remote cluster and removes its finalizer.
+// The mirrors are left if the remote cluster is not reachable by the kubeconfig, e.g. when it is deleted together.
+func (r *remoteTargetReconciler) finalize(
+	ctx context.Context, logger logr.Logger, target *v1alpha1.RemoteTarget,
+) error {
+	if !controllerutil.ContainsFinalizer(target, finalizerRemoteTarget) {
+		return nil
+	}
+
+	remote, err := r.remoteClient(ctx, target)
+	if err != nil {
+		r.eventRecorder.Eventf(
+			target, corev1.EventTypeWarning, reasonFailedCleanup,
+			"Leaving image pull secrets in the remote cluster: %v", err,
+		)
+		logger.Error(err, "failed to clean up image pull secrets in the remote cluster")
+	} else {
+		key := client.ObjectKeyFromObject(target)
+		for _, ns := range target.Status.Namespaces {
+			if err := deleteMirrors(ctx, remote, key, ns, nil); err != nil {
+				return err
+			}
+		}
+		logger.Info("Deleted image pull secrets in the remote cluster.", "namespaces", target.Status.Namespaces)
+	}
+
+	controllerutil.RemoveFinalizer(target, finalizerRemoteTarget)
+	if err := r.Update(ctx, target); err != nil {
+		return fmt.Errorf("failed to remove a finalizer from a RemoteTarget: %w", err)
+	}
+	r.forgetRemoteClient(client.ObjectKeyFromObject(target))
+
+	return nil
+}
+
+// updateStatus records the result of mirroring in the status of a RemoteTarget.
+func (r *remoteTargetReconciler) updateStatus(
+	ctx context.Context, target *v1alpha1.RemoteTarget, namespaces []string, syncErr error,
+) error {
+	orig := target.DeepCopy()
+
+	cond := metav1.Condition{
+		Type:               conditionTypeReady,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: target.GetGeneration(),
+		Reason:             reasonSynced,
+		Message:            "Mirrored image pull secrets to the remote cluster",
+	}
+	if syncErr != nil {
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = reasonFailedSync
+		cond.Message = syncErr.Error()
+	} else {
+		now := metav1.Now()
+		target.Status.LastSyncTime = &now
+	}
+	meta.SetStatusCondition(&target.Status.Conditions, cond)
+	target.Status.ObservedGeneration = target.GetGeneration()
+	target.Status.Namespaces = namespaces
+
+	if err := r.Status().Patch(ctx, target, client.MergeFrom(orig)); err != nil {
+		return fmt.Errorf("failed to update the status of a RemoteTarget: %w", err)
+	}
+
+	return nil
+}
+
+// selectServiceAccounts returns the ServiceAccounts whose image pull secrets are mirrored by a RemoteTarget.
+func (r *remoteTargetReconciler) selectServiceAccounts(
+	ctx context.Context, target *v1alpha1.RemoteTarget,
+) ([]corev1.ServiceAccount, error) {
+	selector, err := metav1.LabelSelectorAsSelector(&target.Spec.ServiceAccountSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ServiceAccount selector: %w", err)
+	}
+
+	sas := &corev1.ServiceAccountList{}
+	if err := r.List(
+		ctx, sas, client.InNamespace(target.GetNamespace()), client.MatchingLabelsSelector{Selector: selector},
+	); err != nil {
+		return nil, fmt.Errorf("failed to list ServiceAccounts: %w", err)
+	}
+
+	return sas.Items, nil
+}
+
+// remoteClient returns a client of the remote cluster of a RemoteTarget.
+func (r *remoteTargetReconciler) remoteClient(
+	ctx context.Context, target *v1alpha1.RemoteTarget,
+) (client.Client, error) {
+	ref := target.Spec.KubeconfigSecretRef
+	secret := &corev1.Secret{}
+	// Kubeconfig Secrets are not cached.
+	key := client.ObjectKey{Namespace: target.GetNamespace(), Name: ref.Name}
+	if err := r.apiReader.Get(ctx, key, secret); err != nil {
+		return nil, fmt.Errorf("failed to get a kubeconfig Secret: %w", err)
+	}
+
+	key = client.ObjectKeyFromObject(target)
+	r.remoteClientsMu.Lock()
+	defer r.remoteClientsMu.Unlock()
+	if c, ok := r.remoteClients[key]; ok && c.resourceVersion == secret.GetResourceVersion() {
+		return c.client, nil
+	}
+
+	kubeconfig, ok := secret.Data[ref.Key]
+	if !ok {
+		return nil, fmt.Errorf("kubeconfig Secret %s does not have key %q", ref.Name, ref.Key)
+	}
+	config, err := restConfigFromKubeconfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	c, err := client.New(config, client.Options{Scheme: r.scheme})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a client of the remote cluster: %w", err)
+	}
+	r.remoteClients[key] = remoteClient{resourceVersion: secret.GetResourceVersion(), client: c}
+
+	return c, nil
+}
+
+// forgetRemoteClient discards the client of the remote cluster of a RemoteTarget.
+func (r *remoteTargetReconciler) forgetRemoteClient(key types.NamespacedName) {
+	r.remoteClientsMu.Lock()
+	defer r.remoteClientsMu.Unlock()
+	delete(r.remoteClients, key)
+}
+
+// restConfigFromKubeconfig builds a REST config from a kubeconfig provided by users.
+// Kubeconfigs executing commands or reading files would run with the privilege of the controller, so they are rejected.
+func restConfigFromKubeconfig(kubeconfig []byte) (*rest.Config, error) {
+	config, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load a kubeconfig: %w", err)
+	}
+
+	for name, authInfo := range config.AuthInfos {
+		if authInfo.Exec != nil || authInfo.AuthProvider != nil {
+			return nil, fmt.Errorf("user %q in the kubeconfig uses an unsupported credential plugin", name)
+		}
+		if authInfo.TokenFile != "" || authInfo.ClientCertificate != "" || authInfo.ClientKey != "" {
+			return nil, fmt.Errorf("user %q in the kubeconfig refers to files", name)
+		}
+	}
+	for name, cluster := range config.Clusters {
+		if cluster.CertificateAuthority != "" {
+			return nil, fmt.Errorf("cluster %q in the kubeconfig refers to files", name)
+		}
+	}
+
+	restConfig, err := clientcmd.NewDefaultClientConfig(*config, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig: %w", err)
+	}
+
+	return restConfig, nil
+}
+
+// remoteNamespaces returns the namespaces in the remote cluster to mirror image pull secrets to.
+func remoteNamespaces(target *v1alpha1.RemoteTarget) []string {
+	if len(target.Spec.Namespaces) == 0 {
+		return []string{target.GetNamespace()}
+	}
+
+	return sets.List(sets.New(target.Spec.Namespaces...))
+}
+
+// remoteSecretName returns the name of mirrors of the image pull secret of a ServiceAccount in remote clusters.
+// It is always suffixed with a hash of the ServiceAccount because joining its namespace and name is ambiguous, and too
+// long names are truncated before the hash.
+func remoteSecretName(sa types.NamespacedName) string {
+	name := "imagepullsecret-remote-" + sa.Namespace + "-" + sa.Name
+	if len(name)+1+replicaHashLength > validation.DNS1123SubdomainMaxLength {
+		name = name[:validation.DNS1123SubdomainMaxLength-1-replicaHashLength]
+		// A label of a DNS subdomain cannot end with a dot or a hyphen followed by the separator.
+		name = strings.TrimRight(name, ".-")
+	}
+
+	return name + "-" + replicaOf(sa)
+}
+
+// remoteImagePullSecret returns a mirror of the image pull secret of a ServiceAccount to apply to a namespace in the
+// remote cluster of a RemoteTarget.
+func remoteImagePullSecret(
+	target types.NamespacedName, sa *corev1.ServiceAccount, secret *corev1.Secret, namespace string,
+) *corev1.Secret {
+	mirror := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      remoteSecretName(client.ObjectKeyFromObject(sa)),
+			Labels: map[string]string{
+				labelKeyRemoteTarget:         replicaOf(target),
+				labelKeyRemoteServiceAccount: sa.GetName(),
+			},
+			Annotations: map[string]string{
+				annotationKeyRemoteTarget: target.String(),
+				annotationKeyIssuedAt:     secret.Annotations[annotationKeyIssuedAt],
+				annotationKeyExpiresAt:    secret.Annotations[annotationKeyExpiresAt],
+				annotationKeyContentHash:  secret.Annotations[annotationKeyContentHash],
+			},
+		},
+		Type: secret.Type,
+		Data: secret.Data,
+	}
+	mirror.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Secret"))
+
+	return mirror
+}
+
+// attachMirror attaches a mirror of an image pull secret to the ServiceAccount with the given name in the remote
+// cluster. ServiceAccounts that do not exist there are not created; pods can still refer to the mirror explicitly.
+func attachMirror(ctx context.Context, remote client.Client, mirror *corev1.Secret, name string) error {
+	sa := &corev1.ServiceAccount{}
+	if err := remote.Get(ctx, client.ObjectKey{Namespace: mirror.GetNamespace(), Name: name}, sa); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	for _, ref := range sa.ImagePullSecrets {
+		if ref.Name == mirror.GetName() {
+			return nil
+		}
+	}
+
+	orig := sa.DeepCopy()
+	sa.ImagePullSecrets = append(sa.ImagePullSecrets, corev1.LocalObjectReference{Name: mirror.GetName()})
+	if err := remote.Patch(
+		ctx, sa, client.StrategicMergeFrom(orig, client.MergeFromWithOptimisticLock{}), client.FieldOwner(fieldManager),
+	); err != nil {
+		return fmt.Errorf("failed to patch a ServiceAccount in the remote cluster: %w", err)
+	}
+
+	return nil
+}
+
+// deleteMirrors detaches and deletes mirrors of a RemoteTarget in a namespace of the remote cluster except for those
+// to keep.
+func deleteMirrors(
+	ctx context.Context, remote client.Client, target types.NamespacedName, namespace string,
+	keep sets.Set[types.NamespacedName],
+) error {
+	mirrors := &corev1.SecretList{}
+	if err := remote.List(
+		ctx, mirrors, client.InNamespace(namespace), client.MatchingLabels{labelKeyRemoteTarget: replicaOf(target)},
+	); err != nil {
+		return fmt.Errorf("failed to list image pull secrets in the remote cluster: %w", err)
+	}
+
+	var errs []error
+	for _, mirror := range mirrors.Items {
+		// Guard against hash collisions.
+		if mirror.Annotations[annotationKeyRemoteTarget] != target.String() || keep.Has(client.ObjectKeyFromObject(&mirror)) {
+			continue
+		}
+
+		if err := detachMirror(ctx, remote, &mirror); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := remote.Delete(ctx, &mirror); client.IgnoreNotFound(err) != nil {
+			errs = append(errs, fmt.Errorf("failed to delete an image pull secret in the remote cluster: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// detachMirror detaches a mirror of an image pull secret from its ServiceAccount in the remote cluster.
+func detachMirror(ctx context.Context, remote client.Client, mirror *corev1.Secret) error {
+	sa := &corev1.ServiceAccount{}
+	name, ok := mirror.Labels[labelKeyRemoteServiceAccount]
+	if !ok {
+		// Mirrors applied by older versions have the label of image pull secrets instead.
+		name = mirror.Labels[labelKeyServiceAccount]
+	}
+	key := client.ObjectKey{Namespace: mirror.GetNamespace(), Name: name}
+	if err := remote.Get(ctx, key, sa); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	retained := []corev1.LocalObjectReference{}
+	for _, ref := range sa.ImagePullSecrets {
+		if ref.Name != mirror.GetName() {
+			retained = append(retained, ref)
+		}
+	}
+	if len(retained) == len(sa.ImagePullSecrets) {
+		return nil
+	}
+
+	orig := sa.DeepCopy()
+	sa.ImagePullSecrets = retained
+	if err := remote.Patch(
+		ctx, sa, client.StrategicMergeFrom(orig, client.MergeFromWithOptimisticLock{}), client.FieldOwner(fieldManager),
+	); err != nil {
+		return fmt.Errorf("failed to patch a ServiceAccount in the remote cluster: %w", err)
+	}
+
+	return nil
+}
+
+// enqueueRemoteTargets enqueues RemoteTargets in the namespace of an image pull secret, e.g. when it is refreshed.
+func (r *remoteTargetReconciler) enqueueRemoteTargets(ctx context.Context, obj client.Object) []reconcile.Request {
+	logger := log.FromContext(ctx)
+
+	targets := &v1alpha1.RemoteTargetList{}
+	if err := r.List(ctx, targets, client.InNamespace(obj.GetNamespace())); err != nil {
+		logger.Error(err, "failed to list RemoteTargets")
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(targets.Items))
+	for _, target := range targets.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&target)})
+	}
+
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *remoteTargetReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.RemoteTarget{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		// Mirror image pull secrets as soon as they are provisioned, refreshed, or deleted.
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.enqueueRemoteTargets)).
+		WithEventFilter(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return r.shard.Contains(obj.GetNamespace())
+		})).
+		Complete(r)
+}
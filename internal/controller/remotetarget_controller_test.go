@@ -0,0 +1,188 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/pfnet/image-pull-secrets-provisioner/api/v1alpha1"
+)
+
+func TestRestConfigFromKubeconfig(t *testing.T) {
+	const clusters = `
+apiVersion: v1
+kind: Config
+clusters:
+- name: edge
+  cluster:
+    server: https://edge.example.com
+contexts:
+- name: edge
+  context:
+    cluster: edge
+    user: puller
+current-context: edge
+`
+
+	for _, tt := range []struct {
+		name       string
+		kubeconfig string
+		wantErr    bool
+	}{
+		{
+			name: "Token",
+			kubeconfig: clusters + `
+users:
+- name: puller
+  user:
+    token: secret-token
+`,
+		},
+		{
+			name: "Exec",
+			kubeconfig: clusters + `
+users:
+- name: puller
+  user:
+    exec:
+      apiVersion: client.authentication.k8s.io/v1
+      command: /bin/sh
+`,
+			wantErr: true,
+		},
+		{
+			name: "Token file",
+			kubeconfig: clusters + `
+users:
+- name: puller
+  user:
+    tokenFile: /var/run/secrets/kubernetes.io/serviceaccount/token
+`,
+			wantErr: true,
+		},
+		{
+			name:       "Malformed",
+			kubeconfig: "clusters: [",
+			wantErr:    true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			config, err := restConfigFromKubeconfig([]byte(tt.kubeconfig))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if config.Host != "https://edge.example.com" || config.BearerToken != "secret-token" {
+				t.Errorf("Unexpected config: %+v", config)
+			}
+		})
+	}
+}
+
+func TestRemoteNamespaces(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		namespaces []string
+		expected   []string
+	}{
+		{
+			name:     "Default",
+			expected: []string{"hub"},
+		},
+		{
+			name:       "Specified",
+			namespaces: []string{"tenant-b", "tenant-a", "tenant-b"},
+			expected:   []string{"tenant-a", "tenant-b"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			target := &v1alpha1.RemoteTarget{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "hub",
+					Name:      "edge",
+				},
+				Spec: v1alpha1.RemoteTargetSpec{
+					Namespaces: tt.namespaces,
+				},
+			}
+
+			if diff := cmp.Diff(tt.expected, remoteNamespaces(target)); diff != "" {
+				t.Errorf("Namespaces mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRemoteSecretName(t *testing.T) {
+	key := types.NamespacedName{Namespace: "hub", Name: "puller"}
+	expected := "imagepullsecret-remote-hub-puller-" + replicaOf(key)
+	if short := remoteSecretName(key); short != expected {
+		t.Errorf("Unexpected name\n\texpected: %s\n\tactual: %s", expected, short)
+	}
+
+	// Joining the namespace and the name by a hyphen alone is ambiguous.
+	teamA := types.NamespacedName{Namespace: "team-a", Name: "x"}
+	team := types.NamespacedName{Namespace: "team", Name: "a-x"}
+	if remoteSecretName(teamA) == remoteSecretName(team) {
+		t.Errorf("Names of different ServiceAccounts collide: %s", remoteSecretName(teamA))
+	}
+
+	long := types.NamespacedName{Namespace: "hub", Name: strings.Repeat("a", validation.DNS1123SubdomainMaxLength)}
+	name := remoteSecretName(long)
+	if len(name) > validation.DNS1123SubdomainMaxLength {
+		t.Errorf("Name is too long: %d", len(name))
+	}
+	if !strings.HasSuffix(name, "-"+replicaOf(long)) {
+		t.Errorf("Name is not suffixed with a hash: %s", name)
+	}
+}
+
+func TestRemoteImagePullSecretIsNotLocal(t *testing.T) {
+	target := types.NamespacedName{Namespace: "hub", Name: "target"}
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "hub", Name: "puller", UID: "uid-0"}}
+	secret := &corev1.Secret{Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{}}`)}}
+
+	// Mirror into the same namespace of the hub cluster, where a ServiceAccount of the same name exists.
+	mirror := remoteImagePullSecret(target, sa, secret, "hub")
+
+	if mirror.Labels[labelKeyRemoteServiceAccount] != "puller" {
+		t.Errorf("Unexpected labels: %v", mirror.Labels)
+	}
+	if ImagePullSecretSelector().Matches(labels.Set(mirror.Labels)) {
+		t.Errorf("Mirror is selected as an image pull secret: %v", mirror.Labels)
+	}
+	if isOwnedBy(mirror, sa) {
+		t.Errorf("Mirror is owned by the ServiceAccount of the same name")
+	}
+}
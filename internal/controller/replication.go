@@ -0,0 +1,436 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Name of the ServiceAccount in each namespace that replicas of image pull secrets are attached to.
+const defaultServiceAccountName = "default"
+
+// Length of the hash of a ServiceAccount in the label of replicas.
+const replicaHashLength = 16
+
+// replicaOf returns the value of the label to select replicas of the image pull secret of a ServiceAccount.
+// ServiceAccount names can be longer than label values, so it is a hash of the namespace and the name.
+func replicaOf(sa types.NamespacedName) string {
+	sum := sha256.Sum256([]byte(sa.String()))
+	return hex.EncodeToString(sum[:])[:replicaHashLength]
+}
+
+// replicaSecretName returns the name of replicas of the image pull secret of a ServiceAccount.
+// It is always suffixed with a hash of the ServiceAccount because joining its namespace and name is ambiguous, and too
+// long names are truncated before the hash.
+func replicaSecretName(sa types.NamespacedName) string {
+	name := "imagepullsecret-replica-" + sa.Namespace + "-" + sa.Name
+	if len(name)+1+replicaHashLength > validation.DNS1123SubdomainMaxLength {
+		name = name[:validation.DNS1123SubdomainMaxLength-1-replicaHashLength]
+		// A label of a DNS subdomain cannot end with a dot or a hyphen followed by the separator.
+		name = strings.TrimRight(name, ".-")
+	}
+
+	return name + "-" + replicaOf(sa)
+}
+
+// unhashedReplicaSecretName returns the name that replicas of the image pull secret of a ServiceAccount had before
+// names were always suffixed with a hash, or an empty string if the name was already suffixed.
+func unhashedReplicaSecretName(sa types.NamespacedName) string {
+	name := "imagepullsecret-replica-" + sa.Namespace + "-" + sa.Name
+	if len(name) > validation.DNS1123SubdomainMaxLength {
+		return ""
+	}
+
+	return name
+}
+
+// replicateImagePullSecret replicates the image pull secret of a ServiceAccount to the namespaces selected by its
+// replicate-to-namespaces annotation, and attaches the replicas to the default ServiceAccount of each namespace.
+// Replicas in namespaces no longer selected are detached and deleted. Passing nil as secret deletes all replicas, and
+// passing nil as sa also does so for a ServiceAccount that no longer exists.
+// It does nothing unless replication is enabled.
+func (r *serviceAccountReconciler) replicateImagePullSecret(
+	ctx context.Context, logger logr.Logger, key types.NamespacedName, sa *corev1.ServiceAccount, secret *corev1.Secret,
+) error {
+	if !r.replication {
+		return nil
+	}
+
+	// The namespaces of replicas are unknown without the ServiceAccount, so look for them across the cluster.
+	if sa == nil {
+		deleted, err := r.deleteReplicas(ctx, key)
+		if len(deleted) > 0 {
+			logger.Info("Deleted replicas of the image pull secret.", "namespaces", deleted)
+		}
+		return err
+	}
+
+	namespaces := []string{}
+	if secret != nil {
+		var err error
+		if namespaces, err = r.replicationTargets(ctx, sa); err != nil {
+			return err
+		}
+	}
+
+	for _, ns := range namespaces {
+		replica, err := r.ensureReplica(ctx, key, secret, ns)
+		if err != nil {
+			return err
+		}
+		if err := r.attachReplica(ctx, replica); err != nil {
+			return err
+		}
+		if err := r.deleteUnhashedReplica(ctx, key, ns); err != nil {
+			return err
+		}
+	}
+	if len(namespaces) > 0 {
+		logger.Info("Replicated the image pull secret.", "namespaces", namespaces)
+	}
+
+	// Namespaces of replicas are tracked in the ServiceAccount not to look for them across the cluster every time.
+	replicated := replicatedNamespaces(sa)
+	desired := sets.New(namespaces...)
+	for ns := range replicated.Difference(desired) {
+		replica := &corev1.Secret{}
+		if err := r.apiReader.Get(ctx, client.ObjectKey{Namespace: ns, Name: replicaSecretName(key)}, replica); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return fmt.Errorf("failed to get a replica of an image pull secret: %w", err)
+		}
+		if err := r.deleteReplica(ctx, replica); err != nil {
+			return err
+		}
+		if err := r.deleteUnhashedReplica(ctx, key, ns); err != nil {
+			return err
+		}
+		logger.Info("Deleted a replica of the image pull secret.", "namespace", ns)
+	}
+
+	if replicated.Equal(desired) {
+		return nil
+	}
+	orig := sa.DeepCopy()
+	setReplicatedNamespaces(sa, desired)
+	if err := r.Patch(ctx, sa, client.MergeFrom(orig), client.FieldOwner(fieldManager)); err != nil {
+		return fmt.Errorf("failed to patch a ServiceAccount: %w", err)
+	}
+
+	return nil
+}
+
+// replicatedNamespaces returns the namespaces that the image pull secret of a ServiceAccount is replicated to.
+func replicatedNamespaces(sa *corev1.ServiceAccount) sets.Set[string] {
+	namespaces := sets.New[string]()
+	for _, ns := range strings.Split(sa.Annotations[annotationKeyReplicatedTo], ",") {
+		if ns != "" {
+			namespaces.Insert(ns)
+		}
+	}
+
+	return namespaces
+}
+
+// setReplicatedNamespaces records the namespaces that the image pull secret of a ServiceAccount is replicated to.
+func setReplicatedNamespaces(sa *corev1.ServiceAccount, namespaces sets.Set[string]) {
+	if namespaces.Len() == 0 {
+		delete(sa.Annotations, annotationKeyReplicatedTo)
+		return
+	}
+
+	if sa.Annotations == nil {
+		sa.Annotations = map[string]string{}
+	}
+	sa.Annotations[annotationKeyReplicatedTo] = strings.Join(sets.List(namespaces), ",")
+}
+
+// replicationTargets returns the namespaces to replicate the image pull secret of a ServiceAccount to.
+func (r *serviceAccountReconciler) replicationTargets(
+	ctx context.Context, sa *corev1.ServiceAccount,
+) ([]string, error) {
+	selector, err := replicationSelector(sa)
+	if err != nil || selector == nil {
+		return nil, err
+	}
+
+	namespaces := &corev1.NamespaceList{}
+	if err := r.List(ctx, namespaces, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+
+	targets := []string{}
+	for _, ns := range namespaces.Items {
+		if ns.GetName() == sa.GetNamespace() || ns.Status.Phase == corev1.NamespaceTerminating ||
+			!r.replicationAllowed(&ns) {
+			continue
+		}
+		targets = append(targets, ns.GetName())
+	}
+
+	return targets, nil
+}
+
+// replicationAllowed returns true iff image pull secrets can be replicated to a namespace, as selected by the operator
+// regardless of the selectors of ServiceAccounts.
+func (r *serviceAccountReconciler) replicationAllowed(ns client.Object) bool {
+	return r.replicationNamespaces != nil && r.replicationNamespaces.Matches(labels.Set(ns.GetLabels()))
+}
+
+// replicationSelector returns the label selector of namespaces to replicate the image pull secret of a ServiceAccount
+// to, or nil if the ServiceAccount does not have the annotation.
+func replicationSelector(sa *corev1.ServiceAccount) (labels.Selector, error) {
+	str := annotation(sa, annotationKeyReplicateToNamespaces)
+	if str == "" {
+		return nil, nil
+	}
+
+	selector, err := labels.Parse(str)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %q annotation: %w", annotationKeyReplicateToNamespaces, err)
+	}
+
+	return selector, nil
+}
+
+// ensureReplica creates or updates a replica of an image pull secret in a namespace by server-side apply.
+func (r *serviceAccountReconciler) ensureReplica(
+	ctx context.Context, sa types.NamespacedName, secret *corev1.Secret, namespace string,
+) (*corev1.Secret, error) {
+	replica := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      replicaSecretName(sa),
+			Labels: map[string]string{
+				labelKeyReplicaOf: replicaOf(sa),
+			},
+			Annotations: map[string]string{
+				annotationKeyReplicaOf:   sa.String(),
+				annotationKeyIssuedAt:    secret.Annotations[annotationKeyIssuedAt],
+				annotationKeyExpiresAt:   secret.Annotations[annotationKeyExpiresAt],
+				annotationKeyContentHash: secret.Annotations[annotationKeyContentHash],
+			},
+		},
+		Type: secret.Type,
+		Data: secret.Data,
+	}
+	replica.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Secret"))
+
+	if err := r.Patch(ctx, replica, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership); err != nil {
+		return nil, fmt.Errorf("failed to apply a replica of an image pull secret: %w", err)
+	}
+
+	return replica, nil
+}
+
+// attachReplica attaches a replica of an image pull secret to the default ServiceAccount of its namespace, and records
+// it as attached by the controller.
+func (r *serviceAccountReconciler) attachReplica(ctx context.Context, replica *corev1.Secret) error {
+	// ServiceAccounts in other namespaces may not be cached.
+	sa := &corev1.ServiceAccount{}
+	key := client.ObjectKey{Namespace: replica.GetNamespace(), Name: defaultServiceAccountName}
+	if err := r.apiReader.Get(ctx, key, sa); err != nil {
+		// The default ServiceAccount of a new namespace may not be created yet, so retry later.
+		return fmt.Errorf("failed to get the default ServiceAccount: %w", err)
+	}
+
+	return r.retryOnConflict(ctx, sa, func() error {
+		attached, _ := attachedSecrets(sa)
+		if r.imagePullSecretAttached(sa, replica.GetName()) && attached.Has(replica.GetName()) {
+			return nil
+		}
+
+		orig := sa.DeepCopy()
+		if !r.imagePullSecretAttached(sa, replica.GetName()) {
+			sa.ImagePullSecrets = append(sa.ImagePullSecrets, corev1.LocalObjectReference{Name: replica.GetName()})
+		}
+		attached.Insert(replica.GetName())
+		setAttachedSecrets(sa, attached)
+
+		if err := r.Patch(
+			ctx, sa, client.StrategicMergeFrom(orig, client.MergeFromWithOptimisticLock{}), client.FieldOwner(fieldManager),
+		); err != nil {
+			return fmt.Errorf("failed to patch the default ServiceAccount: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// deleteReplicas detaches and deletes all replicas of the image pull secret of a ServiceAccount across the cluster.
+// It returns the namespaces of the deleted replicas.
+func (r *serviceAccountReconciler) deleteReplicas(ctx context.Context, sa types.NamespacedName) ([]string, error) {
+	// Replicas are not cached.
+	replicas := &corev1.SecretList{}
+	if err := r.apiReader.List(ctx, replicas, client.MatchingLabels{labelKeyReplicaOf: replicaOf(sa)}); err != nil {
+		return nil, fmt.Errorf("failed to list replicas of an image pull secret: %w", err)
+	}
+
+	deleted := []string{}
+	for _, replica := range replicas.Items {
+		// Guard against hash collisions.
+		if replica.Annotations[annotationKeyReplicaOf] != sa.String() {
+			continue
+		}
+
+		if err := r.deleteReplica(ctx, &replica); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, replica.GetNamespace())
+	}
+
+	return deleted, nil
+}
+
+// deleteReplica detaches a replica of an image pull secret from the default ServiceAccount of its namespace, and
+// deletes it.
+func (r *serviceAccountReconciler) deleteReplica(ctx context.Context, replica *corev1.Secret) error {
+	sa := &corev1.ServiceAccount{}
+	key := client.ObjectKey{Namespace: replica.GetNamespace(), Name: defaultServiceAccountName}
+	if err := r.apiReader.Get(ctx, key, sa); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("failed to get the default ServiceAccount: %w", err)
+	} else if err == nil {
+		if err := r.detachImagePullSecret(ctx, sa, []*corev1.Secret{replica}); err != nil {
+			return fmt.Errorf("failed to detach a replica of an image pull secret: %w", err)
+		}
+	}
+
+	if err := r.Delete(ctx, replica); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("failed to delete a replica of an image pull secret: %w", err)
+	}
+
+	return nil
+}
+
+// deleteUnhashedReplica detaches and deletes a replica of the image pull secret of a ServiceAccount in a namespace
+// named as before names were always suffixed with a hash.
+func (r *serviceAccountReconciler) deleteUnhashedReplica(
+	ctx context.Context, sa types.NamespacedName, namespace string,
+) error {
+	name := unhashedReplicaSecretName(sa)
+	if name == "" {
+		return nil
+	}
+
+	replica := &corev1.Secret{}
+	if err := r.apiReader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, replica); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to get a replica of an image pull secret: %w", err)
+	}
+	// The name may have been shared by replicas of another ServiceAccount.
+	if replica.Annotations[annotationKeyReplicaOf] != sa.String() {
+		return nil
+	}
+
+	return r.deleteReplica(ctx, replica)
+}
+
+// sweepOrphanedReplicas deletes replicas of image pull secrets whose ServiceAccount no longer exists.
+// Replicas of existing ServiceAccounts are kept up to date by the reconciliation.
+func (r *serviceAccountReconciler) sweepOrphanedReplicas(ctx context.Context) error {
+	logger := log.FromContext(ctx)
+
+	replicas := &corev1.SecretList{}
+	if err := r.apiReader.List(ctx, replicas, client.HasLabels{labelKeyReplicaOf}); err != nil {
+		return fmt.Errorf("failed to list replicas of image pull secrets: %w", err)
+	}
+
+	sources := sets.New[types.NamespacedName]()
+	for _, replica := range replicas.Items {
+		ns, name, ok := cutNamespacedName(replica.Annotations[annotationKeyReplicaOf])
+		if ok && r.shard.Contains(ns) {
+			sources.Insert(types.NamespacedName{Namespace: ns, Name: name})
+		}
+	}
+
+	var errs []error
+	for key := range sources {
+		if err := r.Get(ctx, key, &corev1.ServiceAccount{}); !apierrors.IsNotFound(err) {
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to get a ServiceAccount: %w", err))
+			}
+			continue
+		}
+
+		if r.dryRun {
+			logger.Info("Dry run: would delete orphaned replicas of an image pull secret.", "serviceAccount", key)
+			continue
+		}
+		deleted, err := r.deleteReplicas(ctx, key)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		logger.Info("Deleted orphaned replicas of an image pull secret.", "serviceAccount", key, "namespaces", deleted)
+	}
+
+	return errors.Join(errs...)
+}
+
+// cutNamespacedName parses a string formatted as "namespace/name".
+func cutNamespacedName(str string) (namespace string, name string, ok bool) {
+	namespace, name, ok = strings.Cut(str, string(types.Separator))
+	return namespace, name, ok && namespace != "" && name != ""
+}
+
+// enqueueReplicatingServiceAccounts enqueues ServiceAccounts whose image pull secrets are to be replicated to a
+// namespace, e.g. when the namespace is created or its labels are changed.
+func (r *serviceAccountReconciler) enqueueReplicatingServiceAccounts(
+	ctx context.Context, obj client.Object,
+) []reconcile.Request {
+	logger := log.FromContext(ctx)
+
+	sas := &corev1.ServiceAccountList{}
+	if err := r.List(ctx, sas); err != nil {
+		logger.Error(err, "failed to list ServiceAccounts")
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for _, sa := range sas.Items {
+		if sa.GetNamespace() == obj.GetName() || !r.shard.Contains(sa.GetNamespace()) {
+			continue
+		}
+		selector, err := replicationSelector(&sa)
+		if err != nil || selector == nil || !selector.Matches(labels.Set(obj.GetLabels())) {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&sa)})
+	}
+
+	return requests
+}
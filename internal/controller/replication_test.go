@@ -0,0 +1,172 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func TestReplicaSecretName(t *testing.T) {
+	short := types.NamespacedName{Namespace: "namespace-0", Name: "serviceaccount-0"}
+	expected := "imagepullsecret-replica-namespace-0-serviceaccount-0-" + replicaOf(short)
+	if actual := replicaSecretName(short); actual != expected {
+		t.Errorf("Unexpected name\n\texpected: %s\n\tactual: %s", expected, actual)
+	}
+
+	// Joining the namespace and the name by a hyphen alone is ambiguous.
+	teamA := types.NamespacedName{Namespace: "team-a", Name: "x"}
+	team := types.NamespacedName{Namespace: "team", Name: "a-x"}
+	if replicaSecretName(teamA) == replicaSecretName(team) {
+		t.Errorf("Names of different ServiceAccounts collide: %s", replicaSecretName(teamA))
+	}
+
+	long := types.NamespacedName{Namespace: "namespace-0", Name: strings.Repeat("a", validation.DNS1123SubdomainMaxLength)}
+	name := replicaSecretName(long)
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		t.Errorf("Invalid name %s: %v", name, errs)
+	}
+	other := types.NamespacedName{Namespace: "namespace-0", Name: long.Name + "b"}
+	if name == replicaSecretName(other) {
+		t.Errorf("Truncated names are not unique")
+	}
+}
+
+func TestReplicationSelector(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		annotation string
+		namespace  map[string]string
+		expected   bool
+		wantErr    bool
+	}{
+		{
+			name:      "No annotation",
+			namespace: map[string]string{"tenant": "true"},
+			expected:  false,
+		},
+		{
+			name:       "Matching",
+			annotation: "tenant=true",
+			namespace:  map[string]string{"tenant": "true"},
+			expected:   true,
+		},
+		{
+			name:       "Not matching",
+			annotation: "tenant=true",
+			namespace:  map[string]string{"tenant": "false"},
+			expected:   false,
+		},
+		{
+			name:       "Invalid",
+			annotation: "tenant in (true",
+			wantErr:    true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}}}
+			if tt.annotation != "" {
+				sa.Annotations["imagepullsecrets.preferred.jp/replicate-to-namespaces"] = tt.annotation
+			}
+
+			selector, err := replicationSelector(sa)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unexpected error\n\twantErr: %t\n\tactual: %v", tt.wantErr, err)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			actual := selector != nil && selector.Matches(labels.Set(tt.namespace))
+			if actual != tt.expected {
+				t.Errorf("Unexpected match\n\texpected: %t\n\tactual: %t", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestCutNamespacedName(t *testing.T) {
+	ns, name, ok := cutNamespacedName("namespace-0/serviceaccount-0")
+	if !ok || ns != "namespace-0" || name != "serviceaccount-0" {
+		t.Errorf("Unexpected result: %s, %s, %t", ns, name, ok)
+	}
+
+	for _, str := range []string{"", "namespace-0", "/serviceaccount-0", "namespace-0/"} {
+		if _, _, ok := cutNamespacedName(str); ok {
+			t.Errorf("Invalid string is accepted: %q", str)
+		}
+	}
+}
+
+func TestReplicatedNamespaces(t *testing.T) {
+	sa := &corev1.ServiceAccount{}
+
+	setReplicatedNamespaces(sa, sets.New("namespace-1", "namespace-0"))
+	if actual := sa.Annotations["imagepullsecrets.preferred.jp/replicated-to"]; actual != "namespace-0,namespace-1" {
+		t.Errorf("Unexpected annotation\n\texpected: %s\n\tactual: %s", "namespace-0,namespace-1", actual)
+	}
+	if actual := replicatedNamespaces(sa); !actual.Equal(sets.New("namespace-0", "namespace-1")) {
+		t.Errorf("Unexpected namespaces: %v", sets.List(actual))
+	}
+
+	setReplicatedNamespaces(sa, sets.New[string]())
+	if _, ok := sa.Annotations["imagepullsecrets.preferred.jp/replicated-to"]; ok {
+		t.Errorf("Annotation is not removed")
+	}
+}
+
+func TestReplicationAllowed(t *testing.T) {
+	tests := map[string]struct {
+		selector  labels.Selector
+		namespace map[string]string
+		expected  bool
+	}{
+		"no selector": {
+			namespace: map[string]string{"kubernetes.io/metadata.name": "kube-system"},
+			expected:  false,
+		},
+		"selected": {
+			selector:  labels.SelectorFromSet(labels.Set{"tenant": "true"}),
+			namespace: map[string]string{"kubernetes.io/metadata.name": "team-a", "tenant": "true"},
+			expected:  true,
+		},
+		"not selected": {
+			selector:  labels.SelectorFromSet(labels.Set{"tenant": "true"}),
+			namespace: map[string]string{"kubernetes.io/metadata.name": "kube-system"},
+			expected:  false,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := &serviceAccountReconciler{replicationNamespaces: tt.selector}
+			ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Labels: tt.namespace}}
+			if actual := r.replicationAllowed(ns); actual != tt.expected {
+				t.Errorf("Unexpected result\n\texpected: %t\n\tactual: %t", tt.expected, actual)
+			}
+		})
+	}
+}
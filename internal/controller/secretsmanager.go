@@ -0,0 +1,108 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	secretsmanagertypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	corev1 "k8s.io/api/core/v1"
+
+	awscredentials "github.com/pfnet/image-pull-secrets-provisioner/pkg/credentials/aws"
+)
+
+// awsSecretsManagerWriter writes image pull secrets to AWS Secrets Manager as the AWS IAM roles that ServiceAccounts
+// are federated to, so that the controller itself needs no AWS credentials.
+type awsSecretsManagerWriter struct {
+	aws    *awsImpl
+	client *secretsmanager.Client
+}
+
+var _ secretWriter = &awsSecretsManagerWriter{}
+
+func newAWSSecretsManagerWriter(opts AWSClientOptions) (*awsSecretsManagerWriter, error) {
+	cfg, err := opts.config()
+	if err != nil {
+		return nil, err
+	}
+
+	return &awsSecretsManagerWriter{
+		aws:    &awsImpl{Client: awscredentials.NewClient(awscredentials.WithConfig(cfg))},
+		client: secretsmanager.NewFromConfig(cfg),
+	}, nil
+}
+
+func (w *awsSecretsManagerWriter) name() string {
+	return secretWriterAWSSecretsManager
+}
+
+func (w *awsSecretsManagerWriter) target(sa *corev1.ServiceAccount) string {
+	return annotation(sa, annotationKeyAWSSecretsManagerSecretID)
+}
+
+// write puts the Docker config JSON as a new version of the secret. A secret specified by a name is created if it
+// does not exist.
+func (w *awsSecretsManagerWriter) write(
+	ctx context.Context, sa *corev1.ServiceAccount, k8sToken string, target string, dockerConfigJSON []byte,
+) error {
+	region, err := w.region(sa, target)
+	if err != nil {
+		return err
+	}
+	opt := func(o *secretsmanager.Options) {
+		o.Region = region
+		o.Credentials = w.aws.Credentials(k8sToken, region, annotation(sa, annotationKeyAWSRoleARN))
+	}
+	value := string(dockerConfigJSON)
+
+	_, err = w.client.PutSecretValue(ctx, &secretsmanager.PutSecretValueInput{
+		SecretId:     &target,
+		SecretString: &value,
+	}, opt)
+	var notFound *secretsmanagertypes.ResourceNotFoundException
+	if errors.As(err, &notFound) && !arn.IsARN(target) {
+		description := fmt.Sprintf("Image pull secret of Kubernetes ServiceAccount %s/%s", sa.GetNamespace(), sa.GetName())
+		_, err = w.client.CreateSecret(ctx, &secretsmanager.CreateSecretInput{
+			Name:         &target,
+			Description:  &description,
+			SecretString: &value,
+		}, opt)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to put a secret value to AWS Secrets Manager: %w", err)
+	}
+
+	return nil
+}
+
+// region returns the AWS region of a secret, i.e. that of its ARN, or that of the ServiceAccount for a name.
+func (w *awsSecretsManagerWriter) region(sa *corev1.ServiceAccount, target string) (string, error) {
+	if !arn.IsARN(target) {
+		return awsRegion(sa, w.aws)
+	}
+
+	parsed, err := arn.Parse(target)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse the ARN of a secret: %w", err)
+	}
+
+	return parsed.Region, nil
+}
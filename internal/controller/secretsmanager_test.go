@@ -0,0 +1,180 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	awscredentials "github.com/pfnet/image-pull-secrets-provisioner/pkg/credentials/aws"
+	"github.com/pfnet/image-pull-secrets-provisioner/pkg/credentials/credentialstest"
+)
+
+// fakeSecretsManager serves PutSecretValue and CreateSecret of AWS Secrets Manager for secrets it holds by name.
+type fakeSecretsManager struct {
+	mu      sync.Mutex
+	secrets map[string]string
+	calls   []string
+}
+
+func (f *fakeSecretsManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		SecretId     string
+		Name         string
+		SecretString string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	target := r.Header.Get("X-Amz-Target")
+	f.calls = append(f.calls, target)
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	switch target {
+	case "secretsmanager.PutSecretValue":
+		if _, ok := f.secrets[body.SecretId]; !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"ResourceNotFoundException","message":"not found"}`))
+			return
+		}
+		f.secrets[body.SecretId] = body.SecretString
+	case "secretsmanager.CreateSecret":
+		f.secrets[body.Name] = body.SecretString
+	default:
+		http.Error(w, "unexpected target", http.StatusBadRequest)
+		return
+	}
+	_, _ = w.Write([]byte(`{}`))
+}
+
+func TestAWSSecretsManagerWriter(t *testing.T) {
+	testCases := []struct {
+		name     string
+		target   string
+		existing map[string]string
+		calls    []string
+		secrets  map[string]string
+		wantErr  bool
+	}{
+		{
+			name:     "existing",
+			target:   "fake",
+			existing: map[string]string{"fake": "old"},
+			calls:    []string{"secretsmanager.PutSecretValue"},
+			secrets:  map[string]string{"fake": "new"},
+		},
+		{
+			name:     "missing name",
+			target:   "fake",
+			existing: map[string]string{},
+			calls:    []string{"secretsmanager.PutSecretValue", "secretsmanager.CreateSecret"},
+			secrets:  map[string]string{"fake": "new"},
+		},
+		{
+			name:     "missing ARN",
+			target:   "arn:aws:secretsmanager:us-east-1:123456789012:secret:fake",
+			existing: map[string]string{},
+			calls:    []string{"secretsmanager.PutSecretValue"},
+			secrets:  map[string]string{},
+			wantErr:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fakeAWS := credentialstest.NewFakeAWS(t)
+			sm := &fakeSecretsManager{secrets: tc.existing}
+			server := httptest.NewServer(sm)
+			t.Cleanup(server.Close)
+
+			w := &awsSecretsManagerWriter{
+				aws: &awsImpl{Client: awscredentials.NewClient(awscredentials.WithSTSEndpoint(fakeAWS.URL()))},
+				client: secretsmanager.New(secretsmanager.Options{
+					BaseEndpoint:     &server.URL,
+					RetryMaxAttempts: 1,
+				}),
+			}
+			sa := &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      "fake",
+					Annotations: map[string]string{
+						annotationKeyRegistry:                  "123456789012.dkr.ecr.us-east-1.amazonaws.com",
+						annotationKeyAWSRoleARN:                "arn:aws:iam::123456789012:role/fake",
+						annotationKeyAWSSecretsManagerSecretID: tc.target,
+					},
+				},
+			}
+
+			if target := w.target(sa); target != tc.target {
+				t.Errorf("Unexpected target\n\texpected: %v\n\tactual: %v", tc.target, target)
+			}
+			err := w.write(context.Background(), sa, "fake-token", tc.target, []byte("new"))
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Unexpected error\n\texpected: %v\n\tactual: %v", tc.wantErr, err)
+			}
+			if !slices.Equal(sm.calls, tc.calls) {
+				t.Errorf("Unexpected calls\n\texpected: %v\n\tactual: %v", tc.calls, sm.calls)
+			}
+			for name, value := range tc.secrets {
+				if sm.secrets[name] != value {
+					t.Errorf("Unexpected secret %s\n\texpected: %v\n\tactual: %v", name, value, sm.secrets[name])
+				}
+			}
+		})
+	}
+}
+
+func TestAWSSecretsManagerWriterRegion(t *testing.T) {
+	w := &awsSecretsManagerWriter{aws: &awsImpl{}}
+	sa := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				annotationKeyRegistry: "123456789012.dkr.ecr.us-east-1.amazonaws.com",
+			},
+		},
+	}
+
+	testCases := []struct {
+		target string
+		region string
+	}{
+		{target: "fake", region: "us-east-1"},
+		{target: "arn:aws:secretsmanager:ap-northeast-1:123456789012:secret:fake", region: "ap-northeast-1"},
+	}
+	for _, tc := range testCases {
+		region, err := w.region(sa, tc.target)
+		if err != nil {
+			t.Fatalf("Failed to get a region of %s: %v", tc.target, err)
+		}
+		if region != tc.region {
+			t.Errorf("Unexpected region of %s\n\texpected: %v\n\tactual: %v", tc.target, tc.region, region)
+		}
+	}
+}
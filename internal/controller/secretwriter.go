@@ -0,0 +1,116 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Names of secret writers to enable by ServiceAccountReconcilerOptions.SecretWriters.
+const (
+	secretWriterAWSSecretsManager = "aws-secrets-manager"
+)
+
+// SecretWriterNames are the names of secret writers that can be enabled.
+var SecretWriterNames = []string{secretWriterAWSSecretsManager}
+
+// secretWriter writes image pull secrets to a secret store outside the cluster in addition to Kubernetes Secrets, e.g.
+// for workloads consuming registry credentials through the Secrets Store CSI driver. Kubernetes Secrets remain the
+// record of when image pull secrets are provisioned and to be refreshed.
+type secretWriter interface {
+	// name identifies the secret store in logs and events.
+	name() string
+
+	// target returns where a ServiceAccount asks to write its image pull secret in the secret store, or an empty string
+	// if it does not ask for the secret store.
+	target(sa *corev1.ServiceAccount) string
+
+	// write writes the Docker config JSON of an image pull secret to the target on behalf of a ServiceAccount by its
+	// token.
+	write(ctx context.Context, sa *corev1.ServiceAccount, k8sToken string, target string, dockerConfigJSON []byte) error
+}
+
+// newSecretWriters creates the secret writers of the given names.
+func newSecretWriters(names []string, awsOpts AWSClientOptions) ([]secretWriter, error) {
+	var writers []secretWriter
+	for _, name := range names {
+		switch name {
+		case secretWriterAWSSecretsManager:
+			w, err := newAWSSecretsManagerWriter(awsOpts)
+			if err != nil {
+				return nil, err
+			}
+			writers = append(writers, w)
+		default:
+			return nil, fmt.Errorf("unknown secret writer: %q", name)
+		}
+	}
+
+	return writers, nil
+}
+
+// writeToSecretStores writes the Docker config JSON of an image pull secret to the secret stores that a ServiceAccount
+// asks for. It is called before the image pull secret is ensured so that a failure is retried by refreshing the image
+// pull secret again.
+func (r *serviceAccountReconciler) writeToSecretStores(
+	ctx context.Context, logger logr.Logger, sa *corev1.ServiceAccount, secret *corev1.Secret,
+) error {
+	written := false
+	for _, w := range r.secretWriters {
+		target := w.target(sa)
+		if target == "" {
+			continue
+		}
+
+		// Written on behalf of the ServiceAccount, so that it can write only where its principal is allowed to.
+		k8sToken, err := r.createServiceAccountToken(ctx, sa, audiences(sa))
+		if err != nil {
+			return err
+		}
+		err = func() error {
+			// Bounded like calls to container registry providers not to stall a reconciliation.
+			// The timeout applies only to this write, not to the following writers and the rotation hint.
+			wctx := ctx
+			if r.providerTimeout > 0 {
+				var cancel context.CancelFunc
+				wctx, cancel = context.WithTimeout(ctx, r.providerTimeout)
+				defer cancel()
+			}
+			// Errors of secret stores may echo request bodies including the credentials.
+			return redactError(w.write(wctx, sa, k8sToken, target, secret.Data[corev1.DockerConfigJsonKey]))
+		}()
+		if err != nil {
+			return fmt.Errorf("failed to write the image pull secret to %s: %w", w.name(), err)
+		}
+		logger.Info("Wrote the image pull secret to a secret store.", "store", w.name(), "target", target)
+		written = true
+	}
+
+	if written && r.csiRotationHints {
+		// Only hints; volumes rotate on their own interval anyway, so a failure does not fail provisioning.
+		if err := r.requestSecretsStoreCSIRotation(ctx, sa, time.Now()); err != nil {
+			logger.Error(err, "Failed to request the Secrets Store CSI driver to rotate volumes.")
+		}
+	}
+
+	return nil
+}
@@ -18,31 +18,259 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"reflect"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-logr/logr"
-	authenticationv1 "k8s.io/api/authentication/v1"
+	"golang.org/x/time/rate"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	googlecredentials "github.com/pfnet/image-pull-secrets-provisioner/pkg/credentials/google"
 )
 
 type serviceAccountReconciler struct {
 	client.Client
+	// Reader not backed by the cache, which only has image pull secrets provisioned by the controller.
+	apiReader client.Reader
 	*runtime.Scheme
 	eventRecorder record.EventRecorder
 	aws           aws
 	google        google
-	// Grace period for refreshing image pull secrets before they expires.
-	expirationGracePeriod time.Duration
+	// When to refresh image pull secrets, which can be changed at runtime.
+	refresh   RefreshPolicy
+	refreshMu sync.RWMutex
+	// Whether to provision immutable image pull secrets that are rotated by renaming.
+	immutableSecrets bool
+	// Extra labels and annotations to add to image pull secrets.
+	secretLabels      map[string]string
+	secretAnnotations map[string]string
+	// Interval to sweep orphaned image pull secrets. Zero disables sweeping.
+	orphanSweepInterval time.Duration
+	// Backoff to retry provisioning failures, e.g. errors from container registry providers.
+	backoff *failureBackoff
+	// Timeout of each call to container registry providers. Zero disables the timeout.
+	providerTimeout time.Duration
+	// Namespaces to reconcile by this replica.
+	shard Shard
+	// Window before the expiration in which image pull secrets are reported as expiring soon.
+	expiringSoonWindow time.Duration
+	// Number of consecutive provisioning failures across ServiceAccounts to report the controller as not ready.
+	// Zero disables the readiness check.
+	readinessFailureThreshold int
+	failureStreak             atomic.Int64
+	// Whether to only report the changes that would be made without mutating the cluster.
+	dryRun bool
+	// Audit log of access tokens handed out to ServiceAccounts. Nil disables auditing.
+	auditLog *auditLog
+	// Whether to replicate image pull secrets to namespaces selected by ServiceAccounts.
+	replication bool
+	// Namespaces that image pull secrets can be replicated to, whatever ServiceAccounts select.
+	replicationNamespaces labels.Selector
+	// Namespaces that ServiceAccounts can designate to provision their image pull secrets in.
+	secretNamespaces sets.Set[string]
+	// Cache to share access tokens among ServiceAccounts federated to the same principal. Nil disables sharing.
+	tokenCache *tokenCache
+	// Cache of ServiceAccounts without outdated image pull secrets to skip listing Secrets. Nil disables caching.
+	cleanups *cleanupCache
+	// Planner of refreshes bounding parallel calls to each registry. Nil disables tracking and bounding refreshes.
+	planner                 *refreshPlanner
+	maxConcurrentReconciles int
+	// Secret stores outside the cluster to write image pull secrets to as well.
+	secretWriters []secretWriter
+	// Whether to request the Secrets Store CSI driver to rotate volumes after writing to secret stores.
+	csiRotationHints bool
+	// Circuit breakers to stop calling container registry providers during their outages.
+	awsBreaker    *circuitBreaker
+	googleBreaker *circuitBreaker
+	// Rate limiters of calls to container registry providers.
+	awsLimiter    *rate.Limiter
+	googleLimiter *rate.Limiter
+	// Duration for which in-flight reconciliations continue after the controller is stopped.
+	drainTimeout time.Duration
+	// Verifier of credentials against container registries for ServiceAccounts opting in.
+	verifier *registryVerifier
+	// Interval to probe registries with representative image pull secrets. Zero disables probing.
+	registryProbeInterval time.Duration
+	// Address to serve the statusz endpoint on. Empty disables the endpoint.
+	statuszAddr string
+	// Whether to check that a provider will be called before creating a ServiceAccount token.
+	preflightTokenRequests bool
+	// Verbosity of informational logs of each reconciliation.
+	reconcileLogVerbosity int
+	// ServiceAccounts to leave alone in addition to those annotated.
+	ignoredServiceAccounts ServiceAccountPatterns
+	// ConfigMap to hand over ServiceAccounts due for refresh soon to the next leader. Empty disables handover.
+	handoverConfigMap types.NamespacedName
+	// Registries probed last time, and those failing, only accessed by the prober.
+	probedRegistries  map[string]probeTarget
+	failingRegistries map[string]bool
+}
+
+// ServiceAccountReconcilerOptions holds controller-wide settings for the ServiceAccount reconciler.
+type ServiceAccountReconcilerOptions struct {
+	// RefreshPolicy determines when to refresh image pull secrets. It can be changed later by SetRefreshPolicy.
+	RefreshPolicy
+
+	// ImmutableSecrets makes provisioned image pull secrets immutable.
+	// An immutable Secret is rotated by creating a new Secret with a hash-suffixed name and swapping the reference in
+	// the ServiceAccount, which lets kubelets skip watching the Secret.
+	ImmutableSecrets bool
+
+	// SecretLabels and SecretAnnotations are added to provisioned image pull secrets.
+	// They can be overridden per ServiceAccount by annotations.
+	SecretLabels      map[string]string
+	SecretAnnotations map[string]string
+
+	// OrphanSweepInterval is the interval to delete image pull secrets whose ServiceAccount no longer exists or no
+	// longer has configuration for image pull secret provisioning. Zero disables the sweeping.
+	OrphanSweepInterval time.Duration
+
+	// MaxRetryDelay caps the exponential backoff to retry provisioning image pull secrets for a ServiceAccount after
+	// consecutive failures, e.g. errors from container registry providers.
+	MaxRetryDelay time.Duration
+
+	// FailureEventInterval is the minimum interval between events of provisioning failures of a ServiceAccount.
+	// Failures with the same message as the last reported one are never reported again. Other failures within the
+	// interval are collapsed into the next event with their count.
+	FailureEventInterval time.Duration
+
+	// ProviderTimeout is the timeout of each call to container registry providers to generate an access token, so that
+	// a hung connection does not stall a reconciliation indefinitely. Zero disables the timeout.
+	ProviderTimeout time.Duration
+
+	// ShareAccessTokens makes ServiceAccounts federated to the same AWS IAM role or Google service account share access
+	// tokens for the same registry instead of issuing one for each of them.
+	// Note that a ServiceAccount can then get a token without being authorized by the provider's trust policy as long as
+	// another ServiceAccount is, so enable it only if everyone who can annotate ServiceAccounts is trusted for all
+	// principals. ServiceAccounts can opt out of sharing by the share-access-token annotation.
+	ShareAccessTokens bool
+
+	// ProviderQPS and ProviderBurst limit the rate of generating access tokens for each container registry provider,
+	// e.g. not to exhaust the quota of STS by refreshing many image pull secrets at once after the controller restarts.
+	// Zero QPS disables the rate limiting.
+	ProviderQPS   float64
+	ProviderBurst int
+
+	// MaxConcurrentReconciles is the number of ServiceAccounts reconciled in parallel. Zero means one.
+	MaxConcurrentReconciles int
+	// MaxConcurrentRefreshesPerRegistry bounds how many of the parallel reconciliations generate access tokens for the
+	// same container registry at once, so that refreshes due at the same time are smoothed per provider and registry
+	// instead of starving the others. Zero disables the bound.
+	MaxConcurrentRefreshesPerRegistry int
+
+	// Shard restricts the namespaces reconciled by this replica to run multiple replicas actively.
+	Shard Shard
+
+	// ExpiringSoonWindow is the window before the expiration in which image pull secrets are counted by the metric of
+	// Secrets expiring soon, e.g. to page before workloads fail to pull images. It defaults to half of the expiration
+	// grace period of RefreshPolicy, so that only Secrets whose refresh has been failing for a while are counted.
+	ExpiringSoonWindow time.Duration
+
+	// ReadinessFailureThreshold enables a readiness check that fails while a container registry provider seems to be
+	// unavailable or after this number of consecutive provisioning failures across ServiceAccounts, so that the
+	// degradation surfaces in the Deployment. Zero disables the check.
+	ReadinessFailureThreshold int
+
+	// AuditLog receives a JSON line recording every access token handed out to a ServiceAccount, i.e. the time,
+	// the ServiceAccount, the provider, the principal, the registry, and the expiration, but never the token itself.
+	// Provisioning fails if the record cannot be written. Nil disables auditing.
+	AuditLog io.Writer
+
+	// DryRun makes the reconciler only report the changes that it would make as logs and events, without mutating the
+	// cluster or calling container registry providers.
+	DryRun bool
+
+	// Replication enables replicating image pull secrets of ServiceAccounts with the replicate-to-namespaces annotation
+	// to the selected namespaces, and attaching the replicas to their default ServiceAccounts, e.g. for base images
+	// shared across the organization. Note that it lets anyone who can annotate a configured ServiceAccount hand out
+	// its credentials to the namespaces selected by ReplicationNamespaceSelector, so enable it only if they are trusted.
+	Replication bool
+
+	// ReplicationNamespaceSelector selects namespaces that image pull secrets can be replicated to, whatever
+	// ServiceAccounts select by their annotation, e.g. not to let them hand out credentials to kube-system.
+	// It is required if Replication is enabled.
+	ReplicationNamespaceSelector labels.Selector
+
+	// SecretNamespaces are namespaces that ServiceAccounts can designate by the secret-namespace annotation to
+	// provision their image pull secrets in instead of their own namespace, e.g. a namespace where registry credentials
+	// are centralized for CSI drivers or other tools. Such image pull secrets are not attached to the ServiceAccounts.
+	SecretNamespaces []string
+
+	// DrainTimeout lets in-flight reconciliations continue for up to the duration after the controller is stopped, e.g.
+	// on SIGTERM, so that they do not leave an image pull secret created but not attached to its ServiceAccount.
+	// It should be shorter than the graceful shutdown timeout of the manager. Zero cancels them immediately.
+	DrainTimeout time.Duration
+
+	// RegistryProbeInterval is the interval to verify the credentials of a representative image pull secret for each
+	// distinct registry against the registry, to catch permission regressions on the registry side before pods fail to
+	// pull images. Zero disables probing.
+	RegistryProbeInterval time.Duration
+
+	// StatuszBindAddress is the address to serve a read-only JSON listing ServiceAccounts configured for image pull
+	// secret provisioning with their image pull secrets, principals, expiration times and last errors at /statusz.
+	// Empty disables the endpoint.
+	StatuszBindAddress string
+
+	// AWS configures the HTTP connections and retries of AWS API clients.
+	AWS AWSClientOptions
+	// Google configures the HTTP connections of Google API clients.
+	Google GoogleClientOptions
+
+	// PreflightTokenRequests skips creating a ServiceAccount token when no container registry provider would be called
+	// with it, e.g. while the provider's circuit breaker is open or the region of an AWS registry is unknown, not to
+	// flood audit logs of the API server with unused tokens.
+	PreflightTokenRequests bool
+
+	// ReconcileLogVerbosity is the verbosity of informational logs of each reconciliation, e.g. 1 to hide them unless
+	// debug logs are enabled. Errors and logs of controller-wide operations are not affected.
+	ReconcileLogVerbosity int
+
+	// IgnoredServiceAccounts are ServiceAccounts to leave alone as if they were annotated to be ignored, e.g. those
+	// managed by other systems that happen to carry conflicting annotations.
+	IgnoredServiceAccounts ServiceAccountPatterns
+
+	// SecretWriters are names of secret stores outside the cluster, e.g. "aws-secrets-manager", that ServiceAccounts can
+	// ask by annotations to write their image pull secrets to in addition to Kubernetes Secrets.
+	SecretWriters []string
+
+	// SecretsStoreCSIRotationHints annotates SecretProviderClassPodStatuses of pods running as a ServiceAccount and
+	// records events on them whenever its image pull secret is written to secret stores, as signals for the volumes
+	// of the Secrets Store CSI driver projecting it to rotate.
+	SecretsStoreCSIRotationHints bool
+
+	// HandoverConfigMap is NAMESPACE/NAME of a ConfigMap where the leader stepping down records ServiceAccounts whose
+	// image pull secrets are due for refresh soon, for the next leader to reconcile them first. Empty disables it.
+	HandoverConfigMap string
 }
 
 // NewServiceAccountReconciler creates a new ServiceAccount reconciler that creates and refreshes image pull secrets
@@ -50,44 +278,209 @@ type serviceAccountReconciler struct {
 // Image pull secrets are attached to a ServiceAccount (i.e. registered with .imagePullSecrets field) so that pods using
 // the ServiceAccount can pull container images using the secret without specifying .spec.imagePullSecrets field.
 func NewServiceAccountReconciler(
-	ctx context.Context, client client.Client, scheme *runtime.Scheme, eventRecorder record.EventRecorder,
+	ctx context.Context,
+	client client.Client,
+	apiReader client.Reader,
+	scheme *runtime.Scheme,
+	eventRecorder record.EventRecorder,
+	opts ServiceAccountReconcilerOptions,
 ) (*serviceAccountReconciler, error) {
-	g, err := newGoogle(ctx)
+	if err := opts.RefreshPolicy.validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.IgnoredServiceAccounts.Validate(); err != nil {
+		return nil, err
+	}
+	var handoverConfigMap types.NamespacedName
+	if opts.HandoverConfigMap != "" {
+		ns, name, ok := cutNamespacedName(opts.HandoverConfigMap)
+		if !ok {
+			return nil, fmt.Errorf("handover ConfigMap must be NAMESPACE/NAME: %q", opts.HandoverConfigMap)
+		}
+		handoverConfigMap = types.NamespacedName{Namespace: ns, Name: name}
+	}
+	if opts.MaxRetryDelay <= 0 {
+		return nil, fmt.Errorf("max retry delay must be positive: %v", opts.MaxRetryDelay)
+	}
+	if err := opts.Shard.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.ProviderQPS < 0 {
+		return nil, fmt.Errorf("provider QPS must not be negative: %v", opts.ProviderQPS)
+	}
+	if opts.ProviderQPS > 0 && opts.ProviderBurst <= 0 {
+		return nil, fmt.Errorf("provider burst must be positive: %v", opts.ProviderBurst)
+	}
+	if opts.MaxConcurrentReconciles < 0 {
+		return nil, fmt.Errorf("max concurrent reconciles must not be negative: %v", opts.MaxConcurrentReconciles)
+	}
+	if opts.MaxConcurrentRefreshesPerRegistry < 0 {
+		return nil, fmt.Errorf(
+			"max concurrent refreshes per registry must not be negative: %v", opts.MaxConcurrentRefreshesPerRegistry,
+		)
+	}
+	if opts.Replication && opts.ReplicationNamespaceSelector == nil {
+		return nil, errors.New("replication namespace selector is required to enable replication")
+	}
+	if opts.ExpiringSoonWindow < 0 {
+		return nil, fmt.Errorf("expiring-soon window must not be negative: %v", opts.ExpiringSoonWindow)
+	}
+	if opts.ReadinessFailureThreshold < 0 {
+		return nil, fmt.Errorf("readiness failure threshold must not be negative: %v", opts.ReadinessFailureThreshold)
+	}
+	if opts.FailureEventInterval < 0 {
+		return nil, fmt.Errorf("failure event interval must not be negative: %v", opts.FailureEventInterval)
+	}
+	if opts.ProviderTimeout < 0 {
+		return nil, fmt.Errorf("provider timeout must not be negative: %v", opts.ProviderTimeout)
+	}
+	if err := validateLabels(opts.SecretLabels); err != nil {
+		return nil, fmt.Errorf("invalid labels for image pull secrets: %w", err)
+	}
+	if err := validateAnnotations(opts.SecretAnnotations); err != nil {
+		return nil, fmt.Errorf("invalid annotations for image pull secrets: %w", err)
+	}
+
+	a, err := newAWS(opts.AWS)
+	if err != nil {
+		return nil, err
+	}
+	g, err := newGoogle(ctx, opts.Google)
+	if err != nil {
+		return nil, err
+	}
+	writers, err := newSecretWriters(opts.SecretWriters, opts.AWS)
 	if err != nil {
 		return nil, err
 	}
 
-	return &serviceAccountReconciler{
-		Client:                client,
-		Scheme:                scheme,
-		eventRecorder:         eventRecorder,
-		aws:                   newAWS(),
-		google:                g,
-		expirationGracePeriod: time.Minute,
-	}, nil
+	r := &serviceAccountReconciler{
+		Client:                    client,
+		apiReader:                 apiReader,
+		Scheme:                    scheme,
+		eventRecorder:             eventRecorder,
+		aws:                       a,
+		google:                    g,
+		refresh:                   opts.RefreshPolicy.withDefaults(),
+		immutableSecrets:          opts.ImmutableSecrets,
+		secretLabels:              opts.SecretLabels,
+		secretAnnotations:         opts.SecretAnnotations,
+		orphanSweepInterval:       opts.OrphanSweepInterval,
+		backoff:                   newFailureBackoff(baseRetryDelay, opts.MaxRetryDelay, opts.FailureEventInterval),
+		providerTimeout:           opts.ProviderTimeout,
+		shard:                     opts.Shard,
+		expiringSoonWindow:        opts.expiringSoonWindow(),
+		readinessFailureThreshold: opts.ReadinessFailureThreshold,
+		dryRun:                    opts.DryRun,
+		replication:               opts.Replication,
+		replicationNamespaces:     opts.ReplicationNamespaceSelector,
+		secretNamespaces:          sets.New(opts.SecretNamespaces...),
+		awsBreaker:                newCircuitBreaker(providerAWS),
+		googleBreaker:             newCircuitBreaker(providerGoogle),
+		awsLimiter:                newProviderLimiter(opts.ProviderQPS, opts.ProviderBurst),
+		googleLimiter:             newProviderLimiter(opts.ProviderQPS, opts.ProviderBurst),
+		drainTimeout:              opts.DrainTimeout,
+		verifier:                  newRegistryVerifier(),
+		registryProbeInterval:     opts.RegistryProbeInterval,
+		statuszAddr:               opts.StatuszBindAddress,
+		preflightTokenRequests:    opts.PreflightTokenRequests,
+		reconcileLogVerbosity:     opts.ReconcileLogVerbosity,
+		ignoredServiceAccounts:    opts.IgnoredServiceAccounts,
+		handoverConfigMap:         handoverConfigMap,
+		cleanups:                  newCleanupCache(),
+		planner:                   newRefreshPlanner(opts.MaxConcurrentRefreshesPerRegistry),
+		secretWriters:             writers,
+		csiRotationHints:          opts.SecretsStoreCSIRotationHints,
+		maxConcurrentReconciles:   opts.MaxConcurrentReconciles,
+		failingRegistries:         map[string]bool{},
+	}
+	if opts.ShareAccessTokens {
+		r.tokenCache = newTokenCache()
+	}
+	if opts.AuditLog != nil {
+		r.auditLog = newAuditLog(opts.AuditLog)
+	}
+
+	return r, nil
+}
+
+// expiringSoonWindow returns ExpiringSoonWindow, or half of the expiration grace period if it is zero.
+func (opts ServiceAccountReconcilerOptions) expiringSoonWindow() time.Duration {
+	if opts.ExpiringSoonWindow > 0 {
+		return opts.ExpiringSoonWindow
+	}
+
+	return opts.RefreshPolicy.withDefaults().ExpirationGracePeriod / 2
+}
+
+// newProviderLimiter returns a rate limiter of calls to a container registry provider. Zero QPS disables the limiting.
+func newProviderLimiter(qps float64, burst int) *rate.Limiter {
+	if qps == 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+
+	return rate.NewLimiter(rate.Limit(qps), burst)
 }
 
+// Index of image pull secrets by the namespace and the name of their ServiceAccount, which is not always the namespace
+// of the Secrets.
+const indexKeyServiceAccount = "serviceAccount"
+
+// Initial delay to retry provisioning after a failure. It is doubled on every consecutive failure.
+const baseRetryDelay = 5 * time.Second
+
 //+kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;list;watch;update;patch
 //+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
 
 const (
 	// Event reasons.
 	reasonFailedProvisioning    = "FailedProvisioningImagePullSecret"
 	reasonSucceededProvisioning = "ProvisionedImagePullSecret"
 
+	reasonDetectedModification = "DetectedImagePullSecretModification"
+	reasonConflictingSecret    = "ConflictingImagePullSecret"
+	reasonInvalidConfig        = "InvalidImagePullSecretConfig"
+	reasonThrottled            = "ThrottledProvisioningImagePullSecret"
+	// Reasons of provisioning failures telling where to fix.
+	reasonFederationDenied    = "FederationDeniedProvisioningImagePullSecret"
+	reasonImpersonationDenied = "ImpersonationDeniedProvisioningImagePullSecret"
+	reasonRegistryAPIError    = "RegistryAPIErrorProvisioningImagePullSecret"
+	reasonKubernetesAPIError  = "KubernetesAPIErrorProvisioningImagePullSecret"
+	reasonVerificationFailed  = "VerificationFailedProvisioningImagePullSecret"
+
+	reasonFailedReplication = "FailedReplicatingImagePullSecret"
+
 	reasonFailedDecommissioning    = "FailedDecommissioningImagePullSecret"
 	reasonSucceededDecommissioning = "DecommissionedImagePullSecret"
 )
 
 func (r *serviceAccountReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	logger := log.FromContext(ctx)
+	logger := log.FromContext(ctx).V(r.reconcileLogVerbosity)
+	ctx = log.IntoContext(ctx, logger)
+
+	// Finish provisioning in flight on shutdown instead of canceling it halfway.
+	ctx, cancel := drainContext(ctx, r.drainTimeout)
+	defer cancel()
 
 	// Fetch the requested ServiceAccount.
 	sa := &corev1.ServiceAccount{}
 	if err := r.Get(ctx, req.NamespacedName, sa); err != nil {
 		if apierrors.IsNotFound(err) {
 			logger.Info("Requested ServiceAccount is not found.")
+			r.backoff.reset(req.NamespacedName)
+			r.cleanups.forget(req.NamespacedName)
+			r.planner.forget(req.NamespacedName)
+			recordSecretExpiration(req.NamespacedName, nil)
+			if err := r.deleteImagePullSecretsElsewhere(ctx, logger, req.NamespacedName); err != nil {
+				logger.Error(err, "failed to delete image pull secrets in other namespaces")
+				return ctrl.Result{}, err
+			}
+			if err := r.replicateImagePullSecret(ctx, logger, req.NamespacedName, nil, nil); err != nil {
+				logger.Error(err, "failed to delete replicas of an image pull secret")
+				return ctrl.Result{}, err
+			}
 			return ctrl.Result{}, nil
 		}
 		logger.Error(err, "failed to get a ServiceAccount")
@@ -95,14 +488,86 @@ func (r *serviceAccountReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	}
 
 	if !sa.GetDeletionTimestamp().IsZero() {
+		r.planner.forget(req.NamespacedName)
+		return ctrl.Result{}, nil
+	}
+
+	// Leave the ServiceAccount and its image pull secrets to the system managing it.
+	// Removing the annotation will trigger the reconciliation again.
+	if ignored(sa, r.ignoredServiceAccounts) {
+		r.backoff.reset(req.NamespacedName)
+		r.planner.forget(req.NamespacedName)
+		logger.Info("ServiceAccount is ignored.")
 		return ctrl.Result{}, nil
 	}
 
-	should, expiresAt, err := r.shouldCreateOrRefreshImagePullSecret(ctx, logger, sa)
+	// Leave the ServiceAccount and its image pull secrets as they are while provisioning is suspended.
+	// Removing the annotation will trigger the reconciliation again.
+	if suspended(sa) {
+		r.backoff.reset(req.NamespacedName)
+		r.planner.forget(req.NamespacedName)
+		logger.Info("Image pull secret provisioning is suspended for the ServiceAccount.")
+		return ctrl.Result{}, nil
+	}
+
+	should, current, refreshAt, err := r.shouldCreateOrRefreshImagePullSecret(ctx, logger, sa)
 	if err != nil {
 		logger.Error(err, "failed to determine if an image pull secret should be created or refreshed")
 		return ctrl.Result{}, err
 	}
+	if !should {
+		// Nothing to retry.
+		r.backoff.reset(req.NamespacedName)
+	}
+
+	// Never overwrite a Secret that is not managed by the controller unless the user explicitly allows it.
+	if current != nil && !isOwnedBy(current, sa) && !adoptable(current, sa) {
+		if annotation(sa, annotationKeyAdopt) == "true" {
+			r.eventRecorder.Eventf(
+				sa, corev1.EventTypeWarning, reasonConflictingSecret,
+				"Secret %s/%s already exists and cannot be taken over."+
+					" Only Secrets in the namespace of the ServiceAccount and not provisioned for another ServiceAccount"+
+					" can be adopted. Specify another name by %s.",
+				current.GetNamespace(), current.GetName(), annotationKeySecretName,
+			)
+		} else {
+			r.eventRecorder.Eventf(
+				sa, corev1.EventTypeWarning, reasonConflictingSecret,
+				"Secret %s already exists and is not managed by image-pull-secrets-provisioner."+
+					" Annotate the ServiceAccount with %s=true to take it over, or specify another name by %s.",
+				current.GetName(), annotationKeyAdopt, annotationKeySecretName,
+			)
+		}
+		logger.Info("Secret to provision already exists and is not managed by the controller.", "secret", current.GetName())
+		r.planner.forget(req.NamespacedName)
+		// Changing the annotations will trigger the reconciliation again.
+		return ctrl.Result{}, nil
+	}
+
+	// Report misconfiguration naming the offending annotation instead of an opaque error from the provider.
+	// Retrying does not help, but changing the annotations will trigger the reconciliation again.
+	if err := validateConfig(sa); err != nil {
+		r.eventRecorder.Eventf(
+			sa, corev1.EventTypeWarning, reasonInvalidConfig,
+			"Invalid configuration for image pull secret provisioning: %v", err,
+		)
+		logger.Error(err, "invalid configuration for image pull secret provisioning")
+		provisioningFailures.WithLabelValues(providerName(sa), errorClassInvalidConfig).Inc()
+		r.recordProvisioningStatus(ctx, sa, current, err)
+		r.planner.forget(req.NamespacedName)
+		return ctrl.Result{}, nil
+	}
+
+	if r.dryRun {
+		return r.planProvisioning(ctx, logger, sa, should, current, refreshAt)
+	}
+
+	// Name of the image pull secret to keep in cleanup.
+	inUse := ""
+	inUseSecret := current
+	if current != nil {
+		inUse = current.GetName()
+	}
 
 	if should {
 		// Create or refresh an image pull secret, and attach it to the ServiceAccount.
@@ -110,18 +575,22 @@ func (r *serviceAccountReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 
 		var secret *corev1.Secret
 		var err error
-		secret, expiresAt, err = r.createOrRefreshImagePullSecret(ctx, logger, sa)
+		if current == nil {
+			// Reuse a valid image pull secret provisioned under a previous name instead of generating a new one.
+			secret, refreshAt, err = r.adoptOrphanedImagePullSecret(ctx, logger, sa)
+		}
+		if secret == nil && err == nil {
+			secret, refreshAt, err = r.createOrRefreshImagePullSecret(ctx, logger, sa, current)
+		}
 		if err != nil {
-			r.eventRecorder.Eventf(
-				sa, corev1.EventTypeWarning, reasonFailedProvisioning,
-				"Failed to create or refresh an image pull secret: %v", err,
-			)
-			logger.Error(err, "failed to create or refresh an image pull secret")
-			return ctrl.Result{}, err
+			return r.retryProvisioning(ctx, sa, current, err), nil
 		}
+		r.backoff.reset(req.NamespacedName)
+		r.failureStreak.Store(0)
 		logger = logger.WithValues("secret", secret.GetName())
 
-		if err := r.attachImagePullSecret(ctx, logger, sa, secret); err != nil {
+		// Immutable image pull secrets are rotated by replacing the reference to the current one.
+		if err := r.attachImagePullSecret(ctx, logger, sa, secret, inUse); err != nil {
 			r.eventRecorder.Eventf(
 				sa, corev1.EventTypeWarning, reasonFailedProvisioning,
 				"Failed to add an image pull secret to the ServiceAccount: %v", err,
@@ -134,11 +603,35 @@ func (r *serviceAccountReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 			sa, corev1.EventTypeNormal, reasonSucceededProvisioning,
 			"Provisioned an image pull secret: %s", secret.GetName(),
 		)
+		operation := secretOperationProvisioned
+		if current != nil {
+			operation = secretOperationRefreshed
+		}
+		secretOperations.WithLabelValues(providerName(sa), sa.GetNamespace(), operation).Inc()
+		r.eventRecorder.Eventf(
+			secret, corev1.EventTypeNormal, reasonSucceededProvisioning,
+			"Image pull secret %s for ServiceAccount %s/%s, valid until %s.",
+			operation, sa.GetNamespace(), sa.GetName(), secret.GetAnnotations()[annotationKeyExpiresAt],
+		)
+
+		inUse = secret.GetName()
+		inUseSecret = secret
+	} else if current != nil {
+		// Attach the valid image pull secret without generating a new access token if it has been detached, e.g. because
+		// attaching it failed after it was created.
+		if err := r.attachImagePullSecret(ctx, logger.WithValues("secret", inUse), sa, current, ""); err != nil {
+			r.eventRecorder.Eventf(
+				sa, corev1.EventTypeWarning, reasonFailedProvisioning,
+				"Failed to add an image pull secret to the ServiceAccount: %v", err,
+			)
+			logger.Error(err, "failed to attach an image pull secret to a ServiceAccount")
+			return ctrl.Result{}, err
+		}
 	}
 
 	// When the config is changed, outdated image pull secrets remain existing and attached to the ServiceAccount.
 	// So, clean up them.
-	decommissioned, err := r.cleanupImagePullSecrets(ctx, logger, sa)
+	decommissioned, err := r.cleanupImagePullSecrets(ctx, logger, sa, inUse)
 	if err != nil {
 		r.eventRecorder.Eventf(
 			sa, corev1.EventTypeWarning, reasonFailedDecommissioning,
@@ -155,100 +648,427 @@ func (r *serviceAccountReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		)
 	}
 
-	if !expiresAt.IsZero() {
+	// Replicas follow the image pull secret in use, and are deleted if there is none.
+	if err := r.replicateImagePullSecret(ctx, logger, req.NamespacedName, sa, inUseSecret); err != nil {
+		r.eventRecorder.Eventf(
+			sa, corev1.EventTypeWarning, reasonFailedReplication,
+			"Failed to replicate the image pull secret: %v", err,
+		)
+		logger.Error(err, "failed to replicate an image pull secret")
+		return ctrl.Result{}, err
+	}
+
+	recordSecretExpiration(req.NamespacedName, inUseSecret)
+	r.recordProvisioningStatus(ctx, sa, inUseSecret, nil)
+	r.planner.plan(req.NamespacedName, refreshGroup(sa), refreshAt)
+
+	if !refreshAt.IsZero() {
 		return ctrl.Result{
-			RequeueAfter: time.Until(expiresAt.Add(-r.expirationGracePeriod)),
+			RequeueAfter: r.requeueAfter(refreshAt),
 		}, nil
 	}
 
 	return ctrl.Result{}, nil
 }
 
+// retryProvisioning reports a failure to provision an image pull secret, and returns the result to retry it.
+// It retries with its own backoff instead of the workqueue's one to cap the load on container registry providers and
+// the number of events per ServiceAccount. The failure is also reported on the current image pull secret if any.
+func (r *serviceAccountReconciler) retryProvisioning(
+	ctx context.Context, sa *corev1.ServiceAccount, current *corev1.Secret, err error,
+) ctrl.Result {
+	logger := log.FromContext(ctx)
+
+	class := errorClass(err)
+	provisioningFailures.WithLabelValues(providerName(sa), class).Inc()
+	r.failureStreak.Add(1)
+
+	delay, notify, suppressed := r.backoff.failed(client.ObjectKeyFromObject(sa), err.Error())
+	var openErr *circuitOpenError
+	if errors.As(err, &openErr) {
+		// Wait for the circuit breaker to let calls through again.
+		delay = max(delay, openErr.retryAfter)
+	}
+	retryAfter, isThrottled := throttled(err, time.Now())
+	// Respect the delay suggested by the provider.
+	delay = max(delay, retryAfter)
+
+	// Failures not reported as events are collapsed into the next event.
+	collapsed := ""
+	if suppressed > 0 {
+		collapsed = fmt.Sprintf(" (%d more failures since the last event)", suppressed)
+	}
+	switch {
+	case !notify:
+	case isThrottled:
+		// Distinguish quota issues from misconfiguration.
+		r.recordEvent(
+			sa, current, corev1.EventTypeWarning, reasonThrottled,
+			"Container registry provider is throttling requests. Retrying after %s: %v%s",
+			delay.Round(time.Second), err, collapsed,
+		)
+	default:
+		// Tell whether the fix is in the cloud IAM policy or in the cluster by the reason.
+		r.recordEvent(
+			sa, current, corev1.EventTypeWarning, failureReason(class),
+			"Failed to create or refresh an image pull secret: %v%s", err, collapsed,
+		)
+	}
+	logger.Error(err, "failed to create or refresh an image pull secret", "retryAfter", delay, "class", class)
+	r.recordProvisioningStatus(ctx, sa, nil, err)
+
+	return ctrl.Result{RequeueAfter: delay}
+}
+
+// recordEvent records an event on a ServiceAccount, and on its image pull secret too unless secret is nil, so that
+// developers looking at either of them see what happened to the image pull secret.
+func (r *serviceAccountReconciler) recordEvent(
+	sa *corev1.ServiceAccount, secret *corev1.Secret, eventtype, reason, messageFmt string, args ...interface{},
+) {
+	r.eventRecorder.Eventf(sa, eventtype, reason, messageFmt, args...)
+	if secret != nil {
+		r.eventRecorder.Eventf(secret, eventtype, reason, messageFmt, args...)
+	}
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *serviceAccountReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&corev1.ServiceAccount{}).
-		Complete(r)
+	if err := metrics.Registry.Register(&expirationCollector{
+		reader: mgr.GetCache(),
+		shard:  r.shard,
+		window: r.expiringSoonWindow,
+	}); err != nil {
+		return fmt.Errorf("failed to register a metrics collector: %w", err)
+	}
+	if err := metrics.Registry.Register(r.planner); err != nil {
+		return fmt.Errorf("failed to register a metrics collector: %w", err)
+	}
+
+	if r.readinessFailureThreshold > 0 {
+		if err := mgr.AddReadyzCheck("providers", r.checkReadiness); err != nil {
+			return fmt.Errorf("failed to add a readiness check: %w", err)
+		}
+	}
+
+	if r.orphanSweepInterval > 0 {
+		logger := mgr.GetLogger().WithName("orphan-sweeper")
+		if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+			ctx = log.IntoContext(ctx, logger)
+			wait.UntilWithContext(ctx, func(ctx context.Context) {
+				if err := r.sweepOrphanedImagePullSecrets(ctx); err != nil {
+					logger.Error(err, "failed to sweep orphaned image pull secrets")
+				}
+				if r.replication {
+					if err := r.sweepOrphanedReplicas(ctx); err != nil {
+						logger.Error(err, "failed to sweep orphaned replicas of image pull secrets")
+					}
+				}
+			}, r.orphanSweepInterval)
+			return nil
+		})); err != nil {
+			return fmt.Errorf("failed to add an orphan sweeper: %w", err)
+		}
+	}
+
+	if r.registryProbeInterval > 0 {
+		logger := mgr.GetLogger().WithName("registry-prober")
+		if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+			ctx = log.IntoContext(ctx, logger)
+			wait.UntilWithContext(ctx, func(ctx context.Context) {
+				if err := r.probeRegistries(ctx); err != nil {
+					logger.Error(err, "failed to probe registries")
+				}
+			}, r.registryProbeInterval)
+			return nil
+		})); err != nil {
+			return fmt.Errorf("failed to add a registry prober: %w", err)
+		}
+	}
+
+	// Served by every replica from the cache.
+	if r.statuszAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/statusz", r.statuszHandler(mgr.GetClient()))
+		if err := mgr.Add(&manager.Server{
+			Name:   "statusz",
+			Server: &http.Server{Addr: r.statuszAddr, Handler: mux, ReadHeaderTimeout: 10 * time.Second},
+		}); err != nil {
+			return fmt.Errorf("failed to add a statusz server: %w", err)
+		}
+	}
+
+	if err := mgr.GetFieldIndexer().IndexField(
+		context.TODO(),
+		&corev1.Secret{},
+		indexKeyServiceAccount,
+		func(obj client.Object) []string {
+			secret, ok := obj.(*corev1.Secret)
+			if !ok || secret.Labels[labelKeyServiceAccount] == "" {
+				return nil
+			}
+			return []string{serviceAccountOf(secret).String()}
+		},
+	); err != nil {
+		return fmt.Errorf("failed to create a field index: %w", err)
+	}
+
+	// Runnables added to the manager start only after this replica becomes the leader.
+	warmUpEvents := make(chan event.GenericEvent)
+	warmUpLogger := mgr.GetLogger().WithName("warm-up")
+	if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		if err := r.warmUp(log.IntoContext(ctx, warmUpLogger), warmUpEvents); err != nil {
+			warmUpLogger.Error(err, "failed to warm up")
+		}
+		return nil
+	})); err != nil {
+		return fmt.Errorf("failed to add a warm-up pass: %w", err)
+	}
+
+	// Runnables are stopped before the leadership is released.
+	if r.handoverConfigMap.Name != "" && !r.dryRun {
+		handoverLogger := mgr.GetLogger().WithName("handover")
+		if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+			<-ctx.Done()
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), handoverTimeout)
+			defer cancel()
+			if err := r.handOver(log.IntoContext(ctx, handoverLogger)); err != nil {
+				handoverLogger.Error(err, "failed to hand over ServiceAccounts to the next leader")
+			}
+			return nil
+		})); err != nil {
+			return fmt.Errorf("failed to add a handover: %w", err)
+		}
+	}
+
+	b := ctrl.NewControllerManagedBy(mgr).
+		// Enqueue ServiceAccounts first observed in the order of the expiration of their image pull secrets.
+		For(&corev1.ServiceAccount{}, builder.WithPredicates(predicate.Funcs{
+			CreateFunc: func(event.CreateEvent) bool { return false },
+			// Updates not affecting provisioning, e.g. recording the status, do not need another reconciliation.
+			UpdateFunc: serviceAccountChanged,
+		})).
+		Watches(&corev1.ServiceAccount{}, handler.Funcs{CreateFunc: r.enqueueByExpiration}).
+		// Reprovision image pull secrets immediately when they are deleted or modified out-of-band.
+		Owns(&corev1.Secret{}).
+		// Image pull secrets in other namespaces refer to their ServiceAccounts by an annotation instead.
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(enqueueServiceAccountOfSecret)).
+		// Changes of image pull secrets can leave outdated ones to clean up, so they are listed again.
+		Watches(&corev1.Secret{}, r.cleanups.forgetOnSecretEvents()).
+		WatchesRawSource(source.Channel(warmUpEvents, &handler.EnqueueRequestForObject{})).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.maxConcurrentReconciles}).
+		WithEventFilter(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			// Namespaces are cluster-scoped, and ServiceAccounts replicating to them are filtered when enqueued.
+			switch obj := obj.(type) {
+			case *corev1.Namespace:
+				return true
+			case *corev1.Secret:
+				return r.shard.Contains(serviceAccountOf(obj).Namespace)
+			}
+			return r.shard.Contains(obj.GetNamespace())
+		}))
+	if r.replication {
+		// Replicate image pull secrets to namespaces newly selected.
+		b = b.Watches(
+			&corev1.Namespace{},
+			handler.EnqueueRequestsFromMapFunc(r.enqueueReplicatingServiceAccounts),
+			builder.WithPredicates(predicate.LabelChangedPredicate{}),
+		)
+	}
+
+	return b.Complete(r)
+}
+
+// enqueueServiceAccountOfSecret enqueues the ServiceAccount of an image pull secret provisioned in another namespace.
+// Those in the namespace of the ServiceAccount are enqueued by their owner reference.
+func enqueueServiceAccountOfSecret(_ context.Context, obj client.Object) []reconcile.Request {
+	if _, ok := obj.GetAnnotations()[annotationKeyServiceAccount]; !ok {
+		return nil
+	}
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		return nil
+	}
+
+	return []reconcile.Request{{NamespacedName: serviceAccountOf(secret)}}
 }
 
+// shouldCreateOrRefreshImagePullSecret determines if an image pull secret should be created or refreshed.
+// It also returns the image pull secret currently provisioned for the ServiceAccount, or nil if there is none, and the
+// time to refresh it if it should not be refreshed now.
 func (r *serviceAccountReconciler) shouldCreateOrRefreshImagePullSecret(
 	ctx context.Context, logger logr.Logger, sa *corev1.ServiceAccount,
-) (should bool, expiresAt time.Time, _ error) {
+) (should bool, current *corev1.Secret, refreshAt time.Time, _ error) {
 	if !hasConfig(sa) {
 		logger.Info("ServiceAccount does not have configuration for image pull secret provisioning.")
-		return false, time.Time{}, nil
+		return false, nil, time.Time{}, nil
 	}
 
 	// Check if the image pull secret exists.
-	secretKey := client.ObjectKey{Namespace: sa.GetNamespace(), Name: secretName(sa)}
-	logger = logger.WithValues("secret", secretKey.Name)
+	secret, err := findImagePullSecret(ctx, r, sa, r.immutableSecrets)
+	if err == nil && secret == nil && !r.immutableSecrets {
+		// Only image pull secrets provisioned by the controller are cached. Make sure that there is no Secret not
+		// managed by the controller with the same name not to overwrite it.
+		secret, err = findImagePullSecret(ctx, r.apiReader, sa, false)
+	}
+	if err != nil {
+		return false, nil, time.Time{}, fmt.Errorf("failed to check the existing of an image pull secret: %w", err)
+	}
+	if secret == nil {
+		logger.Info("Image pull secret does not exist. Should be created.")
+		return true, nil, time.Time{}, nil
+	}
+	logger = logger.WithValues("secret", secret.GetName())
+
+	// Check if the image pull secret has been modified externally.
+	if hash, ok := secret.Annotations[annotationKeyContentHash]; !ok {
+		logger.Info("Image pull secret does not have a content hash. Should be refreshed.")
+		return true, secret, time.Time{}, nil
+	} else if hash != contentHash(secret.Data[corev1.DockerConfigJsonKey]) {
+		r.recordEvent(
+			sa, secret, corev1.EventTypeWarning, reasonDetectedModification,
+			"Image pull secret %s was modified externally. Restoring it.", secret.GetName(),
+		)
+		logger.Info("Image pull secret has been modified externally. Should be refreshed.")
+		return true, secret, time.Time{}, nil
+	}
 
-	secret := &corev1.Secret{}
-	if err := r.Get(ctx, secretKey, secret); err != nil {
-		if apierrors.IsNotFound(err) {
-			logger.Info("Image pull secret does not exist. Should be created.")
-			return true, time.Time{}, nil
-		}
+	// Check if the configuration has been changed since the image pull secret was provisioned.
+	if secret.Annotations[annotationKeyConfigHash] != configHash(sa) {
+		logger.Info("Configuration for image pull secret provisioning has been changed. Should be refreshed.")
+		return true, secret, time.Time{}, nil
+	}
 
-		return false, time.Time{}, fmt.Errorf("failed to check the existing of an image pull secret: %w", err)
+	// Check if refreshing has been requested since the image pull secret was provisioned.
+	if secret.Annotations[annotationKeyRefreshRequestedAt] != annotation(sa, annotationKeyRefreshRequestedAt) {
+		logger.Info(
+			"Refreshing image pull secret is requested. Should be refreshed.",
+			"refreshRequestedAt", annotation(sa, annotationKeyRefreshRequestedAt),
+		)
+		return true, secret, time.Time{}, nil
 	}
 
-	// Check if the image pull secret is attached to the ServiceAccount.
-	if !r.imagePullSecretAttached(sa, secret.GetName()) {
-		logger.Info("Image pull secret is not attached to the ServiceAccount. Should be attached.")
-		return true, time.Time{}, nil
+	// Check if the user-managed Secret to merge has been changed.
+	merged, err := r.getSecretToMerge(ctx, sa)
+	if err != nil {
+		logger.Error(err, "Failed to get the Secret to merge. Should be refreshed.")
+		// Not returning an error here to report it through the refreshing.
+		return true, secret, time.Time{}, nil
+	}
+	if mergedSecretVersion(merged) != secret.Annotations[annotationKeyMergedSecretVersion] {
+		logger.Info("Secret to merge has been changed. Should be refreshed.")
+		return true, secret, time.Time{}, nil
 	}
 
 	// Check the expiration time of the image pull secret.
-	expiresAt, err := func() (time.Time, error) {
-		str, ok := secret.Annotations[annotationKeyExpiresAt]
-		if !ok {
-			return time.Time{}, fmt.Errorf("%q annotation is missing", annotationKeyExpiresAt)
-		}
-
-		expiresAt, err := time.Parse(time.RFC3339, str)
-		if err != nil {
-			return time.Time{}, fmt.Errorf("failed to parse %q annotation: %w", annotationKeyExpiresAt, err)
-		}
-
-		return expiresAt, nil
-	}()
+	expiresAt, err := secretExpiresAt(secret)
 	if err != nil {
+		r.recordEvent(
+			sa, secret, corev1.EventTypeWarning, reasonDetectedModification,
+			"Image pull secret %s has an invalid expiration annotation. Restoring it: %v", secret.GetName(), err,
+		)
 		logger.Error(err, "Failed to determine the expiration of the image pull secret. Should be refreshed.")
 		// Not returning an error here to continue the reconciliation and set expires-at annotation to the Secret.
-		return true, time.Time{}, nil
+		return true, secret, time.Time{}, nil
+	}
+
+	interval, err := refreshInterval(sa)
+	if err != nil {
+		logger.Error(err, "Failed to determine the refresh interval. Should be refreshed.")
+		// Not returning an error here to report it through the refreshing.
+		return true, secret, time.Time{}, nil
 	}
 
-	if time.Until(expiresAt) < r.expirationGracePeriod {
+	refreshAt = r.refreshTime(client.ObjectKeyFromObject(secret), secretIssuedAt(secret), expiresAt, interval)
+	if !time.Now().Before(refreshAt) {
 		logger.Info("Image pull secret is about to expire. Should be refreshed.", "expiresAt", expiresAt)
-		return true, expiresAt, nil
+		return true, secret, time.Time{}, nil
 	}
 
-	logger.Info("Image pull secret has enough remaining validity. Skipping refreshing it.", "expiresAt", expiresAt)
-	return false, expiresAt, nil
+	logger.Info(
+		"Image pull secret has enough remaining validity. Skipping refreshing it.",
+		"expiresAt", expiresAt, "refreshAt", refreshAt,
+	)
+	return false, secret, refreshAt, nil
 }
 
+// createOrRefreshImagePullSecret ensures an image pull secret for a ServiceAccount. It reuses the credentials in the
+// current image pull secret if they are still valid, e.g. when only the Secret to merge has been changed, not to create
+// a ServiceAccount token and call the container registry provider in vain.
 func (r *serviceAccountReconciler) createOrRefreshImagePullSecret(
-	ctx context.Context, logger logr.Logger, sa *corev1.ServiceAccount,
-) (_ *corev1.Secret, expiresAt time.Time, _ error) {
+	ctx context.Context, logger logr.Logger, sa *corev1.ServiceAccount, current *corev1.Secret,
+) (_ *corev1.Secret, refreshAt time.Time, _ error) {
 	logger.Info("Creating or refreshing an image pull secret for the ServiceAccount...")
 
-	// Generate an access token for the configured image registry from the ServiceAccount's token.
-	username, token, expiresAt, err := r.generateAccessToken(ctx, sa, sa.Annotations[annotationKeyAudience])
+	// Resolve configuration before generating an access token not to waste it.
+	if err := r.checkSecretNamespace(sa); err != nil {
+		return nil, time.Time{}, err
+	}
+	labels, annotations, err := secretMetadata(sa, r.secretLabels, r.secretAnnotations)
 	if err != nil {
-		return nil, time.Time{}, fmt.Errorf(
-			"failed to generate an access token for the configured image registry: %w", err,
-		)
+		return nil, time.Time{}, err
+	}
+
+	interval, err := refreshInterval(sa)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	merged, err := r.getSecretToMerge(ctx, sa)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var mergedAuths map[string]json.RawMessage
+	if merged != nil {
+		mergedAuths, err = dockerConfigJSONAuths(merged)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("failed to read the Secret to merge: %w", err)
+		}
+	}
+
+	username, token, issuedAt, expiresAt, ok := r.reusableCredentials(sa, current, interval)
+	if ok {
+		logger.Info("Reusing the credentials in the current image pull secret.", "expiresAt", expiresAt)
+	} else {
+		username, token, issuedAt, expiresAt, err = r.accessToken(ctx, logger, sa, interval)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		// Keep the current image pull secret as it is if the registry rejects the new credentials.
+		if err := r.verifyImagePullSecret(ctx, sa, username, token); err != nil {
+			return nil, time.Time{}, err
+		}
 	}
-	logger.Info("Generated an access token for the configured image registry.", "expiresAt", expiresAt)
 
 	// Ensure an image pull secret from the access token.
 	secret, err := buildImagePullSecret(
-		sa, secretName(sa), sa.Annotations[annotationKeyRegistry], username, token, expiresAt,
+		sa, secretName(sa), annotation(sa, annotationKeyRegistry), username, token, issuedAt, expiresAt, mergedAuths,
 	)
 	if err != nil {
 		return nil, time.Time{}, fmt.Errorf("failed to build image pull secret definition: %w", err)
 	}
+	if merged != nil {
+		secret.Annotations[annotationKeyMergedSecretVersion] = mergedSecretVersion(merged)
+	}
+	// Labels and annotations set by the controller take precedence.
+	for k, v := range labels {
+		if _, ok := secret.Labels[k]; !ok {
+			secret.Labels[k] = v
+		}
+	}
+	for k, v := range annotations {
+		if _, ok := secret.Annotations[k]; !ok {
+			secret.Annotations[k] = v
+		}
+	}
+
+	if r.immutableSecrets {
+		secret.Name = immutableSecretName(sa, string(secret.Data[corev1.DockerConfigJsonKey]))
+		secret.Immutable = ptr.To(true)
+	}
+
+	if err := r.writeToSecretStores(ctx, logger, sa, secret); err != nil {
+		return nil, time.Time{}, err
+	}
 
 	op, err := r.ensureSecret(ctx, secret)
 	if err != nil {
@@ -256,22 +1076,230 @@ func (r *serviceAccountReconciler) createOrRefreshImagePullSecret(
 	}
 	logger.Info("Ensured an image pull secret.", "secret", secret.GetName(), "operation", op)
 
-	return secret, expiresAt, nil
+	return secret, r.refreshTime(client.ObjectKeyFromObject(secret), issuedAt, expiresAt, interval), nil
 }
 
+// reusableCredentials returns the credentials in the current image pull secret of a ServiceAccount if they were issued
+// for the current configuration, have not been modified externally, and need no refresh yet.
+func (r *serviceAccountReconciler) reusableCredentials(
+	sa *corev1.ServiceAccount, current *corev1.Secret, interval time.Duration,
+) (username string, password string, issuedAt time.Time, expiresAt time.Time, ok bool) {
+	if current == nil ||
+		current.Annotations[annotationKeyConfigHash] != configHash(sa) ||
+		current.Annotations[annotationKeyRefreshRequestedAt] != annotation(sa, annotationKeyRefreshRequestedAt) ||
+		current.Annotations[annotationKeyContentHash] != contentHash(current.Data[corev1.DockerConfigJsonKey]) {
+		return "", "", time.Time{}, time.Time{}, false
+	}
+
+	expiresAt, err := secretExpiresAt(current)
+	if err != nil {
+		return "", "", time.Time{}, time.Time{}, false
+	}
+	issuedAt = secretIssuedAt(current)
+	if !time.Now().Before(r.refreshTime(client.ObjectKeyFromObject(current), issuedAt, expiresAt, interval)) {
+		return "", "", time.Time{}, time.Time{}, false
+	}
+
+	username, password, err = dockerConfigJSONCredentials(current, annotation(sa, annotationKeyRegistry))
+	if err != nil {
+		return "", "", time.Time{}, time.Time{}, false
+	}
+
+	return username, password, issuedAt, expiresAt, true
+}
+
+// adoptOrphanedImagePullSecret copies a still valid image pull secret provisioned for a ServiceAccount under a previous
+// name, e.g. before changing the secret-name annotation or the immutable mode, to the name currently expected.
+// The orphaned Secret itself is deleted in cleanup.
+// It returns nil if there is no Secret to adopt.
+func (r *serviceAccountReconciler) adoptOrphanedImagePullSecret(
+	ctx context.Context, logger logr.Logger, sa *corev1.ServiceAccount,
+) (_ *corev1.Secret, refreshAt time.Time, _ error) {
+	// Orphans are only looked for in the namespace of the ServiceAccount, where adopted Secrets are owned by it.
+	if secretNamespace(sa) != sa.GetNamespace() {
+		return nil, time.Time{}, nil
+	}
+
+	secrets := &corev1.SecretList{}
+	if err := r.List(
+		ctx,
+		secrets,
+		client.InNamespace(sa.GetNamespace()),
+		client.MatchingLabels{
+			labelKeyServiceAccount: sa.GetName(),
+		},
+	); err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to list image pull secrets: %w", err)
+	}
+	if len(secrets.Items) == 0 {
+		return nil, time.Time{}, nil
+	}
+
+	merged, err := r.getSecretToMerge(ctx, sa)
+	if err != nil {
+		// Leave reporting the error to the provisioning.
+		return nil, time.Time{}, nil
+	}
+	interval, err := refreshInterval(sa)
+	if err != nil {
+		// Leave reporting the error to the provisioning.
+		return nil, time.Time{}, nil
+	}
+
+	for _, orphan := range secrets.Items {
+		// Only adopt a Secret provisioned for the same configuration and not modified externally.
+		if orphan.Annotations[annotationKeyConfigHash] != configHash(sa) ||
+			orphan.Annotations[annotationKeyRefreshRequestedAt] != annotation(sa, annotationKeyRefreshRequestedAt) ||
+			orphan.Annotations[annotationKeyContentHash] != contentHash(orphan.Data[corev1.DockerConfigJsonKey]) ||
+			orphan.Annotations[annotationKeyMergedSecretVersion] != mergedSecretVersion(merged) {
+			continue
+		}
+
+		expiresAt, err := secretExpiresAt(&orphan)
+		if err != nil {
+			continue
+		}
+		refreshAt := r.refreshTime(client.ObjectKeyFromObject(&orphan), secretIssuedAt(&orphan), expiresAt, interval)
+		if !time.Now().Before(refreshAt) {
+			continue
+		}
+
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:       sa.GetNamespace(),
+				Name:            secretName(sa),
+				Labels:          orphan.Labels,
+				Annotations:     orphan.Annotations,
+				OwnerReferences: []metav1.OwnerReference{ownerReference(sa)},
+			},
+			Type: orphan.Type,
+			Data: orphan.Data,
+		}
+		if r.immutableSecrets {
+			secret.Name = immutableSecretName(sa, string(orphan.Data[corev1.DockerConfigJsonKey]))
+			secret.Immutable = ptr.To(true)
+		}
+		if secret.GetName() == orphan.GetName() {
+			continue
+		}
+
+		op, err := r.ensureSecret(ctx, secret)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("failed to adopt an orphaned image pull secret: %w", err)
+		}
+		logger.Info(
+			"Adopted an orphaned image pull secret.",
+			"secret", secret.GetName(), "orphan", orphan.GetName(), "operation", op,
+		)
+
+		return secret, r.refreshTime(client.ObjectKeyFromObject(secret), secretIssuedAt(secret), expiresAt, interval), nil
+	}
+
+	return nil, time.Time{}, nil
+}
+
+// getSecretToMerge gets a user-managed Secret whose auth entries should be merged into the image pull secret.
+// It returns nil if no Secret to merge is configured.
+func (r *serviceAccountReconciler) getSecretToMerge(
+	ctx context.Context, sa *corev1.ServiceAccount,
+) (*corev1.Secret, error) {
+	name := annotation(sa, annotationKeyMergeSecretName)
+	if name == "" {
+		return nil, nil
+	}
+
+	// User-managed Secrets are not cached.
+	secret := &corev1.Secret{}
+	if err := r.apiReader.Get(ctx, client.ObjectKey{Namespace: sa.GetNamespace(), Name: name}, secret); err != nil {
+		return nil, fmt.Errorf("failed to get the Secret to merge: %w", err)
+	}
+
+	return secret, nil
+}
+
+// mergedSecretVersion returns a version of a merged user-managed Secret to be recorded in the image pull secret.
+func mergedSecretVersion(merged *corev1.Secret) string {
+	if merged == nil {
+		return ""
+	}
+
+	return merged.GetName() + "/" + merged.GetResourceVersion()
+}
+
+// attachImagePullSecret attaches an image pull secret to a ServiceAccount, and records it as attached by the controller.
+// If replaced is not empty, the reference to the replaced Secret is swapped with the new one in a single patch so that
+// the ServiceAccount never lacks a valid image pull secret.
+// On conflicts with concurrent updates, it retries with the latest ServiceAccount not to waste the Secret already
+// provisioned by generating a new access token.
 func (r *serviceAccountReconciler) attachImagePullSecret(
-	ctx context.Context, logger logr.Logger, sa *corev1.ServiceAccount, secret *corev1.Secret,
+	ctx context.Context, logger logr.Logger, sa *corev1.ServiceAccount, secret *corev1.Secret, replaced string,
+) error {
+	return r.retryOnConflict(ctx, sa, func() error {
+		return r.patchImagePullSecretAttached(ctx, logger, sa, secret, replaced)
+	})
+}
+
+// retryOnConflict calls patch to patch a ServiceAccount, and retries it with the latest ServiceAccount, which is stored
+// into sa, on conflicts with concurrent updates by others, e.g. token controllers.
+func (r *serviceAccountReconciler) retryOnConflict(
+	ctx context.Context, sa *corev1.ServiceAccount, patch func() error,
+) error {
+	first := true
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if !first {
+			log.FromContext(ctx).Info("ServiceAccount was updated concurrently. Retrying patching it...")
+			// The cache may not have caught up with the update yet.
+			if err := r.apiReader.Get(ctx, client.ObjectKeyFromObject(sa), sa); err != nil {
+				return fmt.Errorf("failed to get a ServiceAccount: %w", err)
+			}
+		}
+		first = false
+
+		return patch()
+	})
+}
+
+// patchImagePullSecretAttached patches a ServiceAccount once to attach an image pull secret to it.
+func (r *serviceAccountReconciler) patchImagePullSecretAttached(
+	ctx context.Context, logger logr.Logger, sa *corev1.ServiceAccount, secret *corev1.Secret, replaced string,
 ) error {
+	// ServiceAccounts can only refer to Secrets in their namespace. The reference to the replaced Secret is removed in
+	// cleanup.
+	if secret.GetNamespace() != sa.GetNamespace() {
+		logger.Info("Image pull secret is provisioned in another namespace. Skipping attaching it to the ServiceAccount.")
+		return nil
+	}
+
 	logger.Info("Attaching the image pull secret to the ServiceAccount...")
 
-	if r.imagePullSecretAttached(sa, secret.GetName()) {
+	attached, tracked := attachedSecrets(sa)
+	if r.imagePullSecretAttached(sa, secret.GetName()) && attached.Has(secret.GetName()) {
 		logger.Info("Image pull secret is already attached to the ServiceAccount.")
 		return nil
 	}
 
 	orig := sa.DeepCopy()
-	sa.ImagePullSecrets = append(sa.ImagePullSecrets, corev1.LocalObjectReference{Name: secret.GetName()})
-	if err := r.Patch(ctx, sa, client.StrategicMergeFrom(orig), client.FieldOwner(fieldManager)); err != nil {
+	swapped := false
+	if replaced != "" && (!tracked || attached.Has(replaced)) {
+		for i, ref := range sa.ImagePullSecrets {
+			if ref.Name == replaced {
+				sa.ImagePullSecrets[i] = corev1.LocalObjectReference{Name: secret.GetName()}
+				swapped = true
+			}
+		}
+		attached.Delete(replaced)
+	}
+	if !swapped && !r.imagePullSecretAttached(sa, secret.GetName()) {
+		sa.ImagePullSecrets = append(sa.ImagePullSecrets, corev1.LocalObjectReference{Name: secret.GetName()})
+	}
+	attached.Insert(secret.GetName())
+	setAttachedSecrets(sa, attached)
+
+	// .imagePullSecrets is an atomic list, so server-side apply would take over the whole list from other managers.
+	// Instead, use optimistic locking not to overwrite concurrent changes by others.
+	if err := r.Patch(
+		ctx, sa, client.StrategicMergeFrom(orig, client.MergeFromWithOptimisticLock{}), client.FieldOwner(fieldManager),
+	); err != nil {
 		return fmt.Errorf("failed to patch a ServiceAccount: %w", err)
 	}
 	logger.Info("Attached the image pull secret to the ServiceAccount.")
@@ -279,19 +1307,29 @@ func (r *serviceAccountReconciler) attachImagePullSecret(
 	return nil
 }
 
+// cleanupImagePullSecrets detaches and deletes image pull secrets provisioned for a ServiceAccount except the one named
+// inUse.
 func (r *serviceAccountReconciler) cleanupImagePullSecrets(
-	ctx context.Context, logger logr.Logger, sa *corev1.ServiceAccount,
+	ctx context.Context, logger logr.Logger, sa *corev1.ServiceAccount, inUse string,
 ) (decommissioned []string, _ error) {
+	key := client.ObjectKeyFromObject(sa)
+	state := cleanState{namespace: secretNamespace(sa), inUse: inUse}
+	if r.cleanups.clean(key, state) {
+		logger.Info("No image pull secrets to cleanup since the last cleanup.")
+		return nil, nil
+	}
 	logger.Info("Cleaning up outdated image pull secrets...")
 
 	// List image pull secrets to cleanup.
-	targets, err := r.listImagePullSecretsToCleanup(ctx, sa)
+	generation := r.cleanups.snapshot()
+	targets, kept, err := r.listImagePullSecretsToCleanup(ctx, sa, inUse)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list image pull secrets to cleanup: %w", err)
 	}
 
-	if len(targets) == 0 {
+	if len(targets) == 0 && len(kept) == 0 {
 		logger.Info("No image pull secrets to cleanup.")
+		r.cleanups.remember(key, state, generation)
 		return nil, nil
 	}
 
@@ -301,17 +1339,40 @@ func (r *serviceAccountReconciler) cleanupImagePullSecrets(
 	}
 	logger.Info("Listed image pull secrets to cleanup.", "targets", names)
 
+	// Superseded image pull secrets are detached now, and deleted by a later cleanup once they expire.
+	// The cleanup is not remembered until then.
+	detach := targets
+	attached, _ := attachedSecrets(sa)
+	for _, secret := range kept {
+		logger.Info("Keeping a superseded image pull secret until it expires.", "secret", secret.GetName())
+		if secret.GetNamespace() == sa.GetNamespace() &&
+			(r.imagePullSecretAttached(sa, secret.GetName()) || attached.Has(secret.GetName())) {
+			detach = append(detach, secret)
+		}
+	}
+
 	// Detach the image pull secrets from the ServiceAccount.
-	if err := r.detachImagePullSecret(ctx, sa, targets); err != nil {
-		return nil, fmt.Errorf("failed to detach image pull secrets from a ServiceAccount: %w", err)
+	if len(detach) > 0 {
+		if err := r.detachImagePullSecret(ctx, sa, detach); err != nil {
+			return nil, fmt.Errorf("failed to detach image pull secrets from a ServiceAccount: %w", err)
+		}
+		logger.Info("Detached image pull secrets of cleanup targets from the ServiceAccount.")
+	}
+	if len(targets) == 0 {
+		return nil, nil
 	}
-	logger.Info("Detached image pull secrets of cleanup targets from the ServiceAccount.")
 
 	// Delete the image pull secrets.
 	for _, target := range targets {
 		if err := r.Delete(ctx, target); err != nil {
 			return nil, fmt.Errorf("failed to delete an image pull secret: %w", err)
 		}
+		secretOperations.WithLabelValues(providerName(sa), sa.GetNamespace(), secretOperationDeleted).Inc()
+		// Told on the Secret as well, e.g. for those kept by finalizers or looked up after they are gone.
+		r.eventRecorder.Eventf(
+			target, corev1.EventTypeNormal, reasonSucceededDecommissioning,
+			"Outdated image pull secret of ServiceAccount %s/%s decommissioned.", sa.GetNamespace(), sa.GetName(),
+		)
 	}
 	logger.Info("Deleted image pull secrets of cleanup targets.")
 
@@ -329,47 +1390,99 @@ func (r *serviceAccountReconciler) imagePullSecretAttached(sa *corev1.ServiceAcc
 }
 
 func (r *serviceAccountReconciler) generateAccessToken(
-	ctx context.Context, sa *corev1.ServiceAccount, audience string,
+	ctx context.Context, sa *corev1.ServiceAccount, audiences []string,
 ) (username string, token string, expiresAt time.Time, _ error) {
-	tokenReq := &authenticationv1.TokenRequest{
-		Spec: authenticationv1.TokenRequestSpec{
-			Audiences: []string{audience},
-		},
+	if r.preflightTokenRequests {
+		if err := r.preflightTokenExchange(sa); err != nil {
+			tokenRequests.WithLabelValues(strings.Join(audiences, ","), tokenRequestSkipped).Inc()
+			return "", "", time.Time{}, fmt.Errorf("skipped creating a ServiceAccount token: %w", err)
+		}
 	}
-	if err := r.SubResource("token").Create(ctx, sa, tokenReq); err != nil {
-		return "", "", time.Time{}, fmt.Errorf("failed to create a ServiceAccount token: %w", err)
+
+	// Wait for a slot of the registry before creating a ServiceAccount token not to let it expire while waiting.
+	release, err := r.planner.acquire(ctx, refreshGroup(sa))
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	defer release()
+
+	k8sToken, err := r.createServiceAccountToken(ctx, sa, audiences)
+	if err != nil {
+		return "", "", time.Time{}, err
 	}
 
+	return r.exchangeServiceAccountToken(ctx, sa, k8sToken)
+}
+
+// exchangeServiceAccountToken exchanges a token of a ServiceAccount for an access token for the configured container
+// registry.
+func (r *serviceAccountReconciler) exchangeServiceAccountToken(
+	ctx context.Context, sa *corev1.ServiceAccount, k8sToken string,
+) (username string, token string, expiresAt time.Time, _ error) {
 	// AWS.
-	if roleARN := sa.Annotations[annotationKeyAWSRoleARN]; roleARN != "" {
-		registry := sa.Annotations[annotationKeyRegistry]
-		return r.generateAccessTokenAWS(ctx, tokenReq.Status.Token, registry, roleARN)
+	if roleARN := annotation(sa, annotationKeyAWSRoleARN); roleARN != "" {
+		region, err := awsRegion(sa, r.aws)
+		if err != nil {
+			return "", "", time.Time{}, err
+		}
+		return r.generateAccessTokenAWS(ctx, k8sToken, region, roleARN)
 	}
 
 	// Google.
-	provider := sa.Annotations[annotationKeyGoogleWIDP]
-	saEmail := sa.Annotations[annotationKeyGoogleSA]
+	provider := annotation(sa, annotationKeyGoogleWIDP)
+	saEmail := annotation(sa, annotationKeyGoogleSA)
 	if provider != "" && saEmail != "" {
-		token, expiresAt, err := r.google.GenerateAccessToken(ctx, tokenReq.Status.Token, provider, saEmail)
+		var token string
+		var expiresAt time.Time
+		err := r.callProvider(ctx, r.googleLimiter, r.googleBreaker, func(ctx context.Context) error {
+			var err error
+			token, expiresAt, err = r.google.GenerateAccessToken(ctx, k8sToken, provider, saEmail)
+			return err
+		})
 		if err != nil {
 			return "", "", time.Time{}, fmt.Errorf("failed to generate a Google service account's access token: %w", err)
 		}
 
-		return "oauth2accesstoken", token, expiresAt, nil
+		return googlecredentials.Username, token, expiresAt, nil
 	}
 
 	return "", "", time.Time{}, errors.New("ServiceAccount is missing configuration for image pull secret provisioning")
 }
 
+// callProvider calls a container registry provider through its circuit breaker and rate limiter with the configured
+// timeout.
+func (r *serviceAccountReconciler) callProvider(
+	ctx context.Context, limiter *rate.Limiter, breaker *circuitBreaker, f func(ctx context.Context) error,
+) error {
+	// Errors of providers may echo request bodies including tokens.
+	return redactError(breaker.do(ctx, func() error {
+		if err := limiter.Wait(ctx); err != nil {
+			return fmt.Errorf("failed to wait for the rate limiter: %w", err)
+		}
+
+		if r.providerTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, r.providerTimeout)
+			defer cancel()
+		}
+
+		defer func(start time.Time) {
+			tokenExchangeDuration.WithLabelValues(breaker.provider).Observe(time.Since(start).Seconds())
+		}(time.Now())
+
+		return f(ctx)
+	}))
+}
+
 func (r *serviceAccountReconciler) generateAccessTokenAWS(
-	ctx context.Context, k8sToken string, registry string, roleARN string,
+	ctx context.Context, k8sToken string, region string, roleARN string,
 ) (username string, token string, expiresAt time.Time, _ error) {
-	region, err := r.aws.ExtractRegion(registry)
-	if err != nil {
-		return "", "", time.Time{}, fmt.Errorf("failed to extract an AWS region from registry: %w", err)
-	}
-
-	username, password, expiresAt, err := r.aws.GenerateAccessToken(ctx, k8sToken, region, roleARN)
+	var password string
+	err := r.callProvider(ctx, r.awsLimiter, r.awsBreaker, func(ctx context.Context) error {
+		var err error
+		username, password, expiresAt, err = r.aws.GenerateAccessToken(ctx, k8sToken, region, roleARN)
+		return err
+	})
 	if err != nil {
 		return "", "", time.Time{}, fmt.Errorf("failed to generate an ECR authorization token: %w", err)
 	}
@@ -377,76 +1490,155 @@ func (r *serviceAccountReconciler) generateAccessTokenAWS(
 	return username, password, expiresAt, nil
 }
 
+// ensureSecret creates or updates an image pull secret by server-side apply.
+// Fields managed by others, e.g. labels added by users or other controllers, are left as they are.
 func (r *serviceAccountReconciler) ensureSecret(
 	ctx context.Context, desired *corev1.Secret,
 ) (controllerutil.OperationResult, error) {
-	// We don't use controllerutil.CreateOrPatch because it does not accept client.{Create,Patch}Option.
-
 	orig := &corev1.Secret{}
+	exists := true
 	if err := r.Get(ctx, client.ObjectKeyFromObject(desired), orig); err != nil {
 		if !apierrors.IsNotFound(err) {
 			return controllerutil.OperationResultNone,
 				fmt.Errorf("failed to check the existing of an image pull secret: %w", err)
 		}
+		exists = false
+	}
 
-		if err := r.Create(ctx, desired, client.FieldOwner(fieldManager)); err != nil {
-			return controllerutil.OperationResultNone,
-				fmt.Errorf("failed to create an image pull secret: %w", err)
-		}
-
-		return controllerutil.OperationResultCreated, nil
+	// Immutable Secrets are named after their content, so the existing one is identical to the desired one.
+	if exists && ptr.Deref(desired.Immutable, false) {
+		return controllerutil.OperationResultNone, nil
 	}
 
-	if !reflect.DeepEqual(orig, desired) {
-		if err := r.Patch(ctx, desired, client.StrategicMergeFrom(orig), client.FieldOwner(fieldManager)); err != nil {
-			return controllerutil.OperationResultNone,
-				fmt.Errorf("failed to patch an image pull secret: %w", err)
-		}
+	desired.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Secret"))
+	if err := r.Patch(ctx, desired, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership); err != nil {
+		return controllerutil.OperationResultNone, fmt.Errorf("failed to apply an image pull secret: %w", err)
+	}
 
+	switch {
+	case !exists:
+		return controllerutil.OperationResultCreated, nil
+	case desired.GetResourceVersion() != orig.GetResourceVersion():
 		return controllerutil.OperationResultUpdated, nil
+	default:
+		return controllerutil.OperationResultNone, nil
 	}
-
-	return controllerutil.OperationResultNone, nil
 }
 
-func (r *serviceAccountReconciler) listImagePullSecretsToCleanup(
-	ctx context.Context, sa *corev1.ServiceAccount,
-) ([]*corev1.Secret, error) {
+// listImagePullSecrets lists image pull secrets provisioned for a ServiceAccount in any namespace.
+func (r *serviceAccountReconciler) listImagePullSecrets(
+	ctx context.Context, sa types.NamespacedName,
+) ([]corev1.Secret, error) {
 	secrets := &corev1.SecretList{}
-	if err := r.List(
-		ctx,
-		secrets,
-		client.InNamespace(sa.GetNamespace()),
-		client.MatchingLabels{
-			labelKeyServiceAccount: sa.GetName(),
-		},
-	); err != nil {
+	if err := r.List(ctx, secrets, client.MatchingFields{indexKeyServiceAccount: sa.String()}); err != nil {
 		return nil, fmt.Errorf("failed to list image pull secrets: %w", err)
 	}
 
-	inUse := ""
-	if hasConfig(sa) {
-		inUse = secretName(sa)
+	return secrets.Items, nil
+}
+
+// deleteImagePullSecretsElsewhere deletes image pull secrets provisioned in other namespaces for a ServiceAccount that
+// no longer exists. Those in the namespace of the ServiceAccount are deleted by the garbage collector.
+func (r *serviceAccountReconciler) deleteImagePullSecretsElsewhere(
+	ctx context.Context, logger logr.Logger, sa types.NamespacedName,
+) error {
+	secrets, err := r.listImagePullSecrets(ctx, sa)
+	if err != nil {
+		return err
+	}
+
+	for _, secret := range secrets {
+		if secret.GetNamespace() == sa.Namespace {
+			continue
+		}
+		if r.dryRun {
+			logger.Info("Dry run: would delete an image pull secret.", "secret", client.ObjectKeyFromObject(&secret))
+			continue
+		}
+		if err := r.Delete(ctx, &secret); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to delete an image pull secret: %w", err)
+		}
+		secretOperations.WithLabelValues("", sa.Namespace, secretOperationDeleted).Inc()
+		r.eventRecorder.Eventf(
+			&secret, corev1.EventTypeNormal, reasonSucceededDecommissioning,
+			"Image pull secret of deleted ServiceAccount %s decommissioned.", sa,
+		)
+		logger.Info("Deleted an image pull secret.", "secret", client.ObjectKeyFromObject(&secret))
+	}
+
+	return nil
+}
+
+// checkSecretNamespace checks that a ServiceAccount designates a namespace allowed to provision image pull secrets in.
+func (r *serviceAccountReconciler) checkSecretNamespace(sa *corev1.ServiceAccount) error {
+	ns := secretNamespace(sa)
+	if ns == sa.GetNamespace() || r.secretNamespaces.Has(ns) {
+		return nil
+	}
+
+	return fmt.Errorf("namespace %q designated by %q annotation is not allowed", ns, annotationKeySecretNamespace)
+}
+
+// listImagePullSecretsToCleanup lists image pull secrets provisioned for a ServiceAccount in any namespace except the
+// one named inUse in the namespace to provision them in.
+// Immutable image pull secrets superseded by the one in use are listed separately as kept, to be detached but not
+// deleted until they expire.
+func (r *serviceAccountReconciler) listImagePullSecretsToCleanup(
+	ctx context.Context, sa *corev1.ServiceAccount, inUse string,
+) (targets []*corev1.Secret, kept []*corev1.Secret, _ error) {
+	secrets, err := r.listImagePullSecrets(ctx, client.ObjectKeyFromObject(sa))
+	if err != nil {
+		return nil, nil, err
 	}
 
-	targets := []*corev1.Secret{}
-	for _, secret := range secrets.Items {
-		if secret.GetName() == inUse {
+	now := time.Now()
+	for _, secret := range secrets {
+		if secret.GetNamespace() == secretNamespace(sa) && secret.GetName() == inUse {
+			continue
+		}
+		if inUse != "" && superseded(&secret, sa, now) {
+			kept = append(kept, &secret)
 			continue
 		}
 
 		targets = append(targets, &secret)
 	}
 
-	return targets, nil
+	return targets, kept, nil
+}
+
+// superseded returns true iff an image pull secret is an immutable one of a ServiceAccount replaced by a newer one
+// with the same configuration, and still valid. Pods admitted before the replacement keep referring to it, e.g. to pull
+// images on restarts of their containers, so it is deleted only after it expires.
+func superseded(secret *corev1.Secret, sa *corev1.ServiceAccount, now time.Time) bool {
+	if !ptr.Deref(secret.Immutable, false) || secret.GetNamespace() != secretNamespace(sa) ||
+		!strings.HasPrefix(secret.GetName(), immutableSecretNamePrefix(sa)) ||
+		secret.Annotations[annotationKeyConfigHash] != configHash(sa) {
+		return false
+	}
+
+	expiresAt, err := secretExpiresAt(secret)
+	return err == nil && now.Before(expiresAt)
 }
 
+// detachImagePullSecret detaches image pull secrets from a ServiceAccount.
+// Only references attached by the controller are removed so that references added by users are never touched.
+// On conflicts with concurrent updates, it retries with the latest ServiceAccount.
 func (r *serviceAccountReconciler) detachImagePullSecret(
 	ctx context.Context, sa *corev1.ServiceAccount, targets []*corev1.Secret,
+) error {
+	return r.retryOnConflict(ctx, sa, func() error {
+		return r.patchImagePullSecretsDetached(ctx, sa, targets)
+	})
+}
+
+// patchImagePullSecretsDetached patches a ServiceAccount once to detach image pull secrets from it.
+func (r *serviceAccountReconciler) patchImagePullSecretsDetached(
+	ctx context.Context, sa *corev1.ServiceAccount, targets []*corev1.Secret,
 ) error {
 	isTarget := func(name string) bool {
 		for _, target := range targets {
-			if target.GetName() == name {
+			if target.GetNamespace() == sa.GetNamespace() && target.GetName() == name {
 				return true
 			}
 		}
@@ -454,9 +1646,13 @@ func (r *serviceAccountReconciler) detachImagePullSecret(
 		return false
 	}
 
+	// ServiceAccounts not updated by a version of the controller that tracks attached image pull secrets may have
+	// references attached by older versions, so fall back to removing all references to the targets.
+	attached, tracked := attachedSecrets(sa)
+
 	retained := []corev1.LocalObjectReference{}
 	for _, ref := range sa.ImagePullSecrets {
-		if isTarget(ref.Name) {
+		if isTarget(ref.Name) && (!tracked || attached.Has(ref.Name)) {
 			continue
 		}
 
@@ -465,7 +1661,15 @@ func (r *serviceAccountReconciler) detachImagePullSecret(
 
 	orig := sa.DeepCopy()
 	sa.ImagePullSecrets = retained
-	if err := r.Patch(ctx, sa, client.StrategicMergeFrom(orig), client.FieldOwner(fieldManager)); err != nil {
+	if tracked {
+		for _, target := range targets {
+			attached.Delete(target.GetName())
+		}
+		setAttachedSecrets(sa, attached)
+	}
+	if err := r.Patch(
+		ctx, sa, client.StrategicMergeFrom(orig, client.MergeFromWithOptimisticLock{}), client.FieldOwner(fieldManager),
+	); err != nil {
 		return fmt.Errorf("failed to patch a ServiceAccount: %w", err)
 	}
 
@@ -18,14 +18,22 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
 	"time"
 
+	"github.com/go-logr/logr"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/pfnet/image-pull-secrets-provisioner/pkg/credentials/credentialstest"
 )
 
 var _ = Describe("ServiceAccountReconciler", func() {
@@ -115,6 +123,50 @@ var _ = Describe("ServiceAccountReconciler", func() {
 			}).Should(Succeed())
 		})
 
+		It("Record events on the Secret", func() {
+			// Create a ServiceAccount.
+			sa := sa.DeepCopy()
+			Expect(k8sClient.Create(ctx, sa)).NotTo(HaveOccurred())
+			objectsToDelete = append(objectsToDelete, sa)
+
+			// Wait for a Secret is created once.
+			secret := &corev1.Secret{}
+			Eventually(func(g Gomega) {
+				secrets := &corev1.SecretList{}
+				g.Expect(k8sClient.List(
+					ctx,
+					secrets,
+					client.InNamespace(ns),
+					client.MatchingLabels{
+						"imagepullsecrets.preferred.jp/service-account": sa.GetName(),
+					},
+				)).NotTo(HaveOccurred())
+				g.Expect(secrets.Items).To(HaveLen(1))
+
+				secret = &secrets.Items[0]
+			}).Should(Succeed())
+
+			// Test that the provisioning is recorded on the Secret.
+			Eventually(func(g Gomega) {
+				events := &corev1.EventList{}
+				g.Expect(k8sClient.List(
+					ctx,
+					events,
+					client.InNamespace(ns),
+					client.MatchingFields{
+						"involvedObject.kind": "Secret",
+						"involvedObject.name": secret.GetName(),
+					},
+				)).NotTo(HaveOccurred())
+
+				reasons := []string{}
+				for _, event := range events.Items {
+					reasons = append(reasons, event.Reason)
+				}
+				g.Expect(reasons).To(ContainElement(reasonSucceededProvisioning))
+			}).Should(Succeed())
+		})
+
 		It("Skip refreshing Secrets", func() {
 			// Create a ServiceAccount.
 			sa := sa.DeepCopy()
@@ -185,6 +237,206 @@ var _ = Describe("ServiceAccountReconciler", func() {
 			}).WithTimeout(2 * tokenValidity).Should(Succeed()) // 2 x token validity.
 		})
 
+		It("Recreate a deleted Secret", func() {
+			// Create a ServiceAccount.
+			sa := sa.DeepCopy()
+			Expect(k8sClient.Create(ctx, sa)).NotTo(HaveOccurred())
+			objectsToDelete = append(objectsToDelete, sa)
+
+			// Wait for a Secret is created once.
+			deleted := &corev1.Secret{}
+			Eventually(func(g Gomega) {
+				secrets := &corev1.SecretList{}
+				g.Expect(k8sClient.List(
+					ctx,
+					secrets,
+					client.InNamespace(ns),
+					client.MatchingLabels{
+						"imagepullsecrets.preferred.jp/service-account": sa.GetName(),
+					},
+				)).NotTo(HaveOccurred())
+				g.Expect(secrets.Items).To(HaveLen(1))
+
+				deleted = &secrets.Items[0]
+			}).Should(Succeed())
+
+			// Delete the Secret out-of-band.
+			Expect(k8sClient.Delete(ctx, deleted)).NotTo(HaveOccurred())
+
+			// Test that the Secret is recreated well before it would have been refreshed.
+			Eventually(func(g Gomega) {
+				actual := &corev1.Secret{}
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(deleted), actual)).NotTo(HaveOccurred())
+
+				g.Expect(actual.GetUID()).NotTo(Equal(deleted.GetUID()))
+			}).WithTimeout(tokenValidity / 2).Should(Succeed())
+		})
+
+		It("Reattach a detached Secret without refreshing it", func() {
+			// Create a ServiceAccount.
+			sa := sa.DeepCopy()
+			Expect(k8sClient.Create(ctx, sa)).NotTo(HaveOccurred())
+			objectsToDelete = append(objectsToDelete, sa)
+
+			// Wait for a Secret is created and attached once.
+			secret := &corev1.Secret{}
+			Eventually(func(g Gomega) {
+				secrets := &corev1.SecretList{}
+				g.Expect(k8sClient.List(
+					ctx,
+					secrets,
+					client.InNamespace(ns),
+					client.MatchingLabels{
+						"imagepullsecrets.preferred.jp/service-account": sa.GetName(),
+					},
+				)).NotTo(HaveOccurred())
+				g.Expect(secrets.Items).To(HaveLen(1))
+
+				secret = &secrets.Items[0]
+
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(sa), sa)).NotTo(HaveOccurred())
+				g.Expect(sa.ImagePullSecrets).To(WithTransform(extractNames, ConsistOf("static", secret.GetName())))
+			}).Should(Succeed())
+
+			// Detach the Secret out-of-band.
+			orig := sa.DeepCopy()
+			sa.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "static"}}
+			Expect(k8sClient.Patch(ctx, sa, client.MergeFrom(orig))).NotTo(HaveOccurred())
+
+			// Test that the Secret is attached again as it is.
+			Eventually(func(g Gomega) {
+				actual := &corev1.ServiceAccount{}
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(sa), actual)).NotTo(HaveOccurred())
+
+				g.Expect(actual.ImagePullSecrets).To(WithTransform(extractNames, ConsistOf("static", secret.GetName())))
+			}).WithTimeout(tokenValidity / 2).Should(Succeed())
+
+			actual := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(secret), actual)).NotTo(HaveOccurred())
+			Expect(actual.Data).To(Equal(secret.Data))
+		})
+
+		It("Refresh a Secret on request", func() {
+			// Create a ServiceAccount.
+			sa := sa.DeepCopy()
+			Expect(k8sClient.Create(ctx, sa)).NotTo(HaveOccurred())
+			objectsToDelete = append(objectsToDelete, sa)
+
+			// Wait for a Secret is created once.
+			secret := &corev1.Secret{}
+			Eventually(func(g Gomega) {
+				secrets := &corev1.SecretList{}
+				g.Expect(k8sClient.List(
+					ctx,
+					secrets,
+					client.InNamespace(ns),
+					client.MatchingLabels{
+						"imagepullsecrets.preferred.jp/service-account": sa.GetName(),
+					},
+				)).NotTo(HaveOccurred())
+				g.Expect(secrets.Items).To(HaveLen(1))
+
+				secret = &secrets.Items[0]
+			}).Should(Succeed())
+
+			// Request refreshing.
+			orig := sa.DeepCopy()
+			sa.Annotations["imagepullsecrets.preferred.jp/refresh-requested-at"] = time.Now().Format(time.RFC3339)
+			Expect(k8sClient.Patch(ctx, sa, client.StrategicMergeFrom(orig))).NotTo(HaveOccurred())
+
+			// Test that the Secret is refreshed well before it would have been refreshed.
+			Eventually(func(g Gomega) {
+				actual := &corev1.Secret{}
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(secret), actual)).NotTo(HaveOccurred())
+
+				g.Expect(actual.Data).NotTo(Equal(secret.Data))
+			}).WithTimeout(tokenValidity / 2).Should(Succeed())
+		})
+
+		It("Restore a modified Secret", func() {
+			// Create a ServiceAccount.
+			sa := sa.DeepCopy()
+			Expect(k8sClient.Create(ctx, sa)).NotTo(HaveOccurred())
+			objectsToDelete = append(objectsToDelete, sa)
+
+			// Wait for a Secret is created once.
+			secret := &corev1.Secret{}
+			Eventually(func(g Gomega) {
+				secrets := &corev1.SecretList{}
+				g.Expect(k8sClient.List(
+					ctx,
+					secrets,
+					client.InNamespace(ns),
+					client.MatchingLabels{
+						"imagepullsecrets.preferred.jp/service-account": sa.GetName(),
+					},
+				)).NotTo(HaveOccurred())
+				g.Expect(secrets.Items).To(HaveLen(1))
+
+				secret = &secrets.Items[0]
+			}).Should(Succeed())
+
+			// Modify the Secret's data out-of-band.
+			orig := secret.DeepCopy()
+			secret.Data[corev1.DockerConfigJsonKey] = []byte(`{"auths":{}}`)
+			Expect(k8sClient.Patch(ctx, secret, client.MergeFrom(orig))).NotTo(HaveOccurred())
+
+			// Test that the Secret is restored.
+			Eventually(func(g Gomega) {
+				actual := &corev1.Secret{}
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(secret), actual)).NotTo(HaveOccurred())
+
+				g.Expect(actual.Data[corev1.DockerConfigJsonKey]).NotTo(Equal([]byte(`{"auths":{}}`)))
+				g.Expect(actual.Annotations).To(HaveKeyWithValue(
+					"imagepullsecrets.preferred.jp/content-hash", contentHash(actual.Data[corev1.DockerConfigJsonKey]),
+				))
+			}).WithTimeout(tokenValidity / 2).Should(Succeed())
+		})
+
+		It("Not overwrite a Secret not managed by the controller", func() {
+			// Create a Secret not managed by the controller.
+			userManaged := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:    ns,
+					GenerateName: "user-managed-",
+				},
+				Type: corev1.SecretTypeDockerConfigJson,
+				Data: map[string][]byte{
+					corev1.DockerConfigJsonKey: []byte(`{"auths":{}}`),
+				},
+			}
+			Expect(k8sClient.Create(ctx, userManaged)).NotTo(HaveOccurred())
+			objectsToDelete = append(objectsToDelete, userManaged)
+
+			// Create a ServiceAccount configured to provision the Secret.
+			sa := sa.DeepCopy()
+			sa.Annotations["imagepullsecrets.preferred.jp/secret-name"] = userManaged.GetName()
+			Expect(k8sClient.Create(ctx, sa)).NotTo(HaveOccurred())
+			objectsToDelete = append(objectsToDelete, sa)
+
+			// Test that the Secret is not overwritten.
+			Consistently(func(g Gomega) {
+				actual := &corev1.Secret{}
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(userManaged), actual)).NotTo(HaveOccurred())
+
+				g.Expect(actual.Data).To(Equal(userManaged.Data))
+			}, time.Second).Should(Succeed())
+
+			// Allow the controller to adopt the Secret.
+			orig := sa.DeepCopy()
+			sa.Annotations["imagepullsecrets.preferred.jp/adopt"] = "true"
+			Expect(k8sClient.Patch(ctx, sa, client.StrategicMergeFrom(orig))).NotTo(HaveOccurred())
+
+			// Test that the Secret is adopted.
+			Eventually(func(g Gomega) {
+				actual := &corev1.Secret{}
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(userManaged), actual)).NotTo(HaveOccurred())
+
+				g.Expect(actual.Labels).To(HaveKeyWithValue("imagepullsecrets.preferred.jp/service-account", sa.GetName()))
+				g.Expect(actual.Data).NotTo(Equal(userManaged.Data))
+			}).Should(Succeed())
+		})
+
 		It("Cleanup outdated Secrets", func() {
 			// Create a ServiceAccount.
 			sa := sa.DeepCopy()
@@ -241,6 +493,239 @@ var _ = Describe("ServiceAccountReconciler", func() {
 			}).Should(Succeed())
 		})
 
+		It("Keep a superseded immutable Secret until it expires", func() {
+			// Create a suspended ServiceAccount not to let the controller, which provisions mutable Secrets, manage it.
+			sa := sa.DeepCopy()
+			sa.Annotations["imagepullsecrets.preferred.jp/suspend"] = "true"
+			Expect(k8sClient.Create(ctx, sa)).NotTo(HaveOccurred())
+			objectsToDelete = append(objectsToDelete, sa)
+
+			// Create immutable Secrets as rotated by renaming.
+			createSecret := func(password string, expiresAt time.Time) *corev1.Secret {
+				secret, err := buildImagePullSecret(
+					sa, immutableSecretName(sa, password), sa.Annotations["imagepullsecrets.preferred.jp/registry"],
+					"oauth2accesstoken", password, expiresAt.Add(-time.Hour), expiresAt, nil,
+				)
+				Expect(err).NotTo(HaveOccurred())
+				secret.Immutable = ptr.To(true)
+				Expect(k8sClient.Create(ctx, secret)).NotTo(HaveOccurred())
+				return secret
+			}
+			now := time.Now()
+			expired := createSecret("expired", now.Add(-time.Minute))
+			superseded := createSecret("superseded", now.Add(time.Hour))
+			current := createSecret("current", now.Add(2*time.Hour))
+
+			// Attach the superseded Secret as before the rotation.
+			orig := sa.DeepCopy()
+			sa.ImagePullSecrets = append(sa.ImagePullSecrets, corev1.LocalObjectReference{Name: superseded.GetName()})
+			Expect(k8sClient.Patch(ctx, sa, client.StrategicMergeFrom(orig))).NotTo(HaveOccurred())
+
+			// Cleanup once the cache of the manager has the Secrets.
+			r := &serviceAccountReconciler{
+				Client:        k8sManager.GetClient(),
+				apiReader:     k8sClient,
+				eventRecorder: record.NewFakeRecorder(100),
+			}
+			Eventually(func(g Gomega) {
+				actual := &corev1.ServiceAccount{}
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(sa), actual)).NotTo(HaveOccurred())
+				_, err := r.cleanupImagePullSecrets(ctx, logr.Discard(), actual, current.GetName())
+				g.Expect(err).NotTo(HaveOccurred())
+
+				// Test that the expired Secret is deleted.
+				err = k8sClient.Get(ctx, client.ObjectKeyFromObject(expired), &corev1.Secret{})
+				g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			}).Should(Succeed())
+
+			// Test that the superseded Secret survives the rotation, detached from the ServiceAccount.
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(superseded), &corev1.Secret{})).NotTo(HaveOccurred())
+			actual := &corev1.ServiceAccount{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(sa), actual)).NotTo(HaveOccurred())
+			Expect(actual.ImagePullSecrets).To(WithTransform(extractNames, ConsistOf("static")))
+		})
+
+		It("Adopt an orphaned Secret", func() {
+			// Create a ServiceAccount.
+			sa := sa.DeepCopy()
+			Expect(k8sClient.Create(ctx, sa)).NotTo(HaveOccurred())
+			objectsToDelete = append(objectsToDelete, sa)
+
+			// Wait for a Secret is created once.
+			orphan := &corev1.Secret{}
+			Eventually(func(g Gomega) {
+				secrets := &corev1.SecretList{}
+				g.Expect(k8sClient.List(
+					ctx,
+					secrets,
+					client.InNamespace(ns),
+					client.MatchingLabels{
+						"imagepullsecrets.preferred.jp/service-account": sa.GetName(),
+					},
+				)).NotTo(HaveOccurred())
+				g.Expect(secrets.Items).To(HaveLen(1))
+
+				orphan = &secrets.Items[0]
+			}).Should(Succeed())
+
+			// Change the name of Secret to provision.
+			orig := sa.DeepCopy()
+			sa.Annotations["imagepullsecrets.preferred.jp/secret-name"] = "imagepullsecret-adopted"
+			Expect(k8sClient.Patch(ctx, sa, client.StrategicMergeFrom(orig))).NotTo(HaveOccurred())
+
+			// Test that the credentials in the orphaned Secret are reused instead of generating new ones.
+			Eventually(func(g Gomega) {
+				secrets := &corev1.SecretList{}
+				g.Expect(k8sClient.List(
+					ctx,
+					secrets,
+					client.InNamespace(ns),
+					client.MatchingLabels{
+						"imagepullsecrets.preferred.jp/service-account": sa.GetName(),
+					},
+				)).NotTo(HaveOccurred())
+				g.Expect(secrets.Items).To(HaveLen(1))
+
+				g.Expect(secrets.Items[0].GetName()).To(Equal("imagepullsecret-adopted"))
+				g.Expect(secrets.Items[0].Data).To(Equal(orphan.Data))
+			}).WithTimeout(tokenValidity / 2).Should(Succeed())
+		})
+
+		It("Suspend provisioning", func() {
+			// Create a suspended ServiceAccount.
+			sa := sa.DeepCopy()
+			sa.Annotations["imagepullsecrets.preferred.jp/suspend"] = "true"
+			Expect(k8sClient.Create(ctx, sa)).NotTo(HaveOccurred())
+			objectsToDelete = append(objectsToDelete, sa)
+
+			listSecrets := func(g Gomega) []corev1.Secret {
+				secrets := &corev1.SecretList{}
+				g.Expect(k8sClient.List(
+					ctx,
+					secrets,
+					client.InNamespace(ns),
+					client.MatchingLabels{
+						"imagepullsecrets.preferred.jp/service-account": sa.GetName(),
+					},
+				)).NotTo(HaveOccurred())
+				return secrets.Items
+			}
+
+			// Test that no Secret is created while suspended.
+			Consistently(func(g Gomega) {
+				g.Expect(listSecrets(g)).To(BeEmpty())
+			}, time.Second).Should(Succeed())
+
+			// Resume provisioning.
+			orig := sa.DeepCopy()
+			delete(sa.Annotations, "imagepullsecrets.preferred.jp/suspend")
+			Expect(k8sClient.Patch(ctx, sa, client.StrategicMergeFrom(orig))).NotTo(HaveOccurred())
+
+			// Test that a Secret is created.
+			Eventually(func(g Gomega) {
+				g.Expect(listSecrets(g)).To(HaveLen(1))
+			}).Should(Succeed())
+		})
+
+		It("Hand over ServiceAccounts due for refresh soon to the next leader", func() {
+			// Create a ServiceAccount, whose image pull secret is always due for refresh within the handover window.
+			sa := sa.DeepCopy()
+			Expect(k8sClient.Create(ctx, sa)).NotTo(HaveOccurred())
+			objectsToDelete = append(objectsToDelete, sa)
+
+			r := &serviceAccountReconciler{
+				Client:            k8sClient,
+				apiReader:         k8sClient,
+				handoverConfigMap: types.NamespacedName{Namespace: ns, Name: "handover"},
+			}
+			Expect(r.handOver(ctx)).NotTo(HaveOccurred())
+			objectsToDelete = append(objectsToDelete, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: "handover"},
+			})
+
+			// Test that the next leader takes over the ServiceAccount.
+			handedOver, err := r.takeOver(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(handedOver).To(ContainElement(WithTransform(
+				func(sa *corev1.ServiceAccount) string { return sa.GetName() }, Equal(sa.GetName()),
+			)))
+
+			// Test that the handover is overwritten by the next one.
+			Expect(r.handOver(ctx)).NotTo(HaveOccurred())
+		})
+
+		It("Exchange a ServiceAccount token with Google", func() {
+			// Create a ServiceAccount.
+			sa := sa.DeepCopy()
+			Expect(k8sClient.Create(ctx, sa)).NotTo(HaveOccurred())
+			objectsToDelete = append(objectsToDelete, sa)
+
+			// Test that a Secret has an access token issued by the fake.
+			Eventually(func(g Gomega) {
+				secrets := &corev1.SecretList{}
+				g.Expect(k8sClient.List(
+					ctx,
+					secrets,
+					client.InNamespace(ns),
+					client.MatchingLabels{
+						"imagepullsecrets.preferred.jp/service-account": sa.GetName(),
+					},
+				)).NotTo(HaveOccurred())
+				g.Expect(secrets.Items).To(HaveLen(1))
+				g.Expect(string(secrets.Items[0].Data[corev1.DockerConfigJsonKey])).To(ContainSubstring(
+					`"username":"oauth2accesstoken","password":"fake-access-token-`,
+				))
+			}).Should(Succeed())
+
+			// Test that a ServiceAccount token for the workload identity provider is exchanged.
+			audiences := func(token string) []string {
+				_, audiences, err := tokenClaims(token)
+				Expect(err).NotTo(HaveOccurred())
+				return audiences
+			}
+			Expect(fakeGoogle.SubjectTokens()).To(ContainElement(WithTransform(
+				audiences, ContainElement(sa.Annotations["imagepullsecrets.preferred.jp/audience"]),
+			)))
+		})
+
+		It("Report a failure of a token exchange", func() {
+			// Make Google STS deny token exchanges.
+			fakeGoogle.Fail(credentialstest.StepExchangeToken, http.StatusForbidden)
+			DeferCleanup(fakeGoogle.Fail, credentialstest.StepExchangeToken, 0)
+
+			// Create a ServiceAccount.
+			sa := sa.DeepCopy()
+			Expect(k8sClient.Create(ctx, sa)).NotTo(HaveOccurred())
+			objectsToDelete = append(objectsToDelete, sa)
+
+			// Test that the failure is recorded in the ServiceAccount.
+			Eventually(func(g Gomega) {
+				actual := &corev1.ServiceAccount{}
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(sa), actual)).NotTo(HaveOccurred())
+
+				status := &provisioningStatus{}
+				g.Expect(json.Unmarshal(
+					[]byte(actual.Annotations["imagepullsecrets.preferred.jp/status"]), status,
+				)).NotTo(HaveOccurred())
+				g.Expect(status.LastError).To(ContainSubstring("failed to exchange a ServiceAccount token"))
+			}).Should(Succeed())
+
+			// Test that a Secret is created once Google STS recovers.
+			fakeGoogle.Fail(credentialstest.StepExchangeToken, 0)
+			Eventually(func(g Gomega) {
+				secrets := &corev1.SecretList{}
+				g.Expect(k8sClient.List(
+					ctx,
+					secrets,
+					client.InNamespace(ns),
+					client.MatchingLabels{
+						"imagepullsecrets.preferred.jp/service-account": sa.GetName(),
+					},
+				)).NotTo(HaveOccurred())
+				g.Expect(secrets.Items).To(HaveLen(1))
+			}).Should(Succeed())
+		})
+
 		It("Cleanup all Secrets", func() {
 			// Create a ServiceAccount.
 			sa := sa.DeepCopy()
@@ -290,6 +775,30 @@ var _ = Describe("ServiceAccountReconciler", func() {
 		})
 	})
 
+	It("Sweep orphaned Secrets", func() {
+		// Create an image pull secret whose ServiceAccount does not exist.
+		orphan := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:    ns,
+				GenerateName: "orphan-",
+				Labels: map[string]string{
+					"imagepullsecrets.preferred.jp/service-account": "nonexistent",
+				},
+			},
+			Type: corev1.SecretTypeDockerConfigJson,
+			Data: map[string][]byte{
+				corev1.DockerConfigJsonKey: []byte(`{"auths":{}}`),
+			},
+		}
+		Expect(k8sClient.Create(ctx, orphan)).NotTo(HaveOccurred())
+
+		// Test that the Secret is deleted.
+		Eventually(func(g Gomega) {
+			err := k8sClient.Get(ctx, client.ObjectKeyFromObject(orphan), &corev1.Secret{})
+			g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		}).Should(Succeed())
+	})
+
 	Context("AWS", func() {
 		sa := &corev1.ServiceAccount{
 			ObjectMeta: metav1.ObjectMeta{
@@ -331,6 +840,10 @@ var _ = Describe("ServiceAccountReconciler", func() {
 				secret = &secrets.Items[0]
 			}).Should(Succeed())
 			Expect(secret.Annotations).To(HaveKey("imagepullsecrets.preferred.jp/expires-at"))
+			// Test that the Secret has an authorization token issued by the fake.
+			Expect(string(secret.Data[corev1.DockerConfigJsonKey])).To(ContainSubstring(
+				`"username":"AWS","password":"fake-ecr-password-`,
+			))
 
 			// Test that the Secret is attached to the ServiceAccount.
 			Eventually(func(g Gomega) {
@@ -0,0 +1,54 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// Shard identifies the namespaces reconciled by one of replicas of the controller running actively at the same time.
+// Namespaces are assigned to shards by their hash. The zero value reconciles all namespaces.
+type Shard struct {
+	// Index is the index of the shard in [0, Count).
+	Index int
+	// Count is the number of shards. Zero or one disables sharding.
+	Count int
+}
+
+// Validate returns an error if the shard is not valid.
+func (s Shard) Validate() error {
+	if s.Count < 0 {
+		return fmt.Errorf("shard count must not be negative: %d", s.Count)
+	}
+	if s.Count > 1 && (s.Index < 0 || s.Index >= s.Count) {
+		return fmt.Errorf("shard index must be in [0, %d): %d", s.Count, s.Index)
+	}
+
+	return nil
+}
+
+// Contains returns true if a namespace is assigned to the shard.
+func (s Shard) Contains(namespace string) bool {
+	if s.Count <= 1 {
+		return true
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(namespace))
+	return h.Sum32()%uint32(s.Count) == uint32(s.Index)
+}
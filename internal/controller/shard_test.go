@@ -0,0 +1,48 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestShard(t *testing.T) {
+	const count = 3
+
+	for i := range 100 {
+		namespace := fmt.Sprintf("namespace-%d", i)
+
+		owners := 0
+		for index := range count {
+			if (Shard{Index: index, Count: count}).Contains(namespace) {
+				owners++
+			}
+		}
+		if owners != 1 {
+			t.Errorf("Namespace %s is assigned to %d shards", namespace, owners)
+		}
+
+		if !(Shard{}).Contains(namespace) {
+			t.Errorf("Zero shard should contain namespace %s", namespace)
+		}
+	}
+
+	if err := (Shard{Index: 3, Count: 3}).Validate(); err == nil {
+		t.Errorf("Out-of-range index should be invalid")
+	}
+}
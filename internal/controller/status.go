@@ -0,0 +1,105 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// provisioningStatus is the status of image pull secret provisioning recorded on a ServiceAccount, so that users can
+// debug it by `kubectl get serviceaccount -o yaml` instead of hunting for events.
+type provisioningStatus struct {
+	Provider          string `json:"provider"`
+	Principal         string `json:"principal"`
+	Secret            string `json:"secret,omitempty"`
+	LastProvisionedAt string `json:"lastProvisionedAt,omitempty"`
+	ExpiresAt         string `json:"expiresAt,omitempty"`
+	LastError         string `json:"lastError,omitempty"`
+	LastErrorAt       string `json:"lastErrorAt,omitempty"`
+}
+
+// buildProvisioningStatus returns the status annotation of a ServiceAccount updated with the image pull secret in use
+// and the error of the last provisioning. secret is nil if it is unknown, e.g. on a failure to provision one, in which
+// case the previous one is kept. The last error is kept until the next error. It returns an empty string if the
+// ServiceAccount does not have configuration for image pull secret provisioning.
+func buildProvisioningStatus(sa *corev1.ServiceAccount, secret *corev1.Secret, provErr error, now time.Time) string {
+	if !hasConfig(sa) {
+		return ""
+	}
+
+	// Start from the previous status, ignoring it if it is broken.
+	status := provisioningStatus{}
+	if str, ok := sa.Annotations[annotationKeyStatus]; ok {
+		_ = json.Unmarshal([]byte(str), &status)
+	}
+	status.Provider = providerName(sa)
+	status.Principal = principalName(sa)
+
+	if secret != nil {
+		status.Secret = secret.GetName()
+		status.LastProvisionedAt = ""
+		if issuedAt := secretIssuedAt(secret); !issuedAt.IsZero() {
+			status.LastProvisionedAt = issuedAt.UTC().Format(time.RFC3339)
+		}
+		status.ExpiresAt = ""
+		if expiresAt, err := secretExpiresAt(secret); err == nil {
+			status.ExpiresAt = expiresAt.UTC().Format(time.RFC3339)
+		}
+	}
+	if provErr != nil {
+		status.LastError = provErr.Error()
+		status.LastErrorAt = now.UTC().Format(time.RFC3339)
+	}
+
+	str, _ := json.Marshal(status)
+	return string(str)
+}
+
+// recordProvisioningStatus updates the status annotation of a ServiceAccount. Failures to update it are only logged
+// not to block provisioning for the sake of its status.
+func (r *serviceAccountReconciler) recordProvisioningStatus(
+	ctx context.Context, sa *corev1.ServiceAccount, secret *corev1.Secret, provErr error,
+) {
+	if r.dryRun {
+		return
+	}
+
+	status := buildProvisioningStatus(sa, secret, provErr, time.Now())
+	if current, ok := sa.Annotations[annotationKeyStatus]; current == status && (ok || status == "") {
+		return
+	}
+
+	orig := sa.DeepCopy()
+	if status == "" {
+		delete(sa.Annotations, annotationKeyStatus)
+	} else {
+		if sa.Annotations == nil {
+			sa.Annotations = map[string]string{}
+		}
+		sa.Annotations[annotationKeyStatus] = status
+	}
+	if err := r.Patch(ctx, sa, client.MergeFrom(orig), client.FieldOwner(fieldManager)); err != nil {
+		log.FromContext(ctx).Error(fmt.Errorf("failed to patch a ServiceAccount: %w", err), "failed to record status")
+	}
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestBuildProvisioningStatus(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	config := map[string]string{
+		annotationKeyRegistry:   "asia-northeast1-docker.pkg.dev",
+		annotationKeyAudience:   "audience",
+		annotationKeyGoogleWIDP: "projects/0/locations/global/workloadIdentityPools/pool/providers/provider",
+		annotationKeyGoogleSA:   "sa@project.iam.gserviceaccount.com",
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "imagepullsecret-0",
+			Annotations: map[string]string{
+				annotationKeyIssuedAt:  "2024-01-01T11:00:00Z",
+				annotationKeyExpiresAt: "2024-01-01T12:00:00Z",
+			},
+		},
+	}
+	provisioned := `{"provider":"Google","principal":"sa@project.iam.gserviceaccount.com","secret":"imagepullsecret-0",` +
+		`"lastProvisionedAt":"2024-01-01T11:00:00Z","expiresAt":"2024-01-01T12:00:00Z"}`
+	failed := `{"provider":"Google","principal":"sa@project.iam.gserviceaccount.com","secret":"imagepullsecret-0",` +
+		`"lastProvisionedAt":"2024-01-01T11:00:00Z","expiresAt":"2024-01-01T12:00:00Z",` +
+		`"lastError":"denied","lastErrorAt":"2024-01-01T12:00:00Z"}`
+
+	for _, tt := range []struct {
+		name     string
+		config   map[string]string
+		status   string
+		secret   *corev1.Secret
+		err      error
+		expected string
+	}{
+		{
+			name:     "Provisioned",
+			config:   config,
+			secret:   secret,
+			expected: provisioned,
+		},
+		{
+			name:     "Failed after provisioned",
+			config:   config,
+			status:   provisioned,
+			err:      errors.New("denied"),
+			expected: failed,
+		},
+		{
+			name:     "Provisioned after failed",
+			config:   config,
+			status:   failed,
+			secret:   secret,
+			expected: failed,
+		},
+		{
+			name:     "Broken status",
+			config:   config,
+			status:   "{",
+			secret:   secret,
+			expected: provisioned,
+		},
+		{
+			name:   "No configuration",
+			status: provisioned,
+			secret: secret,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			sa := &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{},
+				},
+			}
+			for key, value := range tt.config {
+				sa.Annotations[key] = value
+			}
+			if tt.status != "" {
+				sa.Annotations[annotationKeyStatus] = tt.status
+			}
+
+			actual := buildProvisioningStatus(sa, tt.secret, tt.err, now)
+			if diff := cmp.Diff(tt.expected, actual); diff != "" {
+				t.Errorf("Status mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
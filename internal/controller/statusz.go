@@ -0,0 +1,86 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"cmp"
+	"encoding/json"
+	"net/http"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// statuszEntry is the status of image pull secret provisioning for a ServiceAccount served by the statusz endpoint.
+type statuszEntry struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Registry  string `json:"registry"`
+	Suspended bool   `json:"suspended,omitempty"`
+	provisioningStatus
+}
+
+// statuszHandler serves a read-only JSON listing all ServiceAccounts configured for image pull secret provisioning in
+// the shard with their image pull secrets, principals, expiration times and last errors, for operators to script health
+// checks without parsing events.
+func (r *serviceAccountReconciler) statuszHandler(reader client.Reader) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		sas := &corev1.ServiceAccountList{}
+		if err := reader.List(req.Context(), sas); err != nil {
+			log.FromContext(req.Context()).Error(err, "failed to list ServiceAccounts")
+			http.Error(w, "Failed to list ServiceAccounts", http.StatusInternalServerError)
+			return
+		}
+
+		entries := []statuszEntry{}
+		for i := range sas.Items {
+			sa := &sas.Items[i]
+			if !hasConfig(sa) || !r.shard.Contains(sa.GetNamespace()) {
+				continue
+			}
+
+			entry := statuszEntry{
+				Namespace: sa.GetNamespace(),
+				Name:      sa.GetName(),
+				Registry:  annotation(sa, annotationKeyRegistry),
+				Suspended: suspended(sa),
+			}
+			// The status is recorded by the controller, and missing until it reconciles the ServiceAccount.
+			if str, ok := sa.Annotations[annotationKeyStatus]; ok {
+				_ = json.Unmarshal([]byte(str), &entry.provisioningStatus)
+			}
+			entry.Provider = providerName(sa)
+			entry.Principal = principalName(sa)
+			entries = append(entries, entry)
+		}
+		slices.SortFunc(entries, func(a, b statuszEntry) int {
+			return cmp.Or(cmp.Compare(a.Namespace, b.Namespace), cmp.Compare(a.Name, b.Name))
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			ServiceAccounts []statuszEntry `json:"serviceAccounts"`
+		}{entries})
+	})
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// serviceAccountLister is a client.Reader listing fixed ServiceAccounts.
+type serviceAccountLister struct {
+	client.Reader
+	items []corev1.ServiceAccount
+}
+
+func (l *serviceAccountLister) List(_ context.Context, list client.ObjectList, _ ...client.ListOption) error {
+	list.(*corev1.ServiceAccountList).Items = l.items
+	return nil
+}
+
+func TestStatuszHandler(t *testing.T) {
+	t.Parallel()
+
+	config := map[string]string{
+		annotationKeyRegistry:   "asia-northeast1-docker.pkg.dev",
+		annotationKeyAudience:   "audience",
+		annotationKeyGoogleWIDP: "projects/0/locations/global/workloadIdentityPools/pool/providers/provider",
+		annotationKeyGoogleSA:   "sa@project.iam.gserviceaccount.com",
+	}
+	withStatus := map[string]string{
+		annotationKeyStatus: `{"secret":"imagepullsecret-1","expiresAt":"2024-01-01T12:00:00Z","lastError":"denied"}`,
+	}
+	for k, v := range config {
+		withStatus[k] = v
+	}
+	r := &serviceAccountReconciler{}
+	reader := &serviceAccountLister{items: []corev1.ServiceAccount{
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "namespace-1", Name: "serviceaccount-1", Annotations: withStatus}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "namespace-0", Name: "serviceaccount-0", Annotations: config}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "namespace-0", Name: "unconfigured"}},
+	}}
+
+	rec := httptest.NewRecorder()
+	r.statuszHandler(reader).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/statusz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status code: %d", rec.Code)
+	}
+	expected := `{"serviceAccounts":[` +
+		`{"namespace":"namespace-0","name":"serviceaccount-0","registry":"asia-northeast1-docker.pkg.dev",` +
+		`"provider":"Google","principal":"sa@project.iam.gserviceaccount.com"},` +
+		`{"namespace":"namespace-1","name":"serviceaccount-1","registry":"asia-northeast1-docker.pkg.dev",` +
+		`"provider":"Google","principal":"sa@project.iam.gserviceaccount.com","secret":"imagepullsecret-1",` +
+		`"expiresAt":"2024-01-01T12:00:00Z","lastError":"denied"}]}` + "\n"
+	if actual := rec.Body.String(); actual != expected {
+		t.Errorf("Unexpected response\n\texpected: %s\n\tactual: %s", expected, actual)
+	}
+
+	rec = httptest.NewRecorder()
+	r.statuszHandler(reader).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/statusz", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Unexpected status code: %d", rec.Code)
+	}
+}
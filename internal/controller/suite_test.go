@@ -18,12 +18,9 @@ package controller
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/hex"
 	"fmt"
 	"path/filepath"
 	"runtime"
-	"strings"
 	"testing"
 	"time"
 
@@ -41,6 +38,11 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	imagepullsecretsv1alpha1 "github.com/pfnet/image-pull-secrets-provisioner/api/v1alpha1"
+	awscredentials "github.com/pfnet/image-pull-secrets-provisioner/pkg/credentials/aws"
+	"github.com/pfnet/image-pull-secrets-provisioner/pkg/credentials/credentialstest"
+	googlecredentials "github.com/pfnet/image-pull-secrets-provisioner/pkg/credentials/google"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -52,8 +54,15 @@ var (
 	k8sClient client.Client
 	testEnv   *envtest.Environment
 
+	// Manager running the controllers, whose client reads from the cache with the indexes of the controllers.
+	k8sManager ctrl.Manager
+
 	ctx    context.Context
 	cancel context.CancelFunc
+
+	// Fakes of the cloud APIs called by the providers of the reconciler.
+	fakeAWS    *credentialstest.FakeAWS
+	fakeGoogle *credentialstest.FakeGoogle
 )
 
 func TestControllers(t *testing.T) {
@@ -69,8 +78,8 @@ var _ = BeforeSuite(func() {
 
 	By("bootstrapping test environment")
 	testEnv = &envtest.Environment{
-		// CRDDirectoryPaths: []string{filepath.Join("..", "..", "config", "crd", "bases")},
-		// ErrorIfCRDPathMissing: true,
+		CRDDirectoryPaths:     []string{filepath.Join("..", "..", "config", "crd", "bases")},
+		ErrorIfCRDPathMissing: true,
 
 		// The BinaryAssetsDirectory is only required if you want to run the tests directly
 		// without call the makefile target test. If not informed it will look for the
@@ -87,16 +96,22 @@ var _ = BeforeSuite(func() {
 	Expect(err).NotTo(HaveOccurred())
 	Expect(cfg).NotTo(BeNil())
 
+	err = imagepullsecretsv1alpha1.AddToScheme(scheme.Scheme)
+	Expect(err).NotTo(HaveOccurred())
+
 	//+kubebuilder:scaffold:scheme
 
 	k8sClient, err = client.New(cfg, client.Options{Scheme: scheme.Scheme})
 	Expect(err).NotTo(HaveOccurred())
 	Expect(k8sClient).NotTo(BeNil())
 
-	k8sManager, err := ctrl.NewManager(cfg, ctrl.Options{
+	k8sManager, err = ctrl.NewManager(cfg, ctrl.Options{
 		Scheme: scheme.Scheme,
 		Cache: cache.Options{
 			ByObject: map[client.Object]cache.ByObject{
+				&corev1.Secret{}: {
+					Label: ImagePullSecretSelector(),
+				},
 				&corev1.Pod{}: {
 					Field: fields.OneTermEqualSelector("status.phase", string(corev1.PodPending)),
 					Transform: func(obj any) (any, error) {
@@ -113,13 +128,37 @@ var _ = BeforeSuite(func() {
 	})
 	Expect(err).NotTo(HaveOccurred())
 
+	// Exercise the providers with fakes of the cloud APIs. Generated access tokens have validity of tokenValidity.
+	fakeAWS = credentialstest.NewFakeAWS(GinkgoT())
+	fakeAWS.SetValidity(tokenValidity)
+	fakeGoogle = credentialstest.NewFakeGoogle(GinkgoT())
+	fakeGoogle.SetValidity(tokenValidity)
+	googleClient, err := googlecredentials.NewClient(
+		ctx,
+		googlecredentials.WithSTSEndpoint(fakeGoogle.URL()),
+		googlecredentials.WithIAMCredentialsEndpoint(fakeGoogle.URL()),
+	)
+	Expect(err).NotTo(HaveOccurred())
+
 	err = (&serviceAccountReconciler{
-		Client:                k8sManager.GetClient(),
-		Scheme:                k8sManager.GetScheme(),
-		eventRecorder:         k8sManager.GetEventRecorderFor("image-pull-secrets-provisioner"),
-		aws:                   &awsMock{},
-		google:                &gMock{},
-		expirationGracePeriod: 0, // To test skipping refreshing Secrets.
+		Client:        k8sManager.GetClient(),
+		apiReader:     k8sManager.GetAPIReader(),
+		Scheme:        k8sManager.GetScheme(),
+		eventRecorder: k8sManager.GetEventRecorderFor("image-pull-secrets-provisioner"),
+		aws: &awsImpl{
+			Client: awscredentials.NewClient(
+				awscredentials.WithSTSEndpoint(fakeAWS.URL()), awscredentials.WithECREndpoint(fakeAWS.URL()),
+			),
+		},
+		google:              &goog{client: googleClient},
+		refresh:             RefreshPolicy{ExpirationGracePeriod: 0}, // To test skipping refreshing Secrets.
+		orphanSweepInterval: time.Second,
+		backoff:             newFailureBackoff(100*time.Millisecond, time.Second, 0),
+		providerTimeout:     time.Second,
+		awsBreaker:          newCircuitBreaker("AWS"),
+		googleBreaker:       newCircuitBreaker("Google"),
+		awsLimiter:          newProviderLimiter(0, 0),
+		googleLimiter:       newProviderLimiter(0, 0),
 	}).SetupWithManager(k8sManager)
 	Expect(err).NotTo(HaveOccurred())
 
@@ -128,6 +167,8 @@ var _ = BeforeSuite(func() {
 		Scheme:        k8sManager.GetScheme(),
 		eventRecorder: k8sManager.GetEventRecorderFor("image-pull-secrets-provisioner"),
 		requeueAfter:  100 * time.Millisecond,
+		// Pods created in tests are bare.
+		policy: EvictionPolicy{EvictBarePods: true},
 	}).SetupWithManager(k8sManager)
 	Expect(err).NotTo(HaveOccurred())
 
@@ -146,59 +187,3 @@ var _ = AfterSuite(func() {
 })
 
 const tokenValidity = 5 * time.Second
-
-// awsMock is a mock implementation of aws.
-// Generated access tokens have validity of tokenValidity.
-type awsMock struct {
-}
-
-func (a *awsMock) GenerateAccessToken(
-	_ context.Context,
-	k8sServiceAccountToken string,
-	region string,
-	awsRoleARN string,
-) (username string, password string, expiresAt time.Time, _ error) {
-	token, err := randomString()
-	if err != nil {
-		return "", "", time.Time{}, err
-	}
-
-	return "AWS", token, time.Now().Add(tokenValidity), nil
-}
-
-func (a *awsMock) ExtractRegion(registry string) (string, error) {
-	parts := strings.SplitN(registry, ".", 5)
-	if len(parts) != 5 {
-		return "", fmt.Errorf("unexpected registry format: %s", registry)
-	}
-
-	return parts[3], nil
-}
-
-// gMock is a mock implementation of google.
-// Generated access tokens have validity of tokenValidity.
-type gMock struct {
-}
-
-func (g *gMock) GenerateAccessToken(
-	_ context.Context,
-	k8sServiceAccountToken string,
-	workloadIdentityProvider string,
-	googleServiceAccountEmail string,
-) (token string, expiresAt time.Time, _ error) {
-	token, err := randomString()
-	if err != nil {
-		return "", time.Time{}, err
-	}
-
-	return token, time.Now().Add(tokenValidity), nil
-}
-
-func randomString() (string, error) {
-	bytes := make([]byte, 8)
-	if _, err := rand.Read(bytes); err != nil {
-		return "", err
-	}
-
-	return hex.EncodeToString(bytes), nil
-}
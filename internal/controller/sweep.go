@@ -0,0 +1,109 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// sweepOrphanedImagePullSecrets deletes image pull secrets whose ServiceAccount no longer exists or no longer has
+// configuration for image pull secret provisioning.
+// Such Secrets are usually cleaned up by the reconciliation, but can be left behind when the controller misses events,
+// e.g. while it is down.
+func (r *serviceAccountReconciler) sweepOrphanedImagePullSecrets(ctx context.Context) error {
+	logger := log.FromContext(ctx)
+
+	secrets := &corev1.SecretList{}
+	if err := r.List(ctx, secrets, client.HasLabels{labelKeyServiceAccount}); err != nil {
+		return fmt.Errorf("failed to list image pull secrets: %w", err)
+	}
+
+	// Group the Secrets by ServiceAccount not to fetch the same ServiceAccount many times.
+	saKeys := map[client.ObjectKey][]*corev1.Secret{}
+	for _, secret := range secrets.Items {
+		key := serviceAccountOf(&secret)
+		if !r.shard.Contains(key.Namespace) {
+			continue
+		}
+		saKeys[key] = append(saKeys[key], &secret)
+	}
+
+	var errs []error
+	for key, secrets := range saKeys {
+		logger := logger.WithValues("serviceAccount", key)
+
+		sa := &corev1.ServiceAccount{}
+		if err := r.Get(ctx, key, sa); err != nil {
+			if !apierrors.IsNotFound(err) {
+				errs = append(errs, fmt.Errorf("failed to get a ServiceAccount: %w", err))
+				continue
+			}
+
+			// ServiceAccount no longer exists. There is nothing to detach the Secrets from.
+			for _, secret := range secrets {
+				if r.dryRun {
+					logger.Info("Dry run: would delete an orphaned image pull secret.", "secret", secret.GetName())
+					continue
+				}
+				if err := r.Delete(ctx, secret); client.IgnoreNotFound(err) != nil {
+					errs = append(errs, fmt.Errorf("failed to delete an image pull secret: %w", err))
+					continue
+				}
+				secretOperations.WithLabelValues("", secret.GetNamespace(), secretOperationDeleted).Inc()
+				logger.Info("Deleted an orphaned image pull secret.", "secret", secret.GetName())
+			}
+			continue
+		}
+
+		if suspended(sa) || ignored(sa, r.ignoredServiceAccounts) {
+			// Leave the Secrets to users while provisioning is suspended or the ServiceAccount is ignored.
+			continue
+		}
+		if hasConfig(sa) {
+			// Outdated image pull secrets of configured ServiceAccounts are cleaned up by the reconciliation.
+			continue
+		}
+
+		if r.dryRun {
+			for _, secret := range secrets {
+				logger.Info("Dry run: would delete an orphaned image pull secret.", "secret", secret.GetName())
+			}
+			continue
+		}
+
+		decommissioned, err := r.cleanupImagePullSecrets(ctx, logger, sa, "")
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if len(decommissioned) > 0 {
+			r.eventRecorder.Eventf(
+				sa, corev1.EventTypeNormal, reasonSucceededDecommissioning,
+				"Decommissioned outdated image pull secrets: %v", decommissioned,
+			)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"google.golang.org/api/googleapi"
+)
+
+// throttled returns true if an error from a container registry provider is a throttling error, i.e. the caller has
+// exceeded its quota. It also returns the delay suggested by the provider, or zero if there is no suggestion.
+func throttled(err error, now time.Time) (retryAfter time.Duration, _ bool) {
+	// Google.
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		if gerr.Code != http.StatusTooManyRequests {
+			return 0, false
+		}
+		return parseRetryAfter(gerr.Header.Get("Retry-After"), now), true
+	}
+
+	// AWS.
+	isThrottled := false
+	var apiErr interface{ ErrorCode() string }
+	if errors.As(err, &apiErr) {
+		_, isThrottled = retry.DefaultThrottleErrorCodes[apiErr.ErrorCode()]
+	}
+	// Not using *smithyhttp.ResponseError directly because AWS SDK wraps it by embedding.
+	var respErr interface{ HTTPResponse() *smithyhttp.Response }
+	var header http.Header
+	if errors.As(err, &respErr) {
+		if resp := respErr.HTTPResponse(); resp != nil && resp.Response != nil {
+			isThrottled = isThrottled || resp.StatusCode == http.StatusTooManyRequests
+			header = resp.Header
+		}
+	}
+	if !isThrottled {
+		return 0, false
+	}
+
+	return parseRetryAfter(header.Get("Retry-After"), now), true
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either a number of seconds or an HTTP date.
+// It returns zero if the value is missing or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0)
+	}
+
+	return 0
+}
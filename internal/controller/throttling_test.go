@@ -0,0 +1,102 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"google.golang.org/api/googleapi"
+)
+
+func TestThrottled(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	awsErr := func(code string, status int, header http.Header) error {
+		return &awshttp.ResponseError{
+			ResponseError: &smithyhttp.ResponseError{
+				Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status, Header: header}},
+				Err:      &smithy.GenericAPIError{Code: code},
+			},
+		}
+	}
+
+	for _, tt := range []struct {
+		name               string
+		err                error
+		expectedThrottled  bool
+		expectedRetryAfter time.Duration
+	}{
+		{
+			name: "Google throttling",
+			err: fmt.Errorf("wrapped: %w", &googleapi.Error{
+				Code:   http.StatusTooManyRequests,
+				Header: http.Header{"Retry-After": []string{"30"}},
+			}),
+			expectedThrottled:  true,
+			expectedRetryAfter: 30 * time.Second,
+		},
+		{
+			name:              "Google throttling without hint",
+			err:               &googleapi.Error{Code: http.StatusTooManyRequests},
+			expectedThrottled: true,
+		},
+		{
+			name: "Google permission denied",
+			err:  &googleapi.Error{Code: http.StatusForbidden},
+		},
+		{
+			name:              "AWS throttling",
+			err:               fmt.Errorf("wrapped: %w", awsErr("ThrottlingException", http.StatusBadRequest, http.Header{})),
+			expectedThrottled: true,
+		},
+		{
+			name: "AWS too many requests",
+			err: awsErr("", http.StatusTooManyRequests, http.Header{
+				"Retry-After": []string{now.Add(time.Minute).Format(http.TimeFormat)},
+			}),
+			expectedThrottled:  true,
+			expectedRetryAfter: time.Minute,
+		},
+		{
+			name: "AWS access denied",
+			err:  awsErr("AccessDenied", http.StatusForbidden, http.Header{}),
+		},
+		{
+			name: "Other",
+			err:  errors.New("invalid registry"),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			retryAfter, throttled := throttled(tt.err, now)
+			if throttled != tt.expectedThrottled {
+				t.Errorf("Unexpected throttled\n\texpected: %t\n\tactual: %t", tt.expectedThrottled, throttled)
+			}
+			if retryAfter != tt.expectedRetryAfter {
+				t.Errorf("Unexpected retry after\n\texpected: %s\n\tactual: %s", tt.expectedRetryAfter, retryAfter)
+			}
+		})
+	}
+}
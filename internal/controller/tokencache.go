@@ -0,0 +1,160 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// tokenCache shares access tokens for container registries among ServiceAccounts federated to the same principal,
+// i.e. the same AWS IAM role or Google service account, to avoid issuing identical tokens for each of them.
+type tokenCache struct {
+	mu     sync.Mutex
+	tokens map[tokenCacheKey]cachedToken
+}
+
+type tokenCacheKey struct {
+	provider  string
+	principal string
+	// Audiences and the workload identity provider are part of the federation, so that ServiceAccounts whose
+	// federation would be rejected by the trust policy never share a token issued for another one.
+	audience                 string
+	workloadIdentityProvider string
+	registry                 string
+	// Value of the refresh-requested-at annotation so that requesting a refresh always issues a new token.
+	refreshRequestedAt string
+}
+
+type cachedToken struct {
+	username  string
+	password  string
+	issuedAt  time.Time
+	expiresAt time.Time
+}
+
+func newTokenCache() *tokenCache {
+	return &tokenCache{
+		tokens: map[tokenCacheKey]cachedToken{},
+	}
+}
+
+func (c *tokenCache) get(key tokenCacheKey) (cachedToken, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	token, ok := c.tokens[key]
+	return token, ok
+}
+
+func (c *tokenCache) put(key tokenCacheKey, token cachedToken) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Drop expired tokens not to grow the cache indefinitely.
+	now := time.Now()
+	for k, t := range c.tokens {
+		if !now.Before(t.expiresAt) {
+			delete(c.tokens, k)
+		}
+	}
+
+	c.tokens[key] = token
+}
+
+// sharedTokenCacheKey returns the key to share an access token for a ServiceAccount.
+// It returns false if the ServiceAccount opts out of sharing.
+func sharedTokenCacheKey(sa *corev1.ServiceAccount) (tokenCacheKey, bool) {
+	if annotation(sa, annotationKeyShareAccessToken) == "false" {
+		return tokenCacheKey{}, false
+	}
+
+	key := tokenCacheKey{
+		audience:           strings.Join(audiences(sa), ","),
+		registry:           annotation(sa, annotationKeyRegistry),
+		refreshRequestedAt: annotation(sa, annotationKeyRefreshRequestedAt),
+	}
+	switch {
+	case annotation(sa, annotationKeyAWSRoleARN) != "":
+		key.provider = providerAWS
+		key.principal = annotation(sa, annotationKeyAWSRoleARN)
+	case annotation(sa, annotationKeyGoogleSA) != "":
+		key.provider = providerGoogle
+		key.principal = annotation(sa, annotationKeyGoogleSA)
+		key.workloadIdentityProvider = annotation(sa, annotationKeyGoogleWIDP)
+	default:
+		return tokenCacheKey{}, false
+	}
+
+	return key, true
+}
+
+// accessToken returns an access token for the configured container registry of a ServiceAccount.
+// If sharing access tokens is enabled, it reuses a token issued for another ServiceAccount federated to the same
+// principal as long as the token is in the first half of its lifetime until the refresh.
+func (r *serviceAccountReconciler) accessToken(
+	ctx context.Context, logger logr.Logger, sa *corev1.ServiceAccount, interval time.Duration,
+) (username string, password string, issuedAt time.Time, expiresAt time.Time, _ error) {
+	key, shared := sharedTokenCacheKey(sa)
+	shared = shared && r.tokenCache != nil
+
+	if shared {
+		if token, ok := r.tokenCache.get(key); ok {
+			secret := types.NamespacedName{Namespace: secretNamespace(sa), Name: secretName(sa)}
+			refreshAt := r.refreshTime(secret, token.issuedAt, token.expiresAt, interval)
+			if time.Now().Before(token.issuedAt.Add(refreshAt.Sub(token.issuedAt) / 2)) {
+				if err := r.audit(sa, token.issuedAt, token.expiresAt, true); err != nil {
+					return "", "", time.Time{}, time.Time{}, err
+				}
+				logger.Info("Reusing an access token issued for the same principal.", "expiresAt", token.expiresAt)
+				return token.username, token.password, token.issuedAt, token.expiresAt, nil
+			}
+		}
+	}
+
+	// Generate an access token for the configured image registry from the ServiceAccount's token.
+	issuedAt = time.Now()
+	username, password, expiresAt, err := r.generateAccessToken(ctx, sa, audiences(sa))
+	if err != nil {
+		return "", "", time.Time{}, time.Time{}, fmt.Errorf(
+			"failed to generate an access token for the configured image registry: %w", err,
+		)
+	}
+	// Not handing out the token unless its issuance is recorded.
+	if err := r.audit(sa, issuedAt, expiresAt, false); err != nil {
+		return "", "", time.Time{}, time.Time{}, err
+	}
+	logger.Info("Generated an access token for the configured image registry.", "expiresAt", expiresAt)
+
+	if shared {
+		r.tokenCache.put(key, cachedToken{
+			username:  username,
+			password:  password,
+			issuedAt:  issuedAt,
+			expiresAt: expiresAt,
+		})
+	}
+
+	return username, password, issuedAt, expiresAt, nil
+}
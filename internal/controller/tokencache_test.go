@@ -0,0 +1,102 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSharedTokenCacheKey(t *testing.T) {
+	newSA := func(namespace string, annotations map[string]string) *corev1.ServiceAccount {
+		annotations["imagepullsecrets.preferred.jp/registry"] = "999999999999.dkr.ecr.ap-northeast-1.amazonaws.com"
+		return &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Annotations: annotations}}
+	}
+	role := "arn:aws:iam::999999999999:role/ROLE-NAME"
+
+	key0, ok0 := sharedTokenCacheKey(newSA("namespace-0", map[string]string{
+		"imagepullsecrets.preferred.jp/aws-role-arn": role,
+	}))
+	key1, ok1 := sharedTokenCacheKey(newSA("namespace-1", map[string]string{
+		"imagepullsecrets.preferred.jp/aws-role-arn": role,
+	}))
+	if !ok0 || !ok1 || key0 != key1 {
+		t.Errorf("ServiceAccounts federated to the same role should share a key\n\tkey0: %+v\n\tkey1: %+v", key0, key1)
+	}
+
+	key3, _ := sharedTokenCacheKey(newSA("namespace-1", map[string]string{
+		"imagepullsecrets.preferred.jp/aws-role-arn": role,
+		"imagepullsecrets.preferred.jp/audience":     "other.example.com",
+	}))
+	if key3 == key0 {
+		t.Errorf("ServiceAccounts with different audiences should not share a key")
+	}
+
+	widp := "projects/999999999999/locations/global/workloadIdentityPools/POOL/providers/PROVIDER"
+	key4, _ := sharedTokenCacheKey(newSA("namespace-0", map[string]string{
+		"imagepullsecrets.preferred.jp/googlecloud-service-account-email":      "sa@project.iam.gserviceaccount.com",
+		"imagepullsecrets.preferred.jp/googlecloud-workload-identity-provider": widp,
+		"imagepullsecrets.preferred.jp/audience":                               "shared.example.com",
+	}))
+	key5, _ := sharedTokenCacheKey(newSA("namespace-1", map[string]string{
+		"imagepullsecrets.preferred.jp/googlecloud-service-account-email":      "sa@project.iam.gserviceaccount.com",
+		"imagepullsecrets.preferred.jp/googlecloud-workload-identity-provider": widp + "-other",
+		"imagepullsecrets.preferred.jp/audience":                               "shared.example.com",
+	}))
+	if key4 == key5 {
+		t.Errorf("ServiceAccounts with different workload identity providers should not share a key")
+	}
+
+	key2, _ := sharedTokenCacheKey(newSA("namespace-0", map[string]string{
+		"imagepullsecrets.preferred.jp/aws-role-arn":         role,
+		"imagepullsecrets.preferred.jp/refresh-requested-at": "2024-01-01T00:00:00Z",
+	}))
+	if key2 == key0 {
+		t.Errorf("Requesting a refresh should not share a key")
+	}
+
+	if _, ok := sharedTokenCacheKey(newSA("namespace-0", map[string]string{
+		"imagepullsecrets.preferred.jp/aws-role-arn":       role,
+		"imagepullsecrets.preferred.jp/share-access-token": "false",
+	})); ok {
+		t.Errorf("ServiceAccount opting out should not share a key")
+	}
+}
+
+func TestTokenCache(t *testing.T) {
+	c := newTokenCache()
+	now := time.Now()
+	expired := tokenCacheKey{provider: "AWS", principal: "expired"}
+	valid := tokenCacheKey{provider: "AWS", principal: "valid"}
+
+	c.put(expired, cachedToken{issuedAt: now.Add(-2 * time.Hour), expiresAt: now.Add(-time.Hour)})
+	c.put(valid, cachedToken{password: "0xc0bebeef", issuedAt: now, expiresAt: now.Add(time.Hour)})
+
+	if token, ok := c.get(valid); !ok || token.password != "0xc0bebeef" {
+		t.Errorf("Unexpected cached token: %+v", token)
+	}
+	if _, ok := c.get(expired); ok {
+		t.Errorf("Expired token should be dropped")
+	}
+
+	if _, ok := c.get(tokenCacheKey{provider: "AWS", principal: "valid", audience: "other.example.com"}); ok {
+		t.Errorf("Token for another audience should not be hit")
+	}
+}
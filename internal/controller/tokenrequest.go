@@ -0,0 +1,81 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Results of TokenRequests for metrics.
+const (
+	tokenRequestSucceeded = "success"
+	tokenRequestFailed    = "failure"
+	tokenRequestSkipped   = "skipped"
+)
+
+// createServiceAccountToken creates a token of a ServiceAccount for audiences, recording its metrics.
+func (r *serviceAccountReconciler) createServiceAccountToken(
+	ctx context.Context, sa *corev1.ServiceAccount, audiences []string,
+) (string, error) {
+	logger := log.FromContext(ctx)
+	audience := strings.Join(audiences, ",")
+
+	tokenReq := &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			Audiences: audiences,
+		},
+	}
+	start := time.Now()
+	err := r.SubResource("token").Create(ctx, sa, tokenReq)
+	duration := time.Since(start)
+	tokenRequestDuration.WithLabelValues(audience).Observe(duration.Seconds())
+	if err != nil {
+		tokenRequests.WithLabelValues(audience, tokenRequestFailed).Inc()
+		return "", fmt.Errorf("failed to create a ServiceAccount token: %w", err)
+	}
+	tokenRequests.WithLabelValues(audience, tokenRequestSucceeded).Inc()
+	logger.V(1).Info("Created a ServiceAccount token.", "audiences", audiences, "duration", duration)
+
+	return tokenReq.Status.Token, nil
+}
+
+// preflightTokenExchange returns an error if exchanging a token of a ServiceAccount would fail before calling the
+// container registry provider, so that the token is not created in vain.
+func (r *serviceAccountReconciler) preflightTokenExchange(sa *corev1.ServiceAccount) error {
+	switch providerName(sa) {
+	case providerAWS:
+		if _, err := awsRegion(sa, r.aws); err != nil {
+			return err
+		}
+		return r.awsBreaker.check()
+	case providerGoogle:
+		if annotation(sa, annotationKeyGoogleSA) == "" {
+			return errors.New("ServiceAccount is missing configuration for image pull secret provisioning")
+		}
+		return r.googleBreaker.check()
+	default:
+		return errors.New("ServiceAccount is missing configuration for image pull secret provisioning")
+	}
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPreflightTokenExchange(t *testing.T) {
+	aws := map[string]string{
+		annotationKeyRegistry:   "123456789012.dkr.ecr.us-east-1.amazonaws.com",
+		annotationKeyAWSRoleARN: "arn:aws:iam::123456789012:role/test",
+	}
+	google := map[string]string{
+		annotationKeyRegistry:   "asia-northeast1-docker.pkg.dev",
+		annotationKeyGoogleWIDP: "projects/123/locations/global/workloadIdentityPools/test/providers/test",
+		annotationKeyGoogleSA:   "test@example.iam.gserviceaccount.com",
+	}
+	with := func(annotations map[string]string, key, value string) map[string]string {
+		merged := maps.Clone(annotations)
+		merged[key] = value
+		return merged
+	}
+
+	for _, tt := range []struct {
+		name        string
+		annotations map[string]string
+		openBreaker string
+		wantErr     bool
+	}{
+		{name: "AWS", annotations: aws},
+		{
+			name:        "AWS with unknown region",
+			annotations: with(aws, annotationKeyRegistry, "ecr-mirror.example.com"),
+			wantErr:     true,
+		},
+		{name: "AWS with open breaker", annotations: aws, openBreaker: providerAWS, wantErr: true},
+		{name: "AWS with open breaker of Google", annotations: aws, openBreaker: providerGoogle},
+		{name: "Google", annotations: google},
+		{name: "Google without service account", annotations: with(google, annotationKeyGoogleSA, ""), wantErr: true},
+		{name: "Google with open breaker", annotations: google, openBreaker: providerGoogle, wantErr: true},
+		{name: "No provider", annotations: map[string]string{annotationKeyRegistry: "example.com"}, wantErr: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := &serviceAccountReconciler{
+				aws:           &awsImpl{},
+				awsBreaker:    newCircuitBreaker(providerAWS),
+				googleBreaker: newCircuitBreaker(providerGoogle),
+			}
+			breakers := map[string]*circuitBreaker{providerAWS: r.awsBreaker, providerGoogle: r.googleBreaker}
+			if breaker := breakers[tt.openBreaker]; breaker != nil {
+				for range breaker.failureThreshold {
+					_ = breaker.do(context.Background(), func() error {
+						return &googleapi.Error{Code: http.StatusServiceUnavailable}
+					})
+				}
+			}
+
+			sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			err := r.preflightTokenExchange(sa)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Unexpected error\n\twantErr: %t\n\tactual: %v", tt.wantErr, err)
+			}
+			var openErr *circuitOpenError
+			if errors.As(err, &openErr) != (tt.openBreaker != "" && tt.wantErr) {
+				t.Errorf("Unexpected circuit open error: %v", err)
+			}
+		})
+	}
+}
+
+func TestReusableCredentials(t *testing.T) {
+	sa := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "test",
+			Annotations: map[string]string{
+				annotationKeyRegistry:   "123456789012.dkr.ecr.us-east-1.amazonaws.com",
+				annotationKeyAWSRoleARN: "arn:aws:iam::123456789012:role/test",
+			},
+		},
+	}
+	now := time.Now()
+
+	for _, tt := range []struct {
+		name     string
+		missing  bool
+		modify   func(secret *corev1.Secret)
+		expected bool
+	}{
+		{name: "Valid", expected: true},
+		{name: "Missing", missing: true},
+		{
+			name:   "Configuration changed",
+			modify: func(secret *corev1.Secret) { secret.Annotations[annotationKeyConfigHash] = "outdated" },
+		},
+		{
+			name:   "Refresh requested",
+			modify: func(secret *corev1.Secret) { secret.Annotations[annotationKeyRefreshRequestedAt] = "2024-01-01" },
+		},
+		{
+			name:   "Modified externally",
+			modify: func(secret *corev1.Secret) { secret.Data[corev1.DockerConfigJsonKey] = []byte(`{"auths":{}}`) },
+		},
+		{
+			name: "About to expire",
+			modify: func(secret *corev1.Secret) {
+				secret.Annotations[annotationKeyExpiresAt] = now.Add(time.Minute).Format(time.RFC3339)
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := &serviceAccountReconciler{refresh: RefreshPolicy{ExpirationGracePeriod: 10 * time.Minute}}
+			current, err := buildImagePullSecret(
+				sa, secretName(sa), annotation(sa, annotationKeyRegistry), "AWS", "password",
+				now, now.Add(time.Hour), nil,
+			)
+			if err != nil {
+				t.Fatalf("Failed to build an image pull secret: %v", err)
+			}
+			if tt.modify != nil {
+				tt.modify(current)
+			}
+			if tt.missing {
+				current = nil
+			}
+
+			username, password, _, expiresAt, ok := r.reusableCredentials(sa, current, 0)
+			if ok != tt.expected {
+				t.Fatalf("Unexpected reusability\n\texpected: %t\n\tactual: %t", tt.expected, ok)
+			}
+			expectedExpiresAt := now.Add(time.Hour).Truncate(time.Second)
+			if ok && (username != "AWS" || password != "password" || !expiresAt.Equal(expectedExpiresAt)) {
+				t.Errorf("Unexpected credentials: %s, %s, %s", username, password, expiresAt)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// TransportOptions configures HTTP connections to the APIs of a container registry provider.
+type TransportOptions struct {
+	// CABundle is a path to a PEM file of CA certificates trusted in addition to the system ones, e.g. of a
+	// TLS-intercepting egress proxy. Empty trusts only the system ones.
+	CABundle string
+	// ProxyURL is the URL of an HTTP proxy to connect through, optionally with credentials in its user info for an
+	// authenticated proxy. Empty uses the proxy in the HTTPS_PROXY and NO_PROXY environment variables.
+	ProxyURL string
+}
+
+// configure applies the options to an HTTP transport.
+func (o TransportOptions) configure(t *http.Transport) error {
+	if o.CABundle != "" {
+		pool, err := loadCABundle(o.CABundle)
+		if err != nil {
+			return err
+		}
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		t.TLSClientConfig.RootCAs = pool
+	}
+
+	if o.ProxyURL != "" {
+		proxyURL, err := url.Parse(o.ProxyURL)
+		if err != nil {
+			return fmt.Errorf("failed to parse a proxy URL: %w", err)
+		}
+		if proxyURL.Scheme == "" || proxyURL.Host == "" {
+			return fmt.Errorf("proxy URL must have a scheme and a host: %s", proxyURL.Redacted())
+		}
+		t.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	return nil
+}
+
+// loadCABundle returns the system certificate pool with the certificates in a PEM file added.
+func loadCABundle(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read a CA bundle: %w", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in a CA bundle: %s", path)
+	}
+
+	return pool, nil
+}
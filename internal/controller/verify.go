@@ -0,0 +1,222 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Timeout of verifying credentials against a container registry.
+const verificationTimeout = 10 * time.Second
+
+// registryVerifier verifies credentials against container registries by the Docker Registry HTTP API V2, following
+// the token authentication of registries that require bearer tokens, e.g. Artifact Registry.
+type registryVerifier struct {
+	client *http.Client
+	// scheme is the URL scheme of registries, which is only changed in tests.
+	scheme string
+}
+
+func newRegistryVerifier() *registryVerifier {
+	return &registryVerifier{
+		client: &http.Client{Timeout: verificationTimeout},
+		scheme: "https",
+	}
+}
+
+// verifyImagePullSecret verifies that the registry of a ServiceAccount accepts newly generated credentials before they
+// are stored into an image pull secret, if the ServiceAccount opts in by the verify annotation.
+// The credentials are also checked to be allowed to pull from the repository in the verify-repository annotation.
+func (r *serviceAccountReconciler) verifyImagePullSecret(
+	ctx context.Context, sa *corev1.ServiceAccount, username string, password string,
+) error {
+	if annotation(sa, annotationKeyVerify) != "true" {
+		return nil
+	}
+
+	registry, repository := annotation(sa, annotationKeyRegistry), annotation(sa, annotationKeyVerifyRepository)
+	if err := r.verifier.verify(ctx, registry, repository, username, password); err != nil {
+		return &classifiedError{
+			class: errorClassVerificationFailed,
+			err:   fmt.Errorf("failed to verify credentials against registry %s: %w", registry, err),
+		}
+	}
+
+	return nil
+}
+
+// verify checks that a registry accepts the credentials, by listing tags of the repository if not empty, or by the
+// base endpoint otherwise.
+func (v *registryVerifier) verify(ctx context.Context, registry, repository, username, password string) error {
+	endpoint := v.scheme + "://" + registry + "/v2/"
+	scope := ""
+	if repository != "" {
+		endpoint += repository + "/tags/list"
+		scope = "repository:" + repository + ":pull"
+	}
+
+	// Registries accepting basic authentication, e.g. ECR, respond to the credentials directly.
+	resp, err := v.get(ctx, endpoint, func(req *http.Request) { req.SetBasicAuth(username, password) })
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	// Others challenge to get a bearer token from their token endpoint with the credentials.
+	challenge := resp.Header.Get("WWW-Authenticate")
+	if resp.StatusCode != http.StatusUnauthorized || !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return fmt.Errorf("unexpected response from %s: %s", endpoint, resp.Status)
+	}
+	token, err := v.bearerToken(ctx, registry, challenge, scope, username, password)
+	if err != nil {
+		return err
+	}
+
+	resp, err = v.get(ctx, endpoint, func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+token) })
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response from %s with a bearer token: %s", endpoint, resp.Status)
+	}
+
+	return nil
+}
+
+// challengeParamPattern matches a parameter of a WWW-Authenticate challenge, e.g. realm="https://example.com/token".
+var challengeParamPattern = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// bearerToken gets a bearer token from the token endpoint in a WWW-Authenticate challenge with the credentials.
+// The credentials are sent only to a trusted token endpoint of the registry, not to whatever the challenge names.
+func (v *registryVerifier) bearerToken(
+	ctx context.Context, registry, challenge, scope, username, password string,
+) (string, error) {
+	params := map[string]string{}
+	for _, m := range challengeParamPattern.FindAllStringSubmatch(challenge, -1) {
+		params[m[1]] = m[2]
+	}
+	if params["realm"] == "" {
+		return "", fmt.Errorf("no realm in the authentication challenge: %s", challenge)
+	}
+
+	realm, err := url.Parse(params["realm"])
+	if err != nil {
+		return "", fmt.Errorf("invalid realm in the authentication challenge: %w", err)
+	}
+	if err := trustedRealm(registry, realm); err != nil {
+		return "", err
+	}
+	query := realm.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	if scope != "" {
+		query.Set("scope", scope)
+	}
+	realm.RawQuery = query.Encode()
+
+	resp, err := v.get(ctx, realm.String(), func(req *http.Request) { req.SetBasicAuth(username, password) })
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected response from the token endpoint %s: %s", realm.Host, resp.Status)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(resp.body, &body); err != nil {
+		return "", fmt.Errorf("failed to parse a response from the token endpoint: %w", err)
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	if body.AccessToken != "" {
+		return body.AccessToken, nil
+	}
+
+	return "", fmt.Errorf("no token in a response from the token endpoint %s", realm.Host)
+}
+
+// trustedRealm returns an error unless the token endpoint of a registry is served over HTTPS by the registry itself or
+// in its domain, e.g. auth.docker.io for registry-1.docker.io, not to hand out credentials to a spoofed challenge.
+func trustedRealm(registry string, realm *url.URL) error {
+	if realm.Scheme != "https" {
+		return fmt.Errorf("realm in the authentication challenge is not HTTPS: %s", realm.Redacted())
+	}
+
+	host, realmHost := strings.ToLower((&url.URL{Host: registry}).Hostname()), strings.ToLower(realm.Hostname())
+	if host == realmHost {
+		return nil
+	}
+	// IP addresses have no domain to share.
+	if net.ParseIP(host) == nil && net.ParseIP(realmHost) == nil {
+		domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+		if err == nil && (realmHost == domain || strings.HasSuffix(realmHost, "."+domain)) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("realm in the authentication challenge is not in the domain of registry %s: %s", registry, realmHost)
+}
+
+// verificationResponse is an HTTP response whose body has been read.
+type verificationResponse struct {
+	*http.Response
+	body []byte
+}
+
+// get sends a GET request to the URL after modifying it with authorize, and reads the response.
+func (v *registryVerifier) get(
+	ctx context.Context, target string, authorize func(*http.Request),
+) (*verificationResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a request: %w", err)
+	}
+	authorize(req)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send a request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Responses for verification are small. Limit the size not to be flooded by a broken registry.
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read a response: %w", err)
+	}
+
+	return &verificationResponse{Response: resp, body: body}, nil
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRegistryVerifier(t *testing.T) {
+	t.Parallel()
+
+	const username, password, token = "user", "password", "bearer-token"
+
+	for _, tt := range []struct {
+		name       string
+		bearer     bool
+		password   string
+		repository string
+		// insecureRealm makes the challenge name a token endpoint served over plain HTTP.
+		insecureRealm bool
+		valid         bool
+	}{
+		{
+			name:     "Basic authentication",
+			password: password,
+			valid:    true,
+		},
+		{
+			name:     "Basic authentication with wrong credentials",
+			password: "wrong",
+		},
+		{
+			name:     "Token authentication",
+			bearer:   true,
+			password: password,
+			valid:    true,
+		},
+		{
+			name:       "Token authentication for a repository",
+			bearer:     true,
+			password:   password,
+			repository: "project/repository",
+			valid:      true,
+		},
+		{
+			name:     "Token authentication with wrong credentials",
+			bearer:   true,
+			password: "wrong",
+		},
+		{
+			name:          "Token authentication with an HTTP realm",
+			bearer:        true,
+			password:      password,
+			insecureRealm: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var realm string
+			handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				user, pass, basic := req.BasicAuth()
+				authorized := basic && user == username && pass == password
+				switch {
+				case req.URL.Path == "/token":
+					if !authorized || req.URL.Query().Get("service") != "registry" {
+						w.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+					if tt.repository != "" && req.URL.Query().Get("scope") != "repository:"+tt.repository+":pull" {
+						w.WriteHeader(http.StatusForbidden)
+						return
+					}
+					_ = json.NewEncoder(w).Encode(map[string]string{"token": token})
+				case tt.bearer:
+					if req.Header.Get("Authorization") != "Bearer "+token {
+						w.Header().Set("WWW-Authenticate", `Bearer realm="`+realm+`/token",service="registry"`)
+						w.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+				case !authorized:
+					w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+					w.WriteHeader(http.StatusUnauthorized)
+				}
+			})
+			srv := httptest.NewTLSServer(handler)
+			defer srv.Close()
+			realm = srv.URL
+			if tt.insecureRealm {
+				// The token endpoint would issue a token, but must not receive the credentials.
+				insecure := httptest.NewServer(handler)
+				defer insecure.Close()
+				realm = insecure.URL
+			}
+
+			v := &registryVerifier{client: srv.Client(), scheme: "https"}
+			registry := strings.TrimPrefix(srv.URL, "https://")
+			err := v.verify(context.Background(), registry, tt.repository, username, tt.password)
+			if tt.valid && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Errorf("Invalid credentials were accepted")
+			}
+		})
+	}
+}
+
+func TestTrustedRealm(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		registry string
+		realm    string
+		trusted  bool
+	}{
+		{
+			name:     "Same host",
+			registry: "asia-northeast1-docker.pkg.dev",
+			realm:    "https://asia-northeast1-docker.pkg.dev/v2/token",
+			trusted:  true,
+		},
+		{
+			name:     "Same host with a port",
+			registry: "registry.example.com:5000",
+			realm:    "https://registry.example.com:5000/token",
+			trusted:  true,
+		},
+		{
+			name:     "Same domain",
+			registry: "registry-1.docker.io",
+			realm:    "https://auth.docker.io/token",
+			trusted:  true,
+		},
+		{
+			name:     "HTTP",
+			registry: "registry.example.com",
+			realm:    "http://registry.example.com/token",
+		},
+		{
+			name:     "Another domain",
+			registry: "registry.example.com",
+			realm:    "https://example.net/token",
+		},
+		{
+			name:     "Another domain under a public suffix",
+			registry: "registry.github.io",
+			realm:    "https://attacker.github.io/token",
+		},
+		{
+			name:     "Another IP address",
+			registry: "10.0.0.1:5000",
+			realm:    "https://10.0.0.2:5000/token",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			realm, err := url.Parse(tt.realm)
+			if err != nil {
+				t.Fatalf("Invalid realm: %v", err)
+			}
+			err = trustedRealm(tt.registry, realm)
+			if tt.trusted && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if !tt.trusted && err == nil {
+				t.Errorf("Untrusted realm was accepted")
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// warmUp enqueues ServiceAccounts whose image pull secrets are missing or already due for refresh, so that they are
+// refreshed immediately after this replica becomes the leader. Otherwise, a leader failover near the expiration of
+// image pull secrets could delay refreshing them. ServiceAccounts handed over by the previous leader come first.
+func (r *serviceAccountReconciler) warmUp(ctx context.Context, events chan<- event.GenericEvent) error {
+	logger := log.FromContext(ctx)
+
+	enqueued := sets.New[types.NamespacedName]()
+	enqueue := func(sa *corev1.ServiceAccount) bool {
+		if enqueued.Has(client.ObjectKeyFromObject(sa)) {
+			return true
+		}
+		select {
+		case events <- event.GenericEvent{Object: sa}:
+			enqueued.Insert(client.ObjectKeyFromObject(sa))
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	handedOver, err := r.takeOver(ctx)
+	if err != nil {
+		// The full scan below still finds the ServiceAccounts, only later.
+		logger.Error(err, "failed to take over ServiceAccounts from the previous leader")
+	}
+	for _, sa := range handedOver {
+		if !enqueue(sa) {
+			return nil
+		}
+	}
+	if len(handedOver) > 0 {
+		logger.Info("Enqueued ServiceAccounts handed over by the previous leader.", "count", len(handedOver))
+	}
+
+	dues, err := r.dueServiceAccounts(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	for _, sa := range dues {
+		if !enqueue(sa) {
+			return nil
+		}
+	}
+	logger.Info("Enqueued ServiceAccounts whose image pull secrets are due for refresh.", "count", len(dues))
+
+	return nil
+}
+
+// dueServiceAccounts returns ServiceAccounts to reconcile by this replica whose image pull secrets are missing or
+// should be refreshed by the given time, in the order of the expiration of their image pull secrets.
+func (r *serviceAccountReconciler) dueServiceAccounts(
+	ctx context.Context, until time.Time,
+) ([]*corev1.ServiceAccount, error) {
+	sas := &corev1.ServiceAccountList{}
+	if err := r.List(ctx, sas); err != nil {
+		return nil, fmt.Errorf("failed to list ServiceAccounts: %w", err)
+	}
+
+	// Refresh image pull secrets closest to expiration first.
+	type dueServiceAccount struct {
+		sa        *corev1.ServiceAccount
+		expiresAt time.Time
+	}
+	var dues []dueServiceAccount
+	for i := range sas.Items {
+		sa := &sas.Items[i]
+		if !r.shard.Contains(sa.GetNamespace()) || !hasConfig(sa) || suspended(sa) ||
+			ignored(sa, r.ignoredServiceAccounts) {
+			continue
+		}
+
+		due, expiresAt, err := r.dueForRefresh(ctx, sa, until)
+		if err != nil {
+			return nil, err
+		}
+		if due {
+			dues = append(dues, dueServiceAccount{sa: sa, expiresAt: expiresAt})
+		}
+	}
+	slices.SortStableFunc(dues, func(a, b dueServiceAccount) int {
+		return a.expiresAt.Compare(b.expiresAt)
+	})
+
+	result := make([]*corev1.ServiceAccount, 0, len(dues))
+	for _, due := range dues {
+		result = append(result, due.sa)
+	}
+
+	return result, nil
+}
+
+// dueForRefresh returns true if the image pull secret of a ServiceAccount is missing or should be refreshed by the
+// given time. It also returns the expiration time of the image pull secret, which is zero if unknown.
+func (r *serviceAccountReconciler) dueForRefresh(
+	ctx context.Context, sa *corev1.ServiceAccount, until time.Time,
+) (due bool, expiresAt time.Time, _ error) {
+	secret, err := findImagePullSecret(ctx, r, sa, r.immutableSecrets)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	if secret == nil {
+		return true, time.Time{}, nil
+	}
+
+	expiresAt, err = secretExpiresAt(secret)
+	if err != nil {
+		return true, time.Time{}, nil
+	}
+	interval, err := refreshInterval(sa)
+	if err != nil {
+		return true, expiresAt, nil
+	}
+
+	refreshAt := r.refreshTime(client.ObjectKeyFromObject(secret), secretIssuedAt(secret), expiresAt, interval)
+	return !until.Before(refreshAt), expiresAt, nil
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package aws generates credentials of Amazon ECR from Kubernetes ServiceAccount tokens by AWS IAM roles for
+// ServiceAccounts, i.e. web identity federation.
+package aws
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// DefaultAudience is the audience of ServiceAccount tokens expected by AWS STS by default.
+const DefaultAudience = "sts.amazonaws.com"
+
+// Client generates ECR authorization tokens. It is safe for concurrent use.
+type Client struct {
+	ecrClient *ecr.Client
+	stsClient *sts.Client
+}
+
+// Option configures a Client.
+type Option func(*options)
+
+type options struct {
+	config      awssdk.Config
+	stsEndpoint *string
+	ecrEndpoint *string
+}
+
+// WithConfig makes the clients of AWS APIs share a configuration, e.g. with an HTTP client through a proxy or a retry
+// mode. Regions and credentials in it are ignored because they are determined for each access token.
+func WithConfig(config awssdk.Config) Option {
+	return func(o *options) {
+		o.config = config
+	}
+}
+
+// WithSTSEndpoint overrides the endpoint of AWS STS, e.g. to use a fake in tests.
+func WithSTSEndpoint(url string) Option {
+	return func(o *options) {
+		o.stsEndpoint = &url
+	}
+}
+
+// WithECREndpoint overrides the endpoint of Amazon ECR, e.g. to use a fake in tests.
+func WithECREndpoint(url string) Option {
+	return func(o *options) {
+		o.ecrEndpoint = &url
+	}
+}
+
+// NewClient creates a new Client.
+func NewClient(opts ...Option) *Client {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &Client{
+		ecrClient: ecr.NewFromConfig(o.config, func(eo *ecr.Options) {
+			eo.BaseEndpoint = o.ecrEndpoint
+		}),
+		stsClient: sts.NewFromConfig(o.config, func(so *sts.Options) {
+			so.BaseEndpoint = o.stsEndpoint
+		}),
+	}
+}
+
+// GenerateAccessToken generates an ECR authorization token from a Kubernetes ServiceAccount token by assuming an AWS
+// IAM role with web identity. Errors of AWS APIs are returned as *smithy.OperationError of the failed operation, i.e.
+// of ECR wrapping one of STS if assuming the role failed.
+func (c *Client) GenerateAccessToken(
+	ctx context.Context,
+	k8sServiceAccountToken string,
+	region string,
+	awsRoleARN string,
+) (username string, password string, expiresAt time.Time, _ error) {
+	// Create an ECR authorization token.
+	resp, err := c.ecrClient.GetAuthorizationToken(
+		ctx, &ecr.GetAuthorizationTokenInput{},
+		func(o *ecr.Options) {
+			o.Region = region
+			o.Credentials = c.Credentials(k8sServiceAccountToken, region, awsRoleARN)
+		},
+	)
+	if err != nil {
+		return "", "", time.Time{}, fmt.Errorf("failed to get an ECR authorization token: %w", err)
+	}
+
+	if auth := resp.AuthorizationData; len(auth) != 1 {
+		return "", "", time.Time{}, fmt.Errorf(
+			"unexpected response from ECR GetAuthorizationToken API: length %d != 1", len(auth),
+		)
+	} else if auth[0].AuthorizationToken == nil {
+		return "", "", time.Time{}, errors.New(
+			"unexpected response from ECR GetAuthorizationToken API: AuthorizationToken is nil",
+		)
+	} else if auth[0].ExpiresAt == nil {
+		return "", "", time.Time{}, errors.New(
+			"unexpected response from ECR GetAuthorizationToken API: ExpiresAt is nil",
+		)
+	}
+
+	username, password, err = ParseAuthorizationToken(*resp.AuthorizationData[0].AuthorizationToken)
+	if err != nil {
+		return "", "", time.Time{}, fmt.Errorf("failed to parse an ECR authorization token: %w", err)
+	}
+
+	return username, password, *resp.AuthorizationData[0].ExpiresAt, nil
+}
+
+// Credentials returns a provider of AWS credentials of an IAM role assumed with web identity from a Kubernetes
+// ServiceAccount token, e.g. to call other AWS APIs on behalf of the ServiceAccount. The role is assumed by AWS STS in
+// the region, lazily on the first retrieval.
+func (c *Client) Credentials(
+	k8sServiceAccountToken string, region string, awsRoleARN string,
+) awssdk.CredentialsProvider {
+	return stscreds.NewWebIdentityRoleProvider(
+		&regionalSTSClient{client: c.stsClient, region: region},
+		awsRoleARN,
+		&staticIDTokenRetriever{token: k8sServiceAccountToken},
+	)
+}
+
+// registryPattern matches ECR registries in <account>.dkr.ecr[-fips].<region>.<DNS suffix> format, where the DNS suffix
+// is one of the partitions known to the SDK, and dual-stack ones in <account>.dkr-ecr[-fips].<region>.on.aws format.
+var registryPattern = regexp.MustCompile(`^[0-9]{12}\.(?:` +
+	`dkr\.ecr(?:-fips)?\.([a-z0-9-]+)\.` +
+	`(?:amazonaws\.com(?:\.cn)?|c2s\.ic\.gov|sc2s\.sgov\.gov|cloud\.adc-e\.uk|csp\.hci\.ic\.gov)|` +
+	`dkr-ecr(?:-fips)?\.([a-z0-9-]+)\.on\.aws` +
+	`)$`)
+
+// ExtractRegion extracts an AWS region from an ECR registry, including FIPS and dual-stack ones.
+func ExtractRegion(registry string) (string, error) {
+	m := registryPattern.FindStringSubmatch(registry)
+	if m == nil {
+		return "", fmt.Errorf("unexpected registry format: %s", registry)
+	}
+	if m[1] != "" {
+		return m[1], nil
+	}
+
+	return m[2], nil
+}
+
+// ParseAuthorizationToken parses an ECR authorization token into a username and a password.
+func ParseAuthorizationToken(token string) (username string, password string, _ error) {
+	// ECR tokens are base64-encoded strings in <username>:<password> format.
+	decoded, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return "", "", err
+	}
+
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return "", "", errors.New("unexpected ECR authorization token format")
+	}
+
+	return parts[0], parts[1], nil
+}
+
+// regionalSTSClient calls AWS STS in a region with a shared client, since stscreds.NewWebIdentityRoleProvider has no
+// way to specify a region for each call.
+type regionalSTSClient struct {
+	client *sts.Client
+	region string
+}
+
+func (c *regionalSTSClient) AssumeRoleWithWebIdentity(
+	ctx context.Context, params *sts.AssumeRoleWithWebIdentityInput, optFns ...func(*sts.Options),
+) (*sts.AssumeRoleWithWebIdentityOutput, error) {
+	return c.client.AssumeRoleWithWebIdentity(ctx, params, append(optFns, func(o *sts.Options) {
+		o.Region = c.region
+	})...)
+}
+
+// staticIDTokenRetriever implements stscreds.IdentityTokenRetriever interface.
+type staticIDTokenRetriever struct {
+	token string
+}
+
+func (r *staticIDTokenRetriever) GetIdentityToken() ([]byte, error) {
+	return []byte(r.token), nil
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aws
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+
+	"github.com/pfnet/image-pull-secrets-provisioner/pkg/credentials/credentialstest"
+)
+
+func TestConformance(t *testing.T) {
+	fake := credentialstest.NewFakeAWS(t)
+	client := NewClient(WithSTSEndpoint(fake.URL()), WithECREndpoint(fake.URL()))
+
+	credentialstest.Run(t, credentialstest.Provider{
+		Fake: fake,
+		GenerateAccessToken: func(
+			ctx context.Context,
+			k8sServiceAccountToken string,
+		) (username string, password string, expiresAt time.Time, _ error) {
+			return client.GenerateAccessToken(
+				ctx, k8sServiceAccountToken, "us-east-1", "arn:aws:iam::000000000000:role/fake",
+			)
+		},
+		FailedStep: func(err error) string {
+			// Failures of STS are wrapped by ECR's as credentials are retrieved on its call.
+			var step string
+			var opErr *smithy.OperationError
+			for errors.As(err, &opErr) {
+				step = opErr.OperationName
+				err = opErr.Err
+			}
+			return step
+		},
+		ExtractRegion: ExtractRegion,
+		Regions: map[string]string{
+			"123456789012.dkr.ecr.us-east-1.amazonaws.com":      "us-east-1",
+			"123456789012.dkr.ecr-fips.us-east-1.amazonaws.com": "us-east-1",
+			"123456789012.dkr-ecr.us-east-1.on.aws":             "us-east-1",
+			"docker.io":                                         "",
+		},
+	})
+}
+
+func TestExtractRegion(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		registry string
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "Valid registry",
+			registry: "123456789012.dkr.ecr.us-east-1.amazonaws.com",
+			expected: "us-east-1",
+			wantErr:  false,
+		},
+		{
+			name:     "China",
+			registry: "123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn",
+			expected: "cn-north-1",
+		},
+		{
+			name:     "FIPS",
+			registry: "123456789012.dkr.ecr-fips.us-gov-west-1.amazonaws.com",
+			expected: "us-gov-west-1",
+		},
+		{
+			name:     "Dual-stack",
+			registry: "123456789012.dkr-ecr.ap-northeast-1.on.aws",
+			expected: "ap-northeast-1",
+		},
+		{
+			name:     "FIPS dual-stack",
+			registry: "123456789012.dkr-ecr-fips.us-east-2.on.aws",
+			expected: "us-east-2",
+		},
+		{
+			name:     "Invalid registry",
+			registry: "docker.io",
+			wantErr:  true,
+		},
+		{
+			name:     "Invalid dual-stack registry",
+			registry: "123456789012.dkr.ecr.us-east-1.on.aws",
+			wantErr:  true,
+		},
+		{
+			name:     "Repository",
+			registry: "123456789012.dkr.ecr.us-east-1.amazonaws.com/repository",
+			wantErr:  true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			region, err := ExtractRegion(tt.registry)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Unexpected error\n\twantErr: %t\n\tactual: %v", tt.wantErr, err)
+			}
+			if region != tt.expected {
+				t.Errorf("Unexpected region\n\texpected: %s\n\tactual: %s", tt.expected, region)
+			}
+		})
+	}
+}
+
+func TestParseAuthorizationToken(t *testing.T) {
+	t.Parallel()
+
+	username, password, err := ParseAuthorizationToken(base64.StdEncoding.EncodeToString([]byte("AWS:pass:word")))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if username != "AWS" || password != "pass:word" {
+		t.Errorf("Unexpected credentials\n\texpected: AWS, pass:word\n\tactual: %s, %s", username, password)
+	}
+
+	if _, _, err := ParseAuthorizationToken(base64.StdEncoding.EncodeToString([]byte("AWS"))); err == nil {
+		t.Errorf("Token without a password was accepted")
+	}
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package credentialstest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Steps of FakeAWS.
+const (
+	StepAssumeRoleWithWebIdentity = "AssumeRoleWithWebIdentity"
+	StepGetAuthorizationToken     = "GetAuthorizationToken"
+)
+
+// Credentials issued by FakeAWS. Passwords are unique for each authorization token.
+const (
+	FakeAWSAccessKeyID = "AKIAFAKE"
+	FakeECRUsername    = "AWS"
+)
+
+// FakeAWS is a fake of AWS STS and Amazon ECR. Both are served at URL.
+type FakeAWS struct {
+	*fake
+}
+
+var _ Fake = &FakeAWS{}
+
+// NewFakeAWS starts a new FakeAWS, which is stopped at the end of the test.
+func NewFakeAWS(t Cleaner) *FakeAWS {
+	f := &FakeAWS{}
+	f.fake = newFake(t, []string{StepAssumeRoleWithWebIdentity, StepGetAuthorizationToken}, f)
+	return f
+}
+
+func (f *FakeAWS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// ECR is a JSON protocol API with operations in X-Amz-Target headers, while STS is a query protocol one.
+	if target := r.Header.Get("X-Amz-Target"); target != "" {
+		if target != "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken" {
+			writeAWSJSONError(w, http.StatusBadRequest, "UnknownOperationException", target)
+			return
+		}
+		f.getAuthorizationToken(w, r)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeAWSQueryError(w, http.StatusBadRequest, "MalformedInput", err.Error())
+		return
+	}
+	if action := r.PostForm.Get("Action"); action != "AssumeRoleWithWebIdentity" {
+		writeAWSQueryError(w, http.StatusBadRequest, "InvalidAction", action)
+		return
+	}
+	f.assumeRoleWithWebIdentity(w, r)
+}
+
+func (f *FakeAWS) assumeRoleWithWebIdentity(w http.ResponseWriter, r *http.Request) {
+	failure := f.begin(StepAssumeRoleWithWebIdentity, r.PostForm.Get("WebIdentityToken"))
+	if failure != 0 {
+		writeAWSQueryError(w, failure, "AccessDenied", "Not authorized to perform sts:AssumeRoleWithWebIdentity")
+		return
+	}
+	if r.PostForm.Get("RoleArn") == "" || r.PostForm.Get("WebIdentityToken") == "" {
+		writeAWSQueryError(w, http.StatusBadRequest, "ValidationError", "RoleArn and WebIdentityToken are required")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/xml")
+	fmt.Fprintf(w, `<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>%s</AccessKeyId>
+      <SecretAccessKey>fake-secret-access-key</SecretAccessKey>
+      <SessionToken>fake-session-token</SessionToken>
+      <Expiration>%s</Expiration>
+    </Credentials>
+    <AssumedRoleUser>
+      <Arn>%s</Arn>
+      <AssumedRoleId>AROAFAKE:fake</AssumedRoleId>
+    </AssumedRoleUser>
+  </AssumeRoleWithWebIdentityResult>
+  <ResponseMetadata>
+    <RequestId>fake</RequestId>
+  </ResponseMetadata>
+</AssumeRoleWithWebIdentityResponse>
+`, FakeAWSAccessKeyID, time.Now().Add(time.Hour).UTC().Format(time.RFC3339), xmlEscape(r.PostForm.Get("RoleArn")))
+}
+
+func (f *FakeAWS) getAuthorizationToken(w http.ResponseWriter, r *http.Request) {
+	failure := f.begin(StepGetAuthorizationToken, "")
+	if failure != 0 {
+		writeAWSJSONError(w, failure, "AccessDeniedException", "Not authorized to perform ecr:GetAuthorizationToken")
+		return
+	}
+	// Requests must be signed with the credentials of the assumed role.
+	if !strings.Contains(r.Header.Get("Authorization"), "Credential="+FakeAWSAccessKeyID+"/") {
+		writeAWSJSONError(w, http.StatusForbidden, "UnrecognizedClientException", "Unexpected credentials")
+		return
+	}
+
+	serial, expiresAt := f.issue()
+	password := fmt.Sprintf("fake-ecr-password-%d", serial)
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"authorizationData": []map[string]any{{
+			"authorizationToken": base64.StdEncoding.EncodeToString([]byte(FakeECRUsername + ":" + password)),
+			// Timestamps are in epoch seconds with fractions.
+			"expiresAt":     float64(expiresAt.UnixMilli()) / 1000,
+			"proxyEndpoint": "https://000000000000.dkr.ecr.us-east-1.amazonaws.com",
+		}},
+	})
+}
+
+func writeAWSQueryError(w http.ResponseWriter, statusCode int, code string, message string) {
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(statusCode)
+	fmt.Fprintf(w, `<ErrorResponse><Error><Type>Sender</Type><Code>%s</Code><Message>%s</Message></Error>`+
+		`<RequestId>fake</RequestId></ErrorResponse>`, code, xmlEscape(message))
+}
+
+func writeAWSJSONError(w http.ResponseWriter, statusCode int, code string, message string) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	w.Header().Set("X-Amzn-ErrorType", code)
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(map[string]string{"__type": code, "message": message})
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,253 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package credentialstest provides a conformance test suite for providers generating registry credentials from
+// Kubernetes ServiceAccount tokens, and fakes of the cloud APIs they call.
+package credentialstest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Fake is a fake of the cloud APIs a provider exchanges ServiceAccount tokens with.
+type Fake interface {
+	// URL returns the base URL of the fake to override endpoints of the provider with.
+	URL() string
+	// Steps returns the names of the API calls of a token exchange in order.
+	Steps() []string
+	// SetExpiresAt sets the expiry of credentials issued by the fake.
+	SetExpiresAt(expiresAt time.Time)
+	// SetValidity makes the fake issue credentials valid for a duration from their issuance.
+	SetValidity(validity time.Duration)
+	// Fail makes the API call of a step fail with an HTTP status code until Reset is called. A status code of 0 makes
+	// it succeed again.
+	Fail(step string, statusCode int)
+	// Reset restores the default behavior of the fake and forgets received ServiceAccount tokens.
+	Reset()
+	// SubjectTokens returns the ServiceAccount tokens the fake has received.
+	SubjectTokens() []string
+}
+
+// Provider describes a provider under test.
+type Provider struct {
+	// Fake serves the cloud APIs the provider calls.
+	Fake Fake
+	// GenerateAccessToken generates registry credentials from a ServiceAccount token with Fake. Providers generating
+	// access tokens without a username return them as passwords.
+	GenerateAccessToken func(
+		ctx context.Context,
+		k8sServiceAccountToken string,
+	) (username string, password string, expiresAt time.Time, _ error)
+	// FailedStep returns the step of Fake whose failure err reports. If nil, errors are not checked for their steps.
+	FailedStep func(err error) string
+	// ExtractRegion extracts a region from a registry. If nil, region extraction is not tested.
+	ExtractRegion func(registry string) (string, error)
+	// Regions maps registries to the regions expected to be extracted from them. Registries mapped to "" are expected
+	// to be rejected.
+	Regions map[string]string
+}
+
+// Cleaner registers a function to be called at the end of a test, e.g. *testing.T or GinkgoT().
+type Cleaner interface {
+	Cleanup(f func())
+}
+
+// Run runs the conformance test suite against a provider. Subtests share Fake, so they do not run in parallel.
+func Run(t *testing.T, p Provider) {
+	t.Helper()
+
+	t.Run("Credentials", func(t *testing.T) {
+		p.Fake.Reset()
+
+		username, password, _, err := p.GenerateAccessToken(context.Background(), "k8s-token")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if username == "" && password == "" {
+			t.Errorf("Empty credentials")
+		}
+		if tokens := p.Fake.SubjectTokens(); !slices.Contains(tokens, "k8s-token") {
+			t.Errorf("ServiceAccount token was not exchanged\n\texpected: %s\n\tactual: %v", "k8s-token", tokens)
+		}
+	})
+
+	t.Run("ExpiryReporting", func(t *testing.T) {
+		// Fractional seconds must be tolerated.
+		expected := time.Now().Add(time.Hour).Truncate(time.Millisecond).Add(123 * time.Millisecond)
+		p.Fake.Reset()
+		p.Fake.SetExpiresAt(expected)
+
+		_, _, actual, err := p.GenerateAccessToken(context.Background(), "k8s-token")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if d := actual.Sub(expected); d < -time.Millisecond || d > time.Millisecond {
+			t.Errorf("Unexpected expiry\n\texpected: %s\n\tactual: %s", expected, actual)
+		}
+	})
+
+	t.Run("ErrorWrapping", func(t *testing.T) {
+		for _, step := range p.Fake.Steps() {
+			t.Run(step, func(t *testing.T) {
+				p.Fake.Reset()
+				p.Fake.Fail(step, http.StatusForbidden)
+
+				_, _, _, err := p.GenerateAccessToken(context.Background(), "k8s-token")
+				if err == nil {
+					t.Fatalf("Failure of %s was not reported", step)
+				}
+				if p.FailedStep != nil {
+					if actual := p.FailedStep(err); actual != step {
+						t.Errorf("Unexpected failed step of %q\n\texpected: %s\n\tactual: %s", err, step, actual)
+					}
+				}
+			})
+		}
+
+		t.Run("Canceled", func(t *testing.T) {
+			p.Fake.Reset()
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			_, _, _, err := p.GenerateAccessToken(ctx, "k8s-token")
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("Unexpected error\n\texpected: %v\n\tactual: %v", context.Canceled, err)
+			}
+		})
+	})
+
+	if p.ExtractRegion == nil {
+		return
+	}
+	t.Run("RegionExtraction", func(t *testing.T) {
+		for registry, expected := range p.Regions {
+			t.Run(registry, func(t *testing.T) {
+				actual, err := p.ExtractRegion(registry)
+				if expected == "" {
+					if err == nil {
+						t.Errorf("Unexpected region of an invalid registry: %s", actual)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if actual != expected {
+					t.Errorf("Unexpected region\n\texpected: %s\n\tactual: %s", expected, actual)
+				}
+			})
+		}
+	})
+}
+
+// fake implements the common behaviors of fakes.
+type fake struct {
+	server *httptest.Server
+	steps  []string
+
+	mu            sync.Mutex
+	expiresAt     time.Time
+	validity      time.Duration
+	failures      map[string]int
+	subjectTokens []string
+	// Number of issued credentials to make them unique.
+	issued int
+}
+
+func newFake(t Cleaner, steps []string, handler http.Handler) *fake {
+	f := &fake{
+		server: httptest.NewServer(handler),
+		steps:  steps,
+	}
+	f.Reset()
+	t.Cleanup(f.server.Close)
+
+	return f
+}
+
+func (f *fake) URL() string {
+	return f.server.URL
+}
+
+func (f *fake) Steps() []string {
+	return slices.Clone(f.steps)
+}
+
+func (f *fake) SetExpiresAt(expiresAt time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.expiresAt = expiresAt
+	f.validity = 0
+}
+
+func (f *fake) SetValidity(validity time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.validity = validity
+}
+
+func (f *fake) Fail(step string, statusCode int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if statusCode == 0 {
+		delete(f.failures, step)
+		return
+	}
+	f.failures[step] = statusCode
+}
+
+func (f *fake) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.expiresAt = time.Time{}
+	f.validity = 12 * time.Hour
+	f.failures = map[string]int{}
+	f.subjectTokens = nil
+}
+
+func (f *fake) SubjectTokens() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.subjectTokens)
+}
+
+// begin records a call of a step and returns the HTTP status code it should fail with, or 0 if it should succeed.
+func (f *fake) begin(step string, subjectToken string) (failure int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if subjectToken != "" {
+		f.subjectTokens = append(f.subjectTokens, subjectToken)
+	}
+	return f.failures[step]
+}
+
+// issue returns a serial number and the expiry of credentials to issue.
+func (f *fake) issue() (serial int, expiresAt time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.issued++
+	if f.validity > 0 {
+		return f.issued, time.Now().Add(f.validity)
+	}
+	return f.issued, f.expiresAt
+}
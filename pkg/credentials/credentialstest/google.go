@@ -0,0 +1,117 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package credentialstest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Steps of FakeGoogle.
+const (
+	StepExchangeToken       = "ExchangeToken"
+	StepGenerateAccessToken = "GenerateAccessToken"
+)
+
+// Federated token issued by FakeGoogle. Access tokens of Google service accounts are unique for each request.
+const FakeGoogleFederatedToken = "fake-federated-token"
+
+// FakeGoogle is a fake of Google STS and IAM Credentials API. Both are served at URL.
+type FakeGoogle struct {
+	*fake
+}
+
+var _ Fake = &FakeGoogle{}
+
+// NewFakeGoogle starts a new FakeGoogle, which is stopped at the end of the test.
+func NewFakeGoogle(t Cleaner) *FakeGoogle {
+	f := &FakeGoogle{}
+	f.fake = newFake(t, []string{StepExchangeToken, StepGenerateAccessToken}, f)
+	return f
+}
+
+func (f *FakeGoogle) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/token":
+		f.exchangeToken(w, r)
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/v1/projects/-/serviceAccounts/") &&
+		strings.HasSuffix(r.URL.Path, ":generateAccessToken"):
+		f.generateAccessToken(w, r)
+	default:
+		writeGoogleError(w, http.StatusNotFound, "NOT_FOUND", r.Method+" "+r.URL.Path)
+	}
+}
+
+func (f *FakeGoogle) exchangeToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Audience     string `json:"audience"`
+		SubjectToken string `json:"subjectToken"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeGoogleError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+		return
+	}
+
+	failure := f.begin(StepExchangeToken, req.SubjectToken)
+	if failure != 0 {
+		writeGoogleError(w, failure, "PERMISSION_DENIED", "The given credential is rejected by the attribute condition")
+		return
+	}
+	if !strings.HasPrefix(req.Audience, "//iam.googleapis.com/") || req.SubjectToken == "" {
+		writeGoogleError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "Invalid audience or subject token")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"access_token":      FakeGoogleFederatedToken,
+		"issued_token_type": "urn:ietf:params:oauth:token-type:access_token",
+		"token_type":        "Bearer",
+		"expires_in":        3600,
+	})
+}
+
+func (f *FakeGoogle) generateAccessToken(w http.ResponseWriter, r *http.Request) {
+	failure := f.begin(StepGenerateAccessToken, "")
+	if failure != 0 {
+		writeGoogleError(w, failure, "PERMISSION_DENIED", "Permission 'iam.serviceAccounts.getAccessToken' denied")
+		return
+	}
+	// Requests must be authorized by the federated token.
+	if r.Header.Get("Authorization") != "Bearer "+FakeGoogleFederatedToken {
+		writeGoogleError(w, http.StatusUnauthorized, "UNAUTHENTICATED", "Unexpected credentials")
+		return
+	}
+
+	serial, expiresAt := f.issue()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"accessToken": fmt.Sprintf("fake-access-token-%d", serial),
+		"expireTime":  expiresAt.UTC().Format(time.RFC3339Nano),
+	})
+}
+
+func writeGoogleError(w http.ResponseWriter, statusCode int, status string, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{"code": statusCode, "message": message, "status": status},
+	})
+}
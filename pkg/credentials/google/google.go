@@ -0,0 +1,191 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package google generates access tokens of Google service accounts from Kubernetes ServiceAccount tokens by workload
+// identity federation, e.g. for Artifact Registry.
+package google
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/iamcredentials/v1"
+	"google.golang.org/api/option"
+	"google.golang.org/api/sts/v1"
+)
+
+// Username is the username to authenticate to Google container registries with an access token.
+const Username = "oauth2accesstoken"
+
+// Audience returns the audience of ServiceAccount tokens expected by a Google workload identity provider by default.
+func Audience(workloadIdentityProvider string) string {
+	return "//iam.googleapis.com/" + workloadIdentityProvider
+}
+
+// FederationError is returned when exchanging a ServiceAccount token with Google STS fails, e.g. because the workload
+// identity provider does not trust the issuer.
+type FederationError struct {
+	Err error
+}
+
+func (e *FederationError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FederationError) Unwrap() error {
+	return e.Err
+}
+
+// ImpersonationError is returned when impersonating a Google service account fails, e.g. because of a missing IAM
+// binding.
+type ImpersonationError struct {
+	Err error
+}
+
+func (e *ImpersonationError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ImpersonationError) Unwrap() error {
+	return e.Err
+}
+
+// Client generates access tokens of Google service accounts. It is safe for concurrent use.
+type Client struct {
+	stsClient *sts.Service
+	// Options for IAM Credentials clients created for each access token.
+	iamCredentialsOpts []option.ClientOption
+	transport          http.RoundTripper
+}
+
+// Option configures a Client.
+type Option func(*options)
+
+type options struct {
+	stsOpts            []option.ClientOption
+	iamCredentialsOpts []option.ClientOption
+	transport          http.RoundTripper
+}
+
+// WithTransport makes the clients of Google APIs send requests by an HTTP transport, e.g. through a proxy or trusting
+// a custom CA.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *options) {
+		o.transport = transport
+	}
+}
+
+// WithSTSEndpoint overrides the endpoint of Google STS, e.g. to use a fake in tests.
+func WithSTSEndpoint(url string) Option {
+	return func(o *options) {
+		o.stsOpts = append(o.stsOpts, option.WithEndpoint(url))
+	}
+}
+
+// WithIAMCredentialsEndpoint overrides the endpoint of Google IAM Credentials API, e.g. to use a fake in tests.
+func WithIAMCredentialsEndpoint(url string) Option {
+	return func(o *options) {
+		o.iamCredentialsOpts = append(o.iamCredentialsOpts, option.WithEndpoint(url))
+	}
+}
+
+// NewClient creates a new Client.
+func NewClient(ctx context.Context, opts ...Option) (*Client, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	stsOpts := []option.ClientOption{option.WithoutAuthentication()}
+	if o.transport != nil {
+		stsOpts = []option.ClientOption{option.WithHTTPClient(&http.Client{Transport: o.transport})}
+	}
+	stsClient, err := sts.NewService(ctx, append(stsOpts, o.stsOpts...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a Google STS client: %w", err)
+	}
+
+	return &Client{
+		stsClient:          stsClient,
+		iamCredentialsOpts: o.iamCredentialsOpts,
+		transport:          o.transport,
+	}, nil
+}
+
+// GenerateAccessToken generates a Google service account's short-lived access token from a Kubernetes ServiceAccount
+// token. Failures of the token exchange and the impersonation are returned as *FederationError and
+// *ImpersonationError respectively.
+func (c *Client) GenerateAccessToken(
+	ctx context.Context,
+	k8sServiceAccountToken string,
+	workloadIdentityProvider string,
+	googleServiceAccountEmail string,
+) (token string, expiresAt time.Time, _ error) {
+	// Exchange the ServiceAccount token for a Google OAuth 2.0 access token.
+	stsResp, err := c.stsClient.V1.Token(&sts.GoogleIdentityStsV1ExchangeTokenRequest{
+		Audience:           Audience(workloadIdentityProvider),
+		GrantType:          "urn:ietf:params:oauth:grant-type:token-exchange",
+		RequestedTokenType: "urn:ietf:params:oauth:token-type:access_token",
+		Scope:              "https://www.googleapis.com/auth/iam",
+		SubjectToken:       k8sServiceAccountToken,
+		SubjectTokenType:   "urn:ietf:params:oauth:token-type:jwt",
+	}).Context(ctx).Do()
+	if err != nil {
+		return "", time.Time{}, &FederationError{
+			Err: fmt.Errorf("failed to exchange a ServiceAccount token for a Google OAuth 2.0 access token: %w", err),
+		}
+	}
+
+	// Impersonate to a Google service account and generate an access token.
+	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{
+		AccessToken: stsResp.AccessToken,
+		Expiry:      time.Now().Add(time.Duration(stsResp.ExpiresIn) * time.Second),
+	})
+	opt := option.WithTokenSource(tokenSource)
+	if c.transport != nil {
+		// A custom HTTP client takes precedence over the token source, so it has to authorize requests by itself.
+		opt = option.WithHTTPClient(&http.Client{
+			Transport: &oauth2.Transport{Source: tokenSource, Base: c.transport},
+		})
+	}
+	iamCredClient, err := iamcredentials.NewService(ctx, append([]option.ClientOption{opt}, c.iamCredentialsOpts...)...)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to create a Google IAM Credentials client: %w", err)
+	}
+
+	tokenResp, err := iamCredClient.Projects.ServiceAccounts.GenerateAccessToken(
+		"projects/-/serviceAccounts/"+googleServiceAccountEmail,
+		&iamcredentials.GenerateAccessTokenRequest{
+			Scope: []string{"https://www.googleapis.com/auth/cloud-platform.read-only"},
+		},
+	).Context(ctx).Do()
+	if err != nil {
+		return "", time.Time{}, &ImpersonationError{
+			Err: fmt.Errorf("failed to generate a Google service account's access token: %w", err),
+		}
+	}
+
+	// Tolerate fractional seconds.
+	expiresAt, err = time.Parse(time.RFC3339Nano, tokenResp.ExpireTime)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to parse a timestamp: %w", err)
+	}
+
+	return tokenResp.AccessToken, expiresAt, nil
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package google
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pfnet/image-pull-secrets-provisioner/pkg/credentials/credentialstest"
+)
+
+func TestConformance(t *testing.T) {
+	fake := credentialstest.NewFakeGoogle(t)
+	client, err := NewClient(context.Background(), WithSTSEndpoint(fake.URL()), WithIAMCredentialsEndpoint(fake.URL()))
+	if err != nil {
+		t.Fatalf("Failed to create a client: %v", err)
+	}
+
+	credentialstest.Run(t, credentialstest.Provider{
+		Fake: fake,
+		GenerateAccessToken: func(
+			ctx context.Context,
+			k8sServiceAccountToken string,
+		) (username string, password string, expiresAt time.Time, _ error) {
+			token, expiresAt, err := client.GenerateAccessToken(
+				ctx,
+				k8sServiceAccountToken,
+				"projects/0/locations/global/workloadIdentityPools/fake/providers/fake",
+				"fake@fake.iam.gserviceaccount.com",
+			)
+			return Username, token, expiresAt, err
+		},
+		FailedStep: func(err error) string {
+			var federationErr *FederationError
+			var impersonationErr *ImpersonationError
+			switch {
+			case errors.As(err, &federationErr):
+				return credentialstest.StepExchangeToken
+			case errors.As(err, &impersonationErr):
+				return credentialstest.StepGenerateAccessToken
+			default:
+				return ""
+			}
+		},
+	})
+}
+
+// countingTransport counts requests sent through it.
+type countingTransport struct {
+	count atomic.Int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.count.Add(1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestWithTransport(t *testing.T) {
+	t.Parallel()
+
+	fake := credentialstest.NewFakeGoogle(t)
+	transport := &countingTransport{}
+	client, err := NewClient(
+		context.Background(),
+		WithSTSEndpoint(fake.URL()),
+		WithIAMCredentialsEndpoint(fake.URL()),
+		WithTransport(transport),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create a client: %v", err)
+	}
+
+	// The fake rejects impersonation unless the request is authorized by the federated token.
+	if _, _, err := client.GenerateAccessToken(
+		context.Background(),
+		"k8s-token",
+		"projects/0/locations/global/workloadIdentityPools/fake/providers/fake",
+		"fake@fake.iam.gserviceaccount.com",
+	); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if actual := transport.count.Load(); actual != 2 {
+		t.Errorf("Unexpected number of requests through the transport\n\texpected: %d\n\tactual: %d", 2, actual)
+	}
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package imagepullsecret builds the content of image pull secrets and names them as image-pull-secrets-provisioner
+// does, for other controllers to mint registry credentials compatible with it.
+package imagepullsecret
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// nameHashLength is the length of the hash suffixed to names of image pull secrets in shared namespaces.
+const nameHashLength = 16
+
+// DockerConfigJSON returns a Docker config JSON, i.e. the content of an image pull secret of type
+// kubernetes.io/dockerconfigjson, to authenticate to a registry with a username and a password.
+// mergedAuths are auth entries of another Docker config JSON to be included as is. The entry for the given registry
+// always takes precedence over them. aliases are alternate keys of the registry, e.g. with a port or a scheme, for
+// container runtimes matching keys literally, and have the same credentials.
+func DockerConfigJSON(
+	registry string, username string, password string, mergedAuths map[string]json.RawMessage, aliases ...string,
+) ([]byte, error) {
+	type dockerConfigEntry struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+
+	type dockerConfigJSON struct {
+		Auths map[string]any `json:"auths"`
+	}
+
+	dockerCfg := &dockerConfigJSON{
+		Auths: map[string]any{},
+	}
+	for key, entry := range mergedAuths {
+		dockerCfg.Auths[key] = entry
+	}
+	for _, key := range append([]string{registry}, aliases...) {
+		dockerCfg.Auths[key] = dockerConfigEntry{
+			Username: username,
+			Password: password,
+		}
+	}
+
+	data, err := json.Marshal(dockerCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal a Docker config JSON: %w", err)
+	}
+
+	return data, nil
+}
+
+// Name returns the default name of the image pull secret of a ServiceAccount provisioned in secretNamespace.
+// Image pull secrets of ServiceAccounts in other namespaces are prefixed with the namespace of the ServiceAccount and
+// suffixed with a hash of its namespaced name not to collide in the shared namespace, even if the namespace or the name
+// contains hyphens or the name is truncated. The name is truncated to the maximum length of Secret names.
+func Name(serviceAccountNamespace string, serviceAccountName string, secretNamespace string) string {
+	if secretNamespace == serviceAccountNamespace {
+		name := "imagepullsecret-" + serviceAccountName
+		if len(name) > validation.DNS1123SubdomainMaxLength {
+			name = name[:validation.DNS1123SubdomainMaxLength]
+		}
+		return name
+	}
+
+	sum := sha256.Sum256([]byte(serviceAccountNamespace + "/" + serviceAccountName))
+	hash := hex.EncodeToString(sum[:])[:nameHashLength]
+	name := "imagepullsecret-" + serviceAccountNamespace + "-" + serviceAccountName
+	if len(name)+1+nameHashLength > validation.DNS1123SubdomainMaxLength {
+		name = name[:validation.DNS1123SubdomainMaxLength-1-nameHashLength]
+		// A label of a DNS subdomain cannot end with a dot or a hyphen followed by the separator.
+		name = strings.TrimRight(name, ".-")
+	}
+
+	return name + "-" + hash
+}
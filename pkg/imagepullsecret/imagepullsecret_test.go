@@ -0,0 +1,126 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagepullsecret
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func TestName(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		name            string
+		secretNamespace string
+		serviceAccount  string
+		expected        string
+	}{
+		{
+			name:            "Namespace of the ServiceAccount",
+			secretNamespace: "namespace-0",
+			serviceAccount:  "serviceaccount-0",
+			expected:        "imagepullsecret-serviceaccount-0",
+		},
+		{
+			name:            "Shared namespace",
+			secretNamespace: "shared",
+			serviceAccount:  "serviceaccount-0",
+			expected:        "imagepullsecret-namespace-0-serviceaccount-0-" + hash("namespace-0/serviceaccount-0"),
+		},
+		{
+			name:            "Long name in a shared namespace",
+			secretNamespace: "shared",
+			serviceAccount:  strings.Repeat("a", 253),
+			expected: "imagepullsecret-namespace-0-" + strings.Repeat("a", 253-len("imagepullsecret-namespace-0-")-17) +
+				"-" + hash("namespace-0/"+strings.Repeat("a", 253)),
+		},
+		{
+			name:            "Long name",
+			secretNamespace: "namespace-0",
+			serviceAccount:  strings.Repeat("a", 253),
+			expected:        "imagepullsecret-" + strings.Repeat("a", 253-len("imagepullsecret-")),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if actual := Name("namespace-0", tt.serviceAccount, tt.secretNamespace); actual != tt.expected {
+				t.Errorf("Unexpected name\n\texpected: %s\n\tactual: %s", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestNameInSharedNamespaceIsUnique(t *testing.T) {
+	t.Parallel()
+
+	// Joining the namespace and the name by a hyphen alone is ambiguous.
+	if Name("team-a", "x", "shared") == Name("team", "a-x", "shared") {
+		t.Errorf("Names of different ServiceAccounts collide: %s", Name("team-a", "x", "shared"))
+	}
+	// So is truncating long names.
+	long := strings.Repeat("a", 253)
+	if Name("namespace-0", long+"-0", "shared") == Name("namespace-0", long+"-1", "shared") {
+		t.Errorf("Names of different ServiceAccounts collide: %s", Name("namespace-0", long+"-0", "shared"))
+	}
+	if errs := validation.IsDNS1123Subdomain(Name("namespace-0", long, "shared")); len(errs) > 0 {
+		t.Errorf("Invalid name: %v", errs)
+	}
+}
+
+func hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+func TestDockerConfigJSON(t *testing.T) {
+	t.Parallel()
+
+	actual, err := DockerConfigJSON("registry", "user", "password", map[string]json.RawMessage{
+		"registry": json.RawMessage(`{"username":"merged","password":"merged"}`),
+		"other":    json.RawMessage(`{"auth":"b3RoZXI6b3RoZXI="}`),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `{"auths":{"other":{"auth":"b3RoZXI6b3RoZXI="},"registry":{"username":"user","password":"password"}}}`
+	if string(actual) != expected {
+		t.Errorf("Unexpected Docker config JSON\n\texpected: %s\n\tactual: %s", expected, actual)
+	}
+}
+
+func TestDockerConfigJSONAliases(t *testing.T) {
+	t.Parallel()
+
+	actual, err := DockerConfigJSON("registry", "user", "password", map[string]json.RawMessage{
+		"https://registry": json.RawMessage(`{"username":"merged","password":"merged"}`),
+	}, "registry:443", "https://registry")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `{"auths":{"https://registry":{"username":"user","password":"password"},` +
+		`"registry":{"username":"user","password":"password"},"registry:443":{"username":"user","password":"password"}}}`
+	if string(actual) != expected {
+		t.Errorf("Unexpected Docker config JSON\n\texpected: %s\n\tactual: %s", expected, actual)
+	}
+}